@@ -1022,3 +1022,36 @@ func (f *fieldVal) Inverse() *fieldVal {
 	f.Square().Square().Square().Square().Square() // f = a^(2^256 - 4294968320)
 	return f.Mul(&a45)                             // f = a^(2^256 - 4294968275) = a^(p-2)
 }
+
+// SqrtVal 计算val的模平方根(mod p)并存入该字段值，val是二次剩余时返回true。
+// 由于secp256k1的素数满足p ≡ 3 (mod 4)，平方根即为val^((p+1)/4)。
+//
+// (p+1)/4的二进制表示由长度为223、22和2的三段连续的1组成，
+// 这里先以加法链求出a^(2^k - 1)的中间结果，再依次拼接。
+//
+// 这需要253个场的平方和13个场的乘法。
+func (f *fieldVal) SqrtVal(val *fieldVal) bool {
+	var a, x2, x3, x6, x9, x11, x22, x44, x88, x176, x220, x223 fieldVal
+	square := func(v *fieldVal, n int) *fieldVal {
+		for i := 0; i < n; i++ {
+			v.Square()
+		}
+		return v
+	}
+	a.Set(val).Normalize()
+	x2.SquareVal(&a).Mul(&a)              // x2 = a^(2^2 - 1)
+	x3.SquareVal(&x2).Mul(&a)             // x3 = a^(2^3 - 1)
+	square(x6.Set(&x3), 3).Mul(&x3)       // x6 = a^(2^6 - 1)
+	square(x9.Set(&x6), 3).Mul(&x3)       // x9 = a^(2^9 - 1)
+	square(x11.Set(&x9), 2).Mul(&x2)      // x11 = a^(2^11 - 1)
+	square(x22.Set(&x11), 11).Mul(&x11)   // x22 = a^(2^22 - 1)
+	square(x44.Set(&x22), 22).Mul(&x22)   // x44 = a^(2^44 - 1)
+	square(x88.Set(&x44), 44).Mul(&x44)   // x88 = a^(2^88 - 1)
+	square(x176.Set(&x88), 88).Mul(&x88)  // x176 = a^(2^176 - 1)
+	square(x220.Set(&x176), 44).Mul(&x44) // x220 = a^(2^220 - 1)
+	square(x223.Set(&x220), 3).Mul(&x3)   // x223 = a^(2^223 - 1)
+	square(f.Set(&x223), 23).Mul(&x22)    // f = a^((2^223 - 1)*2^23 + 2^22 - 1)
+	square(f, 6).Mul(&x2)                 // f = a^(... * 2^6 + 2^2 - 1)
+	square(f, 2).Normalize()              // f = a^((p+1)/4)
+	return new(fieldVal).SquareVal(f).Normalize().Equals(&a)
+}
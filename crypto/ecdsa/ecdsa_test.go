@@ -111,3 +111,155 @@ func TestSignature_IsEqual(t *testing.T) {
 	fmt.Println("pubkey: ", pubs)
 
 }
+
+var (
+	testAddrHex = "970e8128ab834e8eac17ab8e3812f010678cf791"
+	testPrivHex = "289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032"
+)
+
+func TestSign(t *testing.T) {
+	key, _ := HexToPrvKey(testPrivHex)
+	addr := HexToAddress(testAddrHex)
+
+	msg := Keccak256Hash([]byte("foo")).Bytes()
+	sig, err := Sign(msg, key)
+	if err != nil {
+		t.Fatalf("Sign error: %s", err)
+	}
+	if len(sig) != SignatureLength || sig[RecoveryIDOffset] > 1 {
+		t.Fatalf("签名格式错误: %x", sig)
+	}
+	if s := new(big.Int).SetBytes(sig[32:64]); s.Cmp(halforder) > 0 {
+		t.Errorf("S大于N/2: %x", s)
+	}
+	recoveredPub, err := Ecrecover(msg, sig)
+	if err != nil {
+		t.Fatalf("ECRecover error: %s", err)
+	}
+	pubKey, _ := UnmarshalPubkey(recoveredPub)
+	if recoveredAddr := pubKey.ToAddress(); addr != recoveredAddr {
+		t.Errorf("Address mismatch: want: %x have: %x", addr, recoveredAddr)
+	}
+	recoveredAddr, err := RecoverAddress(msg, sig)
+	if err != nil || addr != recoveredAddr {
+		t.Errorf("Address mismatch: want: %x have: %x, %v", addr, recoveredAddr, err)
+	}
+	if !VerifySignature(recoveredPub, msg, sig[:64]) {
+		t.Error("签名验证失败")
+	}
+	if _, err = Sign(msg[1:], key); err == nil {
+		t.Error("31字节的哈希签名成功")
+	}
+}
+
+func Test_SigToPub(t *testing.T) {
+	key, _ := HexToPrvKey(testPrivHex)
+	msg := Keccak256Hash([]byte("foo")).Bytes()
+	sig, err := Sign(msg, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := SigToPub(msg, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.IsEqual(key.ToPubKey()) {
+		t.Errorf("公钥不一致: %s", pub.ToHex())
+	}
+
+	// 修改恢复ID后得到其他公钥
+	sig[RecoveryIDOffset] ^= 1
+	if pub, err = SigToPub(msg, sig); err == nil && pub.IsEqual(key.ToPubKey()) {
+		t.Error("修改恢复ID后恢复出相同的公钥")
+	}
+	sig[RecoveryIDOffset] = 27
+	if _, err = SigToPub(msg, sig); err == nil {
+		t.Error("恢复ID为27时没有报错")
+	}
+	if _, err = SigToPub(msg, sig[:64]); err == nil {
+		t.Error("64字节签名没有报错")
+	}
+}
+
+func TestEcrecover(t *testing.T) {
+	msg, _ := hex.DecodeString("ce0677bb30baa8cf067c88db9811f4333d131bf8bcf12fe7065d211dce971008")
+	sig, _ := hex.DecodeString("90f27b8b488db00b00606796d2987f6a5f59ae62ea05effe84fef5b8b0e549984a691139ad57a3f0b906637673aa2f63d1f55cb1a69199d4009eea23ceaddc9301")
+	pubkey1, _ := hex.DecodeString("04e32df42865e97135acfb65f3bae71bdc86f4d49150ad6a440b6f15878109880a0a2b2667f7e725ceea70c673093bf67663e0312623c8e091b13cf2c0f11ef652")
+	pubkey2, err := Ecrecover(msg, sig)
+	if err != nil {
+		t.Fatalf("recover error: %s", err)
+	}
+	if !bytes.Equal(pubkey1, pubkey2) {
+		t.Errorf("pubkey mismatch: want: %x have: %x", pubkey1, pubkey2)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	key, _ := HexToPrvKey(testPrivHex)
+	pub := key.ToPubKey().SerializeUncompressed()
+	msg := Keccak256Hash([]byte("foo")).Bytes()
+	sig, err := Sign(msg, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig = sig[:64]
+	if !VerifySignature(pub, msg, sig) {
+		t.Error("签名验证失败")
+	}
+	if VerifySignature(pub, msg, sig[:63]) {
+		t.Error("63字节的签名验证通过")
+	}
+	if VerifySignature(pub, Keccak256Hash([]byte("bar")).Bytes(), sig) {
+		t.Error("其他消息的签名验证通过")
+	}
+
+	// 高位S的签名同样满足ECDSA等式，但被拒绝
+	highS := new(big.Int).Sub(order, new(big.Int).SetBytes(sig[32:]))
+	malleable := append(append([]byte(nil), sig[:32]...), paddedAppend(32, nil, highS.Bytes())...)
+	if !(&Signature{R: new(big.Int).SetBytes(sig[:32]), S: highS}).Verify(msg, key.ToPubKey()) {
+		t.Fatal("高位S的签名不满足ECDSA等式")
+	}
+	if VerifySignature(pub, msg, malleable) {
+		t.Error("高位S的签名验证通过")
+	}
+}
+
+func TestValidateSignatureValues(t *testing.T) {
+	check := func(expected bool, v byte, r, s *big.Int) {
+		if ValidateSignatureValues(v, r, s, false) != expected {
+			t.Errorf("mismatch for v: %d r: %d s: %d want: %v", v, r, s, expected)
+		}
+	}
+	minusOne := big.NewInt(-1)
+	zero := big.NewInt(0)
+	secp256k1nMinus1 := new(big.Int).Sub(secp256k1N, one)
+
+	// 正确的v, r, s
+	check(true, 0, one, one)
+	check(true, 1, one, one)
+	// 错误的v
+	check(false, 2, one, one)
+	check(false, 3, one, one)
+	// r、s为0
+	check(false, 0, zero, one)
+	check(false, 0, one, zero)
+	// r、s为负数
+	check(false, 0, minusOne, one)
+	check(false, 0, one, minusOne)
+	// r、s不小于N
+	check(true, 0, secp256k1nMinus1, secp256k1nMinus1)
+	check(false, 0, secp256k1N, secp256k1nMinus1)
+	check(false, 0, secp256k1nMinus1, secp256k1N)
+
+	// homestead要求S不大于N/2
+	halfPlusOne := new(big.Int).Add(halforder, one)
+	if !ValidateSignatureValues(0, one, halforder, true) {
+		t.Error("S = N/2 应有效")
+	}
+	if ValidateSignatureValues(0, one, halfPlusOne, true) {
+		t.Error("homestead下S = N/2+1 应无效")
+	}
+	if !ValidateSignatureValues(0, one, halfPlusOne, false) {
+		t.Error("homestead前S = N/2+1 应有效")
+	}
+}
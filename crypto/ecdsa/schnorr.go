@@ -0,0 +1,281 @@
+package ecdsa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+const (
+	// SchnorrPubKeyLen BIP-340仅含x坐标的公钥长度
+	SchnorrPubKeyLen = 32
+
+	// SchnorrSignatureLen BIP-340签名长度，R的x坐标 || s
+	SchnorrSignatureLen = 64
+)
+
+// BIP-340使用的标签
+const (
+	tagBIP340Aux       = "BIP0340/aux"
+	tagBIP340Nonce     = "BIP0340/nonce"
+	tagBIP340Challenge = "BIP0340/challenge"
+)
+
+var (
+	// ErrSchnorrPubKey 公钥不是曲线上某点的x坐标
+	ErrSchnorrPubKey = errors.New("invalid schnorr public key")
+
+	// ErrSchnorrSignature 签名长度错误，或r、s超出取值范围
+	ErrSchnorrSignature = errors.New("invalid schnorr signature")
+
+	// ErrSchnorrPrivKey 私钥为0或不小于曲线的阶
+	ErrSchnorrPrivKey = errors.New("invalid schnorr private key")
+
+	// ErrSchnorrBatchLength 批量验证时消息、签名和公钥的数量不一致
+	ErrSchnorrBatchLength = errors.New("schnorr batch: mismatched lengths")
+)
+
+// TaggedHash 返回BIP-340定义的带标签哈希 SHA256(SHA256(tag) || SHA256(tag) || msgs...)。
+// 不同用途的哈希使用不同的标签，避免一处的哈希值被挪用到另一处。
+func TaggedHash(tag string, msgs ...[]byte) (h Hash) {
+	tagHash := sha256.Sum256([]byte(tag))
+	d := sha256.New()
+	d.Write(tagHash[:])
+	d.Write(tagHash[:])
+	for _, b := range msgs {
+		d.Write(b)
+	}
+	d.Sum(h[:0])
+	return h
+}
+
+// SerializeXOnly 返回BIP-340格式的公钥，即32字节的x坐标，y坐标隐含为偶数。
+func (p *PublicKey) SerializeXOnly() []byte {
+	return paddedAppend(SchnorrPubKeyLen, nil, p.X.Bytes())
+}
+
+// ParseXOnlyPubKey 解析32字节仅含x坐标的公钥，取y坐标为偶数的曲线点(BIP-340中的lift_x)。
+func ParseXOnlyPubKey(b []byte) (*PublicKey, error) {
+	if len(b) != SchnorrPubKeyLen {
+		return nil, ErrSchnorrPubKey
+	}
+	x, y, ok := liftX(b)
+	if !ok {
+		return nil, ErrSchnorrPubKey
+	}
+	return &PublicKey{Curve: S256(), X: x, Y: y}, nil
+}
+
+// liftX 返回x坐标为b且y坐标为偶数的曲线点，b不小于p或不是曲线上点的x坐标时ok为false。
+func liftX(b []byte) (x, y *big.Int, ok bool) {
+	x = new(big.Int).SetBytes(b)
+	if x.Cmp(S256().P) >= 0 {
+		return nil, nil, false
+	}
+	fx := new(fieldVal).SetByteSlice(b)
+	c := new(fieldVal).SquareVal(fx).Mul(fx).AddInt(7) // c = x^3 + 7
+	fy := new(fieldVal)
+	if !fy.SqrtVal(c) {
+		return nil, nil, false
+	}
+	if fy.IsOdd() {
+		fy.Negate(1).Normalize()
+	}
+	return x, new(big.Int).SetBytes(fy.Bytes()[:]), true
+}
+
+// SchnorrSignature BIP-340 Schnorr签名，R为点R的x坐标。
+type SchnorrSignature struct {
+	R *big.Int
+	S *big.Int
+}
+
+// Serialize 返回64字节的签名 R || S
+func (sig *SchnorrSignature) Serialize() []byte {
+	b := paddedAppend(32, nil, sig.R.Bytes())
+	return paddedAppend(32, b, sig.S.Bytes())
+}
+
+// Verify 使用仅含x坐标的公钥验证消息的签名，等同于SchnorrVerify。
+func (sig *SchnorrSignature) Verify(msg []byte, pubKey *PublicKey) bool {
+	return SchnorrVerify(pubKey, msg, sig)
+}
+
+// IsEqual 比较两个签名是否相同
+func (sig *SchnorrSignature) IsEqual(otherSig *SchnorrSignature) bool {
+	return sig.R.Cmp(otherSig.R) == 0 && sig.S.Cmp(otherSig.S) == 0
+}
+
+// ParseSchnorrSignature 解析64字节的签名，要求r小于p且s小于n。
+func ParseSchnorrSignature(b []byte) (*SchnorrSignature, error) {
+	if len(b) != SchnorrSignatureLen {
+		return nil, ErrSchnorrSignature
+	}
+	r := new(big.Int).SetBytes(b[:32])
+	s := new(big.Int).SetBytes(b[32:])
+	if r.Cmp(S256().P) >= 0 || s.Cmp(order) >= 0 {
+		return nil, ErrSchnorrSignature
+	}
+	return &SchnorrSignature{R: r, S: s}, nil
+}
+
+// SignSchnorr 使用随机的辅助数据对消息进行BIP-340签名
+func (p *PrivateKey) SignSchnorr(msg []byte) (*SchnorrSignature, error) {
+	return SchnorrSign(p, msg, nil)
+}
+
+// SchnorrSign 按BIP-340对任意长度的消息签名。auxRand为32字节的辅助随机数据，
+// 为nil时从crypto/rand读取；相同的私钥、消息和auxRand总是得到相同的签名。
+// 签名完成后会再验证一次，防止计算错误泄露私钥。
+func SchnorrSign(priv *PrivateKey, msg, auxRand []byte) (*SchnorrSignature, error) {
+	curve := S256()
+	d := new(big.Int).Set(priv.D)
+	if d.Sign() <= 0 || d.Cmp(order) >= 0 {
+		return nil, ErrSchnorrPrivKey
+	}
+	if auxRand == nil {
+		auxRand = make([]byte, 32)
+		if _, err := rand.Read(auxRand); err != nil {
+			return nil, err
+		}
+	}
+
+	// 公钥P的y坐标为奇数时改用私钥n-d，使签名对应y坐标为偶数的点。
+	px, py := curve.ScalarBaseMult(d.Bytes())
+	if isOdd(py) {
+		d.Sub(order, d)
+	}
+	pBytes := paddedAppend(32, nil, px.Bytes())
+
+	// t = bytes(d) xor hash_aux(a)
+	t := paddedAppend(32, nil, d.Bytes())
+	aux := TaggedHash(tagBIP340Aux, auxRand)
+	for i := range t {
+		t[i] ^= aux[i]
+	}
+	nonce := TaggedHash(tagBIP340Nonce, t, pBytes, msg)
+	k := new(big.Int).SetBytes(nonce[:])
+	k.Mod(k, order)
+	if k.Sign() == 0 {
+		return nil, errors.New("schnorr nonce is zero")
+	}
+
+	rx, ry := curve.ScalarBaseMult(k.Bytes())
+	if isOdd(ry) {
+		k.Sub(order, k)
+	}
+	rBytes := paddedAppend(32, nil, rx.Bytes())
+	e := challenge(rBytes, pBytes, msg)
+
+	// s = k + e*d mod n
+	s := new(big.Int).Mul(e, d)
+	s.Add(s, k)
+	s.Mod(s, order)
+	sig := &SchnorrSignature{R: rx, S: s}
+
+	pub := &PublicKey{Curve: curve, X: px, Y: py}
+	if !SchnorrVerify(pub, msg, sig) {
+		return nil, errors.New("schnorr signature verification failed")
+	}
+	return sig, nil
+}
+
+// challenge 返回挑战值 e = int(hash_challenge(r || P || m)) mod n
+func challenge(r, p, msg []byte) *big.Int {
+	h := TaggedHash(tagBIP340Challenge, r, p, msg)
+	e := new(big.Int).SetBytes(h[:])
+	return e.Mod(e, order)
+}
+
+// SchnorrVerify 按BIP-340验证签名。只使用公钥的x坐标，y坐标总是视为偶数。
+func SchnorrVerify(pubKey *PublicKey, msg []byte, sig *SchnorrSignature) bool {
+	pBytes, r, ok := schnorrInputs(pubKey, sig)
+	if !ok {
+		return false
+	}
+	px, py, ok := liftX(pBytes)
+	if !ok {
+		return false
+	}
+	curve := S256()
+	e := challenge(r, pBytes, msg)
+
+	// R = s*G - e*P
+	sx, sy := curve.ScalarBaseMult(sig.S.Bytes())
+	ex, ey := curve.ScalarMult(px, py, new(big.Int).Sub(order, e).Bytes())
+	rx, ry := curve.Add(sx, sy, ex, ey)
+	if rx.Sign() == 0 && ry.Sign() == 0 {
+		return false
+	}
+	return !isOdd(ry) && rx.Cmp(sig.R) == 0
+}
+
+// schnorrInputs 检查签名的取值范围，返回公钥和r的32字节编码。
+func schnorrInputs(pubKey *PublicKey, sig *SchnorrSignature) (p, r []byte, ok bool) {
+	if pubKey == nil || pubKey.X == nil || sig == nil || sig.R == nil || sig.S == nil {
+		return nil, nil, false
+	}
+	if pubKey.X.Sign() < 0 || pubKey.X.BitLen() > 256 {
+		return nil, nil, false
+	}
+	if sig.R.Sign() < 0 || sig.R.Cmp(S256().P) >= 0 || sig.S.Sign() < 0 || sig.S.Cmp(order) >= 0 {
+		return nil, nil, false
+	}
+	return paddedAppend(32, nil, pubKey.X.Bytes()), paddedAppend(32, nil, sig.R.Bytes()), true
+}
+
+// SchnorrBatchVerify 批量验证多个BIP-340签名，全部有效时返回true。
+//
+// 第i个签名乘以随机系数a_i(a_1 = 1)后合并为一次检查：
+// (a_1*s_1 + ... + a_u*s_u)*G = a_1*R_1 + a_1*e_1*P_1 + ... + a_u*R_u + a_u*e_u*P_u，
+// 累加在雅可比坐标下进行，只需在最后判断结果是否为无穷远点。
+// 批量验证失败时无法得知是哪个签名无效，需要逐个调用SchnorrVerify。
+func SchnorrBatchVerify(pubKeys []*PublicKey, msgs [][]byte, sigs []*SchnorrSignature) (bool, error) {
+	if len(pubKeys) != len(msgs) || len(msgs) != len(sigs) {
+		return false, ErrSchnorrBatchLength
+	}
+	curve := S256()
+	sum := new(big.Int)
+	qx, qy, qz := new(fieldVal), new(fieldVal), new(fieldVal)
+	add := func(x, y, k *big.Int) {
+		kx, ky := curve.ScalarMult(x, y, k.Bytes())
+		fx, fy := curve.bigAffineToField(kx, ky)
+		curve.addJacobian(qx, qy, qz, fx, fy, new(fieldVal).SetInt(1), qx, qy, qz)
+	}
+
+	for i, sig := range sigs {
+		pBytes, r, ok := schnorrInputs(pubKeys[i], sig)
+		if !ok {
+			return false, nil
+		}
+		px, py, ok := liftX(pBytes)
+		if !ok {
+			return false, nil
+		}
+		rx, ry, ok := liftX(r)
+		if !ok {
+			return false, nil
+		}
+		a := big.NewInt(1)
+		if i > 0 {
+			var err error
+			if a, err = rand.Int(rand.Reader, new(big.Int).Sub(order, one)); err != nil {
+				return false, err
+			}
+			a.Add(a, one)
+		}
+		e := challenge(r, pBytes, msgs[i])
+
+		// 累加 -a_i*R_i - a_i*e_i*P_i，以及 a_i*s_i
+		add(rx, ry, new(big.Int).Sub(order, a))
+		ae := new(big.Int).Mul(a, e)
+		add(px, py, ae.Sub(order, ae.Mod(ae, order)))
+		sum.Add(sum, new(big.Int).Mul(a, sig.S))
+	}
+	sum.Mod(sum, order)
+	gx, gy := curve.ScalarBaseMult(sum.Bytes())
+	fx, fy := curve.bigAffineToField(gx, gy)
+	curve.addJacobian(qx, qy, qz, fx, fy, new(fieldVal).SetInt(1), qx, qy, qz)
+	return qz.Normalize().IsZero() || (qx.Normalize().IsZero() && qy.Normalize().IsZero()), nil
+}
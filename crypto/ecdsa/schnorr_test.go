@@ -0,0 +1,308 @@
+package ecdsa
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// bip340Vectors BIP-340的官方测试向量(test-vectors.csv)，私钥为空的只用于验证。
+var bip340Vectors = []struct {
+	prvKey, pubKey, auxRand, msg, sig string
+	valid                             bool
+}{
+	{
+		"0000000000000000000000000000000000000000000000000000000000000003",
+		"F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"E907831F80848D1069A5371B402410364BDF1C5F8307B0084C55F1CE2DCA821525F66A4A85EA8B71E482A74F382D2CE5EBEEE8FDB2172F477DF4900D310536C0",
+		true,
+	},
+	{
+		"B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF",
+		"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		"0000000000000000000000000000000000000000000000000000000000000001",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"6896BD60EEAE296DB48A229FF71DFE071BDE413E6D43F917DC8DCF8C78DE33418906D11AC976ABCCB20B091292BFF4EA897EFCB639EA871CFA95F6DE339E4B0A",
+		true,
+	},
+	{
+		"C90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B14E5C9",
+		"DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EB8",
+		"C87AA53824B4D7AE2EB035A2B5BBBCCC080E76CDC6D1692C4B0B62D798E6D906",
+		"7E2D58D8B3BCDF1ABADEC7829054F90DDA9805AAB56C77333024B9D0A508B75C",
+		"5831AAEED7B44BB74E5EAB94BA9D4294C49BCF2A60728D8B4C200F50DD313C1BAB745879A5AD954A72C45A91C3A51D3C7ADEA98D82F8481E0E1E03674A6F3FB7",
+		true,
+	},
+	{
+		"0B432B2677937381AEF05BB02A66ECD012773062CF3FA2549E44F58ED2401710",
+		"25D1DFF95105F5253C4022F628A996AD3A0D95FBF21D468A1B33F8C160D8F517",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+		"7EB0509757E246F19449885651611CB965ECC1A187DD51B64FDA1EDC9637D5EC97582B9CB13DB3933705B32BA982AF5AF25FD78881EBB32771FC5922EFC66EA3",
+		true,
+	},
+	{
+		"",
+		"D69C3509BB99E412E68B0FE8544E72837DFA30746D8BE2AA65975F29D22DC7B9",
+		"",
+		"4DF3C3F68FCC83B27E9D42C90431A72499F17875C81A599B566C9889B9696703",
+		"00000000000000000000003B78CE563F89A0ED9414F5AA28AD0D96D6795F9C6376AFB1548AF603B3EB45C9F8207DEE1060CB71C04E80F593060B07D28308D7F4",
+		true,
+	},
+	{
+		// 公钥不在曲线上
+		"",
+		"EEFDEA4CDB677750A420FEE807EACF21EB9898AE79B9768766E4FAA04A2D4A34",
+		"",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B",
+		false,
+	},
+	{
+		// R的y坐标为奇数
+		"",
+		"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		"",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"FFF97BD5755EEEA420453A14355235D382F6472F8568A18B2F057A14602975563CC27944640AC607CD107AE10923D9EF7A73C643E166BE5EBEAFA34B1AC553E2",
+		false,
+	},
+	{
+		// 消息取负
+		"",
+		"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		"",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"1FA62E331EDBC21C394792D2AB1100A7B432B013DF3F6FF4F99FCB33E0E1515F28890B3EDB6E7189B630448B515CE4F8622A954CFE545735AAEA5134FCCDB2BD",
+		false,
+	},
+	{
+		// s取负
+		"",
+		"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		"",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E177769961764B3AA9B2FFCB6EF947B6887A226E8D7C93E00C5ED0C1834FF0D0C2E6DA6",
+		false,
+	},
+	{
+		// s*G - e*P为无穷远点
+		"",
+		"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		"",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"0000000000000000000000000000000000000000000000000000000000000000123DDA8328AF9C23A94C1FEECFD123BA4FB73476F0D594DCB65C6425BD186051",
+		false,
+	},
+	{
+		// s*G - e*P为无穷远点
+		"",
+		"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		"",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"00000000000000000000000000000000000000000000000000000000000000017615FBAF5AE28864013C099742DEADB4DBA87F11AC6754F93780D5A1837CF197",
+		false,
+	},
+	{
+		// r不是曲线上点的x坐标
+		"",
+		"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		"",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"4A298DACAE57395A15D0795DDBFD1DCB564DA82B0F269BC70A74F8220429BA1D69E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B",
+		false,
+	},
+	{
+		// r等于域的大小p
+		"",
+		"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		"",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F69E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B",
+		false,
+	},
+	{
+		// s等于曲线的阶n
+		"",
+		"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		"",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E177769FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141",
+		false,
+	},
+	{
+		// 公钥超出域的大小
+		"",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC30",
+		"",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B",
+		false,
+	},
+	{
+		// 长度为0的消息
+		"0340034003400340034003400340034003400340034003400340034003400340",
+		"778CAA53B4393AC467774D09497A87224BF9FAB6F6E68B23086497324D6FD117",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"",
+		"71535DB165ECD9FBBC046E5FFAEA61186BB6AD436732FCCC25291A55895464CF6069CE26BF03466228F19A3A62DB8A649F2D560FAC652827D1AF0574E427AB63",
+		true,
+	},
+	{
+		// 长度为1的消息
+		"0340034003400340034003400340034003400340034003400340034003400340",
+		"778CAA53B4393AC467774D09497A87224BF9FAB6F6E68B23086497324D6FD117",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"11",
+		"08A20A0AFEF64124649232E0693C583AB1B9934AE63B4C3511F3AE1134C6A303EA3173BFEA6683BD101FA5AA5DBC1996FE7CACFC5A577D33EC14564CEC2BACBF",
+		true,
+	},
+	{
+		// 长度为17的消息
+		"0340034003400340034003400340034003400340034003400340034003400340",
+		"778CAA53B4393AC467774D09497A87224BF9FAB6F6E68B23086497324D6FD117",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"0102030405060708090A0B0C0D0E0F1011",
+		"5130F39A4059B43BC7CAC09A19ECE52B5D8699D1A71E3C52DA9AFDB6B50AC370C4A482B77BF960F8681540E25B6771ECE1E5A37FD80E5A51897C5566A97EA5A5",
+		true,
+	},
+	{
+		// 长度为100的消息
+		"0340034003400340034003400340034003400340034003400340034003400340",
+		"778CAA53B4393AC467774D09497A87224BF9FAB6F6E68B23086497324D6FD117",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		strings.Repeat("99", 100),
+		"403B12B0D8555A344175EA7EC746566303321E5DBFA8BE6F091635163ECA79A8585ED3E3170807E7C03B720FC54C7B23897FCBA0E9D0B4A06894CFD249F22367",
+		true,
+	},
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSchnorrVectors(t *testing.T) {
+	for i, v := range bip340Vectors {
+		msg := decodeHex(t, v.msg)
+		sigBytes := decodeHex(t, v.sig)
+
+		if v.prvKey != "" {
+			prv, err := HexToPrvKey(v.prvKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(prv.ToPubKey().SerializeXOnly()); !strings.EqualFold(got, v.pubKey) {
+				t.Errorf("向量%d: 公钥 %s, 应为 %s", i, got, v.pubKey)
+			}
+			sig, err := SchnorrSign(prv, msg, decodeHex(t, v.auxRand))
+			if err != nil {
+				t.Fatalf("向量%d: %v", i, err)
+			}
+			if !bytes.Equal(sig.Serialize(), sigBytes) {
+				t.Errorf("向量%d: 签名 %X, 应为 %s", i, sig.Serialize(), v.sig)
+			}
+		}
+
+		pub, err := ParseXOnlyPubKey(decodeHex(t, v.pubKey))
+		if err != nil {
+			if v.valid {
+				t.Errorf("向量%d: %v", i, err)
+			}
+			continue
+		}
+		sig, err := ParseSchnorrSignature(sigBytes)
+		if err != nil {
+			if v.valid {
+				t.Errorf("向量%d: %v", i, err)
+			}
+			continue
+		}
+		if got := SchnorrVerify(pub, msg, sig); got != v.valid {
+			t.Errorf("向量%d: 验证结果 %v, 应为 %v", i, got, v.valid)
+		}
+	}
+}
+
+func TestParseXOnlyPubKey(t *testing.T) {
+	for i := 0; i < 16; i++ {
+		_, pub := GenerateKey()
+		parsed, err := ParseXOnlyPubKey(pub.SerializeXOnly())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.X.Cmp(pub.X) != 0 || isOdd(parsed.Y) {
+			t.Fatalf("解析公钥 %x 得到 (%x, %x)", pub.SerializeXOnly(), parsed.X, parsed.Y)
+		}
+		if parsed.Y.Cmp(pub.Y) != 0 && new(big.Int).Add(parsed.Y, pub.Y).Cmp(S256().P) != 0 {
+			t.Fatalf("公钥 %x 的y坐标错误", pub.SerializeXOnly())
+		}
+	}
+	if _, err := ParseXOnlyPubKey(make([]byte, 31)); err != ErrSchnorrPubKey {
+		t.Errorf("31字节的公钥: %v", err)
+	}
+}
+
+func TestSchnorrBatchVerify(t *testing.T) {
+	var (
+		pubs []*PublicKey
+		msgs [][]byte
+		sigs []*SchnorrSignature
+	)
+	for i, v := range bip340Vectors {
+		if !v.valid {
+			continue
+		}
+		pub, err := ParseXOnlyPubKey(decodeHex(t, v.pubKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := ParseSchnorrSignature(decodeHex(t, v.sig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubs = append(pubs, pub)
+		msgs = append(msgs, decodeHex(t, bip340Vectors[i].msg))
+		sigs = append(sigs, sig)
+	}
+	for i := 0; i < 4; i++ {
+		prv, pub := GenerateKey()
+		msg := []byte{byte(i), 'm', 's', 'g'}
+		sig, err := prv.SignSchnorr(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sig.Verify(msg, pub) {
+			t.Fatalf("签名%d验证失败", i)
+		}
+		pubs = append(pubs, pub)
+		msgs = append(msgs, msg)
+		sigs = append(sigs, sig)
+	}
+
+	if ok, err := SchnorrBatchVerify(pubs, msgs, sigs); err != nil || !ok {
+		t.Fatalf("批量验证: %v, %v", ok, err)
+	}
+	if ok, err := SchnorrBatchVerify(nil, nil, nil); err != nil || !ok {
+		t.Errorf("空的批量验证: %v, %v", ok, err)
+	}
+
+	msgs[len(msgs)-1] = []byte("tampered")
+	if ok, _ := SchnorrBatchVerify(pubs, msgs, sigs); ok {
+		t.Error("篡改消息后批量验证通过")
+	}
+	msgs[len(msgs)-1] = msgs[0]
+	if ok, _ := SchnorrBatchVerify(pubs, msgs, sigs); ok {
+		t.Error("替换消息后批量验证通过")
+	}
+	if _, err := SchnorrBatchVerify(pubs, msgs[1:], sigs); err != ErrSchnorrBatchLength {
+		t.Errorf("长度不一致: %v", err)
+	}
+}
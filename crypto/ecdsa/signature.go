@@ -302,3 +302,110 @@ func mac(alg func() hash.Hash, k, m []byte) []byte {
 	h.Write(m)
 	return h.Sum(nil)
 }
+
+const (
+	// SignatureLength 以太坊格式签名的长度 [R || S || V]
+	SignatureLength = 64 + 1
+
+	// RecoveryIDOffset 恢复ID V在签名中的位置
+	RecoveryIDOffset = 64
+
+	// DigestLength 签名的哈希长度
+	DigestLength = 32
+)
+
+// Sign 对32字节的哈希生成以太坊格式的签名 [R || S || V]，V为恢复ID 0或1，S总是取低位值(不大于N/2)。
+func Sign(digestHash []byte, prv *PrivateKey) ([]byte, error) {
+	if len(digestHash) != DigestLength {
+		return nil, fmt.Errorf("hash is required to be exactly %d bytes (%d)", DigestLength, len(digestHash))
+	}
+	if prv.Curve != S256() {
+		return nil, errors.New("private key curve is not secp256k1")
+	}
+	sig, err := SignCompact(S256(), prv, digestHash, false)
+	if err != nil {
+		return nil, err
+	}
+	// 将比特币压缩签名的头部 27+V 移到末尾
+	v := sig[0] - 27
+	copy(sig, sig[1:])
+	sig[RecoveryIDOffset] = v
+	return sig, nil
+}
+
+// SigToPub 从哈希和以太坊格式的签名 [R || S || V] 中恢复出签名的公钥
+func SigToPub(hash, sig []byte) (*PublicKey, error) {
+	if len(hash) != DigestLength {
+		return nil, fmt.Errorf("hash is required to be exactly %d bytes (%d)", DigestLength, len(hash))
+	}
+	if len(sig) != SignatureLength {
+		return nil, errors.New("invalid signature length")
+	}
+	v := sig[RecoveryIDOffset]
+	if v >= 4 {
+		return nil, errors.New("invalid signature recovery id")
+	}
+	s := &Signature{
+		R: new(big.Int).SetBytes(sig[:32]),
+		S: new(big.Int).SetBytes(sig[32:64]),
+	}
+	if s.R.Sign() == 0 || s.S.Sign() == 0 || s.R.Cmp(secp256k1N) >= 0 || s.S.Cmp(secp256k1N) >= 0 {
+		return nil, errors.New("invalid signature values")
+	}
+	pub, err := recoverKeyFromSignature(S256(), s, hash, int(v), false)
+	if err != nil {
+		return nil, err
+	}
+	if pub.X.Sign() == 0 && pub.Y.Sign() == 0 {
+		return nil, errors.New("recovered public key is the point at infinity")
+	}
+	return pub, nil
+}
+
+// Ecrecover 从哈希和以太坊格式的签名中恢复出65字节的未压缩公钥
+func Ecrecover(hash, sig []byte) ([]byte, error) {
+	pub, err := SigToPub(hash, sig)
+	if err != nil {
+		return nil, err
+	}
+	return pub.SerializeUncompressed(), nil
+}
+
+// RecoverAddress 从哈希和以太坊格式的签名中恢复出签名者的地址
+func RecoverAddress(hash, sig []byte) (Address, error) {
+	pub, err := SigToPub(hash, sig)
+	if err != nil {
+		return Address{}, err
+	}
+	return pub.ToAddress(), nil
+}
+
+// VerifySignature 使用65字节的未压缩公钥验证64字节的签名 [R || S]。
+// 为防止签名延展性，S大于N/2的签名视为无效。
+func VerifySignature(pubkey, hash, signature []byte) bool {
+	if len(signature) != 64 {
+		return false
+	}
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if r.Sign() == 0 || s.Sign() == 0 || r.Cmp(secp256k1N) >= 0 || s.Cmp(halforder) > 0 {
+		return false
+	}
+	pub, err := UnmarshalPubkey(pubkey)
+	if err != nil {
+		return false
+	}
+	return e.Verify(pub.ToECDSA(), hash, r, s)
+}
+
+// ValidateSignatureValues 检查签名的取值是否有效：r、s须在[1, N-1]之间，v须为0或1；
+// homestead为true时还要求S不大于N/2。
+func ValidateSignatureValues(v byte, r, s *big.Int, homestead bool) bool {
+	if r.Cmp(one) < 0 || s.Cmp(one) < 0 {
+		return false
+	}
+	if homestead && s.Cmp(halforder) > 0 {
+		return false
+	}
+	return r.Cmp(secp256k1N) < 0 && s.Cmp(secp256k1N) < 0 && (v == 0 || v == 1)
+}
@@ -0,0 +1,481 @@
+// Package typeddata 实现了EIP-712结构化数据的哈希和签名，以及EIP-191 personal_sign消息的哈希和签名。
+//
+// 结构化数据的签名哈希为 Keccak256(0x19 || 0x01 || domainSeparator || hashStruct(message))，
+// 其中 hashStruct(s) = Keccak256(typeHash || encodeData(s))，typeHash为类型编码的Keccak256哈希。
+// 签名为以太坊格式的65字节 [R || S || V]，与钱包一致V取27或28。
+package typeddata
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sea-project/sea-pkg/crypto/ecdsa"
+	"github.com/sea-project/sea-pkg/crypto/sha3"
+	"github.com/sea-project/sea-pkg/util/math"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DomainType 域类型的名称
+const DomainType = "EIP712Domain"
+
+// maxDepth 结构体和数组嵌套的最大深度
+const maxDepth = 64
+
+var (
+	// ErrInvalidSignature 签名长度或V错误
+	ErrInvalidSignature = errors.New("typeddata: invalid signature")
+
+	// ErrMaxDepth 数据嵌套过深
+	ErrMaxDepth = errors.New("typeddata: max depth exceeded")
+)
+
+// Type 结构体类型的一个字段
+type Type struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Types 结构体类型的定义，键为类型名称
+type Types map[string][]Type
+
+// TypedData EIP-712的JSON数据
+type TypedData struct {
+	Types       Types                  `json:"types"`
+	PrimaryType string                 `json:"primaryType"`
+	Domain      map[string]interface{} `json:"domain"`
+	Message     map[string]interface{} `json:"message"`
+}
+
+// Parse 解析EIP-712的JSON数据并检查类型定义。数字解析为json.Number，不会损失精度。
+func Parse(data []byte) (*TypedData, error) {
+	var td TypedData
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&td); err != nil {
+		return nil, err
+	}
+	if err := td.Validate(); err != nil {
+		return nil, err
+	}
+	return &td, nil
+}
+
+var (
+	typeNameRegexp = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+	arrayRegexp    = regexp.MustCompile(`^(.+)\[([0-9]*)\]$`)
+)
+
+// Validate 检查类型定义：类型名称合法，字段类型为已定义的结构体、基本类型或它们的数组，
+// 且域类型和主类型已定义。
+func (td *TypedData) Validate() error {
+	if _, ok := td.Types[DomainType]; !ok {
+		return fmt.Errorf("typeddata: type %s is undefined", DomainType)
+	}
+	if _, ok := td.Types[td.PrimaryType]; !ok {
+		return fmt.Errorf("typeddata: primary type %q is undefined", td.PrimaryType)
+	}
+	for name, fields := range td.Types {
+		if !typeNameRegexp.MatchString(name) || isPrimitive(name) {
+			return fmt.Errorf("typeddata: invalid type name %q", name)
+		}
+		seen := make(map[string]bool, len(fields))
+		for _, f := range fields {
+			if f.Name == "" || seen[f.Name] {
+				return fmt.Errorf("typeddata: invalid or duplicate field name %q in type %s", f.Name, name)
+			}
+			seen[f.Name] = true
+			base := baseType(f.Type)
+			if _, ok := td.Types[base]; !ok && !isPrimitive(base) {
+				return fmt.Errorf("typeddata: unknown type %q of field %s.%s", f.Type, name, f.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// baseType 去掉数组的所有维度，如 Person[][2] 返回 Person
+func baseType(typ string) string {
+	for {
+		m := arrayRegexp.FindStringSubmatch(typ)
+		if m == nil {
+			return typ
+		}
+		typ = m[1]
+	}
+}
+
+// isPrimitive 判断是否为基本类型：address、bool、string、bytes、bytes1到bytes32、uint8到uint256、int8到int256
+func isPrimitive(typ string) bool {
+	switch typ {
+	case "address", "bool", "string", "bytes":
+		return true
+	}
+	_, _, ok := intType(typ)
+	if ok {
+		return true
+	}
+	_, ok = fixedBytesType(typ)
+	return ok
+}
+
+// intType 解析uintN、intN类型，N须为8的倍数且在8到256之间
+func intType(typ string) (bits int, signed, ok bool) {
+	s := typ
+	switch {
+	case strings.HasPrefix(s, "uint"):
+		s = s[4:]
+	case strings.HasPrefix(s, "int"):
+		s, signed = s[3:], true
+	default:
+		return 0, false, false
+	}
+	bits, err := strconv.Atoi(s)
+	if err != nil || bits < 8 || bits > 256 || bits%8 != 0 || strconv.Itoa(bits) != s {
+		return 0, false, false
+	}
+	return bits, signed, true
+}
+
+// fixedBytesType 解析bytesN类型，N在1到32之间
+func fixedBytesType(typ string) (int, bool) {
+	if !strings.HasPrefix(typ, "bytes") {
+		return 0, false
+	}
+	s := typ[5:]
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 32 || strconv.Itoa(n) != s {
+		return 0, false
+	}
+	return n, true
+}
+
+// Dependencies 返回primaryType直接或间接引用的结构体类型，包括它自身
+func (td *TypedData) Dependencies(primaryType string, found []string) []string {
+	primaryType = baseType(primaryType)
+	for _, t := range found {
+		if t == primaryType {
+			return found
+		}
+	}
+	if _, ok := td.Types[primaryType]; !ok {
+		return found
+	}
+	found = append(found, primaryType)
+	for _, f := range td.Types[primaryType] {
+		found = td.Dependencies(f.Type, found)
+	}
+	return found
+}
+
+// EncodeType 返回类型的编码，如 Mail(Person from,Person to,string contents)Person(string name,address wallet)，
+// 主类型在前，引用的类型按名称排序。
+func (td *TypedData) EncodeType(primaryType string) []byte {
+	deps := td.Dependencies(primaryType, nil)
+	if len(deps) > 0 {
+		sort.Strings(deps[1:])
+	}
+	var buf bytes.Buffer
+	for _, dep := range deps {
+		buf.WriteString(dep)
+		buf.WriteByte('(')
+		for i, f := range td.Types[dep] {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(f.Type)
+			buf.WriteByte(' ')
+			buf.WriteString(f.Name)
+		}
+		buf.WriteByte(')')
+	}
+	return buf.Bytes()
+}
+
+// TypeHash 返回类型编码的Keccak256哈希
+func (td *TypedData) TypeHash(primaryType string) []byte {
+	return sha3.Keccak256(td.EncodeType(primaryType))
+}
+
+// HashStruct 返回结构体数据的哈希 Keccak256(typeHash || encodeData(data))
+func (td *TypedData) HashStruct(primaryType string, data map[string]interface{}) ([]byte, error) {
+	enc, err := td.EncodeData(primaryType, data, 1)
+	if err != nil {
+		return nil, err
+	}
+	return sha3.Keccak256(enc), nil
+}
+
+// EncodeData 按EIP-712编码结构体数据：typeHash之后依次为每个字段32字节的编码。
+// 结构体字段编码为其HashStruct，数组编码为元素编码串联后的Keccak256哈希，
+// string和bytes编码为内容的Keccak256哈希，其他基本类型编码为32字节的值。
+func (td *TypedData) EncodeData(primaryType string, data map[string]interface{}, depth int) ([]byte, error) {
+	if depth > maxDepth {
+		return nil, ErrMaxDepth
+	}
+	fields, ok := td.Types[primaryType]
+	if !ok {
+		return nil, fmt.Errorf("typeddata: type %q is undefined", primaryType)
+	}
+	if len(data) > len(fields) {
+		return nil, fmt.Errorf("typeddata: data has more fields than type %s", primaryType)
+	}
+	buf := bytes.NewBuffer(td.TypeHash(primaryType))
+	for _, f := range fields {
+		value, ok := data[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("typeddata: missing field %s.%s", primaryType, f.Name)
+		}
+		enc, err := td.encodeValue(f.Type, value, depth)
+		if err != nil {
+			return nil, fmt.Errorf("typeddata: field %s.%s: %v", primaryType, f.Name, err)
+		}
+		buf.Write(enc)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeValue 返回typ类型的值的32字节编码
+func (td *TypedData) encodeValue(typ string, value interface{}, depth int) ([]byte, error) {
+	if m := arrayRegexp.FindStringSubmatch(typ); m != nil {
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: expected array, got %T", typ, value)
+		}
+		if m[2] != "" {
+			if n, _ := strconv.Atoi(m[2]); n != len(items) {
+				return nil, fmt.Errorf("%s: expected %d items, got %d", typ, n, len(items))
+			}
+		}
+		if depth+1 > maxDepth {
+			return nil, ErrMaxDepth
+		}
+		var buf bytes.Buffer
+		for _, item := range items {
+			enc, err := td.encodeValue(m[1], item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(enc)
+		}
+		return sha3.Keccak256(buf.Bytes()), nil
+	}
+	if _, ok := td.Types[typ]; ok {
+		data, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: expected object, got %T", typ, value)
+		}
+		enc, err := td.EncodeData(typ, data, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return sha3.Keccak256(enc), nil
+	}
+	return encodePrimitive(typ, value)
+}
+
+// encodePrimitive 返回基本类型的值的32字节编码
+func encodePrimitive(typ string, value interface{}) ([]byte, error) {
+	switch typ {
+	case "address":
+		addr, err := toAddress(value)
+		if err != nil {
+			return nil, err
+		}
+		return math.PaddedBigBytes(addr.Big(), 32), nil
+	case "bool":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("bool: invalid value %v", value)
+		}
+		enc := make([]byte, 32)
+		if b {
+			enc[31] = 1
+		}
+		return enc, nil
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("string: invalid value %v", value)
+		}
+		return sha3.Keccak256([]byte(s)), nil
+	case "bytes":
+		b, err := toBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		return sha3.Keccak256(b), nil
+	}
+	if n, ok := fixedBytesType(typ); ok {
+		b, err := toBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != n {
+			return nil, fmt.Errorf("%s: invalid length %d", typ, len(b))
+		}
+		enc := make([]byte, 32)
+		copy(enc, b)
+		return enc, nil
+	}
+	if bits, signed, ok := intType(typ); ok {
+		x, err := toBigInt(value)
+		if err != nil {
+			return nil, err
+		}
+		min, max := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(bits))
+		if signed {
+			max.Rsh(max, 1)
+			min.Neg(max)
+		}
+		if x.Cmp(min) < 0 || x.Cmp(max) >= 0 {
+			return nil, fmt.Errorf("%s: value %v out of range", typ, x)
+		}
+		return math.PaddedBigBytes(math.U256(new(big.Int).Set(x)), 32), nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", typ)
+}
+
+// toAddress 将十六进制字符串或ecdsa.Address转为地址
+func toAddress(value interface{}) (ecdsa.Address, error) {
+	switch v := value.(type) {
+	case ecdsa.Address:
+		return v, nil
+	case *ecdsa.Address:
+		return *v, nil
+	case string:
+		if ecdsa.IsHexAddress(v) {
+			return ecdsa.HexToAddress(v), nil
+		}
+	}
+	return ecdsa.Address{}, fmt.Errorf("address: invalid value %v", value)
+}
+
+// toBytes 将0x开头的十六进制字符串或[]byte转为字节
+func toBytes(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		if strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X") {
+			if b, err := hex.DecodeString(v[2:]); err == nil {
+				return b, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("bytes: invalid value %v", value)
+}
+
+// toBigInt 将数字、十进制字符串、0x开头的十六进制字符串或*big.Int转为整数
+func toBigInt(value interface{}) (*big.Int, error) {
+	switch v := value.(type) {
+	case *big.Int:
+		return v, nil
+	case json.Number:
+		return toBigInt(string(v))
+	case string:
+		x, ok := new(big.Int), false
+		if strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X") {
+			x, ok = x.SetString(v[2:], 16)
+		} else {
+			x, ok = x.SetString(v, 10)
+		}
+		if ok {
+			return x, nil
+		}
+	case float64:
+		if v == float64(int64(v)) {
+			return big.NewInt(int64(v)), nil
+		}
+	case int:
+		return big.NewInt(int64(v)), nil
+	case int64:
+		return big.NewInt(v), nil
+	case uint64:
+		return new(big.Int).SetUint64(v), nil
+	}
+	return nil, fmt.Errorf("integer: invalid value %v", value)
+}
+
+// DomainSeparator 返回域数据的HashStruct
+func (td *TypedData) DomainSeparator() ([]byte, error) {
+	return td.HashStruct(DomainType, td.Domain)
+}
+
+// SigningHash 返回EIP-712签名哈希 Keccak256(0x19 || 0x01 || domainSeparator || hashStruct(message))
+func (td *TypedData) SigningHash() ([]byte, error) {
+	domainSeparator, err := td.DomainSeparator()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := td.HashStruct(td.PrimaryType, td.Message)
+	if err != nil {
+		return nil, err
+	}
+	return sha3.Keccak256([]byte{0x19, 0x01}, domainSeparator, hash), nil
+}
+
+// Sign 对结构化数据签名，返回65字节的 [R || S || V]，V为27或28
+func Sign(td *TypedData, prv *ecdsa.PrivateKey) ([]byte, error) {
+	hash, err := td.SigningHash()
+	if err != nil {
+		return nil, err
+	}
+	return sign(hash, prv)
+}
+
+// Recover 从结构化数据的签名中恢复出签名者的地址，V可以为0、1或27、28
+func Recover(td *TypedData, sig []byte) (ecdsa.Address, error) {
+	hash, err := td.SigningHash()
+	if err != nil {
+		return ecdsa.Address{}, err
+	}
+	return recoverAddress(hash, sig)
+}
+
+// TextHash 返回EIP-191 personal_sign消息的哈希 Keccak256("\x19Ethereum Signed Message:\n" + len(data) + data)
+func TextHash(data []byte) []byte {
+	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(data))
+	return sha3.Keccak256([]byte(prefix), data)
+}
+
+// SignText 按EIP-191 personal_sign对消息签名，返回65字节的 [R || S || V]，V为27或28
+func SignText(data []byte, prv *ecdsa.PrivateKey) ([]byte, error) {
+	return sign(TextHash(data), prv)
+}
+
+// RecoverText 从personal_sign签名中恢复出签名者的地址，V可以为0、1或27、28
+func RecoverText(data, sig []byte) (ecdsa.Address, error) {
+	return recoverAddress(TextHash(data), sig)
+}
+
+func sign(hash []byte, prv *ecdsa.PrivateKey) ([]byte, error) {
+	sig, err := ecdsa.Sign(hash, prv)
+	if err != nil {
+		return nil, err
+	}
+	sig[ecdsa.RecoveryIDOffset] += 27
+	return sig, nil
+}
+
+func recoverAddress(hash, sig []byte) (ecdsa.Address, error) {
+	if len(sig) != ecdsa.SignatureLength {
+		return ecdsa.Address{}, ErrInvalidSignature
+	}
+	v := sig[ecdsa.RecoveryIDOffset]
+	if v == 27 || v == 28 {
+		v -= 27
+	}
+	if v > 1 {
+		return ecdsa.Address{}, ErrInvalidSignature
+	}
+	s := make([]byte, ecdsa.SignatureLength)
+	copy(s, sig)
+	s[ecdsa.RecoveryIDOffset] = v
+	return ecdsa.RecoverAddress(hash, s)
+}
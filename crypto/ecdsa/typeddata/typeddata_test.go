@@ -0,0 +1,214 @@
+package typeddata
+
+import (
+	"encoding/hex"
+	"github.com/sea-project/sea-pkg/crypto/ecdsa"
+	"github.com/sea-project/sea-pkg/crypto/sha3"
+	"math/big"
+	"testing"
+)
+
+// EIP-712规范中的Mail示例
+const mailJSON = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallet", "type": "address"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person"},
+			{"name": "contents", "type": "string"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+func TestMail(t *testing.T) {
+	td, err := Parse([]byte(mailJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(td.EncodeType("Mail")); got != "Mail(Person from,Person to,string contents)Person(string name,address wallet)" {
+		t.Errorf("类型编码 %s", got)
+	}
+	if got := hex.EncodeToString(td.TypeHash("Mail")); got != "a0cedeb2dc280ba39b857546d74f5549c3a1d7bdc2dd96bf881f76108e23dac2" {
+		t.Errorf("类型哈希 %s", got)
+	}
+	hash, err := td.HashStruct("Mail", td.Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(hash); got != "c52c0ee5d84264471806290a3f2c4cecfc5490626bf912d01f240d7a274b371e" {
+		t.Errorf("消息哈希 %s", got)
+	}
+	domainSeparator, err := td.DomainSeparator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(domainSeparator); got != "f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f" {
+		t.Errorf("域哈希 %s", got)
+	}
+	hash, err = td.SigningHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(hash); got != "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2" {
+		t.Errorf("签名哈希 %s", got)
+	}
+
+	prv, err := ecdsa.ToECDSA(sha3.Keccak256([]byte("cow")), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := Sign(td, prv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d" +
+		"07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b91562" + "1c"
+	if got := hex.EncodeToString(sig); got != want {
+		t.Errorf("签名 %s, 应为 %s", got, want)
+	}
+	addr, err := Recover(td, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != ecdsa.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826") {
+		t.Errorf("恢复的地址 %x", addr)
+	}
+}
+
+func TestEncodePrimitive(t *testing.T) {
+	tests := []struct {
+		typ   string
+		value interface{}
+		want  string // 空字符串表示应返回错误
+	}{
+		{"bool", true, "0000000000000000000000000000000000000000000000000000000000000001"},
+		{"uint8", "255", "00000000000000000000000000000000000000000000000000000000000000ff"},
+		{"uint8", 256, ""},
+		{"int8", -128, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff80"},
+		{"int8", "-129", ""},
+		{"int256", big.NewInt(-1), "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"},
+		{"uint256", "0x0100", "0000000000000000000000000000000000000000000000000000000000000100"},
+		{"uint256", 1.5, ""},
+		{"bytes4", "0xdeadbeef", "deadbeef00000000000000000000000000000000000000000000000000000000"},
+		{"bytes4", "0xdead", ""},
+		{"bytes", "0x", "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{"address", "0x01", ""},
+		{"uint7", 1, ""},
+	}
+	for _, test := range tests {
+		enc, err := encodePrimitive(test.typ, test.value)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s %v: 应返回错误", test.typ, test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v: %v", test.typ, test.value, err)
+		} else if got := hex.EncodeToString(enc); got != test.want {
+			t.Errorf("%s %v: %s, 应为 %s", test.typ, test.value, got, test.want)
+		}
+	}
+}
+
+func TestArrays(t *testing.T) {
+	td, err := Parse([]byte(`{
+		"types": {
+			"EIP712Domain": [{"name": "name", "type": "string"}],
+			"Person": [{"name": "name", "type": "string"}],
+			"Group": [
+				{"name": "members", "type": "Person[]"},
+				{"name": "ids", "type": "uint256[2]"}
+			]
+		},
+		"primaryType": "Group",
+		"domain": {"name": "test"},
+		"message": {"members": [{"name": "a"}, {"name": "b"}], "ids": [1, 2]}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(td.EncodeType("Group")); got != "Group(Person[] members,uint256[2] ids)Person(string name)" {
+		t.Errorf("类型编码 %s", got)
+	}
+	person := func(name string) []byte {
+		return sha3.Keccak256(td.TypeHash("Person"), sha3.Keccak256([]byte(name)))
+	}
+	one, two := make([]byte, 32), make([]byte, 32)
+	one[31], two[31] = 1, 2
+	want := sha3.Keccak256(td.TypeHash("Group"), sha3.Keccak256(person("a"), person("b")), sha3.Keccak256(one, two))
+	got, err := td.HashStruct("Group", td.Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(got) != hex.EncodeToString(want) {
+		t.Errorf("哈希 %x, 应为 %x", got, want)
+	}
+
+	td.Message["ids"] = []interface{}{1}
+	if _, err = td.SigningHash(); err == nil {
+		t.Error("定长数组长度错误时应返回错误")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		`{"types": {"Mail": []}, "primaryType": "Mail"}`,
+		`{"types": {"EIP712Domain": []}, "primaryType": "Mail"}`,
+		`{"types": {"EIP712Domain": [], "Mail": [{"name": "to", "type": "Person"}]}, "primaryType": "Mail"}`,
+		`{"types": {"EIP712Domain": [], "Mail": [{"name": "a", "type": "bool"}, {"name": "a", "type": "bool"}]}, "primaryType": "Mail"}`,
+		`{"types": {"EIP712Domain": [], "uint256": []}, "primaryType": "EIP712Domain"}`,
+	}
+	for i, test := range tests {
+		if _, err := Parse([]byte(test)); err == nil {
+			t.Errorf("%d: 应返回错误", i)
+		}
+	}
+}
+
+func TestSignText(t *testing.T) {
+	if got := hex.EncodeToString(TextHash([]byte("Hello World"))); got != "a1de988600a42c4b4ab089b619297c17d53cffae5d5120d82d8a92d0bb3b78f2" {
+		t.Errorf("消息哈希 %s", got)
+	}
+	prv, pub := ecdsa.GenerateKey()
+	msg := []byte("sea")
+	sig, err := SignText(msg, prv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := sig[ecdsa.RecoveryIDOffset]; v != 27 && v != 28 {
+		t.Errorf("V %d", v)
+	}
+	addr, err := RecoverText(msg, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != pub.ToAddress() {
+		t.Errorf("恢复的地址 %x", addr)
+	}
+	sig[ecdsa.RecoveryIDOffset] = 29
+	if _, err = RecoverText(msg, sig); err != ErrInvalidSignature {
+		t.Errorf("V错误: %v", err)
+	}
+}
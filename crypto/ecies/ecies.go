@@ -0,0 +1,151 @@
+// Package ecies 实现了secp256k1公钥上的ECIES集成加密方案，密文格式与以太坊(RLPx握手等)使用的格式兼容。
+//
+// 加密时生成临时密钥对，与接收方公钥做ECDH得到共享密钥z，再用NIST SP 800-56的连接KDF
+// 派生出AES-128密钥Ke和HMAC-SHA256密钥Km，密文为：
+//
+//	R(65字节未压缩的临时公钥) || IV(16字节) || AES-128-CTR(Ke, IV, msg) || HMAC-SHA256(Km, IV || 密文 || s2)
+//
+// 其中s1参与密钥派生，s2参与消息认证，两者可以为nil，但加解密双方必须一致。
+package ecies
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"github.com/sea-project/sea-pkg/crypto/aes"
+	"github.com/sea-project/sea-pkg/crypto/ecdsa"
+	"hash"
+	"io"
+)
+
+const (
+	// keyLen AES-128密钥长度，也是派生的HMAC密钥材料长度
+	keyLen = 16
+
+	// pubKeyLen 未压缩公钥的长度
+	pubKeyLen = ecdsa.PubKeyBytesLenUncompressed
+
+	// Overhead 密文比明文多出的字节数：临时公钥、IV和消息认证码
+	Overhead = pubKeyLen + aes.BlockSise + sha256.Size
+)
+
+var (
+	// ErrInvalidMessage 密文格式错误或消息认证码不匹配
+	ErrInvalidMessage = errors.New("ecies: invalid message")
+
+	// ErrInvalidPublicKey 公钥为空、不在secp256k1曲线上，或为不支持的压缩格式
+	ErrInvalidPublicKey = errors.New("ecies: invalid public key")
+
+	// ErrSharedKeyIsPointAtInfinity ECDH的结果为无穷远点
+	ErrSharedKeyIsPointAtInfinity = errors.New("ecies: shared key is point at infinity")
+)
+
+// Encrypt 使用接收方公钥加密消息。s1为密钥派生的共享信息，s2为消息认证的共享信息。
+func Encrypt(pub *ecdsa.PublicKey, msg, s1, s2 []byte) ([]byte, error) {
+	ephemeral, _ := ecdsa.GenerateKey()
+	iv := make([]byte, aes.BlockSise)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	return encrypt(pub, msg, s1, s2, ephemeral, iv)
+}
+
+// encrypt 使用给定的临时私钥和IV加密消息。
+func encrypt(pub *ecdsa.PublicKey, msg, s1, s2 []byte, ephemeral *ecdsa.PrivateKey, iv []byte) ([]byte, error) {
+	z, err := sharedSecret(ephemeral, pub)
+	if err != nil {
+		return nil, err
+	}
+	ke, km := deriveKeys(z, s1)
+	c, err := aes.AesCTRXOR(ke, msg, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	ct := make([]byte, 0, len(msg)+Overhead)
+	ct = append(ct, ephemeral.ToPubKey().SerializeUncompressed()...)
+	ct = append(ct, iv...)
+	ct = append(ct, c...)
+	return append(ct, messageTag(km, ct[pubKeyLen:], s2)...), nil
+}
+
+// Decrypt 使用接收方私钥解密由Encrypt生成的密文，s1、s2须与加密时相同。
+func Decrypt(prv *ecdsa.PrivateKey, ct, s1, s2 []byte) ([]byte, error) {
+	if len(ct) < Overhead {
+		return nil, ErrInvalidMessage
+	}
+	switch ct[0] {
+	case 4:
+	case 2, 3:
+		return nil, ErrInvalidPublicKey
+	default:
+		return nil, ErrInvalidMessage
+	}
+	pub, err := ecdsa.UnmarshalPubkey(ct[:pubKeyLen])
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	z, err := sharedSecret(prv, pub)
+	if err != nil {
+		return nil, err
+	}
+	ke, km := deriveKeys(z, s1)
+
+	em := ct[pubKeyLen : len(ct)-sha256.Size]
+	tag := ct[len(ct)-sha256.Size:]
+	if subtle.ConstantTimeCompare(messageTag(km, em, s2), tag) != 1 {
+		return nil, ErrInvalidMessage
+	}
+	return aes.AesCTRXOR(ke, em[aes.BlockSise:], em[:aes.BlockSise])
+}
+
+// sharedSecret 返回ECDH共享点的x坐标，左侧补零到32字节。
+func sharedSecret(prv *ecdsa.PrivateKey, pub *ecdsa.PublicKey) ([]byte, error) {
+	if pub == nil || pub.X == nil || pub.Y == nil || !ecdsa.S256().IsOnCurve(pub.X, pub.Y) {
+		return nil, ErrInvalidPublicKey
+	}
+	x := ecdsa.GenerateSharedSecret(prv, pub)
+	if len(x) == 0 {
+		return nil, ErrSharedKeyIsPointAtInfinity
+	}
+	z := make([]byte, 32)
+	copy(z[len(z)-len(x):], x)
+	return z, nil
+}
+
+// deriveKeys 从共享密钥派生出加密密钥ke和认证密钥km，km为派生材料的SHA-256哈希。
+func deriveKeys(z, s1 []byte) (ke, km []byte) {
+	h := sha256.New()
+	k := concatKDF(h, z, s1, 2*keyLen)
+	ke = k[:keyLen]
+	h.Reset()
+	h.Write(k[keyLen:])
+	return ke, h.Sum(nil)
+}
+
+// concatKDF NIST SP 800-56A的连接密钥派生函数，
+// 输出为 H(counter || z || s1)的串联，counter为从1开始的32位大端整数。
+func concatKDF(h hash.Hash, z, s1 []byte, kdLen int) []byte {
+	counter := make([]byte, 4)
+	k := make([]byte, 0, kdLen+h.Size())
+	for i := uint32(1); len(k) < kdLen; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		h.Reset()
+		h.Write(counter)
+		h.Write(z)
+		h.Write(s1)
+		k = h.Sum(k)
+	}
+	return k[:kdLen]
+}
+
+// messageTag 返回 HMAC-SHA256(km, msg || s2)
+func messageTag(km, msg, s2 []byte) []byte {
+	mac := hmac.New(sha256.New, km)
+	mac.Write(msg)
+	mac.Write(s2)
+	return mac.Sum(nil)
+}
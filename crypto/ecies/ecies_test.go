@@ -0,0 +1,107 @@
+package ecies
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/sea-project/sea-pkg/crypto/ecdsa"
+	"testing"
+)
+
+func TestConcatKDF(t *testing.T) {
+	// 以太坊ECIES的KDF测试向量
+	want := "858b192fa2ed4395e2bf88dd8d5770d67dc284ee539f12da8bceaa45d06ebae0700f1ab918a5f0413b8140f9940d6955"
+	for _, n := range []int{6, 32, 48} {
+		got := hex.EncodeToString(concatKDF(sha256.New(), []byte("input"), nil, n))
+		if got != want[:2*n] {
+			t.Errorf("长度%d: 得到 %s, 应为 %s", n, got, want[:2*n])
+		}
+	}
+}
+
+// 接收方私钥为9a2f...0617、临时私钥为1f2e...a798时的密文，由独立实现生成。
+const testCiphertext = "04e3cdda09db614113353f4a4d2d6e9c56cbbbec47fd1814458649a48d338b849f1654c7a1463700ca669c1393e159319c9b3c29c7e424aa773ac243b1916cf556" +
+	"a0a1a2a3a4a5a6a7a8a9aaabacadaeaf" +
+	"15bf4464eaa8821db026324da306e65011cc" +
+	"ad57773adb4b5ed34863cd9d4487a5d822177af2962e04589f111d17df2a1a"
+
+func TestEncryptVector(t *testing.T) {
+	recv, err := ecdsa.HexToPrvKey("9a2f1c3b7e5d4a6f8b0c1d2e3f405162738495a6b7c8d9eaf0b1c2d3e4f50617")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eph, err := ecdsa.HexToPrvKey("1f2e3d4c5b6a79880716253443526170f1e2d3c4b5a6978801f2e3d4c5b6a798")
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv, _ := hex.DecodeString("a0a1a2a3a4a5a6a7a8a9aaabacadaeaf")
+	msg := []byte("sea-project ecies")
+	s1, s2 := []byte("kdf shared"), []byte("mac shared")
+
+	ct, err := encrypt(recv.ToPubKey(), msg, s1, s2, eph, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(ct); got != testCiphertext {
+		t.Fatalf("密文 %s, 应为 %s", got, testCiphertext)
+	}
+	pt, err := Decrypt(recv, ct, s1, s2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pt, msg) {
+		t.Errorf("解密得到 %q", pt)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	prv, pub := ecdsa.GenerateKey()
+	other, _ := ecdsa.GenerateKey()
+	msg := []byte("Hello, world.")
+	s1, s2 := []byte("s1"), []byte("s2")
+
+	ct, err := Encrypt(pub, msg, s1, s2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ct) != len(msg)+Overhead {
+		t.Errorf("密文长度 %d, 应为 %d", len(ct), len(msg)+Overhead)
+	}
+	pt, err := Decrypt(prv, ct, s1, s2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pt, msg) {
+		t.Fatalf("解密得到 %q", pt)
+	}
+	empty, err := Encrypt(pub, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt, err = Decrypt(prv, empty, nil, nil); err != nil || len(pt) != 0 {
+		t.Errorf("空消息解密得到 %q, %v", pt, err)
+	}
+
+	if _, err = Decrypt(other, ct, s1, s2); err != ErrInvalidMessage {
+		t.Errorf("使用其他私钥解密: %v", err)
+	}
+	if _, err = Decrypt(prv, ct, nil, s2); err != ErrInvalidMessage {
+		t.Errorf("s1不同: %v", err)
+	}
+	if _, err = Decrypt(prv, ct, s1, nil); err != ErrInvalidMessage {
+		t.Errorf("s2不同: %v", err)
+	}
+	tampered := append([]byte(nil), ct...)
+	tampered[len(tampered)-sha256.Size-1] ^= 1
+	if _, err = Decrypt(prv, tampered, s1, s2); err != ErrInvalidMessage {
+		t.Errorf("篡改密文: %v", err)
+	}
+	if _, err = Decrypt(prv, ct[:Overhead-1], s1, s2); err != ErrInvalidMessage {
+		t.Errorf("截断密文: %v", err)
+	}
+	tampered = append([]byte(nil), ct...)
+	tampered[1] ^= 1
+	if _, err = Decrypt(prv, tampered, s1, s2); err != ErrInvalidPublicKey {
+		t.Errorf("临时公钥不在曲线上: %v", err)
+	}
+}
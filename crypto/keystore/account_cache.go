@@ -0,0 +1,172 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/sea-project/sea-pkg/crypto/ecdsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Account 密钥库中的账户，对应目录中的一个密钥文件
+type Account struct {
+	Address ecdsa.Address
+	Path    string // 密钥文件的路径
+}
+
+// AccountEventType 账户事件的类型
+type AccountEventType int
+
+const (
+	// AccountAdded 密钥目录中出现了新的密钥文件
+	AccountAdded AccountEventType = iota
+
+	// AccountDropped 密钥文件被删除
+	AccountDropped
+)
+
+// AccountEvent 密钥目录中账户的变化
+type AccountEvent struct {
+	Account Account
+	Type    AccountEventType
+}
+
+// fileInfo 缓存的密钥文件，修改时间和大小不变时不再重新读取
+type fileInfo struct {
+	modTime time.Time
+	size    int64
+	account Account
+	ok      bool // 是否为有效的密钥文件
+}
+
+// accountCache 缓存密钥目录中的账户，按文件名排序
+type accountCache struct {
+	dir   string
+	mu    sync.Mutex
+	all   []Account
+	files map[string]fileInfo
+}
+
+func newAccountCache(dir string) *accountCache {
+	return &accountCache{dir: dir, files: make(map[string]fileInfo)}
+}
+
+// accounts 返回所有账户的副本
+func (ac *accountCache) accounts() []Account {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	cpy := make([]Account, len(ac.all))
+	copy(cpy, ac.all)
+	return cpy
+}
+
+// find 返回地址对应的账户，a.Path不为空时还须匹配路径
+func (ac *accountCache) find(a Account) (Account, error) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	var matches []Account
+	for _, acc := range ac.all {
+		if acc.Address != a.Address {
+			continue
+		}
+		if a.Path != "" && !samePath(acc.Path, a.Path, ac.dir) {
+			continue
+		}
+		matches = append(matches, acc)
+	}
+	switch len(matches) {
+	case 0:
+		return Account{}, ErrNoMatch
+	case 1:
+		return matches[0], nil
+	}
+	return Account{}, &AmbiguousAddrError{Addr: a.Address, Matches: matches}
+}
+
+// samePath 比较两个路径，相对路径视为相对于密钥目录
+func samePath(path, other, dir string) bool {
+	if !filepath.IsAbs(other) {
+		other = filepath.Join(dir, other)
+	}
+	return filepath.Clean(path) == filepath.Clean(other)
+}
+
+// scan 重新扫描密钥目录，返回新增和删除的账户
+func (ac *accountCache) scan() (added, dropped []Account, err error) {
+	infos, err := ioutil.ReadDir(ac.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	files := make(map[string]fileInfo, len(infos))
+	var all []Account
+	for _, fi := range infos {
+		if skipKeyFile(fi) {
+			continue
+		}
+		path := filepath.Join(ac.dir, fi.Name())
+		cached, ok := ac.files[path]
+		if !ok || !cached.modTime.Equal(fi.ModTime()) || cached.size != fi.Size() {
+			cached = fileInfo{modTime: fi.ModTime(), size: fi.Size()}
+			cached.account, cached.ok = readAccount(path)
+		}
+		files[path] = cached
+		if cached.ok {
+			all = append(all, cached.account)
+		}
+	}
+	added = diffAccounts(all, ac.all)
+	dropped = diffAccounts(ac.all, all)
+	ac.all = all
+	ac.files = files
+	return added, dropped, nil
+}
+
+// diffAccounts 返回在a中但不在b中的账户
+func diffAccounts(a, b []Account) []Account {
+	in := make(map[Account]bool, len(b))
+	for _, acc := range b {
+		in[acc] = true
+	}
+	var diff []Account
+	for _, acc := range a {
+		if !in[acc] {
+			diff = append(diff, acc)
+		}
+	}
+	return diff
+}
+
+// skipKeyFile 跳过目录、隐藏文件(如写入中的临时文件)和编辑器的备份文件
+func skipKeyFile(fi os.FileInfo) bool {
+	name := fi.Name()
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+		return true
+	}
+	return !fi.Mode().IsRegular()
+}
+
+// readAccount 读取密钥文件中的地址，文件不是有效的密钥文件时ok为false
+func readAccount(path string) (Account, bool) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Account{}, false
+	}
+	var key struct {
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(buf, &key); err != nil {
+		return Account{}, false
+	}
+	addr, err := hex.DecodeString(strings.TrimPrefix(key.Address, "0x"))
+	if err != nil || len(addr) != ecdsa.AddressLength {
+		return Account{}, false
+	}
+	return Account{Address: ecdsa.BytesToAddress(addr), Path: path}, true
+}
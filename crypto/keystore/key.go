@@ -0,0 +1,112 @@
+// Package keystore 实现了Web3 Secret Storage v3格式的加密密钥文件，以及基于目录的密钥库。
+//
+// 密钥文件中的私钥使用scrypt或pbkdf2从口令派生的密钥做AES-128-CTR加密，
+// 并以Keccak256(派生密钥[16:32] || 密文)作为消息认证码校验口令。
+package keystore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/sea-project/sea-pkg/crypto/ecdsa"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// version 密钥文件的格式版本
+const version = 3
+
+// Key 明文的账户密钥
+type Key struct {
+	Id         string // 密钥文件的UUID
+	Address    ecdsa.Address
+	PrivateKey *ecdsa.PrivateKey
+}
+
+// encryptedKeyJSONV3 v3密钥文件的JSON结构
+type encryptedKeyJSONV3 struct {
+	Address string     `json:"address"`
+	Crypto  CryptoJSON `json:"crypto"`
+	Id      string     `json:"id"`
+	Version int        `json:"version"`
+}
+
+// CryptoJSON 密钥文件中加密私钥的参数和密文
+type CryptoJSON struct {
+	Cipher       string                 `json:"cipher"`
+	CipherText   string                 `json:"ciphertext"`
+	CipherParams cipherparamsJSON       `json:"cipherparams"`
+	KDF          string                 `json:"kdf"`
+	KDFParams    map[string]interface{} `json:"kdfparams"`
+	MAC          string                 `json:"mac"`
+}
+
+type cipherparamsJSON struct {
+	IV string `json:"iv"`
+}
+
+// NewKeyFromECDSA 使用私钥创建密钥，并生成随机的UUID
+func NewKeyFromECDSA(prv *ecdsa.PrivateKey) (*Key, error) {
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &Key{
+		Id:         id,
+		Address:    prv.ToPubKey().ToAddress(),
+		PrivateKey: prv,
+	}, nil
+}
+
+// newKey 随机生成一个密钥
+func newKey() (*Key, error) {
+	prv, _ := ecdsa.GenerateKey()
+	return NewKeyFromECDSA(prv)
+}
+
+// newUUID 返回随机生成的第4版UUID
+func newUUID() (string, error) {
+	var u [16]byte
+	if _, err := io.ReadFull(rand.Reader, u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40 // 版本4
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122变体
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+// zeroKey 将私钥清零
+func zeroKey(k *ecdsa.PrivateKey) {
+	b := k.D.Bits()
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// keyFileName 返回账户密钥文件的文件名，格式为 UTC--<创建时间>--<地址>
+func keyFileName(addr ecdsa.Address) string {
+	ts := time.Now().UTC()
+	return fmt.Sprintf("UTC--%s--%s", ts.Format("2006-01-02T15-04-05.000000000Z"), hex.EncodeToString(addr[:]))
+}
+
+// writeKeyFile 先写入同目录下的隐藏临时文件再重命名，避免其他进程读到不完整的密钥文件
+func writeKeyFile(file string, content []byte) error {
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	f.Close()
+	return os.Rename(f.Name(), file)
+}
@@ -0,0 +1,388 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sea-project/sea-pkg/crypto/ecdsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLocked 账户未解锁
+	ErrLocked = errors.New("account is locked")
+
+	// ErrNoMatch 密钥库中没有该账户
+	ErrNoMatch = errors.New("no key for given address or file")
+
+	// ErrAccountAlreadyExists 导入的账户已在密钥库中
+	ErrAccountAlreadyExists = errors.New("account already exists")
+
+	// ErrClosed 密钥库已关闭
+	ErrClosed = errors.New("keystore is closed")
+)
+
+// watchInterval 轮询密钥目录的时间间隔
+var watchInterval = 2 * time.Second
+
+// AmbiguousAddrError 同一地址对应多个密钥文件
+type AmbiguousAddrError struct {
+	Addr    ecdsa.Address
+	Matches []Account
+}
+
+func (err *AmbiguousAddrError) Error() string {
+	files := ""
+	for i, a := range err.Matches {
+		files += a.Path
+		if i < len(err.Matches)-1 {
+			files += ", "
+		}
+	}
+	return fmt.Sprintf("multiple keys match address (%s)", files)
+}
+
+// unlocked 已解锁的密钥，abort在解锁超时前被重新解锁或锁定时关闭
+type unlocked struct {
+	*Key
+	abort chan struct{}
+}
+
+// KeyStore 管理目录中的v3密钥文件。
+//
+// 密钥库在后台轮询目录，其他进程写入或删除的密钥文件会反映到Accounts中，
+// 并通知通过Subscribe订阅的通道。不再使用时应调用Close停止轮询并锁定所有账户。
+type KeyStore struct {
+	dir              string
+	scryptN, scryptP int
+	cache            *accountCache
+
+	mu       sync.RWMutex
+	unlocked map[ecdsa.Address]*unlocked
+	subs     map[chan<- AccountEvent]struct{}
+	quit     chan struct{}
+	closed   bool
+}
+
+// NewKeyStore 创建以dir为密钥目录的密钥库，新账户使用scryptN、scryptP加密，
+// 如StandardScryptN、StandardScryptP。目录不存在时会创建。
+func NewKeyStore(dir string, scryptN, scryptP int) (*KeyStore, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	ks := &KeyStore{
+		dir:      dir,
+		scryptN:  scryptN,
+		scryptP:  scryptP,
+		cache:    newAccountCache(dir),
+		unlocked: make(map[ecdsa.Address]*unlocked),
+		subs:     make(map[chan<- AccountEvent]struct{}),
+		quit:     make(chan struct{}),
+	}
+	if _, _, err := ks.cache.scan(); err != nil {
+		return nil, err
+	}
+	go ks.watch()
+	return ks, nil
+}
+
+// watch 定时重新扫描密钥目录，直到密钥库关闭
+func (ks *KeyStore) watch() {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ks.quit:
+			return
+		case <-ticker.C:
+			ks.Refresh()
+		}
+	}
+}
+
+// Refresh 立即重新扫描密钥目录，并通知订阅者账户的变化
+func (ks *KeyStore) Refresh() error {
+	added, dropped, err := ks.cache.scan()
+	if err != nil {
+		return err
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, a := range added {
+		ks.notify(AccountEvent{Account: a, Type: AccountAdded})
+	}
+	for _, a := range dropped {
+		ks.notify(AccountEvent{Account: a, Type: AccountDropped})
+	}
+	return nil
+}
+
+// notify 向所有订阅者发送事件，通道已满的订阅者会错过该事件。调用者须持有ks.mu。
+func (ks *KeyStore) notify(ev AccountEvent) {
+	for ch := range ks.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Subscribe 订阅账户的增加和删除事件，返回取消订阅的函数。
+// 发送事件时不会阻塞，应使用带缓冲的通道并及时读取。
+func (ks *KeyStore) Subscribe(ch chan<- AccountEvent) (unsubscribe func()) {
+	ks.mu.Lock()
+	ks.subs[ch] = struct{}{}
+	ks.mu.Unlock()
+	return func() {
+		ks.mu.Lock()
+		delete(ks.subs, ch)
+		ks.mu.Unlock()
+	}
+}
+
+// Close 停止轮询密钥目录并锁定所有账户
+func (ks *KeyStore) Close() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.closed {
+		return
+	}
+	ks.closed = true
+	close(ks.quit)
+	for addr, u := range ks.unlocked {
+		ks.expire(addr, u)
+	}
+}
+
+// Accounts 返回密钥目录中的所有账户
+func (ks *KeyStore) Accounts() []Account {
+	return ks.cache.accounts()
+}
+
+// HasAddress 判断密钥库中是否有该地址的账户
+func (ks *KeyStore) HasAddress(addr ecdsa.Address) bool {
+	_, err := ks.cache.find(Account{Address: addr})
+	return err == nil
+}
+
+// Find 返回地址对应的账户，a.Path不为空时还须匹配密钥文件
+func (ks *KeyStore) Find(a Account) (Account, error) {
+	return ks.cache.find(a)
+}
+
+// NewAccount 生成新的密钥，使用口令加密后写入密钥目录
+func (ks *KeyStore) NewAccount(passphrase string) (Account, error) {
+	key, err := newKey()
+	if err != nil {
+		return Account{}, err
+	}
+	defer zeroKey(key.PrivateKey)
+	return ks.storeKey(key, passphrase)
+}
+
+// ImportECDSA 将私钥使用口令加密后存入密钥库
+func (ks *KeyStore) ImportECDSA(prv *ecdsa.PrivateKey, passphrase string) (Account, error) {
+	key, err := NewKeyFromECDSA(prv)
+	if err != nil {
+		return Account{}, err
+	}
+	if ks.HasAddress(key.Address) {
+		return Account{}, ErrAccountAlreadyExists
+	}
+	return ks.storeKey(key, passphrase)
+}
+
+// Import 导入v3格式的JSON密钥，使用passphrase解密后以newPassphrase重新加密存入密钥库
+func (ks *KeyStore) Import(keyJSON []byte, passphrase, newPassphrase string) (Account, error) {
+	key, err := DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return Account{}, err
+	}
+	defer zeroKey(key.PrivateKey)
+	if ks.HasAddress(key.Address) {
+		return Account{}, ErrAccountAlreadyExists
+	}
+	return ks.storeKey(key, newPassphrase)
+}
+
+// Export 导出账户的密钥，使用passphrase解密后以newPassphrase重新加密
+func (ks *KeyStore) Export(a Account, passphrase, newPassphrase string) ([]byte, error) {
+	a, key, err := ks.getDecryptedKey(a, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key.PrivateKey)
+	return EncryptKey(key, newPassphrase, ks.scryptN, ks.scryptP)
+}
+
+// Update 修改账户密钥文件的口令
+func (ks *KeyStore) Update(a Account, passphrase, newPassphrase string) error {
+	a, key, err := ks.getDecryptedKey(a, passphrase)
+	if err != nil {
+		return err
+	}
+	defer zeroKey(key.PrivateKey)
+	keyJSON, err := EncryptKey(key, newPassphrase, ks.scryptN, ks.scryptP)
+	if err != nil {
+		return err
+	}
+	return writeKeyFile(a.Path, keyJSON)
+}
+
+// Delete 使用口令验证后删除账户的密钥文件
+func (ks *KeyStore) Delete(a Account, passphrase string) error {
+	a, key, err := ks.getDecryptedKey(a, passphrase)
+	if key != nil {
+		zeroKey(key.PrivateKey)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(a.Path); err != nil {
+		return err
+	}
+	ks.mu.Lock()
+	if u, ok := ks.unlocked[a.Address]; ok {
+		ks.expire(a.Address, u)
+	}
+	ks.mu.Unlock()
+	return ks.Refresh()
+}
+
+// Unlock 解锁账户，直到调用Lock或Close
+func (ks *KeyStore) Unlock(a Account, passphrase string) error {
+	return ks.TimedUnlock(a, passphrase, 0)
+}
+
+// TimedUnlock 解锁账户，timeout后自动锁定，timeout为0时一直保持解锁。
+// 账户已限时解锁时重新设置超时时间；已无限期解锁时不改变。
+func (ks *KeyStore) TimedUnlock(a Account, passphrase string, timeout time.Duration) error {
+	a, key, err := ks.getDecryptedKey(a, passphrase)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.closed {
+		zeroKey(key.PrivateKey)
+		return ErrClosed
+	}
+	if u, ok := ks.unlocked[a.Address]; ok {
+		if u.abort == nil {
+			// 已无限期解锁，不缩短为限时解锁
+			zeroKey(key.PrivateKey)
+			return nil
+		}
+		close(u.abort)
+		zeroKey(u.PrivateKey)
+	}
+	u := &unlocked{Key: key}
+	if timeout > 0 {
+		u.abort = make(chan struct{})
+		go ks.expireAfter(a.Address, u, timeout)
+	}
+	ks.unlocked[a.Address] = u
+	return nil
+}
+
+// Lock 锁定账户，清除内存中的私钥
+func (ks *KeyStore) Lock(addr ecdsa.Address) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if u, ok := ks.unlocked[addr]; ok {
+		ks.expire(addr, u)
+	}
+	return nil
+}
+
+// expireAfter 在timeout后锁定账户，u.abort关闭时放弃
+func (ks *KeyStore) expireAfter(addr ecdsa.Address, u *unlocked, timeout time.Duration) {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-u.abort:
+	case <-t.C:
+		ks.mu.Lock()
+		// 只有账户没有在此期间被重新解锁时才锁定
+		if ks.unlocked[addr] == u {
+			ks.expire(addr, u)
+		}
+		ks.mu.Unlock()
+	}
+}
+
+// expire 锁定账户并清除私钥。调用者须持有ks.mu。
+func (ks *KeyStore) expire(addr ecdsa.Address, u *unlocked) {
+	if u.abort != nil {
+		select {
+		case <-u.abort:
+		default:
+			close(u.abort)
+		}
+	}
+	zeroKey(u.PrivateKey)
+	delete(ks.unlocked, addr)
+}
+
+// SignHash 使用已解锁的账户对哈希签名
+func (ks *KeyStore) SignHash(a Account, hash []byte) (*ecdsa.Signature, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	u, ok := ks.unlocked[a.Address]
+	if !ok {
+		return nil, ErrLocked
+	}
+	return u.PrivateKey.Sign(hash)
+}
+
+// SignHashWithPassphrase 使用口令解密账户的密钥并对哈希签名，不改变账户的解锁状态
+func (ks *KeyStore) SignHashWithPassphrase(a Account, passphrase string, hash []byte) (*ecdsa.Signature, error) {
+	_, key, err := ks.getDecryptedKey(a, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key.PrivateKey)
+	return key.PrivateKey.Sign(hash)
+}
+
+// getDecryptedKey 查找账户的密钥文件并使用口令解密
+func (ks *KeyStore) getDecryptedKey(a Account, passphrase string) (Account, *Key, error) {
+	a, err := ks.cache.find(a)
+	if err != nil {
+		return a, nil, err
+	}
+	keyJSON, err := ioutil.ReadFile(a.Path)
+	if err != nil {
+		return a, nil, err
+	}
+	key, err := DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return a, nil, err
+	}
+	if key.Address != a.Address {
+		zeroKey(key.PrivateKey)
+		return a, nil, fmt.Errorf("key content mismatch: have account %x, want %x", key.Address, a.Address)
+	}
+	return a, key, nil
+}
+
+// storeKey 加密密钥并写入新的密钥文件
+func (ks *KeyStore) storeKey(key *Key, passphrase string) (Account, error) {
+	keyJSON, err := EncryptKey(key, passphrase, ks.scryptN, ks.scryptP)
+	if err != nil {
+		return Account{}, err
+	}
+	a := Account{Address: key.Address, Path: filepath.Join(ks.dir, keyFileName(key.Address))}
+	if err := writeKeyFile(a.Path, keyJSON); err != nil {
+		return Account{}, err
+	}
+	return a, ks.Refresh()
+}
@@ -0,0 +1,246 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"github.com/sea-project/sea-pkg/crypto/ecdsa"
+	"github.com/sea-project/sea-pkg/crypto/sha3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Web3 Secret Storage规范中的测试向量，口令均为testpassword
+var v3Vectors = map[string]string{
+	"pbkdf2": `{"crypto":{"cipher":"aes-128-ctr","cipherparams":{"iv":"6087dab2f9fdbbfaddc31a909735c1e6"},"ciphertext":"5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46","kdf":"pbkdf2","kdfparams":{"c":262144,"dklen":32,"prf":"hmac-sha256","salt":"ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"},"mac":"517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"},"id":"3198bc9c-6672-5ab3-d995-4942343ae5b6","version":3}`,
+	"scrypt": `{"crypto":{"cipher":"aes-128-ctr","cipherparams":{"iv":"83dbcc02d8ccb40e466191a123791e0e"},"ciphertext":"d172bf743a674da9cdad04534d56926ef8358534d458fffccd4e6ad2fbde479c","kdf":"scrypt","kdfparams":{"dklen":32,"n":262144,"r":1,"p":8,"salt":"ab0c7876052600dd703518d6fc3fe8984592145b591fc8fb5c6d43190334ba19"},"mac":"2103ac29920d71da29f15d75b4a16dbe95cfd7ff8faea1056c33131d846e3097"},"id":"3198bc9c-6672-5ab3-d995-4942343ae5b6","version":3}`,
+}
+
+func TestDecryptKeyVectors(t *testing.T) {
+	for kdf, keyJSON := range v3Vectors {
+		key, err := DecryptKey([]byte(keyJSON), "testpassword")
+		if err != nil {
+			t.Fatalf("%s: %v", kdf, err)
+		}
+		if got := hex.EncodeToString(key.PrivateKey.D.Bytes()); got != "7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d" {
+			t.Errorf("%s: 私钥 %s", kdf, got)
+		}
+		if got := hex.EncodeToString(key.Address[:]); got != "008aeeda4d805471df9b2a5b0f38a0c3bcba786b" {
+			t.Errorf("%s: 地址 %s", kdf, got)
+		}
+	}
+	if _, err := DecryptKey([]byte(v3Vectors["pbkdf2"]), "wrong"); err != ErrDecrypt {
+		t.Errorf("口令错误: %v", err)
+	}
+}
+
+func TestEncryptKey(t *testing.T) {
+	key, err := newKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyJSON, err := EncryptKey(key, "foo", LightScryptN, LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = DecryptKey(keyJSON, "bar"); err != ErrDecrypt {
+		t.Errorf("口令错误: %v", err)
+	}
+	dec, err := DecryptKey(keyJSON, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec.Id != key.Id || dec.Address != key.Address || dec.PrivateKey.D.Cmp(key.PrivateKey.D) != 0 {
+		t.Errorf("解密得到 %+v, 应为 %+v", dec, key)
+	}
+}
+
+func newTestKeyStore(t *testing.T) (string, *KeyStore) {
+	dir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := NewKeyStore(dir, LightScryptN, LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, ks
+}
+
+func TestKeyStore(t *testing.T) {
+	dir, ks := newTestKeyStore(t)
+	defer os.RemoveAll(dir)
+	defer ks.Close()
+
+	a, err := ks.NewAccount("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(a.Path) != ks.dir {
+		t.Errorf("密钥文件 %s 不在密钥目录中", a.Path)
+	}
+	if accs := ks.Accounts(); len(accs) != 1 || accs[0] != a {
+		t.Fatalf("账户 %v, 应为 [%v]", accs, a)
+	}
+	if !ks.HasAddress(a.Address) {
+		t.Error("HasAddress返回false")
+	}
+
+	hash := sha3.Keccak256([]byte("sea"))
+	if _, err = ks.SignHash(a, hash); err != ErrLocked {
+		t.Fatalf("未解锁时签名: %v", err)
+	}
+	if err = ks.Unlock(a, "bar"); err != ErrDecrypt {
+		t.Fatalf("口令错误时解锁: %v", err)
+	}
+	if err = ks.Unlock(a, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := ks.SignHash(a, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ks.Export(a, "foo", "baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, err := DecryptKey(key, "baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sig.Verify(hash, exported.PrivateKey.ToPubKey()) {
+		t.Error("签名验证失败")
+	}
+	if err = ks.Lock(a.Address); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ks.SignHash(a, hash); err != ErrLocked {
+		t.Errorf("锁定后签名: %v", err)
+	}
+	if _, err = ks.SignHashWithPassphrase(a, "foo", hash); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = ks.Import(key, "baz", "qux"); err != ErrAccountAlreadyExists {
+		t.Errorf("重复导入: %v", err)
+	}
+	if err = ks.Update(a, "foo", "qux"); err != nil {
+		t.Fatal(err)
+	}
+	if err = ks.Delete(a, "foo"); err != ErrDecrypt {
+		t.Errorf("使用旧口令删除: %v", err)
+	}
+	if err = ks.Delete(a, "qux"); err != nil {
+		t.Fatal(err)
+	}
+	if ks.HasAddress(a.Address) {
+		t.Error("删除后账户仍在密钥库中")
+	}
+	imported, err := ks.Import(key, "baz", "qux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Address != a.Address {
+		t.Errorf("导入的账户 %x, 应为 %x", imported.Address, a.Address)
+	}
+}
+
+func TestTimedUnlock(t *testing.T) {
+	dir, ks := newTestKeyStore(t)
+	defer os.RemoveAll(dir)
+	defer ks.Close()
+
+	a, err := ks.NewAccount("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha3.Keccak256([]byte("sea"))
+	if err = ks.TimedUnlock(a, "foo", 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ks.SignHash(a, hash); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if _, err = ks.SignHash(a, hash); err != ErrLocked {
+		t.Fatalf("超时后签名: %v", err)
+	}
+
+	// 重新限时解锁会延长超时时间
+	if err = ks.TimedUnlock(a, "foo", 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err = ks.TimedUnlock(a, "foo", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if _, err = ks.SignHash(a, hash); err != nil {
+		t.Fatalf("延长超时后签名: %v", err)
+	}
+
+	// 无限期解锁后，限时解锁不改变解锁状态
+	if err = ks.Unlock(a, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err = ks.TimedUnlock(a, "foo", 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if _, err = ks.SignHash(a, hash); err != nil {
+		t.Fatalf("无限期解锁后签名: %v", err)
+	}
+}
+
+func TestKeyStoreWatch(t *testing.T) {
+	defer func(d time.Duration) { watchInterval = d }(watchInterval)
+	watchInterval = 20 * time.Millisecond
+	dir, ks := newTestKeyStore(t)
+	defer os.RemoveAll(dir)
+	defer ks.Close()
+
+	events := make(chan AccountEvent, 4)
+	defer ks.Subscribe(events)()
+
+	// 其他进程写入的密钥文件
+	prv, _ := ecdsa.GenerateKey()
+	key, err := NewKeyFromECDSA(prv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyJSON, err := EncryptKey(key, "foo", LightScryptN, LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(ks.dir, keyFileName(key.Address))
+	ioutil.WriteFile(filepath.Join(ks.dir, ".hidden"), keyJSON, 0600)
+	ioutil.WriteFile(filepath.Join(ks.dir, "README"), []byte("not a key"), 0600)
+	if err = ioutil.WriteFile(path, keyJSON, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Account{Address: key.Address, Path: path}
+	wait := func(typ AccountEventType) {
+		select {
+		case ev := <-events:
+			if ev.Type != typ || ev.Account != want {
+				t.Fatalf("事件 %+v, 应为 %v %+v", ev, typ, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("没有收到事件 %v", typ)
+		}
+	}
+	wait(AccountAdded)
+	if accs := ks.Accounts(); len(accs) != 1 || accs[0] != want {
+		t.Fatalf("账户 %v, 应为 [%v]", accs, want)
+	}
+	if err = ks.Unlock(want, "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Remove(path)
+	wait(AccountDropped)
+	if ks.HasAddress(key.Address) {
+		t.Error("密钥文件删除后账户仍在密钥库中")
+	}
+}
@@ -0,0 +1,181 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sea-project/sea-pkg/crypto/aes"
+	"github.com/sea-project/sea-pkg/crypto/ecdsa"
+	"github.com/sea-project/sea-pkg/crypto/sha3"
+	"github.com/sea-project/sea-pkg/util/math"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"io"
+)
+
+const (
+	// StandardScryptN 标准的scrypt参数N，派生一次密钥约需256MB内存和1秒CPU时间
+	StandardScryptN = 1 << 18
+
+	// StandardScryptP 标准的scrypt参数P
+	StandardScryptP = 1
+
+	// LightScryptN 轻量的scrypt参数N，派生一次密钥约需4MB内存和100毫秒CPU时间
+	LightScryptN = 1 << 12
+
+	// LightScryptP 轻量的scrypt参数P
+	LightScryptP = 6
+
+	scryptR     = 8
+	scryptDKLen = 32
+
+	keyCipher = "aes-128-ctr"
+)
+
+var (
+	// ErrDecrypt 口令错误，消息认证码不匹配
+	ErrDecrypt = errors.New("could not decrypt key with given passphrase")
+)
+
+// EncryptKey 使用口令加密密钥，返回v3格式的JSON。scryptN、scryptP为scrypt的CPU/内存开销参数。
+func EncryptKey(key *Key, auth string, scryptN, scryptP int) ([]byte, error) {
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	derivedKey, err := scrypt.Key([]byte(auth), salt, scryptN, scryptR, scryptP, scryptDKLen)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSise)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	keyBytes := math.PaddedBigBytes(key.PrivateKey.D, 32)
+	cipherText, err := aes.AesCTRXOR(derivedKey[:16], keyBytes, iv)
+	if err != nil {
+		return nil, err
+	}
+	mac := sha3.Keccak256(derivedKey[16:32], cipherText)
+
+	cryptoStruct := CryptoJSON{
+		Cipher:       keyCipher,
+		CipherText:   hex.EncodeToString(cipherText),
+		CipherParams: cipherparamsJSON{IV: hex.EncodeToString(iv)},
+		KDF:          "scrypt",
+		KDFParams: map[string]interface{}{
+			"n":     scryptN,
+			"r":     scryptR,
+			"p":     scryptP,
+			"dklen": scryptDKLen,
+			"salt":  hex.EncodeToString(salt),
+		},
+		MAC: hex.EncodeToString(mac),
+	}
+	return json.Marshal(encryptedKeyJSONV3{
+		Address: hex.EncodeToString(key.Address[:]),
+		Crypto:  cryptoStruct,
+		Id:      key.Id,
+		Version: version,
+	})
+}
+
+// DecryptKey 使用口令解密v3格式的JSON密钥，口令错误时返回ErrDecrypt
+func DecryptKey(keyjson []byte, auth string) (*Key, error) {
+	var k encryptedKeyJSONV3
+	if err := json.Unmarshal(keyjson, &k); err != nil {
+		return nil, err
+	}
+	if k.Version != version {
+		return nil, fmt.Errorf("version not supported: %v", k.Version)
+	}
+	keyBytes, err := decryptKeyV3(&k.Crypto, auth)
+	if err != nil {
+		return nil, err
+	}
+	prv, err := ecdsa.ToECDSA(keyBytes, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{
+		Id:         k.Id,
+		Address:    prv.ToPubKey().ToAddress(),
+		PrivateKey: prv,
+	}, nil
+}
+
+// decryptKeyV3 校验消息认证码并解密出私钥
+func decryptKeyV3(c *CryptoJSON, auth string) ([]byte, error) {
+	if c.Cipher != keyCipher {
+		return nil, fmt.Errorf("cipher not supported: %v", c.Cipher)
+	}
+	mac, err := hex.DecodeString(c.MAC)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := hex.DecodeString(c.CipherParams.IV)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSise {
+		return nil, fmt.Errorf("invalid iv length: %d", len(iv))
+	}
+	cipherText, err := hex.DecodeString(c.CipherText)
+	if err != nil {
+		return nil, err
+	}
+	derivedKey, err := kdfKey(c, auth)
+	if err != nil {
+		return nil, err
+	}
+	calculatedMAC := sha3.Keccak256(derivedKey[16:32], cipherText)
+	if subtle.ConstantTimeCompare(calculatedMAC, mac) != 1 {
+		return nil, ErrDecrypt
+	}
+	return aes.AesCTRXOR(derivedKey[:16], cipherText, iv)
+}
+
+// kdfKey 按密钥文件中的KDF参数从口令派生密钥
+func kdfKey(c *CryptoJSON, auth string) ([]byte, error) {
+	salt, err := hex.DecodeString(kdfString(c.KDFParams, "salt"))
+	if err != nil {
+		return nil, err
+	}
+	dkLen := kdfInt(c.KDFParams, "dklen")
+	if dkLen < 32 {
+		return nil, fmt.Errorf("invalid dklen: %d", dkLen)
+	}
+
+	switch c.KDF {
+	case "scrypt":
+		n := kdfInt(c.KDFParams, "n")
+		r := kdfInt(c.KDFParams, "r")
+		p := kdfInt(c.KDFParams, "p")
+		return scrypt.Key([]byte(auth), salt, n, r, p, dkLen)
+	case "pbkdf2":
+		if prf := kdfString(c.KDFParams, "prf"); prf != "hmac-sha256" {
+			return nil, fmt.Errorf("unsupported PBKDF2 PRF: %s", prf)
+		}
+		iter := kdfInt(c.KDFParams, "c")
+		if iter <= 0 {
+			return nil, fmt.Errorf("invalid PBKDF2 iteration count: %d", iter)
+		}
+		return pbkdf2.Key([]byte(auth), salt, iter, dkLen, sha256.New), nil
+	}
+	return nil, fmt.Errorf("unsupported KDF: %s", c.KDF)
+}
+
+// kdfInt 读取KDF的整数参数，JSON中的数字解码为float64
+func kdfInt(params map[string]interface{}, name string) int {
+	f, _ := params[name].(float64)
+	return int(f)
+}
+
+func kdfString(params map[string]interface{}, name string) string {
+	s, _ := params[name].(string)
+	return s
+}
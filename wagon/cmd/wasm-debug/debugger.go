@@ -0,0 +1,504 @@
+// Copyright 2018 The go-interpreter Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/exec"
+	"github.com/sea-project/sea-pkg/wagon/sea"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+// errQuit aborts the execution when the user quits while stopped.
+var errQuit = errors.New("wasm-debug: quit")
+
+type breakpoint struct {
+	fn int64
+	pc int64
+}
+
+// debugger is an exec.Tracer stopping the VM at breakpoints and while
+// stepping, and reading commands from its input while stopped.
+type debugger struct {
+	vm     *exec.VM
+	module *wasm.Module
+	names  []string
+	in     *bufio.Scanner
+	out    io.Writer
+
+	breaks []breakpoint
+	maps   map[int64]*exec.CodeMap
+	frames []int64 // indices of the functions on the call stack
+
+	running   bool
+	quit      bool
+	stepDepth int // stop at the next instruction at a depth up to stepDepth, -1 to run
+	log       *exec.StructLog
+}
+
+func newDebugger(vm *exec.VM, in io.Reader, out io.Writer) *debugger {
+	d := &debugger{
+		vm:        vm,
+		module:    vm.Module(),
+		names:     vm.Module().FunctionNames(),
+		in:        bufio.NewScanner(in),
+		out:       out,
+		maps:      make(map[int64]*exec.CodeMap),
+		stepDepth: -1,
+	}
+	vm.SetTracer(d)
+	vm.RecoverPanic = true
+	return d
+}
+
+// repl reads and runs commands until the input is exhausted or the user
+// quits.
+func (d *debugger) repl() {
+	for !d.quit {
+		fmt.Fprint(d.out, "(wasm-debug) ")
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			return
+		}
+		d.command(d.in.Text())
+	}
+}
+
+// command runs a command line. It returns true if execution resumes.
+func (d *debugger) command(line string) bool {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return false
+	}
+	var err error
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "help", "h":
+		fmt.Fprint(d.out, helpText)
+	case "break", "b":
+		err = d.cmdBreak(args)
+	case "delete", "d":
+		err = d.cmdDelete(args)
+	case "breakpoints", "info":
+		for i, bp := range d.breaks {
+			fmt.Fprintf(d.out, "%d: %s+%d\n", i, d.funcName(bp.fn), bp.pc)
+		}
+	case "run", "r":
+		err = d.cmdRun(args)
+	case "step", "s":
+		return d.resume(math.MaxInt32)
+	case "next", "n":
+		if d.log != nil {
+			return d.resume(d.log.Depth)
+		}
+		return d.resume(math.MaxInt32)
+	case "continue", "c":
+		return d.resume(-1)
+	case "stack":
+		err = d.cmdStack()
+	case "locals":
+		err = d.cmdLocals()
+	case "globals":
+		d.cmdGlobals()
+	case "memory", "mem":
+		err = d.cmdMemory(args)
+	case "disasm", "list", "l":
+		err = d.cmdDisasm(args)
+	case "backtrace", "bt":
+		err = d.cmdBacktrace()
+	case "quit", "q":
+		d.quit = true
+		return true
+	default:
+		err = fmt.Errorf("unknown command %q, try help", cmd)
+	}
+	if err != nil {
+		fmt.Fprintf(d.out, "error: %v\n", err)
+	}
+	return false
+}
+
+const helpText = `commands:
+  break <func>[+<offset>]   set a breakpoint at a compiled code offset of a function, by index or name
+  delete <n>                delete breakpoint n
+  breakpoints               list breakpoints
+  run <func> [args...]      call a function with integer arguments
+  step                      execute one instruction
+  next                      execute one instruction, stepping over calls
+  continue                  run until the next breakpoint
+  stack                     print the value stack
+  locals                    print the locals of the current function
+  globals                   print the globals
+  memory [offset [length]]  print linear memory
+  disasm [func]             print the disassembly of a function
+  backtrace                 print the call stack
+  quit                      quit
+`
+
+func (d *debugger) resume(depth int) bool {
+	if !d.running {
+		fmt.Fprintln(d.out, "error: not running, use run")
+		return false
+	}
+	d.stepDepth = depth
+	return true
+}
+
+func (d *debugger) funcName(fn int64) string {
+	if fn >= 0 && int(fn) < len(d.names) {
+		return d.names[fn]
+	}
+	return fmt.Sprintf("func[%d]", fn)
+}
+
+// parseFunc parses a function index or name.
+func (d *debugger) parseFunc(s string) (int64, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if i < 0 || int(i) >= len(d.names) {
+			return 0, fmt.Errorf("no function at index %d", i)
+		}
+		return i, nil
+	}
+	for i, name := range d.names {
+		if name == s {
+			return int64(i), nil
+		}
+	}
+	return 0, fmt.Errorf("no function named %q", s)
+}
+
+func (d *debugger) codeMap(fn int64) (*exec.CodeMap, error) {
+	if c, ok := d.maps[fn]; ok {
+		return c, nil
+	}
+	c, err := d.vm.CodeMap(fn)
+	if err != nil {
+		return nil, fmt.Errorf("%s has no code", d.funcName(fn))
+	}
+	d.maps[fn] = c
+	return c, nil
+}
+
+func (d *debugger) cmdBreak(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: break <func>[+<offset>]")
+	}
+	name, off := args[0], "0"
+	if i := strings.LastIndexByte(args[0], '+'); i > 0 {
+		name, off = args[0][:i], args[0][i+1:]
+	}
+	fn, err := d.parseFunc(name)
+	if err != nil {
+		return err
+	}
+	pc, err := strconv.ParseInt(off, 0, 64)
+	if err != nil {
+		return fmt.Errorf("invalid offset %q", off)
+	}
+	c, err := d.codeMap(fn)
+	if err != nil {
+		return err
+	}
+	valid := false
+	for _, o := range c.Offsets {
+		valid = valid || o == pc
+	}
+	if !valid {
+		return fmt.Errorf("no instruction starts at %s+%d", d.funcName(fn), pc)
+	}
+	d.breaks = append(d.breaks, breakpoint{fn: fn, pc: pc})
+	fmt.Fprintf(d.out, "breakpoint %d at %s+%d\n", len(d.breaks)-1, d.funcName(fn), pc)
+	return nil
+}
+
+func (d *debugger) cmdDelete(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: delete <n>")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 || n >= len(d.breaks) {
+		return fmt.Errorf("no breakpoint %q", args[0])
+	}
+	d.breaks = append(d.breaks[:n], d.breaks[n+1:]...)
+	return nil
+}
+
+func (d *debugger) cmdRun(args []string) error {
+	if d.running {
+		return errors.New("already running")
+	}
+	if len(args) < 1 {
+		return errors.New("usage: run <func> [args...]")
+	}
+	fn, err := d.parseFunc(args[0])
+	if err != nil {
+		return err
+	}
+	var params []uint64
+	for _, a := range args[1:] {
+		v, err := strconv.ParseInt(a, 0, 64)
+		if err != nil {
+			u, uerr := strconv.ParseUint(a, 0, 64)
+			if uerr != nil {
+				return fmt.Errorf("invalid argument %q", a)
+			}
+			v = int64(u)
+		}
+		params = append(params, uint64(v))
+	}
+
+	d.running = true
+	d.stepDepth = -1
+	res, err := d.vm.ExecCode(fn, params...)
+	d.running = false
+	d.log = nil
+	d.frames = d.frames[:0]
+	if err == errQuit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if res != nil {
+		fmt.Fprintf(d.out, "%s returned %[2]v (%[2]T)\n", d.funcName(fn), res)
+	} else {
+		fmt.Fprintf(d.out, "%s returned\n", d.funcName(fn))
+	}
+	return nil
+}
+
+func (d *debugger) cmdStack() error {
+	if d.log == nil {
+		return errors.New("not stopped")
+	}
+	if len(d.log.Stack) == 0 {
+		fmt.Fprintln(d.out, "<empty>")
+	}
+	for i := len(d.log.Stack) - 1; i >= 0; i-- {
+		v := d.log.Stack[i]
+		fmt.Fprintf(d.out, "%3d: %#x (%d)\n", len(d.log.Stack)-1-i, v, int64(v))
+	}
+	return nil
+}
+
+func (d *debugger) cmdLocals() error {
+	if d.log == nil {
+		return errors.New("not stopped")
+	}
+	types := localTypes(d.module.GetFunction(int(d.log.Func)))
+	for i, v := range d.log.Locals {
+		var typ wasm.ValueType
+		if i < len(types) {
+			typ = types[i]
+		}
+		fmt.Fprintf(d.out, "local[%d] %s = %s\n", i, typ, formatValue(typ, v))
+	}
+	return nil
+}
+
+func (d *debugger) cmdGlobals() {
+	for i, v := range d.vm.Globals() {
+		g := d.module.GetGlobal(i)
+		var typ wasm.ValueType
+		if g != nil {
+			typ = g.Type.Type
+		}
+		fmt.Fprintf(d.out, "global[%d] %s = %s\n", i, typ, formatValue(typ, v))
+	}
+}
+
+func (d *debugger) cmdMemory(args []string) error {
+	mem := d.vm.Memory()
+	if len(args) == 0 {
+		(&sea.WavmMemory{Memory: mem}).Fprint(d.out)
+		return nil
+	}
+	off, err := strconv.ParseUint(args[0], 0, 32)
+	if err != nil {
+		return fmt.Errorf("invalid offset %q", args[0])
+	}
+	n := uint64(64)
+	if len(args) > 1 {
+		if n, err = strconv.ParseUint(args[1], 0, 32); err != nil {
+			return fmt.Errorf("invalid length %q", args[1])
+		}
+	}
+	if off+n > uint64(len(mem)) {
+		return fmt.Errorf("range [%d, %d) out of bounds of memory of %d bytes", off, off+n, len(mem))
+	}
+	for i := off; i < off+n; i += 16 {
+		end := i + 16
+		if end > off+n {
+			end = off + n
+		}
+		fmt.Fprintf(d.out, "%08x: % x\n", i, mem[i:end])
+	}
+	return nil
+}
+
+func (d *debugger) cmdDisasm(args []string) error {
+	var fn int64
+	cur := -1
+	switch {
+	case len(args) > 0:
+		var err error
+		if fn, err = d.parseFunc(args[0]); err != nil {
+			return err
+		}
+	case d.log != nil:
+		fn = d.log.Func
+	default:
+		return errors.New("usage: disasm <func>")
+	}
+	c, err := d.codeMap(fn)
+	if err != nil {
+		return err
+	}
+	if d.log != nil && d.log.Func == fn {
+		cur = c.Lookup(d.log.Pc)
+	}
+	fmt.Fprintf(d.out, "%s:\n", d.funcName(fn))
+	indent := 0
+	for i, instr := range c.Instrs {
+		if instr.Block != nil && !instr.Block.Start && indent > 0 {
+			indent--
+		}
+		mark := "  "
+		if i == cur {
+			mark = "=>"
+		}
+		bp := " "
+		for _, b := range d.breaks {
+			if b.fn == fn && b.pc == c.Offsets[i] {
+				bp = "*"
+			}
+		}
+		off := "-"
+		if c.Offsets[i] >= 0 {
+			off = strconv.FormatInt(c.Offsets[i], 10)
+		}
+		fmt.Fprintf(d.out, "%s%s %6s  %s%s\n", mark, bp, off, strings.Repeat("  ", indent), formatInstr(instr))
+		if instr.Block != nil && instr.Block.Start || instr.Op.Code == ops.Else {
+			indent++
+		}
+	}
+	return nil
+}
+
+func (d *debugger) cmdBacktrace() error {
+	if d.log == nil {
+		return errors.New("not stopped")
+	}
+	for i := len(d.frames) - 1; i >= 0; i-- {
+		fmt.Fprintf(d.out, "#%d %s\n", len(d.frames)-1-i, d.funcName(d.frames[i]))
+	}
+	return nil
+}
+
+// stop prints the current location and reads commands until execution
+// resumes.
+func (d *debugger) stop(log *exec.StructLog) {
+	d.log = log
+	defer func() { d.log = nil }()
+
+	where := fmt.Sprintf("%s+%d", d.funcName(log.Func), log.Pc)
+	if c, err := d.codeMap(log.Func); err == nil && c.Lookup(log.Pc) >= 0 {
+		fmt.Fprintf(d.out, "%s: %s [%s]\n", where, formatInstr(c.Instrs[c.Lookup(log.Pc)]), log.OpName)
+	} else {
+		fmt.Fprintf(d.out, "%s: %s\n", where, log.OpName)
+	}
+	for {
+		fmt.Fprint(d.out, "(wasm-debug) ")
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			d.quit = true
+			break
+		}
+		if d.command(d.in.Text()) {
+			break
+		}
+	}
+	if d.quit {
+		panic(errQuit)
+	}
+}
+
+// CaptureStart implements exec.Tracer.
+func (d *debugger) CaptureStart(fnIndex int64, args []uint64) {
+	d.frames = append(d.frames[:0], fnIndex)
+}
+
+// CaptureStep implements exec.Tracer.
+func (d *debugger) CaptureStep(vm *exec.VM, log *exec.StructLog) {
+	if d.stepDepth >= 0 && log.Depth <= d.stepDepth {
+		d.stop(log)
+		return
+	}
+	for i, bp := range d.breaks {
+		if bp.fn == log.Func && bp.pc == log.Pc {
+			fmt.Fprintf(d.out, "breakpoint %d, ", i)
+			d.stop(log)
+			return
+		}
+	}
+}
+
+// CaptureEnter implements exec.Tracer.
+func (d *debugger) CaptureEnter(depth int, fnIndex int64) {
+	d.frames = append(d.frames, fnIndex)
+}
+
+// CaptureExit implements exec.Tracer.
+func (d *debugger) CaptureExit(depth int, fnIndex int64) {
+	d.frames = d.frames[:len(d.frames)-1]
+}
+
+// CaptureEnd implements exec.Tracer.
+func (d *debugger) CaptureEnd(ret uint64, err error) {}
+
+// localTypes returns the types of the parameters and locals of fn.
+func localTypes(fn *wasm.Function) []wasm.ValueType {
+	if fn == nil || fn.Sig == nil {
+		return nil
+	}
+	types := append([]wasm.ValueType(nil), fn.Sig.ParamTypes...)
+	if fn.Body != nil {
+		for _, entry := range fn.Body.Locals {
+			for i := uint32(0); i < entry.Count; i++ {
+				types = append(types, entry.Type)
+			}
+		}
+	}
+	return types
+}
+
+func formatValue(typ wasm.ValueType, v uint64) string {
+	switch typ {
+	case wasm.ValueTypeI32:
+		return fmt.Sprintf("%d (%#x)", int32(v), uint32(v))
+	case wasm.ValueTypeF32:
+		return fmt.Sprint(math.Float32frombits(uint32(v)))
+	case wasm.ValueTypeF64:
+		return fmt.Sprint(math.Float64frombits(v))
+	default:
+		return fmt.Sprintf("%d (%#x)", int64(v), v)
+	}
+}
+
+func formatInstr(instr disasm.Instr) string {
+	s := instr.Op.Name
+	for _, imm := range instr.Immediates {
+		s += fmt.Sprintf(" %v", imm)
+	}
+	return s
+}
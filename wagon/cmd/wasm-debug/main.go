@@ -0,0 +1,88 @@
+// Copyright 2018 The go-interpreter Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// wasm-debug is an interactive debugger for WebAssembly modules.
+//
+// It loads a module, sets breakpoints on functions, by index or name, and
+// byte offset in their compiled code, single-steps through the compiled
+// code and prints the value stack, locals, globals and linear memory.
+//
+// Usage:
+//
+//	wasm-debug [options] file.wasm
+//
+// Type help at the prompt for the list of commands.
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/sea-project/sea-pkg/wagon/exec"
+	"github.com/sea-project/sea-pkg/wagon/validate"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+func main() {
+	log.SetPrefix("wasm-debug: ")
+	log.SetFlags(0)
+
+	verify := flag.Bool("verify-module", false, "run module verification")
+
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	debug(os.Stdin, os.Stdout, flag.Arg(0), *verify)
+}
+
+func debug(in io.Reader, w io.Writer, fname string, verify bool) {
+	f, err := os.Open(fname)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	m, err := wasm.ReadModule(f, importer)
+	if err != nil {
+		log.Fatalf("could not read module: %v", err)
+	}
+
+	if verify {
+		err = validate.VerifyModule(m)
+		if err != nil {
+			log.Fatalf("could not verify module: %v", err)
+		}
+	}
+
+	vm, err := exec.NewVM(m)
+	if err != nil {
+		log.Fatalf("could not create VM: %v", err)
+	}
+
+	newDebugger(vm, in, w).repl()
+}
+
+func importer(name string) (*wasm.Module, error) {
+	f, err := os.Open(name + ".wasm")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := wasm.ReadModule(f, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = validate.VerifyModule(m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 The go-interpreter Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDebug(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "../../exec/testdata/call.wasm",
+			input: "testdata/call.wasm.in",
+			want:  "testdata/call.wasm.txt",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			in, err := os.Open(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+
+			out := new(bytes.Buffer)
+			debug(in, out, tc.name, true)
+
+			want, err := ioutil.ReadFile(tc.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := string(out.Bytes()), string(want); got != want {
+				t.Fatalf("invalid output.\ngot:\n%s\nwant:\n%s\n", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+// jsonModule is the JSON description of a module printed by -json.
+type jsonModule struct {
+	File      string         `json:"file"`
+	Version   uint32         `json:"version"`
+	Sections  []jsonSection  `json:"sections"`
+	Types     []jsonType     `json:"types"`
+	Imports   []jsonImport   `json:"imports"`
+	Functions []jsonFunction `json:"functions"`
+	Tables    []jsonTable    `json:"tables"`
+	Memories  []jsonLimits   `json:"memories"`
+	Globals   []jsonGlobal   `json:"globals"`
+	Exports   []jsonExport   `json:"exports"`
+	Start     *uint32        `json:"start,omitempty"`
+	Elements  []jsonElement  `json:"elements"`
+	Data      []jsonData     `json:"data"`
+}
+
+type jsonSection struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"` // name of a custom section
+	Start int64  `json:"start"`
+	End   int64  `json:"end"`
+	Size  uint32 `json:"size"`
+}
+
+type jsonType struct {
+	Index   int      `json:"index"`
+	Params  []string `json:"params"`
+	Results []string `json:"results"`
+}
+
+type jsonImport struct {
+	Module string      `json:"module"`
+	Field  string      `json:"field"`
+	Kind   string      `json:"kind"`
+	Type   *uint32     `json:"type,omitempty"`   // signature of a function
+	Global *jsonGlobal `json:"global,omitempty"` // type of a global
+	Table  *jsonTable  `json:"table,omitempty"`
+	Memory *jsonLimits `json:"memory,omitempty"`
+}
+
+type jsonFunction struct {
+	Index  int         `json:"index"` // index in the function index space
+	Name   string      `json:"name,omitempty"`
+	Type   uint32      `json:"type"`
+	Locals []string    `json:"locals"`
+	Code   []jsonInstr `json:"code"`
+}
+
+// jsonInstr is an instruction at the byte offset Offset of the code of its
+// function, following the local declarations.
+type jsonInstr struct {
+	Offset     int           `json:"offset"`
+	Op         string        `json:"op"`
+	Immediates []interface{} `json:"immediates,omitempty"`
+}
+
+type jsonLimits struct {
+	Initial uint32  `json:"initial"`
+	Maximum *uint32 `json:"maximum,omitempty"`
+}
+
+type jsonTable struct {
+	ElementType string `json:"element_type"`
+	jsonLimits
+}
+
+type jsonGlobal struct {
+	Index   *int       `json:"index,omitempty"`
+	Type    string     `json:"type"`
+	Mutable bool       `json:"mutable"`
+	Init    *jsonValue `json:"init,omitempty"`
+}
+
+// jsonValue is the value of an initializer expression, or the error
+// evaluating it, such as a reference to an imported global.
+type jsonValue struct {
+	Type  string      `json:"type,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+type jsonExport struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Index uint32 `json:"index"`
+}
+
+type jsonElement struct {
+	Table  uint32     `json:"table"`
+	Offset *jsonValue `json:"offset"`
+	Elems  []uint32   `json:"elems"`
+}
+
+type jsonData struct {
+	Memory uint32     `json:"memory"`
+	Offset *jsonValue `json:"offset"`
+	Size   int        `json:"size"`
+	Data   string     `json:"data"` // hexadecimal
+}
+
+func printJSON(w io.Writer, fname string, m *wasm.Module) {
+	out, err := newJSONModule(fname, m)
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func newJSONModule(fname string, m *wasm.Module) (*jsonModule, error) {
+	out := &jsonModule{
+		File:      fname,
+		Version:   m.Version,
+		Sections:  []jsonSection{},
+		Types:     []jsonType{},
+		Imports:   []jsonImport{},
+		Functions: []jsonFunction{},
+		Tables:    []jsonTable{},
+		Memories:  []jsonLimits{},
+		Globals:   []jsonGlobal{},
+		Exports:   []jsonExport{},
+		Elements:  []jsonElement{},
+		Data:      []jsonData{},
+	}
+	for _, raw := range rawSections(m) {
+		out.Sections = append(out.Sections, jsonSection{
+			ID:    raw.ID.String(),
+			Name:  raw.Name,
+			Start: raw.Start,
+			End:   raw.End,
+			Size:  raw.PayloadLen,
+		})
+	}
+
+	if sec := m.Types; sec != nil {
+		for i, sig := range sec.Entries {
+			out.Types = append(out.Types, jsonType{
+				Index:   i,
+				Params:  valueTypes(sig.ParamTypes),
+				Results: valueTypes(sig.ReturnTypes),
+			})
+		}
+	}
+
+	nfuncs := 0
+	if sec := m.Import; sec != nil {
+		for _, e := range sec.Entries {
+			imp := jsonImport{Module: e.ModuleName, Field: e.FieldName, Kind: e.Type.Kind().String()}
+			switch typ := e.Type.(type) {
+			case wasm.FuncImport:
+				idx := typ.Type
+				imp.Type = &idx
+				nfuncs++
+			case wasm.GlobalVarImport:
+				imp.Global = &jsonGlobal{Type: typ.Type.Type.String(), Mutable: typ.Type.Mutable}
+			case wasm.TableImport:
+				t := newJSONTable(typ.Type)
+				imp.Table = &t
+			case wasm.MemoryImport:
+				l := newJSONLimits(typ.Type.Limits)
+				imp.Memory = &l
+			}
+			out.Imports = append(out.Imports, imp)
+		}
+	}
+
+	var names wasm.NameMap
+	if ns, err := m.Names(); err == nil && ns != nil {
+		names = ns.Functions
+	}
+	if m.Function != nil && m.Code != nil {
+		for i, typ := range m.Function.Types {
+			fn := jsonFunction{Index: nfuncs + i, Name: names[uint32(nfuncs+i)], Type: typ, Locals: []string{}}
+			if i < len(m.Code.Bodies) {
+				for _, l := range m.Code.Bodies[i].Locals {
+					for j := uint32(0); j < l.Count; j++ {
+						fn.Locals = append(fn.Locals, l.Type.String())
+					}
+				}
+			}
+			code, err := disassemble(m, i)
+			if err != nil {
+				return nil, err
+			}
+			fn.Code = code
+			out.Functions = append(out.Functions, fn)
+		}
+	}
+
+	if sec := m.Table; sec != nil {
+		for _, t := range sec.Entries {
+			out.Tables = append(out.Tables, newJSONTable(t))
+		}
+	}
+	if sec := m.Memory; sec != nil {
+		for _, mem := range sec.Entries {
+			out.Memories = append(out.Memories, newJSONLimits(mem.Limits))
+		}
+	}
+	if sec := m.Global; sec != nil {
+		for i, g := range sec.Globals {
+			i := i
+			out.Globals = append(out.Globals, jsonGlobal{
+				Index:   &i,
+				Type:    g.Type.Type.String(),
+				Mutable: g.Type.Mutable,
+				Init:    initValue(m, g.Init),
+			})
+		}
+	}
+	if sec := m.Export; sec != nil {
+		for name, e := range sec.Entries {
+			out.Exports = append(out.Exports, jsonExport{Name: name, Kind: e.Kind.String(), Index: e.Index})
+		}
+		sort.Slice(out.Exports, func(i, j int) bool { return out.Exports[i].Name < out.Exports[j].Name })
+	}
+	if sec := m.Start; sec != nil {
+		idx := sec.Index
+		out.Start = &idx
+	}
+	if sec := m.Elements; sec != nil {
+		for _, e := range sec.Entries {
+			elems := e.Elems
+			if elems == nil {
+				elems = []uint32{}
+			}
+			out.Elements = append(out.Elements, jsonElement{Table: e.Index, Offset: initValue(m, e.Offset), Elems: elems})
+		}
+	}
+	if sec := m.Data; sec != nil {
+		for _, e := range sec.Entries {
+			out.Data = append(out.Data, jsonData{
+				Memory: e.Index,
+				Offset: initValue(m, e.Offset),
+				Size:   len(e.Data),
+				Data:   hex.EncodeToString(e.Data),
+			})
+		}
+	}
+	return out, nil
+}
+
+// disassemble returns the instructions of the i-th function body of m.
+func disassemble(m *wasm.Module, i int) ([]jsonInstr, error) {
+	code := []jsonInstr{}
+	f := m.GetFunction(i)
+	if f == nil || f.Body == nil {
+		return code, nil
+	}
+	dis, err := disasm.Disassemble(*f, m)
+	if err != nil {
+		return nil, err
+	}
+	for k, ins := range dis.Code {
+		jins := jsonInstr{Offset: dis.Offsets[k], Op: ins.Op.Name}
+		for _, im := range ins.Immediates {
+			jins.Immediates = append(jins.Immediates, jsonNumber(im))
+		}
+		code = append(code, jins)
+	}
+	// the disassembly omits the end of the body.
+	return append(code, jsonInstr{Offset: len(f.Body.Code), Op: "end"}), nil
+}
+
+// initValue evaluates the initializer expression expr.
+func initValue(m *wasm.Module, expr []byte) *jsonValue {
+	v, err := m.ExecInitExpr(expr)
+	if err != nil {
+		return &jsonValue{Error: err.Error()}
+	}
+	var typ wasm.ValueType
+	switch v.(type) {
+	case int32:
+		typ = wasm.ValueTypeI32
+	case int64:
+		typ = wasm.ValueTypeI64
+	case float32:
+		typ = wasm.ValueTypeF32
+	case float64:
+		typ = wasm.ValueTypeF64
+	}
+	return &jsonValue{Type: typ.String(), Value: jsonNumber(v)}
+}
+
+// jsonNumber returns v in a form encoding/json can marshal: block types are
+// named, and non-finite floats are written as strings.
+func jsonNumber(v interface{}) interface{} {
+	switch v := v.(type) {
+	case wasm.BlockType:
+		return v.String()
+	case float32:
+		if f := float64(v); math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Sprint(v)
+		}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Sprint(v)
+		}
+	}
+	return v
+}
+
+func valueTypes(types []wasm.ValueType) []string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.String()
+	}
+	return names
+}
+
+func newJSONLimits(l wasm.ResizableLimits) jsonLimits {
+	jl := jsonLimits{Initial: l.Initial}
+	if l.HasMaximum() {
+		max := l.Maximum
+		jl.Maximum = &max
+	}
+	return jl
+}
+
+func newJSONTable(t wasm.Table) jsonTable {
+	return jsonTable{ElementType: t.ElementType.String(), jsonLimits: newJSONLimits(t.Limits)}
+}
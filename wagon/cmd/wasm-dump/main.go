@@ -44,6 +44,7 @@ var (
 	flagFull    = flag.Bool("s", false, "print raw section contents")
 	flagDis     = flag.Bool("d", false, "disassemble function bodies")
 	flagDetails = flag.Bool("x", false, "show section details")
+	flagJSON    = flag.Bool("json", false, "print the decoded module as JSON")
 )
 
 func main() {
@@ -57,10 +58,10 @@ func main() {
 		os.Exit(1)
 	}
 
-	if !*flagHeaders && !*flagFull && !*flagDis && !*flagDetails {
+	if !*flagHeaders && !*flagFull && !*flagDis && !*flagDetails && !*flagJSON {
 		flag.Usage()
 		flag.PrintDefaults()
-		log.Printf("At least one of -d, -h, -x or -s must be given")
+		log.Printf("At least one of -d, -h, -x, -s or -json must be given")
 		os.Exit(1)
 	}
 
@@ -68,7 +69,7 @@ func main() {
 
 	w := os.Stdout
 	for i, fname := range flag.Args() {
-		if i > 0 {
+		if i > 0 && !*flagJSON {
 			fmt.Fprintf(w, "\n")
 		}
 		process(w, fname)
@@ -87,6 +88,10 @@ func process(w io.Writer, fname string) {
 		log.Fatalf("could not read module: %v", err)
 	}
 
+	if *flagJSON {
+		printJSON(w, f.Name(), m)
+		return
+	}
 	if *flagHeaders {
 		printHeaders(w, f.Name(), m)
 	}
@@ -197,6 +202,14 @@ func printFull(w io.Writer, fname string, m *wasm.Module) {
 	fmt.Fprintf(w, "%s: module version: %#x\n\n", fname, m.Version)
 
 	hdrfmt := "contents of section %s:\n"
+	for _, sec := range rawSections(m) {
+		fmt.Fprintf(w, hdrfmt, sec.ID.String())
+		fmt.Fprintln(w, hexDump(sec.Bytes, uint(sec.Start)))
+	}
+}
+
+// rawSections returns the sections of m, custom sections last.
+func rawSections(m *wasm.Module) []*wasm.RawSection {
 	var sections []*wasm.RawSection
 
 	if sec := m.Types; sec != nil {
@@ -235,11 +248,7 @@ func printFull(w io.Writer, fname string, m *wasm.Module) {
 	for i := range m.Other {
 		sections = append(sections, &m.Other[i])
 	}
-
-	for _, sec := range sections {
-		fmt.Fprintf(w, hdrfmt, sec.ID.String())
-		fmt.Fprintln(w, hexDump(sec.Bytes, uint(sec.Start)))
-	}
+	return sections
 }
 
 func printDis(w io.Writer, fname string, m *wasm.Module) {
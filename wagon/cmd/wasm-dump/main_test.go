@@ -6,9 +6,17 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"io/ioutil"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/builder"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
 )
 
 func TestProcess(t *testing.T) {
@@ -50,3 +58,109 @@ func TestProcess(t *testing.T) {
 		})
 	}
 }
+
+func TestJSON(t *testing.T) {
+	i32 := wasm.ValueTypeI32
+	sig := wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{i32}, ReturnTypes: []wasm.ValueType{i32}}
+	b := builder.New().
+		AddImport("env", "double", sig).
+		AddGlobal("base", true, int32(-7)).
+		AddMemory(wasm.ResizableLimits{Flags: 1, Initial: 1, Maximum: 2}).
+		AddData(16, []byte{0xca, 0xfe})
+	b.AddFunction("main", sig, []wasm.ValueType{i32}, []disasm.Instr{
+		builder.Instr(ops.GetLocal, uint32(0)),
+		builder.Instr(ops.I32Const, int32(1000)),
+		builder.Instr(ops.I32Add),
+		builder.Instr(ops.Call, b.Function("env.double")),
+	}).
+		Export("main", wasm.ExternalFunction, b.Function("main")).
+		Export("memory", wasm.ExternalMemory, 0)
+	raw, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.ReadModule(bytes.NewReader(raw), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	printJSON(buf, "main.wasm", m)
+	var got jsonModule
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.Bytes())
+	}
+
+	if len(got.Imports) != 1 || got.Imports[0].Module != "env" || got.Imports[0].Kind != "function" {
+		t.Errorf("got imports %+v", got.Imports)
+	}
+	if len(got.Globals) != 1 || got.Globals[0].Init == nil || got.Globals[0].Init.Type != "i32" || got.Globals[0].Init.Value != -7.0 {
+		t.Errorf("got globals %+v", got.Globals)
+	}
+	if len(got.Memories) != 1 || got.Memories[0].Maximum == nil || *got.Memories[0].Maximum != 2 {
+		t.Errorf("got memories %+v", got.Memories)
+	}
+	if len(got.Data) != 1 || got.Data[0].Data != "cafe" || got.Data[0].Offset.Value != 16.0 {
+		t.Errorf("got data %+v", got.Data)
+	}
+	if len(got.Exports) != 2 || got.Exports[0].Name != "main" || got.Exports[1].Kind != "memory" {
+		t.Errorf("got exports %+v", got.Exports)
+	}
+	if n := len(got.Sections); n != 9 {
+		t.Errorf("got %d sections, want 9", n)
+	}
+
+	if len(got.Functions) != 1 {
+		t.Fatalf("got %d functions, want 1", len(got.Functions))
+	}
+	fn := got.Functions[0]
+	if fn.Index != 1 || fn.Name != "main" || len(fn.Locals) != 1 {
+		t.Errorf("got function %+v", fn)
+	}
+	code := m.Code.Bodies[0].Code
+	var names []string
+	for _, ins := range fn.Code {
+		names = append(names, ins.Op)
+		if ins.Offset > len(code) {
+			t.Errorf("%s: offset %d out of the body", ins.Op, ins.Offset)
+		}
+	}
+	want := "get_local i32.const i32.add call end"
+	if strings.Join(names, " ") != want {
+		t.Errorf("got code %v, want %s", names, want)
+	}
+	// offsets follow the encoding of the instructions.
+	if fn.Code[2].Offset != 5 || code[5] != 0x6a {
+		t.Errorf("got i32.add at offset %d", fn.Code[2].Offset)
+	}
+
+	// an immediate padded to 5 bytes, as emitted by wasm-ld, moves the
+	// following instructions.
+	dec, err := wasm.DecodeModule(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := &dec.Code.Bodies[0]
+	body.Code = append([]byte{ops.GetLocal, 0, ops.I32Const, 0xe8, 0x87, 0x80, 0x80, 0x00}, body.Code[5:]...)
+	buf.Reset()
+	if err = wasm.EncodeModule(buf, dec); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = wasm.ReadModule(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	printJSON(buf, "main.wasm", m)
+	got = jsonModule{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.Bytes())
+	}
+	code = m.Code.Bodies[0].Code
+	var offsets []int
+	for _, ins := range got.Functions[0].Code {
+		offsets = append(offsets, ins.Offset)
+	}
+	if want := []int{0, 2, 8, 9, len(code)}; !reflect.DeepEqual(offsets, want) || code[8] != 0x6a {
+		t.Errorf("got offsets %v, want %v", offsets, want)
+	}
+}
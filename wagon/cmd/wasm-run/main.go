@@ -13,6 +13,7 @@ import (
 
 	"github.com/sea-project/sea-pkg/wagon/exec"
 	"github.com/sea-project/sea-pkg/wagon/validate"
+	"github.com/sea-project/sea-pkg/wagon/wasi"
 	"github.com/sea-project/sea-pkg/wagon/wasm"
 )
 
@@ -22,6 +23,9 @@ func main() {
 
 	verbose := flag.Bool("v", false, "enable/disable verbose mode")
 	verify := flag.Bool("verify-module", false, "run module verification")
+	wasiMode := flag.Bool("wasi", false, "run the _start function of a WASI module, passing it the remaining arguments")
+	dir := flag.String("dir", "", "host directory preopened as / by a WASI module")
+	deterministic := flag.Bool("deterministic", false, "use deterministic clocks and random source in a WASI module")
 
 	flag.Parse()
 
@@ -33,6 +37,10 @@ func main() {
 
 	wasm.SetDebugMode(*verbose)
 
+	if *wasiMode {
+		os.Exit(runWASI(os.Stdout, os.Stderr, flag.Args(), *dir, *deterministic, *verify))
+	}
+
 	run(os.Stdout, flag.Arg(0), *verify)
 }
 
@@ -95,6 +103,59 @@ func run(w io.Writer, fname string, verify bool) {
 	}
 }
 
+// runWASI runs the WASI module args[0] with the arguments args, and returns
+// its exit status.
+func runWASI(stdout, stderr io.Writer, args []string, dir string, deterministic, verify bool) int {
+	cfg := wasi.Config{
+		Args:          args,
+		Stdin:         os.Stdin,
+		Stdout:        stdout,
+		Stderr:        stderr,
+		Deterministic: deterministic,
+	}
+	if dir != "" {
+		fs, err := wasi.DirFS(dir)
+		if err != nil {
+			log.Fatalf("could not open directory: %v", err)
+		}
+		cfg.FS = fs
+	}
+	w := wasi.New(cfg)
+	reg := exec.NewHostRegistry()
+	if err := reg.Register(w.HostModule()); err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	m, err := wasm.ReadModule(f, reg.Resolver(importer))
+	if err != nil {
+		log.Fatalf("could not read module: %v", err)
+	}
+
+	if verify {
+		err = validate.VerifyModule(m)
+		if err != nil {
+			log.Fatalf("could not verify module: %v", err)
+		}
+	}
+
+	vm, err := exec.NewVM(m)
+	if err != nil {
+		log.Fatalf("could not create VM: %v", err)
+	}
+	code, err := w.Run(vm)
+	if err != nil {
+		log.Printf("err=%v", err)
+		return 1
+	}
+	return int(code)
+}
+
 func importer(name string) (*wasm.Module, error) {
 	f, err := os.Open(name + ".wasm")
 	if err != nil {
@@ -41,3 +41,15 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRunWASI(t *testing.T) {
+	fname := "testdata/hello-wasi.wasm"
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	// fd_write returns 0, passed to proc_exit.
+	if code := runWASI(stdout, stderr, []string{fname}, "", true, true); code != 0 {
+		t.Errorf("got exit status %d, want 0", code)
+	}
+	if stdout.String() != "hello\n" {
+		t.Errorf("got output %q", stdout.String())
+	}
+}
@@ -0,0 +1,15 @@
+;; a WASI command writing "hello\n" to stdout with fd_write, and exiting
+;; with the errno it returned.
+(module
+  (import "wasi_snapshot_preview1" "fd_write" (func $fd_write (param i32 i32 i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "proc_exit" (func $proc_exit (param i32)))
+  (memory (export "memory") 1)
+
+  ;; a single iovec at 0 pointing to the 6 bytes at 100.
+  (data (i32.const 0) "\64\00\00\00\06\00\00\00")
+  (data (i32.const 100) "hello\n")
+
+  (func $_start (export "_start")
+    (call $proc_exit (call $fd_write (i32.const 1) (i32.const 0) (i32.const 1) (i32.const 16)))
+  )
+)
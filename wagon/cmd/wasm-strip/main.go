@@ -0,0 +1,107 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// wasm-strip removes the unreachable functions and the custom sections of
+// WebAssembly modules.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/transform"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: wasm-strip [options] file1.wasm [file2.wasm [...]]
+
+Removes the functions not reachable from the exports, the start function and
+the element segments of each module, and its custom sections. The modules are
+rewritten in place, unless -o is given.
+
+ex:
+ $> wasm-strip -keep name -o out.wasm ./file1.wasm
+
+options:
+`,
+		)
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+}
+
+var (
+	flagVerbose = flag.Bool("v", false, "print what was removed from each module")
+	flagOutput  = flag.String("o", "", "output file, for a single module")
+	flagKeep    = flag.String("keep", "", "comma-separated names of the custom sections to keep")
+	flagNoDCE   = flag.Bool("no-dce", false, "keep the unreachable functions")
+)
+
+func main() {
+	log.SetPrefix("wasm-strip: ")
+	log.SetFlags(0)
+
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+	}
+	if *flagOutput != "" && flag.NArg() > 1 {
+		log.Fatal("-o requires a single module")
+	}
+
+	opts := transform.Options{KeepFunctions: *flagNoDCE}
+	if *flagKeep != "" {
+		opts.KeepSections = strings.Split(*flagKeep, ",")
+	}
+	for _, fname := range flag.Args() {
+		out := *flagOutput
+		if out == "" {
+			out = fname
+		}
+		if err := stripFile(fname, out, opts); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func stripFile(fname, out string, opts transform.Options) error {
+	raw, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	stripped, stats, err := strip(raw, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %v", fname, err)
+	}
+	if *flagVerbose {
+		log.Printf("%s: removed %d functions and %d custom sections, %d -> %d bytes",
+			fname, stats.Functions, stats.Sections, len(raw), len(stripped))
+	}
+	return ioutil.WriteFile(out, stripped, 0644)
+}
+
+// strip returns the module encoded in raw stripped according to opts.
+func strip(raw []byte, opts transform.Options) ([]byte, transform.Stats, error) {
+	m, err := wasm.DecodeModule(bytes.NewReader(raw))
+	if err != nil {
+		return nil, transform.Stats{}, err
+	}
+	stats, err := transform.Strip(m, opts)
+	if err != nil {
+		return nil, stats, err
+	}
+	buf := new(bytes.Buffer)
+	if err = wasm.EncodeModule(buf, m); err != nil {
+		return nil, stats, err
+	}
+	return buf.Bytes(), stats, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 The go-interpreter Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/builder"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+	"github.com/sea-project/sea-pkg/wagon/wasm/transform"
+)
+
+func TestStrip(t *testing.T) {
+	retI32 := wasm.FunctionSig{Form: 0, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}
+	b := builder.New().
+		AddFunction("unused", retI32, nil, []disasm.Instr{builder.Instr(ops.I32Const, int32(0))}).
+		AddFunction("answer", retI32, nil, []disasm.Instr{builder.Instr(ops.I32Const, int32(42))})
+	b.Export("answer", wasm.ExternalFunction, b.Function("answer"))
+	raw, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "wasm-strip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, out := filepath.Join(dir, "in.wasm"), filepath.Join(dir, "out.wasm")
+	if err = ioutil.WriteFile(in, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = stripFile(in, out, transform.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	stripped, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stripped) >= len(raw) {
+		t.Errorf("stripped module has %d bytes, not less than %d", len(stripped), len(raw))
+	}
+	m, err := wasm.ReadModule(bytes.NewReader(stripped), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.FunctionIndexSpace) != 1 || m.Export.Entries["answer"].Index != 0 || m.Other != nil {
+		t.Errorf("got %d functions, export %v, custom sections %v",
+			len(m.FunctionIndexSpace), m.Export.Entries["answer"], m.Other)
+	}
+}
+
+func TestStripTestdata(t *testing.T) {
+	files, err := filepath.Glob("../../exec/testdata/*.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fname := range files {
+		raw, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stripped, _, err := strip(raw, transform.Options{})
+		if err != nil {
+			t.Errorf("%s: %v", fname, err)
+			continue
+		}
+		// stripping is idempotent.
+		again, stats, err := strip(stripped, transform.Options{})
+		if err != nil {
+			t.Errorf("%s: stripping again: %v", fname, err)
+			continue
+		}
+		if stats != (transform.Stats{}) || !bytes.Equal(again, stripped) {
+			t.Errorf("%s: stripping again removed %+v", fname, stats)
+		}
+	}
+}
@@ -67,7 +67,8 @@ type BlockInfo struct {
 // Disassembly is the result of disassembling a WebAssembly function.
 type Disassembly struct {
 	Code     []Instr
-	MaxDepth int // The maximum stack depth that can be reached while executing this function
+	Offsets  []int // The offset of each instruction of Code in the function body
+	MaxDepth int   // The maximum stack depth that can be reached while executing this function
 }
 
 func (d *Disassembly) checkMaxDepth(depth int) {
@@ -107,6 +108,9 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 	var lastOpReturn bool
 
 	for {
+		// the offset is taken from the body, as the immediates of the
+		// instruction may not be minimally encoded.
+		pos := len(code) - reader.Len()
 		op, err := reader.ReadByte()
 		if err == io.EOF {
 			break
@@ -451,6 +455,7 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 		}
 
 		disas.Code = append(disas.Code, instr)
+		disas.Offsets = append(disas.Offsets, pos)
 		curIndex++
 	}
 
@@ -0,0 +1,35 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package disasm_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+func TestDisassembleOffsets(t *testing.T) {
+	fn := wasm.Function{
+		Sig: &wasm.FunctionSig{Form: 0},
+		Body: &wasm.FunctionBody{Code: []byte{
+			0x41, 0x81, 0x80, 0x80, 0x80, 0x00, // i32.const 1, padded to 5 bytes
+			0x1a,       // drop
+			0x41, 0x02, // i32.const 2
+			0x1a, // drop
+		}},
+	}
+	d, err := disasm.Disassemble(fn, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 6, 7, 9}; !reflect.DeepEqual(d.Offsets, want) {
+		t.Errorf("got offsets %v, want %v", d.Offsets, want)
+	}
+	if len(d.Offsets) != len(d.Code) {
+		t.Errorf("got %d offsets for %d instructions", len(d.Offsets), len(d.Code))
+	}
+}
@@ -20,7 +20,9 @@ var (
 func (vm *VM) call() {
 	index := vm.fetchUint32()
 
+	vm.captureEnter(int64(index))
 	vm.funcs[index].call(vm, int64(index))
+	vm.captureExit(int64(index))
 }
 
 func (vm *VM) callIndirect() {
@@ -28,10 +30,13 @@ func (vm *VM) callIndirect() {
 	fnExpect := vm.module.Types.Entries[index]
 	_ = vm.fetchUint32() // reserved (https://github.com/WebAssembly/design/blob/27ac254c854994103c24834a994be16f74f54186/BinaryEncoding.md#call-operators-described-here)
 	tableIndex := vm.popUint32()
-	if int(tableIndex) >= len(vm.module.TableIndexSpace[0]) {
+	if len(vm.tables) == 0 {
+		panic(ErrUndefinedElementIndex)
+	}
+	elemIndex, ok := vm.tables[0].Get(tableIndex)
+	if !ok {
 		panic(ErrUndefinedElementIndex)
 	}
-	elemIndex := vm.module.TableIndexSpace[0][tableIndex]
 	fnActual := vm.module.FunctionIndexSpace[elemIndex]
 
 	if len(fnExpect.ParamTypes) != len(fnActual.Sig.ParamTypes) {
@@ -53,5 +58,7 @@ func (vm *VM) callIndirect() {
 		}
 	}
 
+	vm.captureEnter(int64(elemIndex))
 	vm.funcs[elemIndex].call(vm, int64(elemIndex))
+	vm.captureExit(int64(elemIndex))
 }
@@ -0,0 +1,88 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	stdctx "context"
+	"sync/atomic"
+)
+
+// CanceledError is the error value used while trapping the VM when the
+// context of ExecCodeContext or ExecContractCodeContext is done. Err is the
+// error of the context, context.Canceled or context.DeadlineExceeded.
+type CanceledError struct {
+	Err error
+}
+
+func (e CanceledError) Error() string {
+	return "exec: execution canceled: " + e.Err.Error()
+}
+
+func (e CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// ExecCodeContext is like ExecCode, and stops the execution with a
+// CanceledError when ctx is done. The context is checked at backward
+// branches and function calls, so a running loop or recursion is stopped
+// shortly after, while a host function is not interrupted. The error is
+// returned whatever RecoverPanic is.
+func (vm *VM) ExecCodeContext(ctx stdctx.Context, fnIndex int64, args ...uint64) (rtrn interface{}, err error) {
+	defer vm.watch(ctx)()
+	defer recoverCanceled(&err)
+	return vm.ExecCode(fnIndex, args...)
+}
+
+// ExecContractCodeContext is like ExecContractCode, and stops the execution
+// with a CanceledError when ctx is done, like ExecCodeContext.
+func (vm *VM) ExecContractCodeContext(ctx stdctx.Context, fnIndex int64, args ...uint64) (ret uint64, err error) {
+	defer vm.watch(ctx)()
+	defer recoverCanceled(&err)
+	return vm.ExecContractCode(fnIndex, args...)
+}
+
+// recoverCanceled turns a panic with a CanceledError into a returned error.
+func recoverCanceled(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(CanceledError)
+		if !ok {
+			panic(r)
+		}
+		*err = e
+	}
+}
+
+// watch makes the VM stop when ctx is done, until the returned function is
+// called.
+func (vm *VM) watch(ctx stdctx.Context) func() {
+	atomic.StoreUint32(&vm.interrupted, 0)
+	vm.cancelCtx = ctx
+	if ctx.Done() == nil {
+		return func() { vm.cancelCtx = nil }
+	}
+	stop := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			atomic.StoreUint32(&vm.interrupted, 1)
+		case <-stop:
+		}
+	}()
+	return func() {
+		close(stop)
+		<-exited
+		atomic.StoreUint32(&vm.interrupted, 0)
+		vm.cancelCtx = nil
+	}
+}
+
+// checkInterrupt traps the VM if the context of the execution is done.
+func (vm *VM) checkInterrupt() {
+	if atomic.LoadUint32(&vm.interrupted) != 0 {
+		panic(CanceledError{vm.cancelCtx.Err()})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	stdctx "context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/sea"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/builder"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+// loopModule returns a module with a function "spin" looping forever, and
+// a function "answer" returning 42.
+func loopModule(t *testing.T) *wasm.Module {
+	retI32 := wasm.FunctionSig{Form: 0, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}
+	b := builder.New().
+		AddFunction("answer", retI32, nil, []disasm.Instr{builder.Instr(ops.I32Const, int32(42))}).
+		AddFunction("spin", wasm.FunctionSig{Form: 0}, nil, []disasm.Instr{
+			builder.Instr(ops.Loop),
+			builder.Instr(ops.Br, uint32(0)),
+			builder.Instr(ops.End),
+		})
+	b.Export("answer", wasm.ExternalFunction, b.Function("answer")).
+		Export("spin", wasm.ExternalFunction, b.Function("spin"))
+	m, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestExecCodeContext(t *testing.T) {
+	m := loopModule(t)
+	vm, err := NewVM(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := stdctx.WithTimeout(stdctx.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = vm.ExecCodeContext(ctx, 1)
+	var cerr CanceledError
+	if !errors.As(err, &cerr) || !errors.Is(err, stdctx.DeadlineExceeded) {
+		t.Fatalf("got error %v, want a CanceledError for %v", err, stdctx.DeadlineExceeded)
+	}
+
+	canceled, cancel := stdctx.WithCancel(stdctx.Background())
+	cancel()
+	vm.RecoverPanic = true
+	if _, err = vm.ExecCodeContext(canceled, 1); !errors.Is(err, stdctx.Canceled) {
+		t.Errorf("got error %v, want %v", err, stdctx.Canceled)
+	}
+
+	// the VM runs normally after a cancellation.
+	res, err := vm.ExecCodeContext(stdctx.Background(), 0)
+	if err != nil || res != uint32(42) {
+		t.Errorf("got %v, %v, want 42", res, err)
+	}
+}
+
+func TestExecContractCodeContext(t *testing.T) {
+	initMem := func(mem *sea.WavmMemory, module *wasm.Module) error { return nil }
+	inter, err := NewInterpreter(loopModule(t), nil, initMem, nil, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := stdctx.WithCancel(stdctx.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err = inter.ExecContractCodeContext(ctx, 1); !errors.Is(err, stdctx.Canceled) {
+		t.Errorf("got error %v, want %v", err, stdctx.Canceled)
+	}
+	ret, err := inter.ExecContractCode(0)
+	if err != nil || ret != 42 {
+		t.Errorf("got %d, %v, want 42", ret, err)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/exec/internal/compile"
+)
+
+// CodeMap relates the compiled code of a function, whose offsets are
+// reported in StructLog.Pc, to the instructions of its disassembly.
+type CodeMap struct {
+	Instrs      []disasm.Instr // disassembly of the function body
+	Offsets     []int64        // offset in the compiled code of each instruction, -1 if unreachable
+	BodyOffsets []int          // offset in the function body of each instruction
+	Size        int64          // size of the compiled code
+}
+
+// CodeMap returns the CodeMap of the function at fnIndex. Host functions
+// have no CodeMap.
+func (vm *VM) CodeMap(fnIndex int64) (*CodeMap, error) {
+	if fnIndex < 0 || int(fnIndex) >= len(vm.module.FunctionIndexSpace) {
+		return nil, InvalidFunctionIndexError(fnIndex)
+	}
+	fn := vm.module.FunctionIndexSpace[fnIndex]
+	if _, ok := vm.funcs[fnIndex].(compiledFunction); !ok {
+		return nil, InvalidFunctionIndexError(fnIndex)
+	}
+	d, err := disasm.Disassemble(fn, vm.module)
+	if err != nil {
+		return nil, err
+	}
+	code, _, offsets := compile.CompileWithOptions(d.Code, vm.compileOptions())
+	return &CodeMap{Instrs: d.Code, Offsets: offsets, BodyOffsets: d.Offsets, Size: int64(len(code))}, nil
+}
+
+// Lookup returns the index of the instruction whose compiled code contains
+// pc, or -1 if pc is out of range. Instructions emitting no code, such as
+// block, share their offset with the next instruction, which is preferred.
+func (c *CodeMap) Lookup(pc int64) int {
+	if pc < 0 || pc >= c.Size {
+		return -1
+	}
+	index := -1
+	for i, off := range c.Offsets {
+		if off > pc {
+			break
+		}
+		if off >= 0 {
+			index = i
+		}
+	}
+	return index
+}
+
+// Globals returns the values of the globals of the VM, by index.
+func (vm *VM) Globals() []uint64 {
+	return vm.globals
+}
@@ -0,0 +1,326 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/sea-project/sea-pkg/wagon/exec/internal/compile"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+// funcCoverage holds the counters collected by a Coverage for a function.
+type funcCoverage struct {
+	calls    uint64
+	hits     map[int64]uint64            // executions, by offset in the compiled code
+	branches map[int64]map[uint64]uint64 // outcomes of conditional branches, by offset
+}
+
+// Coverage is a Tracer recording the instructions executed by a VM and the
+// outcomes of its conditional branches, for writing code coverage reports
+// with WriteLCOV.
+//
+// A Coverage is installed with (*VM).SetTracer and accumulates over all the
+// calls made to the VM until Reset is called, such as the calls of a test
+// suite. It is not safe for concurrent use by multiple VMs.
+type Coverage struct {
+	funcs map[int64]*funcCoverage
+}
+
+// NewCoverage creates an empty Coverage.
+func NewCoverage() *Coverage {
+	c := &Coverage{}
+	c.Reset()
+	return c
+}
+
+// Reset discards the collected counters.
+func (c *Coverage) Reset() {
+	c.funcs = make(map[int64]*funcCoverage)
+}
+
+func (c *Coverage) function(index int64) *funcCoverage {
+	f, ok := c.funcs[index]
+	if !ok {
+		f = &funcCoverage{
+			hits:     make(map[int64]uint64),
+			branches: make(map[int64]map[uint64]uint64),
+		}
+		c.funcs[index] = f
+	}
+	return f
+}
+
+// Outcomes of the if and br_if instructions recorded by a Coverage. The
+// outcome of a br_table instruction is its operand.
+const (
+	branchThen     = 0
+	branchElse     = 1
+	branchTaken    = 0
+	branchNotTaken = 1
+)
+
+// CaptureStart implements Tracer.
+func (c *Coverage) CaptureStart(fnIndex int64, args []uint64) {
+	c.function(fnIndex).calls++
+}
+
+// CaptureStep implements Tracer.
+func (c *Coverage) CaptureStep(vm *VM, log *StructLog) {
+	f := c.function(log.Func)
+	f.hits[log.Pc]++
+
+	stack := log.Stack
+	if len(stack) == 0 {
+		return
+	}
+	top := stack[len(stack)-1]
+	var outcome uint64
+	switch log.Op {
+	case compile.OpJmpZ: // if
+		outcome = branchThen
+		if uint32(top) == 0 {
+			outcome = branchElse
+		}
+	case compile.OpJmpNz: // br_if
+		outcome = branchTaken
+		if uint32(top) == 0 {
+			outcome = branchNotTaken
+		}
+	case compile.OpI32CmpJmpNz: // comparison followed by br_if
+		cmp := vm.ctx.code[log.Pc+1]
+		var cond bool
+		switch {
+		case cmp == ops.I32Eqz:
+			cond = uint32(top) == 0
+		case len(stack) >= 2:
+			cond = i32Compare(cmp, uint32(stack[len(stack)-2]), uint32(top))
+		default:
+			return
+		}
+		outcome = branchTaken
+		if !cond {
+			outcome = branchNotTaken
+		}
+	case ops.BrTable:
+		outcome = uint64(uint32(top))
+	default:
+		return
+	}
+	b, ok := f.branches[log.Pc]
+	if !ok {
+		b = make(map[uint64]uint64)
+		f.branches[log.Pc] = b
+	}
+	b[outcome]++
+}
+
+// CaptureEnter implements Tracer.
+func (c *Coverage) CaptureEnter(depth int, fnIndex int64) {
+	c.function(fnIndex).calls++
+}
+
+// CaptureExit implements Tracer.
+func (c *Coverage) CaptureExit(depth int, fnIndex int64) {}
+
+// CaptureEnd implements Tracer.
+func (c *Coverage) CaptureEnd(ret uint64, err error) {}
+
+// lcovFunc is a function of an lcov record.
+type lcovFunc struct {
+	line  int
+	name  string
+	calls uint64
+}
+
+// lcovBranch is a conditional branch of an lcov record.
+type lcovBranch struct {
+	line   int
+	block  uint64
+	branch int
+	taken  uint64
+	hit    bool // whether the branch instruction was executed
+}
+
+// lcovFile is the record of a source file in an lcov tracefile.
+type lcovFile struct {
+	funcs    []lcovFunc
+	branches []lcovBranch
+	lines    map[int]uint64
+}
+
+// WriteLCOV writes the coverage of the functions defined by the module of
+// vm to w, in the lcov tracefile format read by genhtml and most coverage
+// tools. vm must be the VM the Coverage was installed on.
+//
+// Instructions are mapped to source lines with the DWARF line tables of the
+// module, when it has .debug_info and .debug_line custom sections, and
+// instructions without a source line are left out. Otherwise, the report
+// has a single source file named source, whose lines are the offsets of
+// the instructions in the code section, as DWARF addresses.
+//
+// Each if, br_if and br_table instruction is reported as a block of
+// branches, identified by the address of the instruction: the branch 0 of
+// an if enters its then block and the branch 1 skips it, the branch 0 of a
+// br_if branches and the branch 1 falls through, and the branch i of a
+// br_table is its i-th target, the last one being the default.
+func (c *Coverage) WriteLCOV(w io.Writer, vm *VM, source string) error {
+	m := vm.module
+	lines, err := readLineTable(m)
+	if err != nil {
+		return err
+	}
+	starts, err := bodyOffsets(m)
+	if err != nil {
+		return err
+	}
+	names := m.FunctionNames()
+	imported := len(m.ImportEntries(wasm.ExternalFunction))
+
+	files := make(map[string]*lcovFile)
+	file := func(name string) *lcovFile {
+		f, ok := files[name]
+		if !ok {
+			f = &lcovFile{lines: make(map[int]uint64)}
+			files[name] = f
+		}
+		return f
+	}
+	locate := func(addr uint64) (string, int, bool) {
+		if lines == nil {
+			return source, int(addr), true
+		}
+		return lines.lookup(addr)
+	}
+
+	for i, start := range starts {
+		fnIndex := int64(imported + i)
+		if int(fnIndex) >= len(vm.funcs) {
+			break
+		}
+		if _, ok := vm.funcs[fnIndex].(compiledFunction); !ok {
+			continue
+		}
+		cm, err := vm.CodeMap(fnIndex)
+		if err != nil {
+			return err
+		}
+		fc := c.funcs[fnIndex]
+		if fc == nil {
+			fc = &funcCoverage{}
+		}
+
+		var fnFile *lcovFile
+		name := names[fnIndex]
+		if name == "" {
+			name = fmt.Sprintf("func%d", fnIndex)
+		}
+		for k, ins := range cm.Instrs {
+			addr := start + uint64(cm.BodyOffsets[k])
+			pc := cm.Offsets[k]
+			if pc < 0 {
+				continue // unreachable
+			}
+			fname, line, ok := locate(addr)
+			if !ok {
+				continue
+			}
+			f := file(fname)
+			if fnFile == nil {
+				fnFile = f
+				f.funcs = append(f.funcs, lcovFunc{line: line, name: name, calls: fc.calls})
+			}
+			hits := fc.hits[pc]
+			if hits > f.lines[line] {
+				f.lines[line] = hits
+			} else if _, ok := f.lines[line]; !ok {
+				f.lines[line] = 0
+			}
+
+			n := 0
+			switch ins.Op.Code {
+			case ops.If, ops.BrIf:
+				n = 2
+			case ops.BrTable:
+				n = int(ins.Immediates[0].(uint32)) + 1
+			}
+			outcomes := fc.branches[pc]
+			for b := 0; b < n; b++ {
+				br := lcovBranch{line: line, block: addr, branch: b, hit: hits > 0}
+				for outcome, count := range outcomes {
+					taken := int(outcome)
+					if outcome >= uint64(n-1) {
+						taken = n - 1
+					}
+					if taken == b {
+						br.taken += count
+					}
+				}
+				f.branches = append(f.branches, br)
+			}
+		}
+	}
+
+	sources := make([]string, 0, len(files))
+	for name := range files {
+		sources = append(sources, name)
+	}
+	sort.Strings(sources)
+	buf := new(bytes.Buffer)
+	for _, name := range sources {
+		files[name].write(buf, name)
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// write writes the record of f for the source file name to buf.
+func (f *lcovFile) write(buf *bytes.Buffer, name string) {
+	fmt.Fprintf(buf, "TN:\nSF:%s\n", name)
+
+	sort.SliceStable(f.funcs, func(i, j int) bool { return f.funcs[i].line < f.funcs[j].line })
+	fnHit := 0
+	for _, fn := range f.funcs {
+		fmt.Fprintf(buf, "FN:%d,%s\n", fn.line, fn.name)
+	}
+	for _, fn := range f.funcs {
+		fmt.Fprintf(buf, "FNDA:%d,%s\n", fn.calls, fn.name)
+		if fn.calls > 0 {
+			fnHit++
+		}
+	}
+	fmt.Fprintf(buf, "FNF:%d\nFNH:%d\n", len(f.funcs), fnHit)
+
+	brHit := 0
+	for _, br := range f.branches {
+		taken := "-"
+		if br.hit {
+			taken = fmt.Sprint(br.taken)
+		}
+		if br.taken > 0 {
+			brHit++
+		}
+		fmt.Fprintf(buf, "BRDA:%d,%d,%d,%s\n", br.line, br.block, br.branch, taken)
+	}
+	fmt.Fprintf(buf, "BRF:%d\nBRH:%d\n", len(f.branches), brHit)
+
+	lines := make([]int, 0, len(f.lines))
+	for line := range f.lines {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	lineHit := 0
+	for _, line := range lines {
+		fmt.Fprintf(buf, "DA:%d,%d\n", line, f.lines[line])
+		if f.lines[line] > 0 {
+			lineHit++
+		}
+	}
+	fmt.Fprintf(buf, "LF:%d\nLH:%d\nend_of_record\n", len(lines), lineHit)
+}
@@ -0,0 +1,275 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/builder"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+// coverageModule returns a module with the functions "pick", choosing
+// between 1 and 42 with an if, and "small", branching with br_if when its
+// argument is below 5. debug, if not nil, holds custom sections to add.
+func coverageModule(t *testing.T, debug map[string][]byte) *wasm.Module {
+	sig := wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{wasm.ValueTypeI32}, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}
+	b := builder.New().
+		AddFunction("pick", sig, nil, []disasm.Instr{
+			builder.Instr(ops.GetLocal, uint32(0)),
+			builder.Instr(ops.If, wasm.BlockType(wasm.ValueTypeI32)),
+			builder.Instr(ops.I32Const, int32(1)),
+			builder.Instr(ops.Else),
+			builder.Instr(ops.I32Const, int32(42)),
+			builder.Instr(ops.End),
+		}).
+		AddFunction("small", sig, nil, []disasm.Instr{
+			builder.Instr(ops.Block, wasm.BlockTypeEmpty),
+			builder.Instr(ops.GetLocal, uint32(0)),
+			builder.Instr(ops.I32Const, int32(5)),
+			builder.Instr(ops.I32LtU),
+			builder.Instr(ops.BrIf, uint32(0)),
+			builder.Instr(ops.I32Const, int32(0)),
+			builder.Instr(ops.Return),
+			builder.Instr(ops.End),
+			builder.Instr(ops.I32Const, int32(1)),
+		})
+	b.Export("pick", wasm.ExternalFunction, b.Function("pick")).
+		Export("small", wasm.ExternalFunction, b.Function("small"))
+	raw, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readCoverageModule(t, raw, nil, debug)
+}
+
+// readCoverageModule reads the module raw, after editing its decoded form
+// with edit and adding the custom sections of debug, if not nil.
+func readCoverageModule(t *testing.T, raw []byte, edit func(m *wasm.Module), debug map[string][]byte) *wasm.Module {
+	if edit != nil || debug != nil {
+		m, err := wasm.DecodeModule(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if edit != nil {
+			edit(m)
+		}
+		if debug != nil {
+			for _, name := range []string{".debug_abbrev", ".debug_info", ".debug_line"} {
+				sec := append([]byte{byte(len(name))}, name...)
+				m.Other = append(m.Other, wasm.RawSection{ID: wasm.SectionIDCustom, Bytes: append(sec, debug[name]...)})
+			}
+		}
+		buf := new(bytes.Buffer)
+		if err = wasm.EncodeModule(buf, m); err != nil {
+			t.Fatal(err)
+		}
+		raw = buf.Bytes()
+	}
+	m, err := wasm.ReadModule(bytes.NewReader(raw), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func runCoverage(t *testing.T, m *wasm.Module, optimize bool, calls map[string][]uint64) string {
+	vm, err := NewVM(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if optimize {
+		if err = vm.Optimize(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cov := NewCoverage()
+	vm.SetTracer(cov)
+	for name, args := range calls {
+		for _, arg := range args {
+			if _, err = vm.ExecCode(int64(m.Export.Entries[name].Index), arg); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err = cov.WriteLCOV(buf, vm, "test.wasm"); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// brda returns the taken counts of the BRDA records of report, in order.
+func brda(report string) []string {
+	var taken []string
+	for _, line := range strings.Split(report, "\n") {
+		if strings.HasPrefix(line, "BRDA:") {
+			fields := strings.Split(line, ",")
+			taken = append(taken, fields[len(fields)-1])
+		}
+	}
+	return taken
+}
+
+func TestCoverage(t *testing.T) {
+	m := coverageModule(t, nil)
+	for _, optimize := range []bool{false, true} {
+		report := runCoverage(t, m, optimize, map[string][]uint64{"small": {3, 9, 1}})
+		for _, want := range []string{
+			"SF:test.wasm\n",
+			"FNDA:0,pick\n", "FNDA:3,small\n", "FNF:2\nFNH:1\n",
+			"BRF:4\nBRH:2\n",
+			"LH:", "end_of_record\n",
+		} {
+			if !strings.Contains(report, want) {
+				t.Errorf("optimize=%v: report does not contain %q:\n%s", optimize, want, report)
+			}
+		}
+		// the if of pick was not executed, the br_if of small branched
+		// twice and fell through once.
+		if got, want := strings.Join(brda(report), " "), "- - 2 1"; got != want {
+			t.Errorf("optimize=%v: got branches %q, want %q", optimize, got, want)
+		}
+	}
+
+	report := runCoverage(t, m, false, map[string][]uint64{"pick": {0, 0, 7}})
+	if got, want := strings.Join(brda(report), " "), "1 2 - -"; got != want {
+		t.Errorf("got branches %q, want %q", got, want)
+	}
+}
+
+// debugSections returns the DWARF 4 sections of a compilation unit "a.c",
+// whose code starts at line 10 and continues at line 12 from the address
+// else up to the address end.
+func debugSections(elseAddr, endAddr uint32) map[string][]byte {
+	abbrev := []byte{
+		1, 0x11, 0, // compile unit, no children
+		0x03, 0x08, // DW_AT_name, DW_FORM_string
+		0x10, 0x17, // DW_AT_stmt_list, DW_FORM_sec_offset
+		0x1b, 0x08, // DW_AT_comp_dir, DW_FORM_string
+		0, 0, 0,
+	}
+
+	cu := []byte{4, 0, 0, 0, 0, 0, 4} // version 4, abbrev offset 0, address size 4
+	cu = append(cu, 1)
+	cu = append(cu, "a.c\x00"...)
+	cu = append(cu, 0, 0, 0, 0)
+	cu = append(cu, "/src\x00"...)
+	info := make([]byte, 4, 4+len(cu))
+	binary.LittleEndian.PutUint32(info, uint32(len(cu)))
+	info = append(info, cu...)
+
+	header := []byte{1, 1, 1, 0xfb, 14, 13, 0, 1, 1, 1, 1, 0, 0, 0, 1, 0, 0, 1}
+	header = append(header, 0) // no include directories
+	header = append(header, "a.c\x00"...)
+	header = append(header, 0, 0, 0, 0)
+	setAddress := func(addr uint32) []byte {
+		b := []byte{0, 5, 2, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(b[3:], addr)
+		return b
+	}
+	var prog []byte
+	prog = append(prog, setAddress(0)...)
+	prog = append(prog, 3, 9, 1) // advance_line 9, copy
+	prog = append(prog, setAddress(elseAddr)...)
+	prog = append(prog, 3, 2, 1) // advance_line 2, copy
+	prog = append(prog, setAddress(endAddr)...)
+	prog = append(prog, 0, 1, 1) // end_sequence
+
+	unit := []byte{4, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(unit[2:], uint32(len(header)))
+	unit = append(unit, header...)
+	unit = append(unit, prog...)
+	line := make([]byte, 4, 4+len(unit))
+	binary.LittleEndian.PutUint32(line, uint32(len(unit)))
+	line = append(line, unit...)
+
+	return map[string][]byte{".debug_abbrev": abbrev, ".debug_info": info, ".debug_line": line}
+}
+
+func TestCoverageDWARF(t *testing.T) {
+	plain := coverageModule(t, nil)
+	code := plain.Code.Bytes
+	elseAddr := bytes.Index(code, []byte{ops.I32Const, 42})
+	if elseAddr < 0 {
+		t.Fatal("i32.const 42 not found in the code section")
+	}
+
+	m := coverageModule(t, debugSections(uint32(elseAddr), uint32(elseAddr+2)))
+	report := runCoverage(t, m, false, map[string][]uint64{"pick": {0, 0, 7}, "small": {1}})
+	for _, want := range []string{
+		"SF:/src/a.c\n",
+		"FN:10,pick\n", "FNDA:3,pick\n", "FNF:1\n",
+		"BRF:2\nBRH:2\n",
+		"DA:10,3\nDA:12,2\nLF:2\nLH:2\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report does not contain %q:\n%s", want, report)
+		}
+	}
+	if strings.Contains(report, "small") {
+		t.Errorf("report has the function small, without source lines:\n%s", report)
+	}
+}
+
+// TestCoverageDWARFPaddedLEB128 checks the addresses of instructions
+// following an immediate padded to 5 bytes, as wasm-ld emits for calls in
+// builds with debug information.
+func TestCoverageDWARFPaddedLEB128(t *testing.T) {
+	sig := wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{wasm.ValueTypeI32}, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}
+	one := wasm.FunctionSig{Form: 0, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}
+	b := builder.New()
+	b.AddFunction("pick", sig, nil, []disasm.Instr{
+		builder.Instr(ops.GetLocal, uint32(0)),
+		builder.Instr(ops.If, wasm.BlockType(wasm.ValueTypeI32)),
+		builder.Instr(ops.Call, uint32(1)),
+		builder.Instr(ops.Else),
+		builder.Instr(ops.I32Const, int32(42)),
+		builder.Instr(ops.End),
+	}).
+		AddFunction("one", one, nil, []disasm.Instr{builder.Instr(ops.I32Const, int32(1))})
+	b.Export("pick", wasm.ExternalFunction, b.Function("pick"))
+	raw, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := func(m *wasm.Module) {
+		body := &m.Code.Bodies[0]
+		call := bytes.Index(body.Code, []byte{ops.Call, 1})
+		if call < 0 {
+			t.Fatal("call not found in pick")
+		}
+		code := append([]byte(nil), body.Code[:call]...)
+		code = append(code, ops.Call, 0x81, 0x80, 0x80, 0x80, 0x00)
+		body.Code = append(code, body.Code[call+2:]...)
+	}
+
+	plain := readCoverageModule(t, raw, pad, nil)
+	code := plain.Code.Bytes
+	if !bytes.Contains(code, []byte{ops.Call, 0x81, 0x80, 0x80, 0x80, 0x00}) {
+		t.Fatal("the padded call was not kept in the code section")
+	}
+	elseAddr := bytes.Index(code, []byte{ops.I32Const, 42})
+	if elseAddr < 0 {
+		t.Fatal("i32.const 42 not found in the code section")
+	}
+
+	m := readCoverageModule(t, raw, pad, debugSections(uint32(elseAddr), uint32(elseAddr+2)))
+	report := runCoverage(t, m, false, map[string][]uint64{"pick": {0, 0, 7}})
+	for _, want := range []string{
+		"FN:10,pick\n", "FNDA:3,pick\n",
+		"BRF:2\nBRH:2\n",
+		"DA:10,3\nDA:12,2\nLF:2\nLH:2\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report does not contain %q:\n%s", want, report)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/leb128"
+)
+
+// dwarfSections are the DWARF custom sections passed to dwarf.New, in the
+// order of its arguments.
+var dwarfSections = []string{
+	".debug_abbrev", ".debug_aranges", ".debug_frame", ".debug_info",
+	".debug_line", ".debug_pubnames", ".debug_ranges", ".debug_str",
+}
+
+// dwarfExtraSections are the DWARF 5 custom sections added with
+// (*dwarf.Data).AddSection.
+var dwarfExtraSections = []string{
+	".debug_addr", ".debug_line_str", ".debug_str_offsets", ".debug_rnglists",
+}
+
+// lineRow is a row of a DWARF line table. Addresses are offsets in the
+// payload of the code section.
+type lineRow struct {
+	addr uint64
+	end  bool // end of a sequence: addr is past its last instruction
+	file string
+	line int
+}
+
+// lineTable maps code addresses to source lines.
+type lineTable []lineRow
+
+// readLineTable reads the line tables of the DWARF custom sections of m.
+// It returns nil and no error if m has no DWARF line information.
+func readLineTable(m *wasm.Module) (lineTable, error) {
+	if m.CustomSection(".debug_info") == nil || m.CustomSection(".debug_line") == nil {
+		return nil, nil
+	}
+	secs := make([][]byte, len(dwarfSections))
+	for i, name := range dwarfSections {
+		secs[i] = m.CustomSection(name)
+	}
+	d, err := dwarf.New(secs[0], secs[1], secs[2], secs[3], secs[4], secs[5], secs[6], secs[7])
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range dwarfExtraSections {
+		if sec := m.CustomSection(name); sec != nil {
+			if err := d.AddSection(name, sec); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var t lineTable
+	r := d.Reader()
+	for {
+		cu, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if cu == nil {
+			break
+		}
+		if cu.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+		lr, err := d.LineReader(cu)
+		if err != nil {
+			return nil, err
+		}
+		r.SkipChildren()
+		if lr == nil {
+			continue
+		}
+		var e dwarf.LineEntry
+		for {
+			if err := lr.Next(&e); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			row := lineRow{addr: e.Address, end: e.EndSequence, line: e.Line}
+			if e.File != nil {
+				row.file = e.File.Name
+			}
+			t = append(t, row)
+		}
+	}
+	// a sequence starting where another ends wins over its end.
+	sort.SliceStable(t, func(i, j int) bool {
+		if t[i].addr != t[j].addr {
+			return t[i].addr < t[j].addr
+		}
+		return t[i].end && !t[j].end
+	})
+	return t, nil
+}
+
+// lookup returns the source line of the instruction at addr.
+func (t lineTable) lookup(addr uint64) (file string, line int, ok bool) {
+	i := sort.Search(len(t), func(i int) bool { return t[i].addr > addr }) - 1
+	if i < 0 || t[i].end || t[i].line == 0 {
+		return "", 0, false
+	}
+	return t[i].file, t[i].line, true
+}
+
+var errCodeSection = errors.New("exec: malformed code section")
+
+// bodyOffsets returns the offset in the payload of the code section of m of
+// the code of each function body, following its local declarations.
+func bodyOffsets(m *wasm.Module) ([]uint64, error) {
+	if m.Code == nil {
+		return nil, nil
+	}
+	payload := m.Code.Bytes
+	r := bytes.NewReader(payload)
+	n, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, errCodeSection
+	}
+	offsets := make([]uint64, 0, n)
+	for i := uint32(0); i < n; i++ {
+		size, err := leb128.ReadVarUint32(r)
+		if err != nil || int(size) > r.Len() {
+			return nil, errCodeSection
+		}
+		end := len(payload) - r.Len() + int(size)
+		locals, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, errCodeSection
+		}
+		for j := uint32(0); j < locals; j++ {
+			if _, err = leb128.ReadVarUint32(r); err != nil {
+				return nil, errCodeSection
+			}
+			if _, err = r.ReadByte(); err != nil {
+				return nil, errCodeSection
+			}
+		}
+		start := len(payload) - r.Len()
+		if start > end {
+			return nil, errCodeSection
+		}
+		offsets = append(offsets, uint64(start))
+		if _, err = r.Seek(int64(end), io.SeekStart); err != nil {
+			return nil, errCodeSection
+		}
+	}
+	return offsets, nil
+}
@@ -253,7 +253,7 @@ func panics(fn func()) (panicked bool, msg string) {
 	return
 }
 
-func runTest(fileName string, testCases []testCase, t testing.TB) {
+func runTest(fileName string, testCases []testCase, t testing.TB, optimize bool) {
 	file, err := os.Open(fileName)
 	if err != nil {
 		t.Fatal(err)
@@ -272,6 +272,11 @@ func runTest(fileName string, testCases []testCase, t testing.TB) {
 	if err != nil {
 		t.Fatalf("%s: %v", fileName, err)
 	}
+	if optimize {
+		if err = vm.Optimize(); err != nil {
+			t.Fatalf("%s: %v", fileName, err)
+		}
+	}
 
 	b, ok := t.(*testing.B)
 	for _, testCase := range testCases {
@@ -340,7 +345,7 @@ func runTest(fileName string, testCases []testCase, t testing.TB) {
 	}
 }
 
-func testModules(t *testing.T, dir string) {
+func testModules(t *testing.T, dir string, optimize bool) {
 	files := []file{}
 	file, err := os.Open(filepath.Join(dir, "modules.json"))
 	if err != nil {
@@ -362,14 +367,14 @@ func testModules(t *testing.T, dir string) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			runTest(path, testCases, t)
+			runTest(path, testCases, t, optimize)
 		})
 	}
 }
 
-func BenchmarkModules(b *testing.B) {
+func benchmarkModules(b *testing.B, dir string, optimize bool) {
 	files := []file{}
-	file, err := os.Open(filepath.Join("testdata/spec", "modules.json"))
+	file, err := os.Open(filepath.Join(dir, "modules.json"))
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -381,22 +386,52 @@ func BenchmarkModules(b *testing.B) {
 	}
 
 	for _, file := range files {
-		fileName := filepath.Join("testdata/spec", file.FileName)
+		fileName := filepath.Join(dir, file.FileName)
 		testCases := file.Tests
 		b.Run(fileName, func(b *testing.B) {
 			path, err := filepath.Abs(fileName)
 			if err != nil {
 				b.Fatal(err)
 			}
-			runTest(path, testCases, b)
+			runTest(path, testCases, b, optimize)
 		})
 	}
 }
 
+// The benchmarks compare the code compiled as is and with superinstructions,
+// e.g. with benchstat:
+//	go test -run NONE -bench 'Modules$' -count 10 > plain.txt
+//	go test -run NONE -bench 'ModulesOptimized$' -count 10 | sed 's/Optimized//' > optimized.txt
+//	benchstat plain.txt optimized.txt
+
+func BenchmarkModules(b *testing.B) {
+	benchmarkModules(b, specTestsDir, false)
+}
+
+func BenchmarkModulesOptimized(b *testing.B) {
+	benchmarkModules(b, specTestsDir, true)
+}
+
+func BenchmarkNonSpecModules(b *testing.B) {
+	benchmarkModules(b, nonSpecTestsDir, false)
+}
+
+func BenchmarkNonSpecModulesOptimized(b *testing.B) {
+	benchmarkModules(b, nonSpecTestsDir, true)
+}
+
 func TestNonSpec(t *testing.T) {
-	testModules(t, nonSpecTestsDir)
+	testModules(t, nonSpecTestsDir, false)
 }
 
 func TestSpec(t *testing.T) {
-	testModules(t, specTestsDir)
+	testModules(t, specTestsDir, false)
+}
+
+func TestNonSpecOptimized(t *testing.T) {
+	testModules(t, nonSpecTestsDir, true)
+}
+
+func TestSpecOptimized(t *testing.T) {
+	testModules(t, specTestsDir, true)
 }
@@ -80,9 +80,12 @@ func (fn goFunction) call(vm *VM, index int64) {
 }
 
 func (compiled compiledFunction) call(vm *VM, index int64) {
+	vm.checkInterrupt()
 	vm.recursiveCallDepth++
 	defer func() { vm.recursiveCallDepth-- }()
-	newStack := make([]uint64, compiled.maxDepth)
+	// the callee starts with an empty operand stack, as ExecCode does for
+	// the entry function, so that tracers only see live operands.
+	newStack := make([]uint64, 0, compiled.maxDepth)
 	locals := make([]uint64, compiled.totalLocalVars)
 
 	for i := compiled.args - 1; i >= 0; i-- {
@@ -5,6 +5,7 @@
 package exec
 
 import (
+	"github.com/sea-project/sea-pkg/wagon/exec/internal/compile"
 	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
 )
 
@@ -183,4 +184,8 @@ func (vm *VM) newFuncTable() {
 
 	vm.funcTable[ops.Call] = vm.call
 	vm.funcTable[ops.CallIndirect] = vm.callIndirect
+
+	vm.funcTable[compile.OpLocalsI32Add] = vm.localsI32Add
+	vm.funcTable[compile.OpLocalConstI32Add] = vm.localConstI32Add
+	vm.funcTable[compile.OpConstI32Load] = vm.constI32Load
 }
@@ -0,0 +1,471 @@
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+
+	"github.com/sea-project/sea-pkg/wagon/sea"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+var (
+	// ErrDuplicateHostModule is returned by (*HostRegistry).Register when a
+	// module with the same name has already been registered.
+	ErrDuplicateHostModule = errors.New("exec: duplicate host module")
+	// ErrNoManagedMemory is the error value used while trapping the VM when a
+	// host function needs a *WavmProcess or returns bytes, but the VM was not
+	// created by NewInterpreter.
+	ErrNoManagedMemory = errors.New("exec: host function requires an interpreter with managed memory")
+)
+
+var (
+	processType     = reflect.TypeOf((*Process)(nil))
+	wavmProcessType = reflect.TypeOf((*WavmProcess)(nil))
+	errorType       = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// HostTypeError is returned when a Go function registered as a host function
+// uses a parameter or result type that cannot be mapped to WebAssembly.
+type HostTypeError struct {
+	Func   string
+	Type   reflect.Type
+	Result bool // Whether Type was found in the results of the function
+}
+
+func (e HostTypeError) Error() string {
+	where := "parameter"
+	if e.Result {
+		where = "result"
+	}
+	return fmt.Sprintf("exec: host function %s: unsupported %s type %v", e.Func, where, e.Type)
+}
+
+// HostFunctionError is the error value used while trapping the VM when a host
+// function returns a non-nil error.
+type HostFunctionError struct {
+	Module string
+	Name   string
+	Err    error
+}
+
+func (e HostFunctionError) Error() string {
+	return fmt.Sprintf("exec: host function %s.%s: %v", e.Module, e.Name, e.Err)
+}
+
+func (e HostFunctionError) Unwrap() error {
+	return e.Err
+}
+
+// hostValue describes how a single Go parameter or result is mapped to
+// WebAssembly values.
+type hostValue int
+
+const (
+	hostI32    hostValue = iota // int32, uint32
+	hostI64                     // int64, uint64
+	hostF32                     // float32
+	hostF64                     // float64
+	hostBool                    // bool, as an i32
+	hostBytes                   // []byte, as an (i32 pointer, i32 length) pair
+	hostString                  // string, as an (i32 pointer, i32 length) pair
+	hostArray                   // [N]byte, as an i32 pointer to N bytes
+)
+
+// HostFunction is a Go function bound to a WebAssembly function signature.
+//
+// Parameters are mapped as follows:
+//
+//	int32, uint32, bool  -> i32
+//	int64, uint64        -> i64
+//	float32, float64     -> f32, f64
+//	[]byte, string       -> i32 pointer, i32 length into linear memory
+//	[N]byte              -> i32 pointer to N bytes of linear memory
+//
+// The first parameter may be a *Process or a *WavmProcess, in which case it
+// is not part of the WebAssembly signature.
+// A function returns at most one value, mapped as the parameters are, except
+// that []byte, string and [N]byte are copied into the interpreter's memory and
+// returned as an i32 pointer. It may additionally return an error as its last
+// result, which traps the VM when non-nil.
+type HostFunction struct {
+	Module string
+	Name   string
+	Sig    wasm.FunctionSig
+
+	val     reflect.Value
+	proc    reflect.Type // nil, processType or wavmProcessType
+	params  []hostValue
+	results []hostValue
+	err     bool // whether the last Go result is an error
+}
+
+func newHostFunction(module, name string, fn interface{}) (*HostFunction, error) {
+	val := reflect.ValueOf(fn)
+	if val.Kind() != reflect.Func {
+		return nil, fmt.Errorf("exec: host function %s.%s is a %v, not a func", module, name, val.Kind())
+	}
+	typ := val.Type()
+	if typ.IsVariadic() {
+		return nil, fmt.Errorf("exec: host function %s.%s is variadic", module, name)
+	}
+
+	hf := &HostFunction{
+		Module: module,
+		Name:   name,
+		val:    val,
+	}
+	full := module + "." + name
+
+	in := 0
+	if typ.NumIn() > 0 && (typ.In(0) == processType || typ.In(0) == wavmProcessType) {
+		hf.proc = typ.In(0)
+		in = 1
+	}
+	for ; in < typ.NumIn(); in++ {
+		v, ok := hostValueOf(typ.In(in))
+		if !ok {
+			return nil, HostTypeError{full, typ.In(in), false}
+		}
+		hf.params = append(hf.params, v)
+		switch v {
+		case hostBytes, hostString:
+			hf.Sig.ParamTypes = append(hf.Sig.ParamTypes, wasm.ValueTypeI32, wasm.ValueTypeI32)
+		default:
+			hf.Sig.ParamTypes = append(hf.Sig.ParamTypes, v.valueType())
+		}
+	}
+
+	out := typ.NumOut()
+	if out > 0 && typ.Out(out-1) == errorType {
+		hf.err = true
+		out--
+	}
+	if out > 1 {
+		return nil, fmt.Errorf("exec: host function %s returns more than one value", full)
+	}
+	if out == 1 {
+		v, ok := hostValueOf(typ.Out(0))
+		if !ok {
+			return nil, HostTypeError{full, typ.Out(0), true}
+		}
+		hf.results = append(hf.results, v)
+		hf.Sig.ReturnTypes = append(hf.Sig.ReturnTypes, v.valueType())
+	}
+
+	return hf, nil
+}
+
+func hostValueOf(t reflect.Type) (hostValue, bool) {
+	switch t.Kind() {
+	case reflect.Int32, reflect.Uint32:
+		return hostI32, true
+	case reflect.Int64, reflect.Uint64:
+		return hostI64, true
+	case reflect.Float32:
+		return hostF32, true
+	case reflect.Float64:
+		return hostF64, true
+	case reflect.Bool:
+		return hostBool, true
+	case reflect.String:
+		return hostString, true
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return hostBytes, true
+		}
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return hostArray, true
+		}
+	}
+	return 0, false
+}
+
+// valueType returns the WebAssembly type of a single-valued mapping. Byte
+// results are returned as an i32 pointer.
+func (v hostValue) valueType() wasm.ValueType {
+	switch v {
+	case hostI64:
+		return wasm.ValueTypeI64
+	case hostF32:
+		return wasm.ValueTypeF32
+	case hostF64:
+		return wasm.ValueTypeF64
+	default:
+		return wasm.ValueTypeI32
+	}
+}
+
+// HostModule is a named collection of host functions that WebAssembly modules
+// can import.
+type HostModule struct {
+	name  string
+	funcs []*HostFunction
+	index map[string]int
+}
+
+// NewHostModule creates an empty host module with the given import name.
+func NewHostModule(name string) *HostModule {
+	return &HostModule{
+		name:  name,
+		index: make(map[string]int),
+	}
+}
+
+// Name returns the name modules use to import from m.
+func (m *HostModule) Name() string {
+	return m.name
+}
+
+// Func binds fn to the export name. See HostFunction for the Go types
+// that fn may use.
+func (m *HostModule) Func(name string, fn interface{}) error {
+	if _, exists := m.index[name]; exists {
+		return fmt.Errorf("exec: duplicate host function %s.%s", m.name, name)
+	}
+	hf, err := newHostFunction(m.name, name, fn)
+	if err != nil {
+		return err
+	}
+	m.index[name] = len(m.funcs)
+	m.funcs = append(m.funcs, hf)
+	return nil
+}
+
+// MustFunc is like Func but panics if fn cannot be bound.
+func (m *HostModule) MustFunc(name string, fn interface{}) *HostModule {
+	if err := m.Func(name, fn); err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Lookup returns the host function exported under name.
+func (m *HostModule) Lookup(name string) (*HostFunction, bool) {
+	i, ok := m.index[name]
+	if !ok {
+		return nil, false
+	}
+	return m.funcs[i], true
+}
+
+// Module returns a wasm.Module exporting the functions of m, suitable for
+// returning from a wasm.ResolveFunc. Import signatures are checked against
+// the exported signatures by wasm.ReadModule.
+func (m *HostModule) Module() *wasm.Module {
+	mod := wasm.NewModule()
+	mod.Types.Entries = make([]wasm.FunctionSig, len(m.funcs))
+	mod.FunctionIndexSpace = make([]wasm.Function, len(m.funcs))
+	mod.Export.Entries = make(map[string]wasm.ExportEntry, len(m.funcs))
+	for i, hf := range m.funcs {
+		mod.Types.Entries[i] = hf.Sig
+		mod.FunctionIndexSpace[i] = wasm.Function{
+			Sig:  &mod.Types.Entries[i],
+			Body: &wasm.FunctionBody{},
+			Host: reflect.ValueOf(hf),
+		}
+		mod.Export.Entries[hf.Name] = wasm.ExportEntry{
+			FieldStr: hf.Name,
+			Kind:     wasm.ExternalFunction,
+			Index:    uint32(i),
+		}
+	}
+	return mod
+}
+
+// HostRegistry holds the host modules available for import.
+// It is safe for concurrent use.
+type HostRegistry struct {
+	mu      sync.RWMutex
+	modules map[string]*HostModule
+}
+
+// NewHostRegistry creates an empty registry.
+func NewHostRegistry() *HostRegistry {
+	return &HostRegistry{modules: make(map[string]*HostModule)}
+}
+
+// Register adds m to the registry.
+func (r *HostRegistry) Register(m *HostModule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.modules[m.name]; exists {
+		return ErrDuplicateHostModule
+	}
+	r.modules[m.name] = m
+	return nil
+}
+
+// Module returns the host module registered under name.
+func (r *HostRegistry) Module(name string) (*HostModule, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.modules[name]
+	return m, ok
+}
+
+// Resolver returns a wasm.ResolveFunc that resolves imports against the
+// registered host modules. Names that are not registered are passed to
+// fallback, if it is not nil.
+func (r *HostRegistry) Resolver(fallback wasm.ResolveFunc) wasm.ResolveFunc {
+	return func(name string) (*wasm.Module, error) {
+		if m, ok := r.Module(name); ok {
+			return m.Module(), nil
+		}
+		if fallback != nil {
+			return fallback(name)
+		}
+		return nil, fmt.Errorf("exec: unknown host module %q", name)
+	}
+}
+
+// hostFunctionOf returns the *HostFunction bound to fn, if any.
+func hostFunctionOf(fn wasm.Function) (*HostFunction, bool) {
+	if fn.Host.Kind() != reflect.Ptr {
+		return nil, false
+	}
+	hf, ok := fn.Host.Interface().(*HostFunction)
+	return hf, ok
+}
+
+// hostCall is the function implementation for a *HostFunction.
+type hostCall struct {
+	fn      *HostFunction
+	memory  *sea.WavmMemory // nil for VMs created by NewVM
+	mutable *bool
+}
+
+func (h hostCall) call(vm *VM, index int64) {
+	fn := h.fn
+	raw := make([]uint64, len(fn.Sig.ParamTypes))
+	for i := len(raw) - 1; i >= 0; i-- {
+		raw[i] = vm.popUint64()
+	}
+
+	typ := fn.val.Type()
+	args := make([]reflect.Value, 0, typ.NumIn())
+	switch fn.proc {
+	case processType:
+		args = append(args, reflect.ValueOf(NewProcess(vm)))
+	case wavmProcessType:
+		if h.memory == nil {
+			panic(ErrNoManagedMemory)
+		}
+		args = append(args, reflect.ValueOf(NewWavmProcess(vm, h.memory, h.mutable)))
+	}
+
+	in := len(args)
+	for _, p := range fn.params {
+		t := typ.In(in)
+		val := reflect.New(t).Elem()
+		switch p {
+		case hostI32:
+			if t.Kind() == reflect.Int32 {
+				val.SetInt(int64(int32(raw[0])))
+			} else {
+				val.SetUint(uint64(uint32(raw[0])))
+			}
+			raw = raw[1:]
+		case hostI64:
+			if t.Kind() == reflect.Int64 {
+				val.SetInt(int64(raw[0]))
+			} else {
+				val.SetUint(raw[0])
+			}
+			raw = raw[1:]
+		case hostF32:
+			val.SetFloat(float64(math.Float32frombits(uint32(raw[0]))))
+			raw = raw[1:]
+		case hostF64:
+			val.SetFloat(math.Float64frombits(raw[0]))
+			raw = raw[1:]
+		case hostBool:
+			val.SetBool(uint32(raw[0]) != 0)
+			raw = raw[1:]
+		case hostBytes:
+			val.SetBytes(vm.readMemory(uint32(raw[0]), uint32(raw[1])))
+			raw = raw[2:]
+		case hostString:
+			val.SetString(string(vm.readMemory(uint32(raw[0]), uint32(raw[1]))))
+			raw = raw[2:]
+		case hostArray:
+			reflect.Copy(val, reflect.ValueOf(vm.readMemory(uint32(raw[0]), uint32(t.Len()))))
+			raw = raw[1:]
+		}
+		args = append(args, val)
+		in++
+	}
+
+	if vm.debug && vm.captureEnvFunctionStart != nil {
+		vm.captureEnvFunctionStart(uint64(vm.ctx.pc), fn.Module+"."+fn.Name)
+	}
+	rtrns := fn.val.Call(args)
+	if vm.debug && vm.captureEnvFunctionEnd != nil {
+		vm.captureEnvFunctionEnd(uint64(vm.ctx.pc), fn.Module+"."+fn.Name)
+	}
+
+	if fn.err {
+		if err := rtrns[len(rtrns)-1]; !err.IsNil() {
+			panic(HostFunctionError{fn.Module, fn.Name, err.Interface().(error)})
+		}
+		rtrns = rtrns[:len(rtrns)-1]
+	}
+
+	for i, out := range rtrns {
+		switch fn.results[i] {
+		case hostI32:
+			if out.Kind() == reflect.Int32 {
+				vm.pushUint32(uint32(out.Int()))
+			} else {
+				vm.pushUint32(uint32(out.Uint()))
+			}
+		case hostI64:
+			if out.Kind() == reflect.Int64 {
+				vm.pushInt64(out.Int())
+			} else {
+				vm.pushUint64(out.Uint())
+			}
+		case hostF32:
+			vm.pushFloat32(float32(out.Float()))
+		case hostF64:
+			vm.pushFloat64(out.Float())
+		case hostBool:
+			vm.pushBool(out.Bool())
+		case hostBytes, hostString, hostArray:
+			if h.memory == nil {
+				panic(ErrNoManagedMemory)
+			}
+			var p []byte
+			switch out.Kind() {
+			case reflect.String:
+				p = []byte(out.String())
+			case reflect.Array:
+				p = make([]byte, out.Len())
+				reflect.Copy(reflect.ValueOf(p), out)
+			default:
+				p = out.Bytes()
+			}
+			// host functions may run after the linear memory was grown.
+			h.memory.Memory = vm.memory.data
+			vm.pushUint32(uint32(h.memory.SetBytes(p)))
+		}
+	}
+}
+
+// readMemory returns a copy of n bytes of linear memory starting at ptr.
+func (vm *VM) readMemory(ptr, n uint32) []byte {
+	end := uint64(ptr) + uint64(n)
+	if end > uint64(len(vm.memory.data)) {
+		panic(ErrOutOfBoundsMemoryAccess)
+	}
+	p := make([]byte, n)
+	copy(p, vm.memory.data[ptr:end])
+	return p
+}
@@ -0,0 +1,226 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/sea"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+var errHostFail = errors.New("host failure")
+
+func newTestHostModule(t *testing.T) *HostModule {
+	env := NewHostModule("env")
+	for name, fn := range map[string]interface{}{
+		"concat": func(proc *WavmProcess, a []byte, b string) []byte {
+			return append(a, b...)
+		},
+		"add": func(a int32, b int64) int64 {
+			return int64(a) + b
+		},
+		"fail": func(proc *Process) (int32, error) {
+			return 0, errHostFail
+		},
+	} {
+		if err := env.Func(name, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return env
+}
+
+// hostImportModule encodes a module importing env.concat, env.add and
+// env.fail with the given signatures, followed by three functions calling
+// each of them.
+func hostImportModule(t *testing.T, addSig wasm.FunctionSig) []byte {
+	i32, i64 := wasm.ValueTypeI32, wasm.ValueTypeI64
+	m := &wasm.Module{
+		Types: &wasm.SectionTypes{
+			Entries: []wasm.FunctionSig{
+				{Form: 0, ParamTypes: []wasm.ValueType{i32, i32, i32, i32}, ReturnTypes: []wasm.ValueType{i32}},
+				addSig,
+				{Form: 0, ReturnTypes: []wasm.ValueType{i32}},
+				{Form: 0, ReturnTypes: []wasm.ValueType{i64}},
+			},
+		},
+		Import: &wasm.SectionImports{
+			Entries: []wasm.ImportEntry{
+				{ModuleName: "env", FieldName: "concat", Type: wasm.FuncImport{Type: 0}},
+				{ModuleName: "env", FieldName: "add", Type: wasm.FuncImport{Type: 1}},
+				{ModuleName: "env", FieldName: "fail", Type: wasm.FuncImport{Type: 2}},
+			},
+		},
+		Function: &wasm.SectionFunctions{Types: []uint32{2, 3, 2}},
+		Memory: &wasm.SectionMemories{
+			Entries: []wasm.Memory{{Limits: wasm.ResizableLimits{Initial: 1}}},
+		},
+		Export: &wasm.SectionExports{
+			Entries: map[string]wasm.ExportEntry{
+				"call_concat": {FieldStr: "call_concat", Kind: wasm.ExternalFunction, Index: 3},
+				"call_add":    {FieldStr: "call_add", Kind: wasm.ExternalFunction, Index: 4},
+				"call_fail":   {FieldStr: "call_fail", Kind: wasm.ExternalFunction, Index: 5},
+			},
+		},
+		Code: &wasm.SectionCode{
+			Bodies: []wasm.FunctionBody{
+				// concat(16, 5, 16, 5)
+				{Code: []byte{0x41, 0x10, 0x41, 0x05, 0x41, 0x10, 0x41, 0x05, 0x10, 0x00}},
+				// add(-2, 44)
+				{Code: []byte{0x41, 0x7e, 0x42, 0x2c, 0x10, 0x01}},
+				// fail()
+				{Code: []byte{0x10, 0x02}},
+			},
+		},
+		Data: &wasm.SectionData{
+			Entries: []wasm.DataSegment{
+				{Offset: []byte{0x41, 0x10, 0x0b}, Data: []byte("hello")},
+			},
+		},
+	}
+	buf := new(bytes.Buffer)
+	if err := wasm.EncodeModule(buf, m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+var addSig = wasm.FunctionSig{
+	Form:        0,
+	ParamTypes:  []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI64},
+	ReturnTypes: []wasm.ValueType{wasm.ValueTypeI64},
+}
+
+func TestHostModuleSignatures(t *testing.T) {
+	env := newTestHostModule(t)
+	for _, tc := range []struct {
+		name string
+		sig  wasm.FunctionSig
+	}{
+		{"concat", wasm.FunctionSig{ParamTypes: []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}},
+		{"add", addSig},
+		{"fail", wasm.FunctionSig{ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}},
+	} {
+		hf, ok := env.Lookup(tc.name)
+		if !ok {
+			t.Fatalf("%s: not found", tc.name)
+		}
+		if !reflect.DeepEqual(hf.Sig.ParamTypes, tc.sig.ParamTypes) || !reflect.DeepEqual(hf.Sig.ReturnTypes, tc.sig.ReturnTypes) {
+			t.Errorf("%s: got signature %v, want %v", tc.name, hf.Sig, tc.sig)
+		}
+	}
+
+	if err := env.Func("bad", func(m map[string]int) {}); err == nil {
+		t.Error("expected an error binding a map parameter")
+	} else if _, ok := err.(HostTypeError); !ok {
+		t.Errorf("unexpected error type %T: %v", err, err)
+	}
+	if err := env.Func("add", func() {}); err == nil {
+		t.Error("expected an error binding a duplicate name")
+	}
+}
+
+func TestHostModuleCall(t *testing.T) {
+	reg := NewHostRegistry()
+	if err := reg.Register(newTestHostModule(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register(NewHostModule("env")); err != ErrDuplicateHostModule {
+		t.Fatalf("got %v, want %v", err, ErrDuplicateHostModule)
+	}
+
+	m, err := wasm.ReadModule(bytes.NewReader(hostImportModule(t, addSig)), reg.Resolver(nil))
+	if err != nil {
+		t.Fatalf("could not read module: %v", err)
+	}
+	initMem := func(mem *sea.WavmMemory, module *wasm.Module) error {
+		mem.Pos = 1024
+		return nil
+	}
+	inter, err := NewInterpreter(m, nil, initMem, nil, nil, nil, false)
+	if err != nil {
+		t.Fatalf("could not create interpreter: %v", err)
+	}
+	inter.RecoverPanic = true
+
+	ptr, err := inter.ExecContractCode(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := inter.Memory.GetPtr(ptr); string(got) != "hellohello" {
+		t.Errorf("concat: got %q, want %q", got, "hellohello")
+	}
+
+	sum, err := inter.ExecContractCode(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(sum) != 42 {
+		t.Errorf("add: got %d, want 42", int64(sum))
+	}
+
+	_, err = inter.ExecContractCode(5)
+	if herr, ok := err.(HostFunctionError); !ok || herr.Err != errHostFail {
+		t.Errorf("fail: got error %v, want a HostFunctionError wrapping %v", err, errHostFail)
+	}
+}
+
+func TestHostModuleLinkErrors(t *testing.T) {
+	reg := NewHostRegistry()
+	if err := reg.Register(newTestHostModule(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	badSig := wasm.FunctionSig{
+		Form:        0,
+		ParamTypes:  []wasm.ValueType{wasm.ValueTypeI32},
+		ReturnTypes: []wasm.ValueType{wasm.ValueTypeI64},
+	}
+	_, err := wasm.ReadModule(bytes.NewReader(hostImportModule(t, badSig)), reg.Resolver(nil))
+	if _, ok := err.(wasm.InvalidImportError); !ok {
+		t.Errorf("signature mismatch: got error %v (%T), want wasm.InvalidImportError", err, err)
+	}
+
+	_, err = wasm.ReadModule(bytes.NewReader(hostImportModule(t, addSig)), NewHostRegistry().Resolver(nil))
+	if err == nil {
+		t.Error("expected an error resolving an unregistered module")
+	}
+
+	empty := NewHostRegistry()
+	empty.Register(NewHostModule("env"))
+	_, err = wasm.ReadModule(bytes.NewReader(hostImportModule(t, addSig)), empty.Resolver(nil))
+	if _, ok := err.(wasm.ExportNotFoundError); !ok {
+		t.Errorf("missing function: got error %v (%T), want wasm.ExportNotFoundError", err, err)
+	}
+}
+
+func TestHostModuleNoManagedMemory(t *testing.T) {
+	reg := NewHostRegistry()
+	reg.Register(newTestHostModule(t))
+	m, err := wasm.ReadModule(bytes.NewReader(hostImportModule(t, addSig)), reg.Resolver(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, err := NewVM(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.RecoverPanic = true
+
+	if _, err = vm.ExecCode(3); err != ErrNoManagedMemory {
+		t.Errorf("got error %v, want %v", err, ErrNoManagedMemory)
+	}
+	sum, err := vm.ExecCode(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.(uint64) != 42 {
+		t.Errorf("add: got %v, want 42", sum)
+	}
+}
@@ -114,17 +114,60 @@ type block struct {
 // TODO(vibhavp): Add options for optimizing code. Operators like i32.reinterpret/f32
 // are no-ops, and can be safely removed.
 func Compile(disassembly []disasm.Instr) ([]byte, []*sea.BranchTable) {
+	code, tables, _ := CompileWithOffsets(disassembly)
+	return code, tables
+}
+
+// CompileWithOffsets is like Compile, and also returns the offset in the
+// compiled code at which each instruction of the disassembly starts.
+// Unreachable instructions, which are not compiled, have an offset of -1.
+func CompileWithOffsets(disassembly []disasm.Instr) ([]byte, []*sea.BranchTable, []int64) {
+	return CompileWithOptions(disassembly, Options{})
+}
+
+// CompileWithOptions is like CompileWithOffsets, and applies the
+// optimizations enabled by opts. Instructions fused into a superinstruction
+// share its offset, and removed instructions have the offset of the next
+// compiled instruction.
+func CompileWithOptions(disassembly []disasm.Instr, opts Options) ([]byte, []*sea.BranchTable, []int64) {
 	buffer := new(bytes.Buffer)
 	branchTables := []*sea.BranchTable{}
 
 	curBlockDepth := -1
 	blocks := make(map[int]*block) // maps nesting depths (labels) to blocks
 
+	offsets := make([]int64, len(disassembly))
+
+	// fused is the number of instructions following a superinstruction
+	// that it replaces. cmp is the comparison to fuse with the
+	// next br_if.
+	fused := 0
+	var cmp byte
+
 	blocks[-1] = &block{}
-	for _, instr := range disassembly {
+	for i, instr := range disassembly {
 		if instr.Unreachable {
+			offsets[i] = -1
+			continue
+		}
+		offsets[i] = int64(buffer.Len())
+		if fused > 0 {
+			offsets[i] = offsets[i-1]
+			fused--
 			continue
 		}
+		if opts.Fuse {
+			if n := fuse(buffer, disassembly[i:]); n > 0 {
+				fused = n - 1
+				continue
+			}
+			if fusedCmp(instr.Op.Code) && i+1 < len(disassembly) {
+				if next := disassembly[i+1]; !next.Unreachable && next.Op.Code == ops.BrIf {
+					cmp = instr.Op.Code
+					continue
+				}
+			}
+		}
 		switch instr.Op.Code {
 		case ops.I32Load, ops.I64Load, ops.F32Load, ops.F64Load, ops.I32Load8s, ops.I32Load8u, ops.I32Load16s, ops.I32Load16u, ops.I64Load8s, ops.I64Load8u, ops.I64Load16s, ops.I64Load16u, ops.I64Load32s, ops.I64Load32u, ops.I32Store, ops.I64Store, ops.F32Store, ops.F64Store, ops.I32Store8, ops.I32Store16, ops.I64Store8, ops.I64Store16, ops.I64Store32:
 			// memory_immediate has two fields, the alignment and the offset.
@@ -238,7 +281,13 @@ func Compile(disassembly []disasm.Instr) ([]byte, []*sea.BranchTable) {
 			binary.Write(buffer, binary.LittleEndian, int64(0))
 			continue
 		case ops.BrIf:
-			buffer.WriteByte(OpJmpNz)
+			if cmp != 0 {
+				buffer.WriteByte(OpI32CmpJmpNz)
+				buffer.WriteByte(cmp)
+				cmp = 0
+			} else {
+				buffer.WriteByte(OpJmpNz)
+			}
 			label := int(instr.Immediates[0].(uint32))
 			block := blocks[curBlockDepth-int(label)]
 			block.patchOffsets = append(block.patchOffsets, int64(buffer.Len()))
@@ -312,7 +361,7 @@ func Compile(disassembly []disasm.Instr) ([]byte, []*sea.BranchTable) {
 	for _, table := range branchTables {
 		table.PatchedAddrs = nil
 	}
-	return buffer.Bytes(), branchTables
+	return buffer.Bytes(), branchTables, offsets
 }
 
 // replace the address starting at start with addr
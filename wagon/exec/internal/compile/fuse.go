@@ -0,0 +1,95 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compile
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+// Superinstructions emitted when compiling with Options.Fuse. Their
+// opcodes are outside the range of WebAssembly opcodes.
+var (
+	// OpLocalsI32Add replaces get_local a; get_local b; i32.add. Its
+	// immediates are the uint32 indices a and b.
+	OpLocalsI32Add byte = 0xc0
+	// OpLocalConstI32Add replaces get_local a; i32.const c; i32.add. Its
+	// immediates are the uint32 index a and the int32 constant c.
+	OpLocalConstI32Add byte = 0xc1
+	// OpConstI32Load replaces i32.const addr; i32.load offset. Its
+	// immediates are the uint32 address and offset.
+	OpConstI32Load byte = 0xc2
+	// OpI32CmpJmpNz replaces an i32 comparison followed by br_if. Its
+	// immediates are the opcode of the comparison followed by those of
+	// OpJmpNz.
+	OpI32CmpJmpNz byte = 0xc3
+)
+
+// Options controls the optimizations of the compile pass.
+type Options struct {
+	// Fuse rewrites common instruction sequences into superinstructions
+	// and removes values pushed only to be dropped.
+	Fuse bool
+}
+
+// fusedCmp reports whether op is an i32 comparison fused with a following
+// br_if into OpI32CmpJmpNz.
+func fusedCmp(op byte) bool {
+	return op == ops.I32Eqz || (op >= ops.I32Eq && op <= ops.I32GeU)
+}
+
+// pure reports whether instr only pushes a value on the stack.
+func pure(instr disasm.Instr) bool {
+	switch instr.Op.Code {
+	case ops.GetLocal, ops.GetGlobal, ops.I32Const, ops.I64Const, ops.F32Const, ops.F64Const:
+		return true
+	}
+	return false
+}
+
+// fuse writes to buffer the superinstruction replacing the instructions at
+// the start of code, and returns the number of instructions replaced, or 0
+// if no sequence matches. Sequences only hold straight-line instructions,
+// so that no branch targets their middle.
+func fuse(buffer *bytes.Buffer, code []disasm.Instr) int {
+	match := func(codes ...byte) bool {
+		if len(code) < len(codes) {
+			return false
+		}
+		for i, c := range codes {
+			if code[i].Unreachable || code[i].Op.Code != c {
+				return false
+			}
+		}
+		return true
+	}
+	write := func(op byte, imms ...interface{}) {
+		buffer.WriteByte(op)
+		for _, imm := range imms {
+			binary.Write(buffer, binary.LittleEndian, imm)
+		}
+	}
+
+	switch {
+	case match(ops.GetLocal, ops.GetLocal, ops.I32Add):
+		write(OpLocalsI32Add, code[0].Immediates[0].(uint32), code[1].Immediates[0].(uint32))
+		return 3
+	case match(ops.GetLocal, ops.I32Const, ops.I32Add):
+		write(OpLocalConstI32Add, code[0].Immediates[0].(uint32), code[1].Immediates[0].(int32))
+		return 3
+	case match(ops.I32Const, ops.I32Load):
+		write(OpConstI32Load, uint32(code[0].Immediates[0].(int32)), code[1].Immediates[1].(uint32))
+		return 2
+	case match(ops.TeeLocal, ops.Drop):
+		write(ops.SetLocal, code[0].Immediates[0].(uint32))
+		return 2
+	case len(code) >= 2 && pure(code[0]) && match(code[0].Op.Code, ops.Drop):
+		return 2
+	}
+	return 0
+}
@@ -16,6 +16,8 @@ type Interpreter struct {
 	Memory           *sea.WavmMemory
 	heapPointerIndex int64
 	Mutable          *bool
+
+	poolState *interpreterState // initial state, for interpreters of an InterpreterPool
 }
 
 func NewInterpreter(module *wasm.Module, compiled []sea.Compiled, initMem func(m *sea.WavmMemory, module *wasm.Module) error, captureOp func(pc uint64, op byte) error, captureEnvFunctionStart func(pc uint64, name string) error, captureEnvFunctionEnd func(pc uint64, name string) error, debug bool) (*Interpreter, error) {
@@ -29,19 +31,22 @@ func NewInterpreter(module *wasm.Module, compiled []sea.Compiled, initMem func(m
 	inter.heapPointerIndex = -1
 	mut := false
 	inter.Mutable = &mut
-	if module.Memory != nil && len(module.Memory.Entries) != 0 {
-		if len(module.Memory.Entries) > 1 {
-			return nil, ErrMultipleLinearMemories
-		}
-		vm.memory = make([]byte, uint(module.Memory.Entries[0].Limits.Initial)*wasmPageSize)
-		copy(vm.memory, module.LinearMemoryIndexSpace[0])
-	} else {
-		vm.memory = make([]byte, 1*wasmPageSize)
+	memories, err := newMemories(module, nil)
+	if err != nil {
+		return nil, err
 	}
+	if _, ok := module.MemoryLimits(0); !ok {
+		// contracts without a memory get a single page for host values.
+		memories[0] = NewMemory(wasm.ResizableLimits{Initial: 1})
+	}
+	vm.memories = memories
+	vm.memory = memories[0]
+	vm.tables = newTables(module)
 
-	inter.Memory.Memory = vm.memory
+	inter.Memory.Memory = vm.memory.data
+	inter.Memory.Grower = vm.memory
 	// init linear memory with module data section
-	err := initMem(inter.Memory, module)
+	err = initMem(inter.Memory, module)
 	if err != nil {
 		return nil, err
 	}
@@ -52,13 +57,33 @@ func NewInterpreter(module *wasm.Module, compiled []sea.Compiled, initMem func(m
 	vm.module = module
 
 	nNatives := 0
+	insts := make(tableInstances)
 	for i, fn := range module.FunctionIndexSpace {
+		// Functions of imported tables run in an instance of the module
+		// defining them.
+		imported, ok, err := insts.functionOf(module, i)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			vm.funcs[i] = imported
+			continue
+		}
 		// Skip native methods as they need not be
 		// disassembled; simply add them at the end
 		// of the `funcs` array as is, as specified
 		// in the spec. See the "host functions"
 		// section of:
 		// https://webassembly.github.io/spec/core/exec/modules.html#allocation
+		if hf, ok := hostFunctionOf(fn); ok {
+			vm.funcs[i] = hostCall{
+				fn:      hf,
+				memory:  inter.Memory,
+				mutable: inter.Mutable,
+			}
+			nNatives++
+			continue
+		}
 		if fn.IsHost() {
 			vm.funcs[i] = contractFunction{
 				typ:     fn.Host.Type(),
@@ -134,6 +159,7 @@ func NewInterpreter(module *wasm.Module, compiled []sea.Compiled, initMem func(m
 			if v.Kind == wasm.ExternalGlobal {
 				inter.heapPointerIndex = int64(v.Index)
 				inter.Memory.Pos = int(vm.globals[inter.heapPointerIndex])
+				inter.Memory.HeapPointer = &vm.globals[inter.heapPointerIndex]
 			}
 		}
 	}
@@ -193,9 +219,14 @@ func (vm *VM) ExecContractCode(fnIndex int64, args ...uint64) (ret uint64, err e
 		vm.ctx.locals[i] = arg
 	}
 
-	res := vm.execCode(compiled)
+	if vm.tracer != nil {
+		vm.tracer.CaptureStart(fnIndex, args)
+		defer vm.traceEnd(&ret, &err)
+	}
+
+	ret = vm.execCode(compiled)
 
-	return res, nil
+	return ret, nil
 }
 
 func (vm *VM) Module() *wasm.Module {
@@ -0,0 +1,68 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/sea"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/builder"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+// TestInterpreterAllocAfterGrow checks that a block reused from the free
+// list after the contract grew its memory is written to the memory the
+// contract sees.
+func TestInterpreterAllocAfterGrow(t *testing.T) {
+	b := builder.New().
+		AddMemory(wasm.ResizableLimits{Flags: 1, Initial: 1, Maximum: 2}).
+		AddGlobal("heap_pointer", true, int32(16)).
+		AddFunction("grow", loadSig, nil, []disasm.Instr{
+			builder.Instr(ops.I32Const, int32(1)),
+			builder.Instr(ops.GrowMemory, uint8(0)),
+		}).
+		AddFunction("load", wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{wasm.ValueTypeI32}, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI64}}, nil, []disasm.Instr{
+			builder.Instr(ops.GetLocal, uint32(0)),
+			builder.Instr(ops.I64Load, uint32(3), uint32(0)),
+		})
+	b.Export("heap_pointer", wasm.ExternalGlobal, b.Global("heap_pointer"))
+	m, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	initMem := func(mem *sea.WavmMemory, module *wasm.Module) error { return nil }
+	inter, err := NewInterpreter(m, nil, initMem, nil, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := inter.Memory.Alloc([]byte("previous"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = inter.Memory.Free(uint64(p)); err != nil {
+		t.Fatal(err)
+	}
+	if pages, err := inter.ExecContractCode(int64(b.Function("grow"))); err != nil || pages != 1 {
+		t.Fatalf("grow_memory returned %d, %v, want 1", pages, err)
+	}
+	q, err := inter.Memory.Alloc([]byte("abcdefgh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != p {
+		t.Fatalf("got block %d, want the freed block %d", q, p)
+	}
+	ret, err := inter.ExecContractCode(int64(b.Function("load")), uint64(q))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := binary.LittleEndian.Uint64([]byte("abcdefgh")); ret != want {
+		t.Errorf("contract loaded %#x, want %#x", ret, want)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"errors"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+// maxPages is the number of pages addressable by a 32-bit linear memory.
+const maxPages = 65536
+
+// ErrMemoryNotExported is returned by (*VM).ExportedMemory when the module
+// has no memory export with the requested name.
+var ErrMemoryNotExported = errors.New("exec: memory not exported")
+
+// Memory is a linear memory instance. A Memory may be shared between the
+// VMs of linked modules, one exporting it and the others importing it.
+//
+// A Memory is not safe for concurrent use.
+type Memory struct {
+	data   []byte
+	limits wasm.ResizableLimits
+}
+
+// NewMemory creates a linear memory of limits.Initial pages.
+func NewMemory(limits wasm.ResizableLimits) *Memory {
+	return &Memory{
+		data:   make([]byte, int(limits.Initial)*wasmPageSize),
+		limits: limits,
+	}
+}
+
+// Bytes returns the content of the memory. The slice is invalidated when
+// the memory grows.
+func (m *Memory) Bytes() []byte {
+	return m.data
+}
+
+// Pages returns the size of the memory in pages.
+func (m *Memory) Pages() uint32 {
+	return uint32(len(m.data) / wasmPageSize)
+}
+
+// Limits returns the limits of the memory, with Initial set to its current
+// size.
+func (m *Memory) Limits() wasm.ResizableLimits {
+	limits := m.limits
+	limits.Initial = m.Pages()
+	return limits
+}
+
+// Grow grows the memory by n pages and returns its previous size in pages.
+// It returns -1 and leaves the memory unchanged if the new size would exceed
+// the maximum of the memory.
+func (m *Memory) Grow(n uint32) int32 {
+	cur := m.Pages()
+	max := uint64(maxPages)
+	if m.limits.HasMaximum() && uint64(m.limits.Maximum) < max {
+		max = uint64(m.limits.Maximum)
+	}
+	if uint64(cur)+uint64(n) > max {
+		return -1
+	}
+	if n > 0 {
+		m.data = append(m.data, make([]byte, int(n)*wasmPageSize)...)
+	}
+	return int32(cur)
+}
+
+// Memories returns the linear memories of the VM, by index in the memory
+// index space.
+func (vm *VM) Memories() []*Memory {
+	return vm.memories
+}
+
+// ExportedMemory returns the memory exported by the module under name,
+// for sharing it with the VM of another module through Imports.
+func (vm *VM) ExportedMemory(name string) (*Memory, error) {
+	if vm.module.Export != nil {
+		e, ok := vm.module.Export.Entries[name]
+		if ok && e.Kind == wasm.ExternalMemory && int(e.Index) < len(vm.memories) {
+			return vm.memories[e.Index], nil
+		}
+	}
+	return nil, ErrMemoryNotExported
+}
+
+// Imports holds the memories, functions, tables and globals shared with a
+// VM created by NewVMWithImports.
+type Imports struct {
+	Memories  map[string]*Memory     // imported memories, keyed by "module.field"
+	Functions map[string]FunctionRef // imported functions, keyed by "module.field"
+	Tables    map[string]TableRef    // imported tables, keyed by "module.field"
+	Globals   map[string]uint64      // values of imported globals, keyed by "module.field"
+}
+
+// AddMemory shares mem as the memory imported as field from module.
+func (i *Imports) AddMemory(module, field string, mem *Memory) {
+	if i.Memories == nil {
+		i.Memories = make(map[string]*Memory)
+	}
+	i.Memories[module+"."+field] = mem
+}
+
+// AddFunction makes fn the function imported as field from module. The
+// function runs in the VM of fn, with its memories and globals.
+func (i *Imports) AddFunction(module, field string, fn FunctionRef) {
+	if i.Functions == nil {
+		i.Functions = make(map[string]FunctionRef)
+	}
+	i.Functions[module+"."+field] = fn
+}
+
+// AddTable makes t the table imported as field from module. The functions
+// of the table run in the VM of t, with its memories and globals.
+func (i *Imports) AddTable(module, field string, t TableRef) {
+	if i.Tables == nil {
+		i.Tables = make(map[string]TableRef)
+	}
+	i.Tables[module+"."+field] = t
+}
+
+// AddGlobal sets the value of the global imported as field from module.
+func (i *Imports) AddGlobal(module, field string, val uint64) {
+	if i.Globals == nil {
+		i.Globals = make(map[string]uint64)
+	}
+	i.Globals[module+"."+field] = val
+}
+
+// newMemories creates the linear memories of module. Imported memories
+// provided by imports are shared, and the data segments of module are
+// written to them; other memories are created from the module's limits
+// and initial data.
+func newMemories(module *wasm.Module, imports *Imports) ([]*Memory, error) {
+	imported := module.ImportEntries(wasm.ExternalMemory)
+	n := len(imported)
+	if module.Memory != nil {
+		n += len(module.Memory.Entries)
+	}
+	if n == 0 {
+		n = 1
+	}
+	memories := make([]*Memory, 0, n)
+	for i := 0; i < n; i++ {
+		var data []byte
+		if i < len(module.LinearMemoryIndexSpace) {
+			data = module.LinearMemoryIndexSpace[i]
+		}
+		limits, ok := module.MemoryLimits(uint32(i))
+		if !ok {
+			// modules without a memory keep an empty one.
+			memories = append(memories, &Memory{limits: wasm.ResizableLimits{Flags: 1}})
+			continue
+		}
+		if i < len(imported) && imports != nil {
+			e := imported[i]
+			if mem, ok := imports.Memories[e.ModuleName+"."+e.FieldName]; ok {
+				if !mem.Limits().Matches(limits) {
+					return nil, wasm.ImportLimitsError{ModuleName: e.ModuleName, FieldName: e.FieldName, Kind: wasm.ExternalMemory}
+				}
+				if err := initData(module, mem, uint32(i)); err != nil {
+					return nil, err
+				}
+				memories = append(memories, mem)
+				continue
+			}
+		}
+		if i < len(imported) {
+			// an imported memory holds the whole memory of the exporter,
+			// which may be larger than declared by the import.
+			if pages := uint32((len(data) + wasmPageSize - 1) / wasmPageSize); pages > limits.Initial {
+				limits.Initial = pages
+			}
+		}
+		mem := NewMemory(limits)
+		copy(mem.data, data)
+		memories = append(memories, mem)
+	}
+	return memories, nil
+}
+
+// initData writes the data segments of module for the memory at index
+// to mem.
+func initData(module *wasm.Module, mem *Memory, index uint32) error {
+	if module.Data == nil {
+		return nil
+	}
+	for _, entry := range module.Data.Entries {
+		if entry.Index != index {
+			continue
+		}
+		val, err := module.ExecInitExpr(entry.Offset)
+		if err != nil {
+			return err
+		}
+		offset, ok := val.(int32)
+		if !ok || uint64(uint32(offset))+uint64(len(entry.Data)) > uint64(len(mem.data)) {
+			return ErrOutOfBoundsMemoryAccess
+		}
+		copy(mem.data[uint32(offset):], entry.Data)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/validate"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/builder"
+)
+
+var i32Sig = wasm.FunctionSig{Form: 0, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}
+
+func encodeModule(t *testing.T, m *wasm.Module) []byte {
+	buf := new(bytes.Buffer)
+	if err := wasm.EncodeModule(buf, m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readModule reads the module built by b, changed by edit if not nil for
+// the parts of a module the builder does not write, with the imports
+// resolved by resolve.
+func readModule(t *testing.T, b *builder.Builder, edit func(m *wasm.Module), resolve wasm.ResolveFunc) *wasm.Module {
+	raw, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edit != nil {
+		m, err := wasm.DecodeModule(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		edit(m)
+		raw = encodeModule(t, m)
+	}
+	m, err := wasm.ReadModule(bytes.NewReader(raw), resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// exporterModule encodes a module exporting a memory of at most two pages
+// as "mem", and a table holding a function calling a function returning
+// its global 42 as "tab".
+func exporterModule(t *testing.T) []byte {
+	return encodeModule(t, &wasm.Module{
+		Types:    &wasm.SectionTypes{Entries: []wasm.FunctionSig{i32Sig}},
+		Function: &wasm.SectionFunctions{Types: []uint32{0, 0}},
+		Table: &wasm.SectionTables{
+			Entries: []wasm.Table{{ElementType: wasm.ElemTypeAnyFunc, Limits: wasm.ResizableLimits{Initial: 1}}},
+		},
+		Global: &wasm.SectionGlobals{
+			Globals: []wasm.GlobalEntry{{Type: wasm.GlobalVar{Type: wasm.ValueTypeI32}, Init: []byte{0x41, 0x2a, 0x0b}}},
+		},
+		Memory: &wasm.SectionMemories{
+			Entries: []wasm.Memory{{Limits: wasm.ResizableLimits{Flags: 1, Initial: 1, Maximum: 2}}},
+		},
+		Export: &wasm.SectionExports{
+			Entries: map[string]wasm.ExportEntry{
+				"mem": {FieldStr: "mem", Kind: wasm.ExternalMemory, Index: 0},
+				"tab": {FieldStr: "tab", Kind: wasm.ExternalTable, Index: 0},
+			},
+		},
+		Elements: &wasm.SectionElements{
+			Entries: []wasm.ElementSegment{{Offset: []byte{0x41, 0x00, 0x0b}, Elems: []uint32{0}}},
+		},
+		Code: &wasm.SectionCode{
+			Bodies: []wasm.FunctionBody{{Code: []byte{0x10, 0x01}}, {Code: []byte{0x23, 0x00}}},
+		},
+		Data: &wasm.SectionData{
+			Entries: []wasm.DataSegment{{Offset: []byte{0x41, 0x00, 0x0b}, Data: []byte("hi")}},
+		},
+	})
+}
+
+// linkedModule encodes a module importing env.mem with memLimits and
+// env.tab, with a function storing 7 at address 8 and calling the first
+// element of the table, and a function growing the memory twice by one page.
+func linkedModule(t *testing.T, memLimits wasm.ResizableLimits) []byte {
+	return encodeModule(t, &wasm.Module{
+		Types: &wasm.SectionTypes{Entries: []wasm.FunctionSig{i32Sig}},
+		Import: &wasm.SectionImports{
+			Entries: []wasm.ImportEntry{
+				{ModuleName: "env", FieldName: "mem", Type: wasm.MemoryImport{Type: wasm.Memory{Limits: memLimits}}},
+				{ModuleName: "env", FieldName: "tab", Type: wasm.TableImport{Type: wasm.Table{ElementType: wasm.ElemTypeAnyFunc, Limits: wasm.ResizableLimits{Initial: 1}}}},
+			},
+		},
+		Function: &wasm.SectionFunctions{Types: []uint32{0, 0}},
+		Code: &wasm.SectionCode{
+			Bodies: []wasm.FunctionBody{
+				{Code: []byte{0x41, 0x08, 0x41, 0x07, 0x36, 0x02, 0x00, 0x41, 0x00, 0x11, 0x00, 0x00}},
+				{Code: []byte{0x41, 0x01, 0x40, 0x00, 0x1a, 0x41, 0x01, 0x40, 0x00}},
+			},
+		},
+	})
+}
+
+func readLinkedModules(t *testing.T, memLimits wasm.ResizableLimits) (exporter, importer *wasm.Module, err error) {
+	exporter, err = wasm.ReadModule(bytes.NewReader(exporterModule(t)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	importer, err = wasm.ReadModule(bytes.NewReader(linkedModule(t, memLimits)), func(name string) (*wasm.Module, error) {
+		return exporter, nil
+	})
+	return exporter, importer, err
+}
+
+func TestMemoryGrow(t *testing.T) {
+	mem := NewMemory(wasm.ResizableLimits{Flags: 1, Initial: 1, Maximum: 3})
+	if got := mem.Grow(2); got != 1 {
+		t.Errorf("Grow(2) = %d, want 1", got)
+	}
+	if got := mem.Grow(1); got != -1 {
+		t.Errorf("Grow(1) past the maximum = %d, want -1", got)
+	}
+	if mem.Pages() != 3 || len(mem.Bytes()) != 3*wasmPageSize {
+		t.Errorf("got %d pages and %d bytes, want 3 pages", mem.Pages(), len(mem.Bytes()))
+	}
+
+	mem = NewMemory(wasm.ResizableLimits{})
+	if got := mem.Grow(maxPages + 1); got != -1 {
+		t.Errorf("Grow(%d) = %d, want -1", maxPages+1, got)
+	}
+}
+
+func TestSharedMemory(t *testing.T) {
+	exporter, importer, err := readLinkedModules(t, wasm.ResizableLimits{Initial: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	evm, err := NewVM(exporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem, err := evm.ExportedMemory("mem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := evm.ExportedMemory("tab"); err != ErrMemoryNotExported {
+		t.Errorf("ExportedMemory(tab): got error %v, want %v", err, ErrMemoryNotExported)
+	}
+
+	var imports Imports
+	imports.AddMemory("env", "mem", mem)
+	vm, err := NewVMWithImports(importer, &imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vm.Memories()[0] != mem {
+		t.Fatal("imported memory is not shared")
+	}
+
+	// the table element calls the function of the exporter.
+	ret, err := vm.ExecCode(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != uint32(42) {
+		t.Errorf("call_indirect returned %v, want 42", ret)
+	}
+	if got := evm.Memory()[8]; got != 7 {
+		t.Errorf("exporter memory at 8 = %d, want 7", got)
+	}
+	if got := string(evm.Memory()[:2]); got != "hi" {
+		t.Errorf("exporter memory = %q, want %q", got, "hi")
+	}
+
+	// the maximum of the exporter's memory applies to the importer.
+	ret, err = vm.ExecCode(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != uint32(0xffffffff) {
+		t.Errorf("grow_memory past the maximum returned %v, want -1", ret)
+	}
+	if mem.Pages() != 2 || len(evm.Memory()) != 2*wasmPageSize {
+		t.Errorf("got %d pages, want 2", mem.Pages())
+	}
+}
+
+func TestImportedMemoryCopy(t *testing.T) {
+	_, importer, err := readLinkedModules(t, wasm.ResizableLimits{Initial: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the function of the table refers to the index spaces of the
+	// exporter.
+	if err = validate.VerifyModule(importer); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := NewVM(importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(vm.Memory()[:2]); got != "hi" {
+		t.Errorf("imported memory = %q, want %q", got, "hi")
+	}
+	if ret, err := vm.ExecCode(0); err != nil || ret != uint32(42) {
+		t.Fatalf("call_indirect returned %v, %v, want 42", ret, err)
+	}
+}
+
+func TestImportLimits(t *testing.T) {
+	for _, limits := range []wasm.ResizableLimits{
+		{Initial: 2},
+		{Flags: 1, Initial: 1, Maximum: 1},
+	} {
+		_, _, err := readLinkedModules(t, limits)
+		want := wasm.ImportLimitsError{ModuleName: "env", FieldName: "mem", Kind: wasm.ExternalMemory}
+		if err != want {
+			t.Errorf("limits %+v: got error %v, want %v", limits, err, want)
+		}
+	}
+
+	_, importer, err := readLinkedModules(t, wasm.ResizableLimits{Initial: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imports Imports
+	imports.AddMemory("env", "mem", NewMemory(wasm.ResizableLimits{}))
+	if _, err := NewVMWithImports(importer, &imports); err == nil {
+		t.Error("NewVMWithImports accepted a memory smaller than the import")
+	}
+}
+
+func TestMultipleMemories(t *testing.T) {
+	m, err := wasm.ReadModule(bytes.NewReader(encodeModule(t, &wasm.Module{
+		Types:    &wasm.SectionTypes{Entries: []wasm.FunctionSig{i32Sig}},
+		Function: &wasm.SectionFunctions{Types: []uint32{0}},
+		Memory: &wasm.SectionMemories{
+			Entries: []wasm.Memory{
+				{Limits: wasm.ResizableLimits{Initial: 1}},
+				{Limits: wasm.ResizableLimits{Flags: 1, Initial: 2, Maximum: 2}},
+			},
+		},
+		Code: &wasm.SectionCode{
+			// grow_memory 1 (i32.const 0) + current_memory 1
+			Bodies: []wasm.FunctionBody{{Code: []byte{0x41, 0x00, 0x40, 0x01, 0x3f, 0x01, 0x6a}}},
+		},
+		Data: &wasm.SectionData{
+			Entries: []wasm.DataSegment{{Index: 1, Offset: []byte{0x41, 0x00, 0x0b}, Data: []byte("second")}},
+		},
+	})), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, err := NewVM(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mems := vm.Memories()
+	if len(mems) != 2 || mems[0].Pages() != 1 || mems[1].Pages() != 2 {
+		t.Fatalf("got %d memories", len(mems))
+	}
+	if got := string(mems[1].Bytes()[:6]); got != "second" {
+		t.Errorf("second memory = %q, want %q", got, "second")
+	}
+	ret, err := vm.ExecCode(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != uint32(4) {
+		t.Errorf("got %v, want 4", ret)
+	}
+}
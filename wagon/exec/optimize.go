@@ -0,0 +1,100 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/exec/internal/compile"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+// Optimize recompiles the functions of the VM with the peephole optimizer
+// of the compile pass, which fuses common instruction sequences into
+// superinstructions and removes values pushed only to be dropped.
+//
+// Optimized code executes fewer, larger steps: tracers and the debug hooks
+// observe the superinstructions, named by OpName, and GasUsed counts each
+// of them as a single instruction.
+func (vm *VM) Optimize() error {
+	for i, fn := range vm.funcs {
+		compiled, ok := fn.(compiledFunction)
+		if !ok {
+			continue
+		}
+		d, err := disasm.Disassemble(vm.module.FunctionIndexSpace[i], vm.module)
+		if err != nil {
+			return err
+		}
+		compiled.code, compiled.branchTables, _ = compile.CompileWithOptions(d.Code, compile.Options{Fuse: true})
+		vm.funcs[i] = compiled
+	}
+	vm.optimized = true
+	return nil
+}
+
+// compileOptions returns the options the functions of the VM are compiled
+// with.
+func (vm *VM) compileOptions() compile.Options {
+	return compile.Options{Fuse: vm.optimized}
+}
+
+func (vm *VM) localsI32Add() {
+	a := vm.fetchUint32()
+	b := vm.fetchUint32()
+	vm.pushUint32(uint32(vm.ctx.locals[a]) + uint32(vm.ctx.locals[b]))
+}
+
+func (vm *VM) localConstI32Add() {
+	a := vm.fetchUint32()
+	c := vm.fetchUint32()
+	vm.pushUint32(uint32(vm.ctx.locals[a]) + c)
+}
+
+func (vm *VM) constI32Load() {
+	addr := vm.fetchUint32()
+	addr += vm.fetchUint32()
+	if int(addr)+3 >= len(vm.memory.data) {
+		panic(ErrOutOfBoundsMemoryAccess)
+	}
+	vm.pushUint32(endianess.Uint32(vm.memory.data[addr:]))
+}
+
+// i32Cmp pops the operands of the i32 comparison op and returns its result.
+func (vm *VM) i32Cmp(op byte) bool {
+	if op == ops.I32Eqz {
+		return vm.popUint32() == 0
+	}
+	v2 := vm.popUint32()
+	v1 := vm.popUint32()
+	return i32Compare(op, v1, v2)
+}
+
+// i32Compare returns the result of the binary i32 comparison op of v1 and
+// v2.
+func i32Compare(op byte, v1, v2 uint32) bool {
+	switch op {
+	case ops.I32Eq:
+		return v1 == v2
+	case ops.I32Ne:
+		return v1 != v2
+	case ops.I32LtS:
+		return int32(v1) < int32(v2)
+	case ops.I32LtU:
+		return v1 < v2
+	case ops.I32GtS:
+		return int32(v1) > int32(v2)
+	case ops.I32GtU:
+		return v1 > v2
+	case ops.I32LeS:
+		return int32(v1) <= int32(v2)
+	case ops.I32LeU:
+		return v1 <= v2
+	case ops.I32GeS:
+		return int32(v1) >= int32(v2)
+	case ops.I32GeU:
+		return v1 >= v2
+	}
+	panic(ops.InvalidOpcodeError(op))
+}
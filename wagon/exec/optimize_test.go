@@ -0,0 +1,127 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+// optimizeTestModule returns a module with the function
+//
+//	(func (param $n i32) (result i32) (local $i i32) (local $s i32)
+//	  block loop
+//	    get_local $i get_local $n i32.ge_s br_if 1
+//	    get_local $s get_local $i i32.add set_local $s
+//	    get_local $i i32.const 1 i32.add tee_local $i drop
+//	    i32.const 7 drop
+//	    br 0
+//	  end end
+//	  get_local $s i32.const 0 i32.load i32.add)
+//
+// and the value 1000 stored at address 0.
+func optimizeTestModule(t *testing.T) *wasm.Module {
+	i32 := wasm.ValueTypeI32
+	m := &wasm.Module{
+		Types: &wasm.SectionTypes{
+			Entries: []wasm.FunctionSig{{Form: 0, ParamTypes: []wasm.ValueType{i32}, ReturnTypes: []wasm.ValueType{i32}}},
+		},
+		Function: &wasm.SectionFunctions{Types: []uint32{0}},
+		Memory: &wasm.SectionMemories{
+			Entries: []wasm.Memory{{Limits: wasm.ResizableLimits{Initial: 1}}},
+		},
+		Code: &wasm.SectionCode{
+			Bodies: []wasm.FunctionBody{{
+				Locals: []wasm.LocalEntry{{Count: 2, Type: i32}},
+				Code: []byte{
+					0x02, 0x40, 0x03, 0x40,
+					0x20, 0x01, 0x20, 0x00, 0x4e, 0x0d, 0x01,
+					0x20, 0x02, 0x20, 0x01, 0x6a, 0x21, 0x02,
+					0x20, 0x01, 0x41, 0x01, 0x6a, 0x22, 0x01, 0x1a,
+					0x41, 0x07, 0x1a,
+					0x0c, 0x00,
+					0x0b, 0x0b,
+					0x20, 0x02, 0x41, 0x00, 0x28, 0x02, 0x00, 0x6a,
+				},
+			}},
+		},
+		Data: &wasm.SectionData{
+			Entries: []wasm.DataSegment{{Offset: []byte{0x41, 0x00, 0x0b}, Data: []byte{0xe8, 0x03, 0x00, 0x00}}},
+		},
+	}
+	buf := new(bytes.Buffer)
+	if err := wasm.EncodeModule(buf, m); err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.ReadModule(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestOptimize(t *testing.T) {
+	m := optimizeTestModule(t)
+	plain, err := NewVM(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret, err := plain.ExecCode(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != uint32(1045) {
+		t.Fatalf("got %v, want 1045", ret)
+	}
+
+	vm, err := NewVM(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = vm.Optimize(); err != nil {
+		t.Fatal(err)
+	}
+	logger := NewStructLogger(&LogConfig{DisableLocals: true, DisableMemory: true})
+	vm.SetTracer(logger)
+	ret, err = vm.ExecCode(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != uint32(1045) {
+		t.Fatalf("optimized code returned %v, want 1045", ret)
+	}
+	if vm.GasUsed() >= plain.GasUsed() {
+		t.Errorf("optimized code executed %d instructions, not fewer than %d", vm.GasUsed(), plain.GasUsed())
+	}
+
+	cm, err := vm.CodeMap(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, l := range logger.Logs() {
+		seen[l.OpName] = true
+		if l.OpName == "drop" {
+			t.Error("optimized code executed a drop")
+		}
+		if cm.Lookup(l.Pc) < 0 {
+			t.Errorf("pc %d of %s is not mapped to an instruction", l.Pc, l.OpName)
+		}
+	}
+	for _, name := range []string{"get_local.get_local.i32.add", "get_local.i32.const.i32.add", "i32.const.i32.load", "i32.cmp.jmpnz", "set_local"} {
+		if !seen[name] {
+			t.Errorf("optimized code did not execute %s", name)
+		}
+	}
+
+	// an out of bounds constant load still traps.
+	vm.memory.data = vm.memory.data[:2]
+	vm.RecoverPanic = true
+	if _, err = vm.ExecCode(0, 0); err == nil || err.Error() != ErrOutOfBoundsMemoryAccess.Error() {
+		t.Errorf("got error %v, want %v", err, ErrOutOfBoundsMemoryAccess)
+	}
+}
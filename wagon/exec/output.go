@@ -0,0 +1,131 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SeaModuleName is the name of the host module through which contracts emit
+// logs, set their return data and revert.
+const SeaModuleName = "sea"
+
+// MaxLogTopics is the maximum number of topics of a log.
+const MaxLogTopics = 4
+
+var (
+	// ErrReverted is the error value used while trapping the VM when the
+	// contract calls revert.
+	ErrReverted = errors.New("exec: execution reverted")
+	// ErrLogTopics is the error value used while trapping the VM when the
+	// topics passed to emit_log are not a list of at most MaxLogTopics
+	// 32-byte words.
+	ErrLogTopics = fmt.Errorf("exec: log topics must be at most %d 32-byte words", MaxLogTopics)
+)
+
+// Log is an event emitted by a contract.
+type Log struct {
+	Topics [][32]byte
+	Data   []byte
+}
+
+// CallResult is the outcome of a contract call. Its encoded fields are
+// plain byte strings, lists and integers, so it encodes with RLP as is,
+// like its logs for receipts.
+type CallResult struct {
+	Value        uint64 `rlp:"-"` // value returned by the function
+	Return       []byte // data passed to set_return; nil if reverted
+	Logs         []*Log // logs emitted, in order; nil if reverted
+	Reverted     bool
+	RevertReason []byte // data passed to revert
+}
+
+// callOutput collects the output of a contract during a call.
+type callOutput struct {
+	ret          []byte
+	logs         []*Log
+	reverted     bool
+	revertReason []byte
+}
+
+// EmitLog appends a log with the given topics and data to the output of
+// the current call.
+func (proc *WavmProcess) EmitLog(topics [][32]byte, data []byte) {
+	proc.vm.output.logs = append(proc.vm.output.logs, &Log{
+		Topics: append([][32]byte(nil), topics...),
+		Data:   append([]byte(nil), data...),
+	})
+}
+
+// SetReturn sets the return data of the current call, replacing the data
+// set before.
+func (proc *WavmProcess) SetReturn(data []byte) {
+	proc.vm.output.ret = append([]byte(nil), data...)
+}
+
+// Revert traps the VM with ErrReverted, discarding the logs of the current
+// call and recording reason as its revert reason.
+func (proc *WavmProcess) Revert(reason []byte) {
+	proc.vm.output.reverted = true
+	proc.vm.output.revertReason = append([]byte(nil), reason...)
+	panic(ErrReverted)
+}
+
+// NewSeaHostModule returns the "sea" host module, whose functions record
+// the output of a contract run by an Interpreter:
+//
+//	emit_log(topics_ptr, topics_len, data_ptr, data_len)
+//	set_return(ptr, len)
+//	revert(ptr, len)
+//
+// The topics of emit_log are topics_len bytes holding up to MaxLogTopics
+// consecutive 32-byte words. revert does not return.
+func NewSeaHostModule() *HostModule {
+	return NewHostModule(SeaModuleName).
+		MustFunc("emit_log", func(proc *WavmProcess, topics, data []byte) error {
+			if len(topics)%32 != 0 || len(topics) > 32*MaxLogTopics {
+				return ErrLogTopics
+			}
+			words := make([][32]byte, len(topics)/32)
+			for i := range words {
+				copy(words[i][:], topics[32*i:])
+			}
+			proc.EmitLog(words, data)
+			return nil
+		}).
+		MustFunc("set_return", func(proc *WavmProcess, data []byte) {
+			proc.SetReturn(data)
+		}).
+		MustFunc("revert", func(proc *WavmProcess, reason []byte) {
+			proc.Revert(reason)
+		})
+}
+
+// Call calls the function with the given index and arguments, like
+// ExecContractCode, and returns its output. A call ending with revert is
+// not an error: the result is marked Reverted, without logs or return data.
+// Other traps are returned as errors, whatever RecoverPanic is.
+func (inter *Interpreter) Call(fnIndex int64, args ...uint64) (*CallResult, error) {
+	inter.output = callOutput{}
+	defer func() { inter.output = callOutput{} }()
+
+	recoverPanic := inter.RecoverPanic
+	inter.RecoverPanic = true
+	ret, err := inter.ExecContractCode(fnIndex, args...)
+	inter.RecoverPanic = recoverPanic
+
+	out := inter.output
+	if out.reverted && errors.Is(err, ErrReverted) {
+		return &CallResult{
+			Reverted:     true,
+			RevertReason: out.revertReason,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CallResult{Value: ret, Return: out.ret, Logs: out.logs}, nil
+}
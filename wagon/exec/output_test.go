@@ -0,0 +1,108 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/sea"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/builder"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+func TestCallOutput(t *testing.T) {
+	reg := NewHostRegistry()
+	if err := reg.Register(NewSeaHostModule()); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		i32    = wasm.ValueTypeI32
+		sig2   = wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{i32, i32}}
+		sig4   = wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{i32, i32, i32, i32}}
+		retI32 = wasm.FunctionSig{Form: 0, ReturnTypes: []wasm.ValueType{i32}}
+		c      = func(v int32) disasm.Instr { return builder.Instr(ops.I32Const, v) }
+		topics = append(bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)...)
+	)
+	b := builder.New().
+		AddImport("sea", "emit_log", sig4).
+		AddImport("sea", "set_return", sig2).
+		AddImport("sea", "revert", sig2).
+		AddMemory(wasm.ResizableLimits{Initial: 1}).
+		AddData(0, topics).
+		AddData(100, []byte("datareturnreason"))
+	emit := func(topicsLen, dataLen int32) []disasm.Instr {
+		return []disasm.Instr{c(0), c(topicsLen), c(100), c(dataLen), builder.Instr(ops.Call, b.Function("sea.emit_log"))}
+	}
+	var run []disasm.Instr
+	run = append(run, emit(64, 4)...)
+	run = append(run, emit(0, 0)...)
+	run = append(run, c(104), c(6), builder.Instr(ops.Call, b.Function("sea.set_return")), c(7))
+	var revert []disasm.Instr
+	revert = append(revert, emit(32, 4)...)
+	revert = append(revert, c(104), c(6), builder.Instr(ops.Call, b.Function("sea.set_return")))
+	revert = append(revert, c(110), c(6), builder.Instr(ops.Call, b.Function("sea.revert")), c(0))
+	b.AddFunction("run", retI32, nil, run).
+		AddFunction("revert", retI32, nil, revert).
+		AddFunction("badlog", wasm.FunctionSig{Form: 0}, nil, emit(31, 0))
+	b.Export("run", wasm.ExternalFunction, b.Function("run")).
+		Resolver(reg.Resolver(nil))
+	m, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	initMem := func(mem *sea.WavmMemory, module *wasm.Module) error {
+		mem.Pos = 1024
+		return nil
+	}
+	inter, err := NewInterpreter(m, nil, initMem, nil, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := inter.Call(int64(b.Function("run")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != 7 || res.Reverted || string(res.Return) != "return" {
+		t.Errorf("run: got value %d, reverted %v and return data %q", res.Value, res.Reverted, res.Return)
+	}
+	if len(res.Logs) != 2 {
+		t.Fatalf("run: got %d logs, want 2", len(res.Logs))
+	}
+	if l := res.Logs[0]; len(l.Topics) != 2 || l.Topics[1][0] != 2 || string(l.Data) != "data" {
+		t.Errorf("run: got log %+v", l)
+	}
+	if l := res.Logs[1]; len(l.Topics) != 0 || len(l.Data) != 0 {
+		t.Errorf("run: got log %+v, want an empty log", l)
+	}
+
+	res, err = inter.Call(int64(b.Function("revert")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Reverted || string(res.RevertReason) != "reason" || res.Logs != nil || res.Return != nil {
+		t.Errorf("revert: got %+v", res)
+	}
+
+	if _, err = inter.Call(int64(b.Function("badlog"))); !errors.Is(err, ErrLogTopics) {
+		t.Errorf("badlog: got error %v, want %v", err, ErrLogTopics)
+	}
+	if inter.RecoverPanic {
+		t.Error("RecoverPanic left set by Call")
+	}
+
+	// outputs do not leak into the next call.
+	res, err = inter.Call(int64(b.Function("run")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Logs) != 2 {
+		t.Errorf("got %d logs, want 2", len(res.Logs))
+	}
+}
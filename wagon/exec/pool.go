@@ -0,0 +1,228 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/sea-project/sea-pkg/wagon/sea"
+)
+
+// ModuleHash identifies the module of the interpreters of an
+// InterpreterPool.
+type ModuleHash [32]byte
+
+// HashModule returns the SHA-256 hash of the binary encoding of a module.
+func HashModule(code []byte) ModuleHash {
+	return sha256.Sum256(code)
+}
+
+// interpreterState is the state of an interpreter right after its
+// instantiation, restored when it is returned to an InterpreterPool.
+type interpreterState struct {
+	memories [][]byte
+	tables   [][]uint32
+	globals  []uint64
+	heap     *sea.WavmMemory // heap state, as copied by CopyState
+	bytes    int64
+}
+
+func (inter *Interpreter) snapshot() *interpreterState {
+	s := &interpreterState{
+		memories: make([][]byte, len(inter.memories)),
+		tables:   make([][]uint32, len(inter.tables)),
+		globals:  append([]uint64(nil), inter.globals...),
+		heap:     new(sea.WavmMemory),
+	}
+	s.heap.CopyState(inter.Memory)
+	for i, mem := range inter.memories {
+		s.memories[i] = append([]byte(nil), mem.data...)
+		s.bytes += int64(len(mem.data))
+	}
+	for i, t := range inter.tables {
+		s.tables[i] = append([]uint32(nil), t.elems...)
+		s.bytes += 4 * int64(len(t.elems))
+	}
+	s.bytes += 8 * int64(len(s.globals)+2*len(s.heap.Size))
+	return s
+}
+
+// restore resets inter to the state s, reusing its memory buffers.
+func (inter *Interpreter) restore(s *interpreterState) {
+	for i, mem := range inter.memories {
+		mem.data = append(mem.data[:0], s.memories[i]...)
+	}
+	for i, t := range inter.tables {
+		t.elems = append(t.elems[:0], s.tables[i]...)
+	}
+	copy(inter.globals, s.globals)
+	inter.Memory.Memory = inter.memory.data
+	inter.Memory.CopyState(s.heap)
+	*inter.Mutable = false
+	inter.ResetContext()
+	inter.abort = false
+	inter.tracer = nil
+	inter.gasUsed = 0
+	inter.recursiveCallDepth = 0
+	inter.output = callOutput{}
+}
+
+// memorySize returns the number of bytes held by the memories and tables
+// of inter.
+func (inter *Interpreter) memorySize() int64 {
+	var n int64
+	for _, mem := range inter.memories {
+		n += int64(cap(mem.data))
+	}
+	for _, t := range inter.tables {
+		n += 4 * int64(cap(t.elems))
+	}
+	return n
+}
+
+type pooledInterpreter struct {
+	hash  ModuleHash
+	inter *Interpreter
+	bytes int64
+}
+
+type poolEntry struct {
+	state *interpreterState
+	idle  []*list.Element
+}
+
+// InterpreterPool holds idle interpreters for reuse by later calls to the
+// same module. Interpreters are handed out reset to the state they had
+// after their instantiation: the contents of their memories and tables,
+// their globals and the heap pointer. An InterpreterPool is safe for
+// concurrent use; an Interpreter is used by a single goroutine between Get
+// and Put.
+//
+// The memory held by idle interpreters and their initial states is bounded
+// by the size given to NewInterpreterPool. The least recently returned
+// interpreters are dropped first.
+type InterpreterPool struct {
+	mu      sync.Mutex
+	max     int64
+	size    int64
+	entries map[ModuleHash]*poolEntry
+	lru     *list.List // idle interpreters, least recently returned first
+}
+
+// NewInterpreterPool creates a pool holding at most maxBytes of idle
+// interpreter memory.
+func NewInterpreterPool(maxBytes int64) *InterpreterPool {
+	return &InterpreterPool{
+		max:     maxBytes,
+		entries: make(map[ModuleHash]*poolEntry),
+		lru:     list.New(),
+	}
+}
+
+// Get returns an idle interpreter of the module identified by hash, or one
+// created by calling create, whose state is recorded for resetting it in
+// Put.
+func (p *InterpreterPool) Get(hash ModuleHash, create func() (*Interpreter, error)) (*Interpreter, error) {
+	p.mu.Lock()
+	if e, ok := p.entries[hash]; ok && len(e.idle) > 0 {
+		elem := e.idle[len(e.idle)-1]
+		e.idle = e.idle[:len(e.idle)-1]
+		pi := p.lru.Remove(elem).(*pooledInterpreter)
+		p.size -= pi.bytes
+		if len(e.idle) == 0 {
+			// the interpreter keeps the state for Put.
+			p.drop(hash, e)
+		}
+		p.mu.Unlock()
+		return pi.inter, nil
+	}
+	p.mu.Unlock()
+
+	inter, err := create()
+	if err != nil {
+		return nil, err
+	}
+	inter.poolState = inter.snapshot()
+	return inter, nil
+}
+
+// Put resets inter and returns it to the pool for the module identified by
+// hash. inter must have been obtained from Get with the same hash, and must
+// not be used after Put. Interpreters not obtained from the pool, and
+// interpreters that do not fit in the pool, are dropped.
+func (p *InterpreterPool) Put(hash ModuleHash, inter *Interpreter) {
+	state := inter.poolState
+	if state == nil {
+		return
+	}
+	inter.restore(state)
+	pi := &pooledInterpreter{hash: hash, inter: inter, bytes: inter.memorySize()}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.entries[hash]
+	need := pi.bytes
+	if !ok {
+		need += state.bytes
+	}
+	if need > p.max {
+		return
+	}
+	if !ok {
+		e = &poolEntry{state: state}
+		p.entries[hash] = e
+		p.size += state.bytes
+	}
+	// idle interpreters share the state of their entry, the only one
+	// counted in size.
+	inter.poolState = e.state
+	e.idle = append(e.idle, p.lru.PushBack(pi))
+	p.size += pi.bytes
+	for p.size > p.max {
+		p.evict()
+	}
+}
+
+// evict drops the least recently returned idle interpreter, and the initial
+// state of its module if no other interpreter of the module is idle.
+func (p *InterpreterPool) evict() {
+	elem := p.lru.Front()
+	pi := p.lru.Remove(elem).(*pooledInterpreter)
+	p.size -= pi.bytes
+	e := p.entries[pi.hash]
+	for i, el := range e.idle {
+		if el == elem {
+			e.idle = append(e.idle[:i], e.idle[i+1:]...)
+			break
+		}
+	}
+	if len(e.idle) == 0 {
+		p.drop(pi.hash, e)
+	}
+}
+
+// drop removes the entry e of the module identified by hash, which holds no
+// idle interpreter.
+func (p *InterpreterPool) drop(hash ModuleHash, e *poolEntry) {
+	delete(p.entries, hash)
+	p.size -= e.state.bytes
+}
+
+// Len returns the number of idle interpreters in the pool.
+func (p *InterpreterPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lru.Len()
+}
+
+// Size returns the number of bytes held by the idle interpreters of the
+// pool and the initial states of their modules.
+func (p *InterpreterPool) Size() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
@@ -0,0 +1,253 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/sea"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+// poolModule encodes a module with a memory holding "hi" at address 0 and
+// an exported heap_pointer global initialized to 16, with a function
+// storing 'A' at address 0 and returning the incremented heap pointer.
+func poolModule(t *testing.T) []byte {
+	return encodeModule(t, &wasm.Module{
+		Types:    &wasm.SectionTypes{Entries: []wasm.FunctionSig{i32Sig}},
+		Function: &wasm.SectionFunctions{Types: []uint32{0}},
+		Memory: &wasm.SectionMemories{
+			Entries: []wasm.Memory{{Limits: wasm.ResizableLimits{Initial: 1}}},
+		},
+		Global: &wasm.SectionGlobals{
+			Globals: []wasm.GlobalEntry{{
+				Type: wasm.GlobalVar{Type: wasm.ValueTypeI32, Mutable: true},
+				Init: []byte{0x41, 0x10, 0x0b},
+			}},
+		},
+		Export: &wasm.SectionExports{
+			Entries: map[string]wasm.ExportEntry{
+				"touch":        {FieldStr: "touch", Kind: wasm.ExternalFunction, Index: 0},
+				"heap_pointer": {FieldStr: "heap_pointer", Kind: wasm.ExternalGlobal, Index: 0},
+			},
+		},
+		Code: &wasm.SectionCode{
+			Bodies: []wasm.FunctionBody{{Code: []byte{
+				0x41, 0x00, 0x41, 0x41, 0x3a, 0x00, 0x00,
+				0x23, 0x00, 0x41, 0x01, 0x6a, 0x24, 0x00, 0x23, 0x00,
+			}}},
+		},
+		Data: &wasm.SectionData{
+			Entries: []wasm.DataSegment{{Offset: []byte{0x41, 0x00, 0x0b}, Data: []byte("hi")}},
+		},
+	})
+}
+
+func newPoolInterpreter(t *testing.T, raw []byte) func() (*Interpreter, error) {
+	return func() (*Interpreter, error) {
+		m, err := wasm.ReadModule(bytes.NewReader(raw), nil)
+		if err != nil {
+			return nil, err
+		}
+		initMem := func(mem *sea.WavmMemory, module *wasm.Module) error { return nil }
+		return NewInterpreter(m, nil, initMem, nil, nil, nil, false)
+	}
+}
+
+func TestInterpreterPool(t *testing.T) {
+	raw := poolModule(t)
+	hash := HashModule(raw)
+	create := newPoolInterpreter(t, raw)
+	pool := NewInterpreterPool(1 << 20)
+
+	inter, err := pool.Get(hash, create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inter.Memory.Pos != 16 {
+		t.Fatalf("got heap position %d, want 16", inter.Memory.Pos)
+	}
+	for i := 0; i < 2; i++ {
+		ret, err := inter.ExecContractCode(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := uint64(17 + i); ret != want {
+			t.Fatalf("call %d: got %d, want %d", i, ret, want)
+		}
+	}
+	inter.Memory.SetBytes([]byte("state"))
+	pool.Put(hash, inter)
+	if pool.Len() != 1 {
+		t.Fatalf("got %d idle interpreters, want 1", pool.Len())
+	}
+
+	reused, err := pool.Get(hash, func() (*Interpreter, error) {
+		t.Fatal("created an interpreter with one idle")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused != inter {
+		t.Fatal("got a new interpreter, want the idle one")
+	}
+	if got := string(reused.Memory.Memory[:2]); got != "hi" {
+		t.Errorf("got memory %q, want %q", got, "hi")
+	}
+	if reused.Memory.Pos != 16 || len(reused.Memory.Size) != 0 {
+		t.Errorf("got heap position %d and %d allocations, want 16 and 0", reused.Memory.Pos, len(reused.Memory.Size))
+	}
+	if ret, err := reused.ExecContractCode(0); err != nil || ret != 17 {
+		t.Errorf("got %d, %v, want 17", ret, err)
+	}
+
+	// interpreters not obtained from the pool are dropped.
+	other, err := create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Put(hash, other)
+	if pool.Len() != 0 {
+		t.Errorf("got %d idle interpreters, want 0", pool.Len())
+	}
+}
+
+func TestInterpreterPoolBound(t *testing.T) {
+	raw := poolModule(t)
+	hash := HashModule(raw)
+	create := newPoolInterpreter(t, raw)
+
+	// a page for the initial state and two idle interpreters.
+	pool := NewInterpreterPool(3*wasmPageSize + 1024)
+	var inters []*Interpreter
+	for i := 0; i < 4; i++ {
+		inter, err := pool.Get(hash, create)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inters = append(inters, inter)
+	}
+	for _, inter := range inters {
+		pool.Put(hash, inter)
+		if size := pool.Size(); size > 3*wasmPageSize+1024 {
+			t.Fatalf("pool holds %d bytes", size)
+		}
+	}
+	if pool.Len() != 2 {
+		t.Errorf("got %d idle interpreters, want 2", pool.Len())
+	}
+	// the least recently returned interpreters were dropped.
+	for i := 3; i >= 2; i-- {
+		inter, err := pool.Get(hash, create)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inter != inters[i] {
+			t.Errorf("got interpreter %p, want %p", inter, inters[i])
+		}
+	}
+	if pool.Size() != 0 {
+		t.Errorf("empty pool holds %d bytes", pool.Size())
+	}
+
+	small := NewInterpreterPool(1024)
+	inter, err := small.Get(hash, create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	small.Put(hash, inter)
+	if small.Len() != 0 {
+		t.Errorf("got %d idle interpreters, want 0", small.Len())
+	}
+}
+
+// retainedBytes returns the number of bytes held by the idle interpreters
+// of p and the distinct states they keep.
+func retainedBytes(p *InterpreterPool) int64 {
+	var n int64
+	states := make(map[*interpreterState]bool)
+	for elem := p.lru.Front(); elem != nil; elem = elem.Next() {
+		inter := elem.Value.(*pooledInterpreter).inter
+		n += inter.memorySize()
+		if s := inter.poolState; !states[s] {
+			states[s] = true
+			n += s.bytes
+		}
+	}
+	return n
+}
+
+func TestInterpreterPoolRetainedBytes(t *testing.T) {
+	raw := poolModule(t)
+	hash := HashModule(raw)
+	create := newPoolInterpreter(t, raw)
+
+	// interpreters created while none is idle each record a state.
+	pool := NewInterpreterPool(4*wasmPageSize + 1024)
+	var inters []*Interpreter
+	for i := 0; i < 3; i++ {
+		inter, err := pool.Get(hash, create)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inters = append(inters, inter)
+	}
+	for _, inter := range inters {
+		pool.Put(hash, inter)
+	}
+	if pool.Len() != 3 {
+		t.Fatalf("got %d idle interpreters, want 3", pool.Len())
+	}
+	if got, want := retainedBytes(pool), pool.Size(); got != want {
+		t.Errorf("idle interpreters retain %d bytes, pool counts %d", got, want)
+	}
+	if size := pool.Size(); size > 4*wasmPageSize+1024 {
+		t.Errorf("pool holds %d bytes", size)
+	}
+}
+
+func TestInterpreterPoolConcurrent(t *testing.T) {
+	raw := poolModule(t)
+	hash := HashModule(raw)
+	create := newPoolInterpreter(t, raw)
+	pool := NewInterpreterPool(4 * wasmPageSize)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				inter, err := pool.Get(hash, create)
+				if err != nil {
+					errs <- err
+					return
+				}
+				ret, err := inter.ExecContractCode(0)
+				if err == nil && ret != 17 {
+					err = fmt.Errorf("got %d, want 17", ret)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				pool.Put(hash, inter)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if size := pool.Size(); size > 4*wasmPageSize {
+		t.Errorf("pool holds %d bytes", size)
+	}
+}
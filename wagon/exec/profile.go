@@ -0,0 +1,353 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+// FunctionProfile holds the counters collected by a Profiler for a function.
+type FunctionProfile struct {
+	Index        int64         // index in the function index space
+	Name         string        // name from the name section, the imports or the exports
+	Host         bool          // whether the function is imported
+	Calls        uint64        // number of calls
+	Instructions uint64        // instructions executed in the function itself
+	WallTime     time.Duration // time spent in the function itself
+}
+
+type profileSample struct {
+	stack []int64 // function indices, leaf last
+	calls uint64
+	instr uint64
+	wall  time.Duration
+}
+
+// Profiler is a Tracer counting executed instructions and wall time per
+// function and per call stack. Time spent in imported functions is
+// accounted to the import, so host calls show up in the profile.
+//
+// A Profiler is installed with (*VM).SetTracer and accumulates over all the
+// calls made to the VM until Reset is called. It is not safe for concurrent
+// use by multiple VMs.
+type Profiler struct {
+	funcs   []FunctionProfile
+	start   time.Time
+	last    time.Time
+	stack   []int64
+	cur     *profileSample
+	samples map[string]*profileSample
+	key     []byte
+}
+
+// NewProfiler creates a Profiler for the functions of m.
+func NewProfiler(m *wasm.Module) *Profiler {
+	names := m.FunctionNames()
+	imported := 0
+	if m.Import != nil {
+		for _, e := range m.Import.Entries {
+			if _, ok := e.Type.(wasm.FuncImport); ok {
+				imported++
+			}
+		}
+	}
+	p := &Profiler{funcs: make([]FunctionProfile, len(names))}
+	for i, name := range names {
+		p.funcs[i] = FunctionProfile{
+			Index: int64(i),
+			Name:  name,
+			Host:  i < imported || m.FunctionIndexSpace[i].IsHost(),
+		}
+	}
+	p.Reset()
+	return p
+}
+
+// Reset discards the collected counters.
+func (p *Profiler) Reset() {
+	for i := range p.funcs {
+		f := &p.funcs[i]
+		f.Calls, f.Instructions, f.WallTime = 0, 0, 0
+	}
+	p.samples = make(map[string]*profileSample)
+	p.stack = p.stack[:0]
+	p.cur = nil
+	p.start = time.Now()
+}
+
+// Functions returns the counters of the functions that were called,
+// sorted by function index.
+func (p *Profiler) Functions() []FunctionProfile {
+	var out []FunctionProfile
+	for _, f := range p.funcs {
+		if f.Calls > 0 {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// charge accounts the time elapsed since the last event to the current
+// call stack.
+func (p *Profiler) charge() {
+	now := time.Now()
+	if p.cur != nil {
+		d := now.Sub(p.last)
+		p.cur.wall += d
+		p.funcs[p.stack[len(p.stack)-1]].WallTime += d
+	}
+	p.last = now
+}
+
+// sample returns the sample of the current call stack.
+func (p *Profiler) sample() *profileSample {
+	p.key = p.key[:0]
+	var buf [binary.MaxVarintLen64]byte
+	for _, i := range p.stack {
+		n := binary.PutVarint(buf[:], i)
+		p.key = append(p.key, buf[:n]...)
+	}
+	s, ok := p.samples[string(p.key)]
+	if !ok {
+		s = &profileSample{stack: append([]int64(nil), p.stack...)}
+		p.samples[string(p.key)] = s
+	}
+	return s
+}
+
+// push enters the function at index and makes its call stack current.
+func (p *Profiler) push(index int64) {
+	p.stack = append(p.stack, index)
+	p.cur = p.sample()
+	p.cur.calls++
+	p.funcs[index].Calls++
+}
+
+// pop leaves the current function and makes the caller's call stack current.
+func (p *Profiler) pop() {
+	p.stack = p.stack[:len(p.stack)-1]
+	p.cur = nil
+	if len(p.stack) > 0 {
+		p.cur = p.sample()
+	}
+}
+
+// CaptureStart implements Tracer.
+func (p *Profiler) CaptureStart(fnIndex int64, args []uint64) {
+	p.stack = p.stack[:0]
+	p.charge()
+	p.push(fnIndex)
+}
+
+// CaptureStep implements Tracer.
+func (p *Profiler) CaptureStep(vm *VM, log *StructLog) {
+	if p.cur != nil {
+		p.cur.instr++
+		p.funcs[log.Func].Instructions++
+	}
+}
+
+// CaptureEnter implements Tracer.
+func (p *Profiler) CaptureEnter(depth int, fnIndex int64) {
+	p.charge()
+	p.push(fnIndex)
+}
+
+// CaptureExit implements Tracer.
+func (p *Profiler) CaptureExit(depth int, fnIndex int64) {
+	p.charge()
+	p.pop()
+}
+
+// CaptureEnd implements Tracer.
+func (p *Profiler) CaptureEnd(ret uint64, err error) {
+	p.charge()
+	p.stack = p.stack[:0]
+	p.cur = nil
+}
+
+// WriteProfile writes the collected samples to w as a gzipped pprof
+// profile.proto, readable by `go tool pprof`. The profile has three sample
+// types: calls, instructions (the default) and wall time.
+func (p *Profiler) WriteProfile(w io.Writer) error {
+	samples := make([]*profileSample, 0, len(p.samples))
+	for _, s := range p.samples {
+		samples = append(samples, s)
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		a, b := samples[i].stack, samples[j].stack
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+
+	var b profileBuilder
+	b.strings = map[string]int64{"": 0}
+	b.stringTable = []string{""}
+
+	var vt protoBuffer
+	for _, typ := range [][2]string{{"calls", "count"}, {"instructions", "count"}, {"wall", "nanoseconds"}} {
+		vt.reset()
+		vt.int64(1, b.str(typ[0]))
+		vt.int64(2, b.str(typ[1]))
+		b.msg(1, &vt)
+	}
+
+	// function and location IDs are the function index plus one.
+	used := make(map[int64]bool)
+	var sb protoBuffer
+	for _, s := range samples {
+		sb.reset()
+		locs := make([]uint64, len(s.stack))
+		for i, f := range s.stack {
+			// the leaf comes first.
+			locs[len(locs)-1-i] = uint64(f) + 1
+			used[f] = true
+		}
+		sb.packedUint64(1, locs)
+		sb.packedInt64(2, []int64{int64(s.calls), int64(s.instr), int64(s.wall)})
+		b.msg(2, &sb)
+	}
+
+	indices := make([]int64, 0, len(used))
+	for f := range used {
+		indices = append(indices, f)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	var lb, line protoBuffer
+	for _, f := range indices {
+		lb.reset()
+		lb.uint64(1, uint64(f)+1)
+		line.reset()
+		line.uint64(1, uint64(f)+1)
+		lb.msg(4, &line)
+		b.msg(4, &lb)
+	}
+	var fb protoBuffer
+	for _, f := range indices {
+		fb.reset()
+		fb.uint64(1, uint64(f)+1)
+		name := b.str(p.funcs[f].Name)
+		fb.int64(2, name)
+		fb.int64(3, name)
+		b.msg(5, &fb)
+	}
+
+	// the string table must be written after every string is interned.
+	defaultType := b.str("instructions")
+	for _, s := range b.stringTable {
+		b.out.string(6, s)
+	}
+	b.out.int64(9, p.start.UnixNano())
+	b.out.int64(10, int64(time.Since(p.start)))
+	b.out.int64(14, defaultType)
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.out.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// profileBuilder accumulates a profile.proto message.
+type profileBuilder struct {
+	out         protoBuffer
+	strings     map[string]int64
+	stringTable []string
+}
+
+// str interns s in the string table and returns its index.
+func (b *profileBuilder) str(s string) int64 {
+	if i, ok := b.strings[s]; ok {
+		return i
+	}
+	i := int64(len(b.stringTable))
+	b.strings[s] = i
+	b.stringTable = append(b.stringTable, s)
+	return i
+}
+
+func (b *profileBuilder) msg(tag int, m *protoBuffer) {
+	b.out.msg(tag, m)
+}
+
+// protoBuffer is a minimal protocol buffers encoder, sufficient to write
+// the profile.proto messages.
+type protoBuffer struct {
+	data []byte
+	tmp  []byte
+}
+
+func (b *protoBuffer) reset() {
+	b.data = b.data[:0]
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	b.data = append(b.data, buf[:n]...)
+}
+
+func (b *protoBuffer) key(tag, wireType int) {
+	b.varint(uint64(tag)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) uint64(tag int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(tag, 0)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64(tag int, x int64) {
+	b.uint64(tag, uint64(x))
+}
+
+func (b *protoBuffer) bytes(tag int, p []byte) {
+	b.key(tag, 2)
+	b.varint(uint64(len(p)))
+	b.data = append(b.data, p...)
+}
+
+// string always writes s, as repeated strings such as the string table
+// must keep their empty entries.
+func (b *protoBuffer) string(tag int, s string) {
+	b.key(tag, 2)
+	b.varint(uint64(len(s)))
+	b.data = append(b.data, s...)
+}
+
+func (b *protoBuffer) msg(tag int, m *protoBuffer) {
+	b.bytes(tag, m.data)
+}
+
+func (b *protoBuffer) packedUint64(tag int, xs []uint64) {
+	b.tmp = b.tmp[:0]
+	var buf [binary.MaxVarintLen64]byte
+	for _, x := range xs {
+		n := binary.PutUvarint(buf[:], x)
+		b.tmp = append(b.tmp, buf[:n]...)
+	}
+	b.bytes(tag, b.tmp)
+}
+
+func (b *protoBuffer) packedInt64(tag int, xs []int64) {
+	us := make([]uint64, len(xs))
+	for i, x := range xs {
+		us[i] = uint64(x)
+	}
+	b.packedUint64(tag, us)
+}
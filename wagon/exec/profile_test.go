@@ -0,0 +1,299 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/leb128"
+)
+
+func TestProfiler(t *testing.T) {
+	reg := NewHostRegistry()
+	if err := reg.Register(newTestHostModule(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	names := wasm.NameSection{Functions: wasm.NameMap{4: "add_answer"}}
+	sec, err := names.Section()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// append the name section to the encoded module.
+	buf := bytes.NewBuffer(hostImportModule(t, addSig))
+	buf.WriteByte(byte(wasm.SectionIDCustom))
+	leb128.WriteVarUint32(buf, uint32(len(sec.Bytes)))
+	buf.Write(sec.Bytes)
+
+	m, err := wasm.ReadModule(bytes.NewReader(buf.Bytes()), reg.Resolver(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, err := NewVM(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProfiler(m)
+	vm.SetTracer(p)
+	for i := 0; i < 3; i++ {
+		if _, err := vm.ExecCode(4); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	funcs := p.Functions()
+	if len(funcs) != 2 {
+		t.Fatalf("got %d profiled functions, want 2: %+v", len(funcs), funcs)
+	}
+	add, caller := funcs[0], funcs[1]
+	if add.Name != "env.add" || !add.Host || add.Calls != 3 || add.Instructions != 0 {
+		t.Errorf("got host function profile %+v", add)
+	}
+	if caller.Name != "add_answer" || caller.Host || caller.Calls != 3 || caller.Instructions != 3*4 {
+		t.Errorf("got function profile %+v", caller)
+	}
+
+	out := new(bytes.Buffer)
+	if err := p.WriteProfile(out); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proto, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof, err := decodeProfile(proto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"calls/count", "instructions/count", "wall/nanoseconds"}; !reflect.DeepEqual(prof.types, want) {
+		t.Errorf("got sample types %v, want %v", prof.types, want)
+	}
+	if prof.defaultType != "instructions" {
+		t.Errorf("got default sample type %q", prof.defaultType)
+	}
+	stacks := make(map[string][]int64)
+	for _, s := range prof.samples {
+		var names []string
+		for _, loc := range s.locs {
+			name, ok := prof.locations[loc]
+			if !ok {
+				t.Fatalf("sample refers to unknown location %d", loc)
+			}
+			names = append(names, name)
+		}
+		stacks[strings.Join(names, ";")] = s.values
+	}
+	// the leaf comes first.
+	want := map[string][]int64{
+		"add_answer":         {3, 3 * 4},
+		"env.add;add_answer": {3, 0},
+	}
+	if len(stacks) != len(want) {
+		t.Fatalf("got samples %v, want %v", stacks, want)
+	}
+	for stack, values := range want {
+		got, ok := stacks[stack]
+		if !ok || len(got) != 3 || got[0] != values[0] || got[1] != values[1] || got[2] < 0 {
+			t.Errorf("got values %v for stack %q, want %v and a wall time", got, stack, values)
+		}
+	}
+
+	p.Reset()
+	if len(p.Functions()) != 0 {
+		t.Error("Reset did not discard the counters")
+	}
+}
+
+// testProfile is the part of a decoded profile.proto checked by the tests.
+type testProfile struct {
+	types       []string // type/unit of each sample value
+	defaultType string
+	samples     []testSample
+	locations   map[uint64]string // location ID to function name
+}
+
+type testSample struct {
+	locs   []uint64
+	values []int64
+}
+
+type protoField struct {
+	tag   int
+	value uint64 // varint fields
+	data  []byte // length-delimited fields
+}
+
+// protoFields splits a protocol buffers message into its fields. Only the
+// varint and length-delimited wire types used by profile.proto are supported.
+func protoFields(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("bad field key")
+		}
+		b = b[n:]
+		f := protoField{tag: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			if f.value, n = binary.Uvarint(b); n <= 0 {
+				return nil, errors.New("bad varint")
+			}
+			b = b[n:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errors.New("bad length")
+			}
+			f.data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func packedVarints(b []byte) ([]uint64, error) {
+	var xs []uint64
+	for len(b) > 0 {
+		x, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("bad packed varint")
+		}
+		xs = append(xs, x)
+		b = b[n:]
+	}
+	return xs, nil
+}
+
+// decodeProfile decodes an uncompressed profile.proto message.
+func decodeProfile(b []byte) (*testProfile, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		strs      []string
+		types     [][2]uint64
+		locFuncs  = make(map[uint64]uint64)
+		funcNames = make(map[uint64]uint64)
+		defType   uint64
+		p         = &testProfile{locations: make(map[uint64]string)}
+	)
+	for _, f := range fields {
+		var sub []protoField
+		switch f.tag {
+		case 1, 2, 4, 5: // messages
+			if sub, err = protoFields(f.data); err != nil {
+				return nil, err
+			}
+		}
+		switch f.tag {
+		case 1: // sample_type
+			var vt [2]uint64
+			for _, g := range sub {
+				if g.tag == 1 || g.tag == 2 {
+					vt[g.tag-1] = g.value
+				}
+			}
+			types = append(types, vt)
+		case 2: // sample
+			var s testSample
+			for _, g := range sub {
+				xs, err := packedVarints(g.data)
+				if err != nil {
+					return nil, err
+				}
+				switch g.tag {
+				case 1:
+					s.locs = xs
+				case 2:
+					for _, x := range xs {
+						s.values = append(s.values, int64(x))
+					}
+				}
+			}
+			p.samples = append(p.samples, s)
+		case 4: // location
+			var id uint64
+			for _, g := range sub {
+				switch g.tag {
+				case 1:
+					id = g.value
+				case 4: // line
+					line, err := protoFields(g.data)
+					if err != nil {
+						return nil, err
+					}
+					for _, l := range line {
+						if l.tag == 1 {
+							locFuncs[id] = l.value
+						}
+					}
+				}
+			}
+		case 5: // function
+			var id, name uint64
+			for _, g := range sub {
+				switch g.tag {
+				case 1:
+					id = g.value
+				case 2:
+					name = g.value
+				}
+			}
+			funcNames[id] = name
+		case 6: // string_table
+			strs = append(strs, string(f.data))
+		case 14: // default_sample_type
+			defType = f.value
+		}
+	}
+	str := func(i uint64) (string, error) {
+		if i >= uint64(len(strs)) {
+			return "", fmt.Errorf("string index %d out of range", i)
+		}
+		return strs[i], nil
+	}
+	for _, vt := range types {
+		typ, err := str(vt[0])
+		if err != nil {
+			return nil, err
+		}
+		unit, err := str(vt[1])
+		if err != nil {
+			return nil, err
+		}
+		p.types = append(p.types, typ+"/"+unit)
+	}
+	if p.defaultType, err = str(defType); err != nil {
+		return nil, err
+	}
+	for loc, fn := range locFuncs {
+		name, ok := funcNames[fn]
+		if !ok {
+			return nil, fmt.Errorf("location %d refers to unknown function %d", loc, fn)
+		}
+		if p.locations[loc], err = str(name); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,315 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+var (
+	// ErrFunctionNotExported is returned by (*VM).ExportedFunction when the
+	// module has no function export with the requested name.
+	ErrFunctionNotExported = errors.New("exec: function not exported")
+	// ErrGlobalNotExported is returned by (*VM).ExportedGlobal when the
+	// module has no global export with the requested name.
+	ErrGlobalNotExported = errors.New("exec: global not exported")
+	// ErrDuplicateInstance is returned by (*Store).Instantiate when the
+	// store already has an instance with the requested name.
+	ErrDuplicateInstance = errors.New("exec: duplicate instance")
+)
+
+// FunctionRef refers to a function of a VM, for importing it in the VM of
+// another module through Imports.
+type FunctionRef struct {
+	VM    *VM
+	Index int64 // index in the function index space of the module of VM
+}
+
+// ExportedFunction returns the function exported by the module under name.
+func (vm *VM) ExportedFunction(name string) (FunctionRef, error) {
+	if vm.module.Export != nil {
+		e, ok := vm.module.Export.Entries[name]
+		if ok && e.Kind == wasm.ExternalFunction && int(e.Index) < len(vm.funcs) {
+			return FunctionRef{VM: vm, Index: int64(e.Index)}, nil
+		}
+	}
+	return FunctionRef{}, ErrFunctionNotExported
+}
+
+// ExportedGlobal returns the current value of the global exported by the
+// module under name.
+func (vm *VM) ExportedGlobal(name string) (uint64, error) {
+	if vm.module.Export != nil {
+		e, ok := vm.module.Export.Entries[name]
+		if ok && e.Kind == wasm.ExternalGlobal && int(e.Index) < len(vm.globals) {
+			return vm.globals[e.Index], nil
+		}
+	}
+	return 0, ErrGlobalNotExported
+}
+
+// importedFunction is a function imported from the VM of another module,
+// which runs it with its own memories and globals.
+type importedFunction struct {
+	FunctionRef
+	args    int
+	returns bool
+}
+
+func (fn importedFunction) call(vm *VM, index int64) {
+	target := fn.VM
+	// the target is left as it was if the callee traps, as the stack of
+	// the context is truncated to its length before the call.
+	defer func(ctx context) { target.ctx = ctx }(target.ctx)
+	args := make([]uint64, fn.args)
+	for i := fn.args - 1; i >= 0; i-- {
+		args[i] = vm.popUint64()
+	}
+	for _, arg := range args {
+		target.pushUint64(arg)
+	}
+	if vm.cancelCtx != nil && target.cancelCtx == nil {
+		// the callee stops with the caller.
+		defer target.watch(vm.cancelCtx)()
+	}
+	target.funcs[fn.Index].call(target, fn.Index)
+	if target.abort {
+		target.abort = false
+		vm.abort = true
+	}
+	if fn.returns {
+		vm.pushUint64(target.popUint64())
+	}
+}
+
+// importedFunctionOf returns the function imported as the i-th function of
+// module, if imports provides it. The functions appended to the function
+// index space for an imported table are imported from the VM exporting the
+// table.
+func importedFunctionOf(module *wasm.Module, imports *Imports, i int) (function, bool, error) {
+	if imports == nil {
+		return nil, false, nil
+	}
+	if table, elem, ok := module.ImportedTableElement(i); ok {
+		return tableFunctionOf(module, imports, table, elem)
+	}
+	if len(imports.Functions) == 0 {
+		return nil, false, nil
+	}
+	entries := module.ImportEntries(wasm.ExternalFunction)
+	if i >= len(entries) {
+		return nil, false, nil
+	}
+	e := entries[i]
+	ref, ok := imports.Functions[e.ModuleName+"."+e.FieldName]
+	if !ok {
+		return nil, false, nil
+	}
+	typ := e.Type.(wasm.FuncImport).Type
+	fn := ref.VM.module.GetFunction(int(ref.Index))
+	if fn == nil || int(typ) >= len(module.Types.Entries) || !fn.Sig.Equal(module.Types.Entries[typ]) {
+		return nil, false, wasm.InvalidImportError{ModuleName: e.ModuleName, FieldName: e.FieldName, TypeIndex: typ}
+	}
+	return newImportedFunction(ref, fn), true, nil
+}
+
+// tableFunctionOf returns the function held by element elem of the table
+// imported at index table of module, if imports provides the table.
+func tableFunctionOf(module *wasm.Module, imports *Imports, table, elem uint32) (function, bool, error) {
+	entries := module.ImportEntries(wasm.ExternalTable)
+	if int(table) >= len(entries) {
+		return nil, false, nil
+	}
+	e := entries[table]
+	ref, ok := imports.Tables[e.ModuleName+"."+e.FieldName]
+	if !ok {
+		return nil, false, nil
+	}
+	elems := ref.VM.module.TableIndexSpace[ref.Index]
+	if int(elem) >= len(elems) {
+		return nil, false, wasm.InvalidTableIndexError(elem)
+	}
+	fn := ref.VM.module.GetFunction(int(elems[elem]))
+	if fn == nil {
+		return nil, false, wasm.InvalidFunctionIndexError(elems[elem])
+	}
+	return newImportedFunction(FunctionRef{VM: ref.VM, Index: int64(elems[elem])}, fn), true, nil
+}
+
+// tableInstances holds the instances of the modules defining the functions
+// of tables imported without a store, created once per module.
+type tableInstances map[*wasm.Module]*VM
+
+// functionOf returns the i-th function of module, if it was appended to the
+// function index space for an imported table, run in an instance of the
+// module defining it.
+func (insts tableInstances) functionOf(module *wasm.Module, i int) (function, bool, error) {
+	def, index, ok := module.ImportedTableFunction(i)
+	if !ok {
+		return nil, false, nil
+	}
+	vm, ok := insts[def]
+	if !ok {
+		var err error
+		if vm, err = NewVM(def); err != nil {
+			return nil, false, err
+		}
+		insts[def] = vm
+	}
+	return newImportedFunction(FunctionRef{VM: vm, Index: int64(index)}, def.GetFunction(int(index))), true, nil
+}
+
+func newImportedFunction(ref FunctionRef, fn *wasm.Function) importedFunction {
+	return importedFunction{
+		FunctionRef: ref,
+		args:        len(fn.Sig.ParamTypes),
+		returns:     len(fn.Sig.ReturnTypes) != 0,
+	}
+}
+
+// Store holds named instances of modules, linked to each other: a module
+// instantiated in a store imports the functions, memories and globals
+// exported by the instances created before it.
+//
+// A module must be read with the resolver returned by (*Store).Resolver
+// before being instantiated:
+//
+//	s := exec.NewStore()
+//	lib, err := wasm.ReadModule(libFile, s.Resolver(nil))
+//	...
+//	_, err = s.Instantiate("lib", lib)
+//	...
+//	app, err := wasm.ReadModule(appFile, s.Resolver(nil))
+//	...
+//	inst, err := s.Instantiate("app", app)
+//	...
+//	res, err := inst.Call("main")
+//
+// Each instance has its own VM, memories and globals. An imported function,
+// called directly or through an imported table, runs in the instance
+// exporting it, with that instance's memories and globals; an imported
+// memory is shared with the exporting instance, and an imported global is a
+// copy of the value of the exported one when the importing module is
+// instantiated. An imported table holds the elements of the exported one
+// when the importing module is read.
+type Store struct {
+	instances map[string]*Instance
+}
+
+// NewStore returns an empty store.
+func NewStore() *Store {
+	return &Store{instances: make(map[string]*Instance)}
+}
+
+// Resolver returns a wasm.ResolveFunc resolving the names of the instances
+// of s to their modules, and other names with fallback, which may be nil.
+func (s *Store) Resolver(fallback wasm.ResolveFunc) wasm.ResolveFunc {
+	return func(name string) (*wasm.Module, error) {
+		if inst, ok := s.instances[name]; ok {
+			return inst.module, nil
+		}
+		if fallback == nil {
+			return nil, fmt.Errorf("exec: no instance %q in store", name)
+		}
+		return fallback(name)
+	}
+}
+
+// Instance returns the instance of s named name, if any.
+func (s *Store) Instance(name string) (*Instance, bool) {
+	inst, ok := s.instances[name]
+	return inst, ok
+}
+
+// Instantiate creates the instance of m named name, linking the imports of m
+// from instances of s. Imports from modules which are not instances of s,
+// such as host modules, are left to NewVMWithImports. The start function of
+// m, if any, runs before Instantiate returns.
+func (s *Store) Instantiate(name string, m *wasm.Module) (*Instance, error) {
+	if _, ok := s.instances[name]; ok {
+		return nil, ErrDuplicateInstance
+	}
+	imports := new(Imports)
+	if m.Import != nil {
+		for _, e := range m.Import.Entries {
+			from, ok := s.instances[e.ModuleName]
+			if !ok {
+				continue
+			}
+			var err error
+			switch e.Type.Kind() {
+			case wasm.ExternalFunction:
+				var fn FunctionRef
+				if fn, err = from.vm.ExportedFunction(e.FieldName); err == nil {
+					imports.AddFunction(e.ModuleName, e.FieldName, fn)
+				}
+			case wasm.ExternalTable:
+				var t TableRef
+				if t, err = from.vm.ExportedTable(e.FieldName); err == nil {
+					imports.AddTable(e.ModuleName, e.FieldName, t)
+				}
+			case wasm.ExternalMemory:
+				var mem *Memory
+				if mem, err = from.vm.ExportedMemory(e.FieldName); err == nil {
+					imports.AddMemory(e.ModuleName, e.FieldName, mem)
+				}
+			case wasm.ExternalGlobal:
+				var val uint64
+				if val, err = from.vm.ExportedGlobal(e.FieldName); err == nil {
+					imports.AddGlobal(e.ModuleName, e.FieldName, val)
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("exec: import %s.%s: %v", e.ModuleName, e.FieldName, err)
+			}
+		}
+	}
+	vm, err := NewVMWithImports(m, imports)
+	if err != nil {
+		return nil, err
+	}
+	inst := &Instance{name: name, module: m, vm: vm}
+	s.instances[name] = inst
+	return inst, nil
+}
+
+// Instance is an instance of a module in a Store.
+type Instance struct {
+	name   string
+	module *wasm.Module
+	vm     *VM
+}
+
+// Name returns the name of the instance in its store.
+func (inst *Instance) Name() string { return inst.name }
+
+// Module returns the module of the instance.
+func (inst *Instance) Module() *wasm.Module { return inst.module }
+
+// VM returns the VM running the instance.
+func (inst *Instance) VM() *VM { return inst.vm }
+
+// Call calls the function exported as name by the instance, like ExecCode.
+func (inst *Instance) Call(name string, args ...uint64) (interface{}, error) {
+	fn, err := inst.vm.ExportedFunction(name)
+	if err != nil {
+		return nil, err
+	}
+	return inst.vm.ExecCode(fn.Index, args...)
+}
+
+// Memory returns the memory exported as name by the instance.
+func (inst *Instance) Memory(name string) (*Memory, error) {
+	return inst.vm.ExportedMemory(name)
+}
+
+// Global returns the current value of the global exported as name by the
+// instance.
+func (inst *Instance) Global(name string) (uint64, error) {
+	return inst.vm.ExportedGlobal(name)
+}
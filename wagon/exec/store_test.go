@@ -0,0 +1,259 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/builder"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+var (
+	storeSig = wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{wasm.ValueTypeI32}}
+	loadSig  = wasm.FunctionSig{Form: 0, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}
+)
+
+// libBuilder builds a module storing and loading an i32 at address 0 of its
+// memory, counting the stores in the exported global "count", and a
+// function "fail" trapping.
+func libBuilder() *builder.Builder {
+	b := builder.New().
+		AddMemory(wasm.ResizableLimits{Initial: 1}).
+		AddGlobal("count", true, int32(0)).
+		AddGlobal("base", false, int32(7))
+	b.AddFunction("store", storeSig, nil, []disasm.Instr{
+		builder.Instr(ops.I32Const, int32(0)),
+		builder.Instr(ops.GetLocal, uint32(0)),
+		builder.Instr(ops.I32Store, uint32(2), uint32(0)),
+		builder.Instr(ops.GetGlobal, b.Global("count")),
+		builder.Instr(ops.I32Const, int32(1)),
+		builder.Instr(ops.I32Add),
+		builder.Instr(ops.SetGlobal, b.Global("count")),
+	}).
+		AddFunction("load", loadSig, nil, []disasm.Instr{
+			builder.Instr(ops.I32Const, int32(0)),
+			builder.Instr(ops.I32Load, uint32(2), uint32(0)),
+		}).
+		AddFunction("fail", storeSig, nil, []disasm.Instr{
+			builder.Instr(ops.Unreachable),
+		})
+	return b.Export("store", wasm.ExternalFunction, b.Function("store")).
+		Export("load", wasm.ExternalFunction, b.Function("load")).
+		Export("fail", wasm.ExternalFunction, b.Function("fail")).
+		Export("count", wasm.ExternalGlobal, b.Global("count")).
+		Export("base", wasm.ExternalGlobal, b.Global("base")).
+		Export("memory", wasm.ExternalMemory, 0)
+}
+
+func libModule(t *testing.T) *wasm.Module {
+	return readModule(t, libBuilder(), nil, nil)
+}
+
+// appModule returns a module importing the functions and the global "base"
+// of lib, with a memory of its own.
+func appModule(t *testing.T, s *Store) *wasm.Module {
+	b := builder.New().
+		AddImport("lib", "store", storeSig).
+		AddImport("lib", "load", loadSig).
+		AddImport("lib", "fail", storeSig).
+		AddMemory(wasm.ResizableLimits{Initial: 1})
+	b.AddFunction("run", loadSig, nil, []disasm.Instr{
+		builder.Instr(ops.I32Const, int32(0)),
+		builder.Instr(ops.I32Const, int32(99)),
+		builder.Instr(ops.I32Store, uint32(2), uint32(0)),
+		builder.Instr(ops.I32Const, int32(5)),
+		builder.Instr(ops.Call, b.Function("lib.store")),
+		builder.Instr(ops.Call, b.Function("lib.load")),
+		builder.Instr(ops.I32Const, int32(0)),
+		builder.Instr(ops.I32Load, uint32(2), uint32(0)),
+		builder.Instr(ops.I32Add),
+		builder.Instr(ops.GetGlobal, uint32(0)),
+		builder.Instr(ops.I32Add),
+	})
+	b.AddFunction("fail", loadSig, nil, []disasm.Instr{
+		builder.Instr(ops.I32Const, int32(1)),
+		builder.Instr(ops.Call, b.Function("lib.fail")),
+		builder.Instr(ops.I32Const, int32(0)),
+	})
+	b.Export("run", wasm.ExternalFunction, b.Function("run")).
+		Export("fail", wasm.ExternalFunction, b.Function("fail"))
+	// the builder only imports functions.
+	return readModule(t, b, func(m *wasm.Module) {
+		m.Import.Entries = append(m.Import.Entries, wasm.ImportEntry{
+			ModuleName: "lib",
+			FieldName:  "base",
+			Type:       wasm.GlobalVarImport{Type: wasm.GlobalVar{Type: wasm.ValueTypeI32}},
+		})
+	}, s.Resolver(nil))
+}
+
+func TestStore(t *testing.T) {
+	s := NewStore()
+	lib, err := s.Instantiate("lib", libModule(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := s.Instantiate("app", appModule(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst, ok := s.Instance("app"); !ok || inst != app {
+		t.Errorf("Instance(%q) = %v, %v", "app", inst, ok)
+	}
+
+	res, err := app.Call("run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != uint32(5+99+7) {
+		t.Errorf("run returned %v, want %d", res, 5+99+7)
+	}
+
+	// the stores of each module went to its own memory.
+	if got := app.VM().Memory()[0]; got != 99 {
+		t.Errorf("app memory holds %d, want 99", got)
+	}
+	mem, err := lib.Memory("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mem.Bytes()[0]; got != 5 {
+		t.Errorf("lib memory holds %d, want 5", got)
+	}
+	if count, err := lib.Global("count"); err != nil || count != 1 {
+		t.Errorf("lib count is %d, %v, want 1", count, err)
+	}
+
+	if _, err = s.Instantiate("lib", libModule(t)); err != ErrDuplicateInstance {
+		t.Errorf("got error %v, want %v", err, ErrDuplicateInstance)
+	}
+	if _, err = app.Call("missing"); err != ErrFunctionNotExported {
+		t.Errorf("got error %v, want %v", err, ErrFunctionNotExported)
+	}
+	if _, err = s.Resolver(nil)("other"); err == nil {
+		t.Error("resolving a missing instance: no error")
+	}
+}
+
+func TestStoreImportedTrap(t *testing.T) {
+	s := NewStore()
+	lib, err := s.Instantiate("lib", libModule(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := s.Instantiate("app", appModule(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.VM().RecoverPanic = true
+
+	ctx := lib.VM().ctx
+	if _, err = app.Call("fail"); err != ErrUnreachable {
+		t.Fatalf("got error %v, want %v", err, ErrUnreachable)
+	}
+	// the trap left lib as it was before the call.
+	if got := lib.VM().ctx; got.curFunc != ctx.curFunc || got.pc != ctx.pc || len(got.stack) != len(ctx.stack) {
+		t.Errorf("lib context is %+v after the trap, want %+v", got, ctx)
+	}
+
+	// the caller keeps running with lib.
+	for i := 0; i < 2; i++ {
+		res, err := app.Call("run")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != uint32(5+99+7) {
+			t.Errorf("run returned %v, want %d", res, 5+99+7)
+		}
+	}
+}
+
+// tableLibModule returns the module of libBuilder, exporting a table
+// holding its "store" and "load" functions.
+func tableLibModule(t *testing.T) *wasm.Module {
+	return readModule(t, libBuilder(), func(m *wasm.Module) {
+		m.Table = &wasm.SectionTables{Entries: []wasm.Table{
+			{ElementType: wasm.ElemTypeAnyFunc, Limits: wasm.ResizableLimits{Initial: 2}},
+		}}
+		m.Elements = &wasm.SectionElements{Entries: []wasm.ElementSegment{{
+			Offset: []byte{ops.I32Const, 0, ops.End},
+			Elems:  []uint32{m.Export.Entries["store"].Index, m.Export.Entries["load"].Index},
+		}}}
+		m.Export.Entries["table"] = wasm.ExportEntry{FieldStr: "table", Kind: wasm.ExternalTable}
+	}, nil)
+}
+
+// tableAppModule returns a module importing the table of lib, calling its
+// functions with call_indirect, with a memory of its own.
+func tableAppModule(t *testing.T, s *Store) *wasm.Module {
+	b := builder.New().AddMemory(wasm.ResizableLimits{Initial: 1})
+	b.AddFunction("run", loadSig, nil, []disasm.Instr{
+		builder.Instr(ops.I32Const, int32(0)),
+		builder.Instr(ops.I32Const, int32(99)),
+		builder.Instr(ops.I32Store, uint32(2), uint32(0)),
+		builder.Instr(ops.I32Const, int32(5)),
+		builder.Instr(ops.I32Const, int32(0)),
+		builder.Instr(ops.CallIndirect, b.Type(storeSig), uint32(0)),
+		builder.Instr(ops.I32Const, int32(1)),
+		builder.Instr(ops.CallIndirect, b.Type(loadSig), uint32(0)),
+		builder.Instr(ops.I32Const, int32(0)),
+		builder.Instr(ops.I32Load, uint32(2), uint32(0)),
+		builder.Instr(ops.I32Add),
+	})
+	b.Export("run", wasm.ExternalFunction, b.Function("run"))
+	// the builder only imports functions.
+	return readModule(t, b, func(m *wasm.Module) {
+		m.Import = &wasm.SectionImports{Entries: []wasm.ImportEntry{{
+			ModuleName: "lib",
+			FieldName:  "table",
+			Type: wasm.TableImport{Type: wasm.Table{
+				ElementType: wasm.ElemTypeAnyFunc,
+				Limits:      wasm.ResizableLimits{Initial: 2},
+			}},
+		}}}
+	}, s.Resolver(nil))
+}
+
+func TestStoreImportedTable(t *testing.T) {
+	s := NewStore()
+	lib, err := s.Instantiate("lib", tableLibModule(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := s.Instantiate("app", tableAppModule(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := app.Call("run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != uint32(5+99) {
+		t.Errorf("run returned %v, want %d", res, 5+99)
+	}
+
+	// the functions called through the table used the memory and globals
+	// of lib.
+	if got := app.VM().Memory()[0]; got != 99 {
+		t.Errorf("app memory holds %d, want 99", got)
+	}
+	mem, err := lib.Memory("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mem.Bytes()[0]; got != 5 {
+		t.Errorf("lib memory holds %d, want 5", got)
+	}
+	if count, err := lib.Global("count"); err != nil || count != 1 {
+		t.Errorf("lib count is %d, %v, want 1", count, err)
+	}
+	if _, err = lib.VM().ExportedTable("missing"); err != ErrTableNotExported {
+		t.Errorf("got error %v, want %v", err, ErrTableNotExported)
+	}
+}
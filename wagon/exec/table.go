@@ -0,0 +1,123 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"errors"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+// ErrTableNotExported is returned by (*VM).ExportedTable when the module
+// has no table export with the requested name.
+var ErrTableNotExported = errors.New("exec: table not exported")
+
+// maxTableSize bounds the size of tables without a maximum.
+const maxTableSize = 1 << 24
+
+// Table is a table instance, holding indices into the function index space
+// of the VM's module.
+type Table struct {
+	elems  []uint32
+	limits wasm.ResizableLimits
+}
+
+// NewTable creates a table of limits.Initial elements, set to init.
+func NewTable(limits wasm.ResizableLimits, init uint32) *Table {
+	t := &Table{limits: limits}
+	t.elems = make([]uint32, limits.Initial)
+	for i := range t.elems {
+		t.elems[i] = init
+	}
+	return t
+}
+
+// Len returns the number of elements of the table.
+func (t *Table) Len() uint32 {
+	return uint32(len(t.elems))
+}
+
+// Get returns the function index stored at i.
+func (t *Table) Get(i uint32) (uint32, bool) {
+	if i >= t.Len() {
+		return 0, false
+	}
+	return t.elems[i], true
+}
+
+// Set stores the function index fn at i. It returns false if i is out of
+// bounds.
+func (t *Table) Set(i, fn uint32) bool {
+	if i >= t.Len() {
+		return false
+	}
+	t.elems[i] = fn
+	return true
+}
+
+// Limits returns the limits of the table, with Initial set to its current
+// size.
+func (t *Table) Limits() wasm.ResizableLimits {
+	limits := t.limits
+	limits.Initial = t.Len()
+	return limits
+}
+
+// Grow grows the table by n elements set to init, and returns its previous
+// size. It returns -1 and leaves the table unchanged if the new size would
+// exceed the maximum of the table.
+func (t *Table) Grow(n, init uint32) int32 {
+	cur := t.Len()
+	max := uint64(maxTableSize)
+	if t.limits.HasMaximum() && uint64(t.limits.Maximum) < max {
+		max = uint64(t.limits.Maximum)
+	}
+	if uint64(cur)+uint64(n) > max {
+		return -1
+	}
+	for i := uint32(0); i < n; i++ {
+		t.elems = append(t.elems, init)
+	}
+	return int32(cur)
+}
+
+// Tables returns the tables of the VM, by index in the table index space.
+// Imported tables hold the functions of the exporting module, appended to
+// the function index space of the VM's module by wasm.ReadModule.
+func (vm *VM) Tables() []*Table {
+	return vm.tables
+}
+
+// TableRef refers to a table of a VM, for importing it in the VM of another
+// module through Imports.
+type TableRef struct {
+	VM    *VM
+	Index uint32 // index in the table index space of the module of VM
+}
+
+// ExportedTable returns the table exported by the module under name.
+func (vm *VM) ExportedTable(name string) (TableRef, error) {
+	if vm.module.Export != nil {
+		e, ok := vm.module.Export.Entries[name]
+		if ok && e.Kind == wasm.ExternalTable && int(e.Index) < len(vm.module.TableIndexSpace) {
+			return TableRef{VM: vm, Index: e.Index}, nil
+		}
+	}
+	return TableRef{}, ErrTableNotExported
+}
+
+// newTables creates the tables of module from its table index space.
+func newTables(module *wasm.Module) []*Table {
+	tables := make([]*Table, len(module.TableIndexSpace))
+	for i, elems := range module.TableIndexSpace {
+		limits, _ := module.TableLimits(uint32(i))
+		if n := uint32(len(elems)); n > limits.Initial {
+			limits.Initial = n
+		}
+		tables[i] = NewTable(limits, 0)
+		copy(tables[i].elems, elems)
+	}
+	return tables
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+func TestTableGrow(t *testing.T) {
+	tab := NewTable(wasm.ResizableLimits{Flags: 1, Initial: 1, Maximum: 3}, 5)
+	if got := tab.Grow(2, 7); got != 1 {
+		t.Errorf("Grow(2) = %d, want 1", got)
+	}
+	if got := tab.Grow(1, 7); got != -1 {
+		t.Errorf("Grow(1) past the maximum = %d, want -1", got)
+	}
+	if tab.Len() != 3 {
+		t.Fatalf("got %d elements, want 3", tab.Len())
+	}
+	for i, want := range []uint32{5, 7, 7} {
+		if got, ok := tab.Get(uint32(i)); !ok || got != want {
+			t.Errorf("element %d = %d, want %d", i, got, want)
+		}
+	}
+	if !tab.Set(0, 1) || tab.Set(3, 1) {
+		t.Error("Set did not check the bounds of the table")
+	}
+	if _, ok := tab.Get(3); ok {
+		t.Error("Get did not check the bounds of the table")
+	}
+	if lim := tab.Limits(); lim.Initial != 3 || lim.Maximum != 3 {
+		t.Errorf("got limits %+v", lim)
+	}
+}
+
+func TestImportedTable(t *testing.T) {
+	_, importer, err := readLinkedModules(t, wasm.ResizableLimits{Initial: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the function of the exporter is appended to the function index space.
+	if len(importer.FunctionIndexSpace) != 3 || len(importer.TableIndexSpace[0]) != 1 || importer.TableIndexSpace[0][0] != 2 {
+		t.Fatalf("got table %v and %d functions", importer.TableIndexSpace, len(importer.FunctionIndexSpace))
+	}
+	vm, err := NewVM(importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vm.Tables()) != 1 || vm.Tables()[0].Len() != 1 {
+		t.Fatalf("got %d tables", len(vm.Tables()))
+	}
+	ret, err := vm.ExecCode(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != uint32(42) {
+		t.Errorf("call_indirect returned %v, want 42", ret)
+	}
+}
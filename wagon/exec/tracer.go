@@ -0,0 +1,366 @@
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/sea-project/sea-pkg/wagon/exec/internal/compile"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+// Tracer receives structured execution events from a VM.
+// A tracer is installed with (*VM).SetTracer, and its methods are called
+// synchronously from the goroutine executing the VM.
+type Tracer interface {
+	// CaptureStart is called when ExecCode or ExecContractCode starts
+	// executing the function at fnIndex.
+	CaptureStart(fnIndex int64, args []uint64)
+	// CaptureStep is called before each instruction is executed.
+	// The StructLog and its slices are only valid for the duration of
+	// the call.
+	CaptureStep(vm *VM, log *StructLog)
+	// CaptureEnter is called when a function, including a host function,
+	// is called at the given call depth.
+	CaptureEnter(depth int, fnIndex int64)
+	// CaptureExit is called when the function entered at depth returns.
+	CaptureExit(depth int, fnIndex int64)
+	// CaptureEnd is called when the function passed to CaptureStart returns,
+	// with the raw return value or the error that trapped the VM.
+	CaptureEnd(ret uint64, err error)
+}
+
+// HexBytes is a byte slice encoded as a hexadecimal string in JSON.
+type HexBytes []byte
+
+// MarshalText implements encoding.TextMarshaler.
+func (b HexBytes) MarshalText() ([]byte, error) {
+	out := make([]byte, hex.EncodedLen(len(b)))
+	hex.Encode(out, b)
+	return out, nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *HexBytes) UnmarshalText(text []byte) error {
+	out := make([]byte, hex.DecodedLen(len(text)))
+	if _, err := hex.Decode(out, text); err != nil {
+		return err
+	}
+	*b = out
+	return nil
+}
+
+// MemoryChange describes a write to linear memory.
+type MemoryChange struct {
+	Offset uint32   `json:"offset"`
+	Data   HexBytes `json:"data"`
+}
+
+// StructLog is a structured log emitted for every executed instruction.
+type StructLog struct {
+	Func   int64         `json:"func"`             // index of the executing function
+	Pc     int64         `json:"pc"`               // offset of the instruction in the compiled code
+	Op     byte          `json:"op"`               // opcode of the instruction
+	OpName string        `json:"opName"`           // mnemonic of the instruction
+	Gas    uint64        `json:"gas"`              // instructions executed before this one
+	Depth  int           `json:"depth"`            // call depth, 0 for the entry function
+	Stack  []uint64      `json:"stack,omitempty"`  // top of the operand stack, topmost value last
+	Locals []uint64      `json:"locals,omitempty"` // locals of the executing function
+	Memory *MemoryChange `json:"memory,omitempty"` // the memory write this instruction performs
+}
+
+// LogConfig selects what is recorded in a StructLog.
+type LogConfig struct {
+	StackDepth    int  // number of values recorded from the top of the stack
+	DisableLocals bool // do not record locals
+	DisableMemory bool // do not record memory writes
+	Limit         int  // maximum number of steps recorded, 0 for no limit
+}
+
+// DefaultLogConfig is used by the collectors when no LogConfig is given.
+var DefaultLogConfig = LogConfig{StackDepth: 8}
+
+// compiledOpNames names the operators introduced by the compile pass, whose
+// opcodes are reused from structured control operators, and the
+// superinstructions of optimized code.
+var compiledOpNames = map[byte]string{
+	compile.OpJmp:                "jmp",
+	compile.OpJmpZ:               "jmpz",
+	compile.OpJmpNz:              "jmpnz",
+	compile.OpDiscard:            "discard",
+	compile.OpDiscardPreserveTop: "discard_preserve_top",
+	compile.OpLocalsI32Add:       "get_local.get_local.i32.add",
+	compile.OpLocalConstI32Add:   "get_local.i32.const.i32.add",
+	compile.OpConstI32Load:       "i32.const.i32.load",
+	compile.OpI32CmpJmpNz:        "i32.cmp.jmpnz",
+}
+
+// OpName returns the mnemonic of an opcode of compiled code.
+func OpName(op byte) string {
+	if name, ok := compiledOpNames[op]; ok {
+		return name
+	}
+	o, err := ops.New(op)
+	if err != nil {
+		return fmt.Sprintf("<unknown %#x>", op)
+	}
+	return o.Name
+}
+
+// storeSizes maps store operators to the number of bytes they write.
+var storeSizes = map[byte]int{
+	ops.I32Store:   4,
+	ops.I64Store:   8,
+	ops.F32Store:   4,
+	ops.F64Store:   8,
+	ops.I32Store8:  1,
+	ops.I32Store16: 2,
+	ops.I64Store8:  1,
+	ops.I64Store16: 2,
+	ops.I64Store32: 4,
+}
+
+// SetTracer installs t as the tracer of vm. A nil t disables tracing.
+func (vm *VM) SetTracer(t Tracer) {
+	vm.tracer = t
+}
+
+// Tracer returns the tracer installed on vm, if any.
+func (vm *VM) Tracer() Tracer {
+	return vm.tracer
+}
+
+// GasUsed returns the number of instructions executed by the VM.
+func (vm *VM) GasUsed() uint64 {
+	return vm.gasUsed
+}
+
+// captureStep reports the instruction op, located at the current pc,
+// to the tracer.
+func (vm *VM) captureStep(op byte) {
+	log := StructLog{
+		Func:   vm.ctx.curFunc,
+		Pc:     vm.ctx.pc,
+		Op:     op,
+		OpName: OpName(op),
+		Gas:    vm.gasUsed,
+		Depth:  vm.recursiveCallDepth,
+		Stack:  vm.ctx.stack,
+		Locals: vm.ctx.locals,
+	}
+	if size, ok := storeSizes[op]; ok && len(vm.ctx.stack) >= 2 {
+		// the store immediate is the 4 byte offset that follows the opcode.
+		offset := endianess.Uint32(vm.ctx.code[vm.ctx.pc+1:])
+		base := uint32(vm.ctx.stack[len(vm.ctx.stack)-2])
+		var val [8]byte
+		endianess.PutUint64(val[:], vm.ctx.stack[len(vm.ctx.stack)-1])
+		log.Memory = &MemoryChange{
+			Offset: base + offset,
+			Data:   val[:size],
+		}
+	}
+	vm.tracer.CaptureStep(vm, &log)
+}
+
+func (vm *VM) captureEnter(index int64) {
+	if vm.tracer != nil {
+		vm.tracer.CaptureEnter(vm.recursiveCallDepth+1, index)
+	}
+}
+
+func (vm *VM) captureExit(index int64) {
+	if vm.tracer != nil {
+		vm.tracer.CaptureExit(vm.recursiveCallDepth+1, index)
+	}
+}
+
+// traceEnd reports the end of an ExecCode call to the tracer. It must be
+// deferred, and recovers and re-raises any panic trapping the VM.
+func (vm *VM) traceEnd(ret *uint64, err *error) {
+	if r := recover(); r != nil {
+		vm.tracer.CaptureEnd(0, panicError(r))
+		panic(r)
+	}
+	vm.tracer.CaptureEnd(*ret, *err)
+}
+
+func panicError(r interface{}) error {
+	if e, ok := r.(error); ok {
+		return e
+	}
+	return fmt.Errorf("exec: %v", r)
+}
+
+// copyLog returns a copy of log retaining what cfg selects.
+func copyLog(log *StructLog, cfg *LogConfig) StructLog {
+	cpy := *log
+	cpy.Stack = nil
+	if n := cfg.StackDepth; n > 0 && len(log.Stack) > 0 {
+		if n > len(log.Stack) {
+			n = len(log.Stack)
+		}
+		cpy.Stack = append([]uint64(nil), log.Stack[len(log.Stack)-n:]...)
+	}
+	cpy.Locals = nil
+	if !cfg.DisableLocals && len(log.Locals) > 0 {
+		cpy.Locals = append([]uint64(nil), log.Locals...)
+	}
+	if cfg.DisableMemory {
+		cpy.Memory = nil
+	} else if log.Memory != nil {
+		cpy.Memory = &MemoryChange{
+			Offset: log.Memory.Offset,
+			Data:   append(HexBytes(nil), log.Memory.Data...),
+		}
+	}
+	return cpy
+}
+
+// StructLogger is a Tracer collecting StructLogs in memory.
+type StructLogger struct {
+	cfg LogConfig
+
+	mu    sync.Mutex
+	logs  []StructLog
+	err   error
+	ret   uint64
+	steps int
+}
+
+// NewStructLogger creates a StructLogger. A nil cfg selects DefaultLogConfig.
+func NewStructLogger(cfg *LogConfig) *StructLogger {
+	l := &StructLogger{cfg: DefaultLogConfig}
+	if cfg != nil {
+		l.cfg = *cfg
+	}
+	return l
+}
+
+// CaptureStart implements Tracer.
+func (l *StructLogger) CaptureStart(fnIndex int64, args []uint64) {}
+
+// CaptureStep implements Tracer.
+func (l *StructLogger) CaptureStep(vm *VM, log *StructLog) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.steps++
+	if l.cfg.Limit != 0 && len(l.logs) >= l.cfg.Limit {
+		return
+	}
+	l.logs = append(l.logs, copyLog(log, &l.cfg))
+}
+
+// CaptureEnter implements Tracer.
+func (l *StructLogger) CaptureEnter(depth int, fnIndex int64) {}
+
+// CaptureExit implements Tracer.
+func (l *StructLogger) CaptureExit(depth int, fnIndex int64) {}
+
+// CaptureEnd implements Tracer.
+func (l *StructLogger) CaptureEnd(ret uint64, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ret, l.err = ret, err
+}
+
+// Logs returns the collected logs.
+func (l *StructLogger) Logs() []StructLog {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.logs
+}
+
+// Result returns the return value and error of the last traced call.
+func (l *StructLogger) Result() (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ret, l.err
+}
+
+// Steps returns the number of executed instructions, including those
+// dropped because of LogConfig.Limit.
+func (l *StructLogger) Steps() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.steps
+}
+
+// Reset discards the collected logs.
+func (l *StructLogger) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs, l.err, l.ret, l.steps = nil, nil, 0, 0
+}
+
+// JSONLogger is a Tracer writing one JSON object per line to a writer.
+// Each step is written as a StructLog; the start and end of a call are
+// written as objects with a "start" or "end" key.
+type JSONLogger struct {
+	cfg LogConfig
+	enc *json.Encoder
+	err error
+	n   int
+}
+
+// NewJSONLogger creates a JSONLogger writing to w. A nil cfg selects
+// DefaultLogConfig.
+func NewJSONLogger(cfg *LogConfig, w io.Writer) *JSONLogger {
+	l := &JSONLogger{cfg: DefaultLogConfig, enc: json.NewEncoder(w)}
+	if cfg != nil {
+		l.cfg = *cfg
+	}
+	return l
+}
+
+func (l *JSONLogger) encode(v interface{}) {
+	if l.err == nil {
+		l.err = l.enc.Encode(v)
+	}
+}
+
+// CaptureStart implements Tracer.
+func (l *JSONLogger) CaptureStart(fnIndex int64, args []uint64) {
+	l.encode(struct {
+		Func int64    `json:"start"`
+		Args []uint64 `json:"args"`
+	}{fnIndex, args})
+}
+
+// CaptureStep implements Tracer.
+func (l *JSONLogger) CaptureStep(vm *VM, log *StructLog) {
+	if l.cfg.Limit != 0 && l.n >= l.cfg.Limit {
+		return
+	}
+	l.n++
+	cpy := copyLog(log, &l.cfg)
+	l.encode(&cpy)
+}
+
+// CaptureEnter implements Tracer.
+func (l *JSONLogger) CaptureEnter(depth int, fnIndex int64) {}
+
+// CaptureExit implements Tracer.
+func (l *JSONLogger) CaptureExit(depth int, fnIndex int64) {}
+
+// CaptureEnd implements Tracer.
+func (l *JSONLogger) CaptureEnd(ret uint64, err error) {
+	end := struct {
+		Ret   uint64 `json:"end"`
+		Error string `json:"error,omitempty"`
+	}{Ret: ret}
+	if err != nil {
+		end.Error = err.Error()
+	}
+	l.encode(&end)
+}
+
+// Err returns the first error encountered while writing logs.
+func (l *JSONLogger) Err() error {
+	return l.err
+}
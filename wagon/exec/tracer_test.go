@@ -0,0 +1,223 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+// tracerTestModule returns a module with two functions:
+//
+//	(func $inc (param i32) (result i32) get_local 0 i32.const 1 i32.add)
+//	(func $main (result i32)
+//	  i32.const 8 i32.const 42 call $inc i32.store offset=4
+//	  i32.const 8 i32.load offset=4)
+func tracerTestModule(t *testing.T) *wasm.Module {
+	i32 := wasm.ValueTypeI32
+	m := &wasm.Module{
+		Types: &wasm.SectionTypes{
+			Entries: []wasm.FunctionSig{
+				{Form: 0, ParamTypes: []wasm.ValueType{i32}, ReturnTypes: []wasm.ValueType{i32}},
+				{Form: 0, ReturnTypes: []wasm.ValueType{i32}},
+			},
+		},
+		Function: &wasm.SectionFunctions{Types: []uint32{0, 1}},
+		Memory: &wasm.SectionMemories{
+			Entries: []wasm.Memory{{Limits: wasm.ResizableLimits{Initial: 1}}},
+		},
+		Code: &wasm.SectionCode{
+			Bodies: []wasm.FunctionBody{
+				{Code: []byte{0x20, 0x00, 0x41, 0x01, 0x6a}},
+				{Code: []byte{0x41, 0x08, 0x41, 0x2a, 0x10, 0x00, 0x36, 0x02, 0x04, 0x41, 0x08, 0x28, 0x02, 0x04}},
+			},
+		},
+	}
+	buf := new(bytes.Buffer)
+	if err := wasm.EncodeModule(buf, m); err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.ReadModule(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+type callRecorder struct {
+	*StructLogger
+	calls []int64
+}
+
+func (r *callRecorder) CaptureEnter(depth int, fnIndex int64) {
+	r.calls = append(r.calls, int64(depth), fnIndex)
+}
+
+func (r *callRecorder) CaptureExit(depth int, fnIndex int64) {
+	r.calls = append(r.calls, -int64(depth), fnIndex)
+}
+
+func TestStructLogger(t *testing.T) {
+	vm, err := NewVM(tracerTestModule(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &callRecorder{StructLogger: NewStructLogger(nil)}
+	vm.SetTracer(rec)
+
+	res, err := vm.ExecCode(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.(uint32) != 43 {
+		t.Fatalf("got %v, want 43", res)
+	}
+	if ret, err := rec.Result(); ret != 43 || err != nil {
+		t.Errorf("Result() = %d, %v; want 43, nil", ret, err)
+	}
+	if want := []int64{1, 0, -1, 0}; !reflect.DeepEqual(rec.calls, want) {
+		t.Errorf("calls: got %v, want %v", rec.calls, want)
+	}
+
+	logs := rec.Logs()
+	if uint64(len(logs)) != vm.GasUsed() {
+		t.Errorf("got %d logs, but %d instructions were executed", len(logs), vm.GasUsed())
+	}
+	var names []string
+	var store *StructLog
+	for i := range logs {
+		if logs[i].Gas != uint64(i) {
+			t.Errorf("log %d: got gas %d", i, logs[i].Gas)
+		}
+		names = append(names, logs[i].OpName)
+		if logs[i].OpName == "i32.store" {
+			store = &logs[i]
+		}
+		if logs[i].OpName == "i32.add" {
+			if logs[i].Func != 0 || logs[i].Depth != 1 {
+				t.Errorf("i32.add: got func %d depth %d, want func 0 depth 1", logs[i].Func, logs[i].Depth)
+			}
+			if !reflect.DeepEqual(logs[i].Locals, []uint64{42}) {
+				t.Errorf("i32.add: got locals %v, want [42]", logs[i].Locals)
+			}
+			// the callee's operand stack holds only its own operands.
+			if s := logs[i].Stack; !reflect.DeepEqual(s, []uint64{42, 1}) {
+				t.Errorf("i32.add: got stack %v, want [42 1]", s)
+			}
+		}
+	}
+	// the compile pass terminates each function with a nop.
+	want := []string{
+		"i32.const", "i32.const", "call",
+		"get_local", "i32.const", "i32.add", "nop",
+		"i32.store", "i32.const", "i32.load", "nop",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("got ops %v, want %v", names, want)
+	}
+	if store.Memory == nil {
+		t.Fatal("i32.store: no memory change recorded")
+	}
+	if store.Memory.Offset != 12 || !bytes.Equal(store.Memory.Data, []byte{43, 0, 0, 0}) {
+		t.Errorf("i32.store: got memory change %+v", store.Memory)
+	}
+
+	rec.Reset()
+	if len(rec.Logs()) != 0 {
+		t.Error("Reset did not discard the logs")
+	}
+}
+
+func TestStructLoggerConfig(t *testing.T) {
+	vm, err := NewVM(tracerTestModule(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewStructLogger(&LogConfig{StackDepth: 1, DisableLocals: true, DisableMemory: true, Limit: 7})
+	vm.SetTracer(l)
+	if _, err = vm.ExecCode(1); err != nil {
+		t.Fatal(err)
+	}
+	logs := l.Logs()
+	if len(logs) != 7 || l.Steps() != 11 {
+		t.Fatalf("got %d logs of %d steps, want 7 of 11", len(logs), l.Steps())
+	}
+	for _, log := range logs {
+		if len(log.Stack) > 1 || log.Locals != nil || log.Memory != nil {
+			t.Errorf("%s: config not applied: %+v", log.OpName, log)
+		}
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	vm, err := NewVM(tracerTestModule(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	l := NewJSONLogger(nil, buf)
+	vm.SetTracer(l)
+	if _, err = vm.ExecCode(1); err != nil {
+		t.Fatal(err)
+	}
+	if l.Err() != nil {
+		t.Fatal(l.Err())
+	}
+
+	var lines []map[string]json.RawMessage
+	s := bufio.NewScanner(buf)
+	for s.Scan() {
+		var line map[string]json.RawMessage
+		if err := json.Unmarshal(s.Bytes(), &line); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", s.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 13 {
+		t.Fatalf("got %d lines, want 13", len(lines))
+	}
+	if string(lines[0]["start"]) != "1" {
+		t.Errorf("first line: got %v, want a start line", lines[0])
+	}
+	if string(lines[12]["end"]) != "43" {
+		t.Errorf("last line: got %v, want an end line", lines[12])
+	}
+	var store StructLog
+	for _, line := range lines[1:12] {
+		if string(line["opName"]) == `"i32.store"` {
+			raw, _ := json.Marshal(line)
+			if err := json.Unmarshal(raw, &store); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if store.Memory == nil || store.Memory.Offset != 12 || !bytes.Equal(store.Memory.Data, []byte{43, 0, 0, 0}) {
+		t.Errorf("i32.store: got memory change %+v", store.Memory)
+	}
+}
+
+func TestTracerTrap(t *testing.T) {
+	m := tracerTestModule(t)
+	// replace $inc with unreachable
+	m.Code.Bodies[0].Code = []byte{0x00}
+	vm, err := NewVM(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.RecoverPanic = true
+	l := NewStructLogger(nil)
+	vm.SetTracer(l)
+	if _, err = vm.ExecCode(1); err == nil {
+		t.Fatal("expected a trap")
+	}
+	if _, terr := l.Result(); terr == nil || terr.Error() != err.Error() {
+		t.Errorf("tracer got error %v, want %v", terr, err)
+	}
+}
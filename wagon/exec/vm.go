@@ -6,6 +6,7 @@
 package exec
 
 import (
+	stdctx "context"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -20,8 +21,10 @@ import (
 )
 
 var (
-	// ErrMultipleLinearMemories is returned by (*VM).NewVM when the module
-	// has more then one entries in the linear memory space.
+	// ErrMultipleLinearMemories was returned by (*VM).NewVM when the module
+	// had more then one entries in the linear memory space.
+	//
+	// Deprecated: modules may define or import several linear memories.
 	ErrMultipleLinearMemories = errors.New("exec: more than one linear memories in module")
 	// ErrInvalidArgumentCount is returned by (*VM).ExecCode when an invalid
 	// number of arguments to the WebAssembly function are passed to it.
@@ -56,10 +59,12 @@ type context struct {
 type VM struct {
 	ctx context
 
-	module  *wasm.Module
-	globals []uint64
-	memory  []byte
-	funcs   []function
+	module   *wasm.Module
+	globals  []uint64
+	memory   *Memory   // the default linear memory, at index 0
+	memories []*Memory // linear memories by index, some may be shared through imports
+	tables   []*Table
+	funcs    []function
 
 	funcTable [256]func()
 
@@ -76,6 +81,15 @@ type VM struct {
 	captureEnvFunctionStart func(pc uint64, name string) error
 	captureEnvFunctionEnd   func(pc uint64, name string) error
 	recursiveCallDepth      int
+
+	tracer    Tracer // Receives structured execution events, if set
+	gasUsed   uint64 // Number of instructions executed
+	optimized bool   // Whether the functions were compiled with superinstructions
+
+	output callOutput // Logs and return data of the current contract call
+
+	interrupted uint32         // Set atomically when cancelCtx is done
+	cancelCtx   stdctx.Context // Context of ExecCodeContext, if running
 }
 
 // As per the WebAssembly spec: https://github.com/WebAssembly/design/blob/27ac254c854994103c24834a994be16f74f54186/Semantics.md#linear-memory
@@ -86,15 +100,27 @@ var endianess = binary.LittleEndian
 // NewVM creates a new VM from a given module. If the module defines a
 // start function, it will be executed.
 func NewVM(module *wasm.Module) (*VM, error) {
+	return NewVMWithImports(module, nil)
+}
+
+// NewVMWithImports is like NewVM, and shares the memories provided by
+// imports with the module, typically exported by the VM of another module.
+// Memories imported by the module and missing from imports are copied from
+// the module resolved by wasm.ReadModule instead. Functions provided by
+// imports, and the functions of tables provided by imports, run in their
+// own VM, and globals provided by imports take the given values.
+//
+// Load and store instructions access the memory at index 0, and
+// current_memory and grow_memory the memory at their index immediate.
+func NewVMWithImports(module *wasm.Module, imports *Imports) (*VM, error) {
 	var vm VM
 
-	if module.Memory != nil && len(module.Memory.Entries) != 0 {
-		if len(module.Memory.Entries) > 1 {
-			return nil, ErrMultipleLinearMemories
-		}
-		vm.memory = make([]byte, uint(module.Memory.Entries[0].Limits.Initial)*wasmPageSize)
-		copy(vm.memory, module.LinearMemoryIndexSpace[0])
+	var err error
+	if vm.memories, err = newMemories(module, imports); err != nil {
+		return nil, err
 	}
+	vm.memory = vm.memories[0]
+	vm.tables = newTables(module)
 
 	vm.funcs = make([]function, len(module.FunctionIndexSpace))
 	vm.globals = make([]uint64, len(module.GlobalIndexSpace))
@@ -102,13 +128,37 @@ func NewVM(module *wasm.Module) (*VM, error) {
 	vm.module = module
 
 	nNatives := 0
+	insts := make(tableInstances)
 	for i, fn := range module.FunctionIndexSpace {
+		// Functions imported from the VM of another module run in
+		// that VM.
+		imported, ok, err := importedFunctionOf(module, imports, i)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// Functions of the other imported tables run in an
+			// instance of the module defining them.
+			imported, ok, err = insts.functionOf(module, i)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if ok {
+			vm.funcs[i] = imported
+			continue
+		}
 		// Skip native methods as they need not be
 		// disassembled; simply add them at the end
 		// of the `funcs` array as is, as specified
 		// in the spec. See the "host functions"
 		// section of:
 		// https://webassembly.github.io/spec/core/exec/modules.html#allocation
+		if hf, ok := hostFunctionOf(fn); ok {
+			vm.funcs[i] = hostCall{fn: hf}
+			nNatives++
+			continue
+		}
 		if fn.IsHost() {
 			vm.funcs[i] = goFunction{
 				typ: fn.Host.Type(),
@@ -155,6 +205,13 @@ func NewVM(module *wasm.Module) (*VM, error) {
 			vm.globals[i] = uint64(math.Float64bits(v))
 		}
 	}
+	if imports != nil {
+		for i, e := range module.ImportEntries(wasm.ExternalGlobal) {
+			if val, ok := imports.Globals[e.ModuleName+"."+e.FieldName]; ok && i < len(vm.globals) {
+				vm.globals[i] = val
+			}
+		}
+	}
 
 	if module.Start != nil {
 		_, err := vm.ExecCode(int64(module.Start.Index))
@@ -168,7 +225,7 @@ func NewVM(module *wasm.Module) (*VM, error) {
 
 // Memory returns the linear memory space for the VM.
 func (vm *VM) Memory() []byte {
-	return vm.memory
+	return vm.memory.data
 }
 
 func (vm *VM) pushBool(v bool) {
@@ -307,7 +364,13 @@ func (vm *VM) ExecCode(fnIndex int64, args ...uint64) (rtrn interface{}, err err
 		vm.ctx.locals[i] = arg
 	}
 
-	res := vm.execCode(compiled)
+	var res uint64
+	if vm.tracer != nil {
+		vm.tracer.CaptureStart(fnIndex, args)
+		defer vm.traceEnd(&res, &err)
+	}
+
+	res = vm.execCode(compiled)
 	if compiled.returns {
 		rtrnType := vm.module.GetFunction(int(fnIndex)).Sig.ReturnTypes[0]
 		switch rtrnType {
@@ -334,6 +397,10 @@ outer:
 			panic(fmt.Errorf("recursive call limit reached 1024"))
 		}
 		op := vm.ctx.code[vm.ctx.pc]
+		if vm.tracer != nil {
+			vm.captureStep(op)
+		}
+		vm.gasUsed++
 		vm.ctx.pc++
 		if vm.debug == true && vm.captureOp != nil {
 			vm.captureOp(uint64(vm.ctx.pc), op)
@@ -342,11 +409,18 @@ outer:
 		case ops.Return:
 			break outer
 		case compile.OpJmp:
-			vm.ctx.pc = vm.fetchInt64()
+			target := vm.fetchInt64()
+			if target < vm.ctx.pc {
+				vm.checkInterrupt()
+			}
+			vm.ctx.pc = target
 			continue
 		case compile.OpJmpZ:
 			target := vm.fetchInt64()
 			if vm.popUint32() == 0 {
+				if target < vm.ctx.pc {
+					vm.checkInterrupt()
+				}
 				vm.ctx.pc = target
 				continue
 			}
@@ -355,6 +429,9 @@ outer:
 			preserveTop := vm.fetchBool()
 			discard := vm.fetchInt64()
 			if vm.popUint32() != 0 {
+				if target < vm.ctx.pc {
+					vm.checkInterrupt()
+				}
 				vm.ctx.pc = target
 				var top uint64
 				if preserveTop {
@@ -384,6 +461,9 @@ outer:
 			if target.Return {
 				break outer
 			}
+			if target.Addr < vm.ctx.pc {
+				vm.checkInterrupt()
+			}
 			vm.ctx.pc = target.Addr
 			var top uint64
 			if target.PreserveTop {
@@ -394,6 +474,26 @@ outer:
 				vm.pushUint64(top)
 			}
 			continue
+		case compile.OpI32CmpJmpNz:
+			cond := vm.i32Cmp(byte(vm.fetchInt8()))
+			target := vm.fetchInt64()
+			preserveTop := vm.fetchBool()
+			discard := vm.fetchInt64()
+			if cond {
+				if target < vm.ctx.pc {
+					vm.checkInterrupt()
+				}
+				vm.ctx.pc = target
+				var top uint64
+				if preserveTop {
+					top = vm.ctx.stack[len(vm.ctx.stack)-1]
+				}
+				vm.ctx.stack = vm.ctx.stack[:len(vm.ctx.stack)-int(discard)]
+				if preserveTop {
+					vm.pushUint64(top)
+				}
+				continue
+			}
 		case compile.OpDiscard:
 			place := vm.fetchInt64()
 			vm.ctx.stack = vm.ctx.stack[:len(vm.ctx.stack)-int(place)]
@@ -468,6 +568,12 @@ func (proc *Process) WriteAt(p []byte, off int64) (int, error) {
 	return length, err
 }
 
+// Memory returns the linear memory of the VM. The slice is invalidated
+// when the memory grows.
+func (proc *Process) Memory() []byte {
+	return proc.vm.Memory()
+}
+
 // Terminate stops the execution of the current module.
 func (proc *Process) Terminate() {
 	proc.vm.abort = true
@@ -9,15 +9,15 @@ import (
 )
 
 var (
-	smallMemoryVM      = &VM{memory: []byte{1, 2, 3}}
-	emptyMemoryVM      = &VM{memory: []byte{}}
+	smallMemoryVM      = &VM{memory: &Memory{data: []byte{1, 2, 3}}}
+	emptyMemoryVM      = &VM{memory: &Memory{data: []byte{}}}
 	smallMemoryProcess = &Process{vm: smallMemoryVM}
 	emptyMemoryProcess = &Process{vm: emptyMemoryVM}
 	tooBigABuffer      = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 0}
 )
 
 func TestNormalWrite(t *testing.T) {
-	vm := &VM{memory: make([]byte, 300)}
+	vm := &VM{memory: &Memory{data: make([]byte, 300)}}
 	proc := &Process{vm: vm}
 	n, err := proc.WriteAt(tooBigABuffer, 0)
 	if err != nil {
@@ -33,7 +33,7 @@ func TestWriteBoundary(t *testing.T) {
 	if err == nil {
 		t.Fatal("Should have reported an error and didn't")
 	}
-	if n != len(smallMemoryVM.memory) {
+	if n != len(smallMemoryVM.memory.data) {
 		t.Fatalf("Number of written bytes was %d, should have been 0", n)
 	}
 }
@@ -44,7 +44,7 @@ func TestReadBoundary(t *testing.T) {
 	if err == nil {
 		t.Fatal("Should have reported an error and didn't")
 	}
-	if n != len(smallMemoryVM.memory) {
+	if n != len(smallMemoryVM.memory.data) {
 		t.Fatalf("Number of written bytes was %d, should have been 0", n)
 	}
 }
@@ -95,7 +95,7 @@ func TestWriteEmpty(t *testing.T) {
 }
 
 func TestWriteOffset(t *testing.T) {
-	vm := &VM{memory: make([]byte, 300)}
+	vm := &VM{memory: &Memory{data: make([]byte, 300)}}
 	proc := &Process{vm: vm}
 
 	n, err := proc.WriteAt(tooBigABuffer, 2)
@@ -106,7 +106,7 @@ func TestWriteOffset(t *testing.T) {
 		t.Fatalf("Number of written bytes was %d, should have been %d", n, len(tooBigABuffer))
 	}
 
-	if vm.memory[0] != 0 || vm.memory[1] != 0 || vm.memory[2] != tooBigABuffer[0] {
+	if vm.memory.data[0] != 0 || vm.memory.data[1] != 0 || vm.memory.data[2] != tooBigABuffer[0] {
 		t.Fatal("Writing at offset didn't work")
 	}
 }
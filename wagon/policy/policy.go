@@ -0,0 +1,382 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package policy checks WebAssembly modules against a declarative admission
+// policy, such as the one of a chain accepting contracts: allowed host
+// imports, required exports, and limits on memories, tables, opcodes and
+// code size.
+//
+// A policy is usually read from JSON:
+//
+//	{
+//	  "imports": [{"module": "env", "name": "get_balance", "params": ["i32"], "results": ["i64"]}],
+//	  "exports": [{"name": "invoke", "kind": "function"}, {"name": "memory", "kind": "memory"}],
+//	  "max_memory_pages": 16,
+//	  "max_table_size": 64,
+//	  "max_code_size": 65536
+//	}
+//
+// Check and CheckModule return every violation found, rather than the first
+// one.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/validate"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+// Policy describes the modules accepted by Check. The zero Policy accepts
+// modules without imports and start function, using no floating-point
+// values.
+type Policy struct {
+	Imports []Import `json:"imports"` // host functions modules may import
+	Exports []Export `json:"exports"` // exports modules must define
+
+	AllowStart bool `json:"allow_start"` // whether modules may have a start function
+	AllowFloat bool `json:"allow_float"` // whether modules may use floating-point values
+
+	// MaxMemoryPages, if not zero, requires memories to declare a maximum
+	// size of at most MaxMemoryPages pages.
+	MaxMemoryPages uint32 `json:"max_memory_pages"`
+	// MaxTableSize, if not zero, requires tables to declare a maximum size
+	// of at most MaxTableSize elements.
+	MaxTableSize uint32 `json:"max_table_size"`
+	// MaxCodeSize, if not zero, is the maximum size in bytes of the code
+	// section.
+	MaxCodeSize uint32 `json:"max_code_size"`
+
+	// DecodeOptions bounds the resources used by CheckModule to decode a
+	// module. Nil means wasm.DefaultDecodeOptions.
+	DecodeOptions *wasm.DecodeOptions `json:"-"`
+}
+
+// Import is a host function modules may import, with its exact signature.
+type Import struct {
+	Module  string   `json:"module"`
+	Name    string   `json:"name"`
+	Params  []string `json:"params"`  // value types, such as "i32"
+	Results []string `json:"results"` // value types, such as "i32"
+}
+
+// Export is an export modules must define.
+type Export struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"` // "function", "table", "memory" or "global"
+}
+
+// Rule identifies the part of a Policy a Violation breaks.
+type Rule string
+
+// Rules checked by a Policy.
+const (
+	RuleImport     Rule = "import"
+	RuleExport     Rule = "export"
+	RuleStart      Rule = "start"
+	RuleMemory     Rule = "memory"
+	RuleTable      Rule = "table"
+	RuleFloat      Rule = "float"
+	RuleCodeSize   Rule = "code-size"
+	RuleValidation Rule = "validation" // the module is not valid
+)
+
+// Violation is a breach of a Policy by a module.
+type Violation struct {
+	Rule    Rule
+	Func    int // index of the function in the function index space, or -1
+	Offset  int // offset of the instruction in the code of Func, or -1
+	Message string
+}
+
+func (v Violation) Error() string {
+	switch {
+	case v.Func < 0:
+		return fmt.Sprintf("policy: %s: %s", v.Rule, v.Message)
+	case v.Offset < 0:
+		return fmt.Sprintf("policy: %s: function %d: %s", v.Rule, v.Func, v.Message)
+	}
+	return fmt.Sprintf("policy: %s: function %d at offset %d: %s", v.Rule, v.Func, v.Offset, v.Message)
+}
+
+var valueTypes = map[string]wasm.ValueType{
+	"i32": wasm.ValueTypeI32,
+	"i64": wasm.ValueTypeI64,
+	"f32": wasm.ValueTypeF32,
+	"f64": wasm.ValueTypeF64,
+}
+
+var externals = map[string]wasm.External{
+	"function": wasm.ExternalFunction,
+	"table":    wasm.ExternalTable,
+	"memory":   wasm.ExternalMemory,
+	"global":   wasm.ExternalGlobal,
+}
+
+// Read reads a JSON policy from r.
+func Read(r io.Reader) (*Policy, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("policy: %v", err)
+	}
+	for _, imp := range p.Imports {
+		if _, err := imp.sig(); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range p.Exports {
+		if _, ok := externals[e.Kind]; !ok {
+			return nil, fmt.Errorf("policy: export %q has unknown kind %q", e.Name, e.Kind)
+		}
+	}
+	return &p, nil
+}
+
+// sig returns the signature of imp.
+func (imp Import) sig() (wasm.FunctionSig, error) {
+	sig := wasm.FunctionSig{Form: 0}
+	for _, list := range []struct {
+		names []string
+		types *[]wasm.ValueType
+	}{
+		{imp.Params, &sig.ParamTypes},
+		{imp.Results, &sig.ReturnTypes},
+	} {
+		for _, name := range list.names {
+			t, ok := valueTypes[name]
+			if !ok {
+				return sig, fmt.Errorf("policy: import %s.%s has unknown value type %q", imp.Module, imp.Name, name)
+			}
+			*list.types = append(*list.types, t)
+		}
+	}
+	return sig, nil
+}
+
+// CheckModule reads a module from r and checks it against p. The module is
+// decoded with the limits of p.DecodeOptions, and its imports are resolved
+// with stubs of the declared signatures, so that modules importing
+// functions not allowed by p can be checked. The error is not nil if the
+// module cannot be decoded, or exceeds the limits.
+func (p *Policy) CheckModule(r io.Reader) ([]Violation, error) {
+	opts := wasm.DefaultDecodeOptions
+	if p.DecodeOptions != nil {
+		opts = *p.DecodeOptions
+	}
+	if opts.MaxModuleSize != 0 {
+		r = io.LimitReader(r, int64(opts.MaxModuleSize)+1)
+	}
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxModuleSize != 0 && len(raw) > int(opts.MaxModuleSize) {
+		return nil, fmt.Errorf("policy: module exceeds %d bytes", opts.MaxModuleSize)
+	}
+	decoded, err := wasm.DecodeModuleWithOptions(bytes.NewReader(raw), opts)
+	if err != nil {
+		return nil, err
+	}
+	m, err := wasm.ReadModuleWithOptions(bytes.NewReader(raw), stubResolver(decoded), opts)
+	if err != nil {
+		return nil, err
+	}
+	return p.Check(m), nil
+}
+
+// Check returns the violations of p by m, which must have its imports
+// resolved, if any.
+func (p *Policy) Check(m *wasm.Module) []Violation {
+	var vs []Violation
+	add := func(rule Rule, format string, args ...interface{}) {
+		vs = append(vs, Violation{Rule: rule, Func: -1, Offset: -1, Message: fmt.Sprintf(format, args...)})
+	}
+
+	p.checkImports(m, add)
+	p.checkExports(m, add)
+	if !p.AllowStart && m.Start != nil {
+		add(RuleStart, "start function %d not allowed", m.Start.Index)
+	}
+
+	for i := 0; ; i++ {
+		limits, ok := m.MemoryLimits(uint32(i))
+		if !ok {
+			break
+		}
+		checkLimits(RuleMemory, fmt.Sprintf("memory %d", i), "pages", limits, p.MaxMemoryPages, add)
+	}
+	for i := 0; ; i++ {
+		limits, ok := m.TableLimits(uint32(i))
+		if !ok {
+			break
+		}
+		checkLimits(RuleTable, fmt.Sprintf("table %d", i), "elements", limits, p.MaxTableSize, add)
+	}
+	if m.Code != nil && p.MaxCodeSize != 0 && m.Code.PayloadLen > p.MaxCodeSize {
+		add(RuleCodeSize, "code section of %d bytes exceeds %d bytes", m.Code.PayloadLen, p.MaxCodeSize)
+	}
+
+	for _, err := range validate.VerifyModuleAll(m) {
+		offset := err.Offset
+		if err.Function < 0 {
+			offset = -1
+		}
+		msg := fmt.Sprint(err.Err)
+		if err.Expected != nil || err.Actual != nil {
+			msg += fmt.Sprintf(": expected operands %v, got %v", err.Expected, err.Actual)
+		}
+		vs = append(vs, Violation{Rule: RuleValidation, Func: err.Function, Offset: offset, Message: msg})
+	}
+	if !p.AllowFloat {
+		vs = append(vs, floatViolations(m)...)
+	}
+
+	return vs
+}
+
+func (p *Policy) checkImports(m *wasm.Module, add func(Rule, string, ...interface{})) {
+	if m.Import == nil {
+		return
+	}
+	allowed := make(map[[2]string]Import, len(p.Imports))
+	for _, imp := range p.Imports {
+		allowed[[2]string{imp.Module, imp.Name}] = imp
+	}
+	for _, e := range m.Import.Entries {
+		fn, ok := e.Type.(wasm.FuncImport)
+		if !ok {
+			add(RuleImport, "import of %v %s.%s not allowed", e.Type.Kind(), e.ModuleName, e.FieldName)
+			continue
+		}
+		imp, ok := allowed[[2]string{e.ModuleName, e.FieldName}]
+		if !ok {
+			add(RuleImport, "import of function %s.%s not allowed", e.ModuleName, e.FieldName)
+			continue
+		}
+		want, err := imp.sig()
+		if err != nil {
+			add(RuleImport, "%v", err)
+			continue
+		}
+		if int(fn.Type) >= len(m.Types.Entries) {
+			continue // reported by validation
+		}
+		if got := m.Types.Entries[fn.Type]; !got.Equal(want) {
+			add(RuleImport, "function %s.%s imported with signature %v, want %v", e.ModuleName, e.FieldName, got, want)
+		}
+	}
+}
+
+func (p *Policy) checkExports(m *wasm.Module, add func(Rule, string, ...interface{})) {
+	for _, want := range p.Exports {
+		kind, ok := externals[want.Kind]
+		if !ok {
+			add(RuleExport, "export %q has unknown kind %q", want.Name, want.Kind)
+			continue
+		}
+		var e wasm.ExportEntry
+		if m.Export != nil {
+			e, ok = m.Export.Entries[want.Name]
+		}
+		switch {
+		case !ok:
+			add(RuleExport, "missing %s export %q", want.Kind, want.Name)
+		case e.Kind != kind:
+			add(RuleExport, "export %q is a %v, want a %s", want.Name, e.Kind, want.Kind)
+		}
+	}
+}
+
+// checkLimits checks that limits declare a maximum of at most max units.
+func checkLimits(rule Rule, what, units string, limits wasm.ResizableLimits, max uint32, add func(Rule, string, ...interface{})) {
+	switch {
+	case max == 0:
+	case !limits.HasMaximum():
+		add(rule, "%s has no maximum size", what)
+	case limits.Maximum > max:
+		add(rule, "%s has a maximum of %d %s, above %d", what, limits.Maximum, units, max)
+	}
+}
+
+// isFloat reports whether t is a floating-point type.
+func isFloat(t wasm.ValueType) bool {
+	return t == wasm.ValueTypeF32 || t == wasm.ValueTypeF64
+}
+
+// hasFloat reports whether ts holds a floating-point type.
+func hasFloat(ts []wasm.ValueType) bool {
+	for _, t := range ts {
+		if isFloat(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// floatViolations returns the floating-point values declared by m, in its
+// types, imported and defined globals and locals, and the floating-point
+// instructions of the functions it defines. The declarations are checked
+// because get_local, set_local, get_global and set_global move values of
+// any type.
+func floatViolations(m *wasm.Module) []Violation {
+	var vs []Violation
+	add := func(fn, offset int, format string, args ...interface{}) {
+		vs = append(vs, Violation{Rule: RuleFloat, Func: fn, Offset: offset, Message: fmt.Sprintf(format, args...)})
+	}
+	if m.Types != nil {
+		for i, sig := range m.Types.Entries {
+			if hasFloat(sig.ParamTypes) || hasFloat(sig.ReturnTypes) {
+				add(-1, -1, "type %d %v has floating-point values", i, sig)
+			}
+		}
+	}
+	importedGlobals := m.ImportEntries(wasm.ExternalGlobal)
+	for _, e := range importedGlobals {
+		if t := e.Type.(wasm.GlobalVarImport).Type.Type; isFloat(t) {
+			add(-1, -1, "imported global %s.%s has floating-point type %v", e.ModuleName, e.FieldName, t)
+		}
+	}
+	if m.Global != nil {
+		for i, g := range m.Global.Globals {
+			if isFloat(g.Type.Type) {
+				add(-1, -1, "global %d has floating-point type %v", len(importedGlobals)+i, g.Type.Type)
+			}
+		}
+	}
+
+	if m.Function == nil {
+		return vs
+	}
+	imported := len(m.ImportEntries(wasm.ExternalFunction))
+	for i := imported; i < len(m.FunctionIndexSpace); i++ {
+		fn := m.FunctionIndexSpace[i]
+		if fn.Body == nil {
+			continue
+		}
+		local := len(fn.Sig.ParamTypes)
+		for _, l := range fn.Body.Locals {
+			if isFloat(l.Type) {
+				add(i, -1, "local %d has floating-point type %v", local, l.Type)
+			}
+			local += int(l.Count)
+		}
+		dis, err := disasm.Disassemble(fn, m)
+		if err != nil {
+			continue // reported by validation
+		}
+		for k, ins := range dis.Code {
+			if isFloat(ins.Op.Returns) || hasFloat(ins.Op.Args) {
+				add(i, dis.Offsets[k], "floating-point instruction %s", ins.Op.Name)
+			}
+		}
+	}
+	return vs
+}
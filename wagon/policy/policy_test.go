@@ -0,0 +1,204 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package policy_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/policy"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/builder"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+const contractPolicy = `{
+	"imports": [{"module": "env", "name": "get_balance", "params": ["i32"], "results": ["i64"]}],
+	"exports": [{"name": "invoke", "kind": "function"}, {"name": "memory", "kind": "memory"}],
+	"max_memory_pages": 16,
+	"max_table_size": 64,
+	"max_code_size": 1024
+}`
+
+var (
+	i32 = wasm.ValueTypeI32
+	i64 = wasm.ValueTypeI64
+
+	balanceSig = wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{i32}, ReturnTypes: []wasm.ValueType{i64}}
+)
+
+// encode returns the module built by b, changed by edit if not nil, for
+// the parts of a module the builder does not write.
+func encode(t *testing.T, b *builder.Builder, edit func(m *wasm.Module)) []byte {
+	raw, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edit == nil {
+		return raw
+	}
+	m, err := wasm.DecodeModule(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(m)
+	buf := new(bytes.Buffer)
+	if err = wasm.EncodeModule(buf, m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheckModule(t *testing.T) {
+	p, err := policy.Read(strings.NewReader(contractPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := builder.New().
+		AddImport("env", "get_balance", balanceSig).
+		AddMemory(wasm.ResizableLimits{Flags: 1, Initial: 1, Maximum: 16})
+	b.AddFunction("invoke", balanceSig, nil, []disasm.Instr{
+		builder.Instr(ops.GetLocal, uint32(0)),
+		builder.Instr(ops.Call, b.Function("env.get_balance")),
+	}).
+		Export("invoke", wasm.ExternalFunction, b.Function("invoke")).
+		Export("memory", wasm.ExternalMemory, 0)
+	vs, err := p.CheckModule(bytes.NewReader(encode(t, b, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vs {
+		t.Errorf("unexpected violation: %v", v)
+	}
+
+	b = builder.New().
+		AddImport("env", "get_balance", wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{i64}, ReturnTypes: []wasm.ValueType{i64}}).
+		AddImport("env", "selfdestruct", wasm.FunctionSig{Form: 0}).
+		AddMemory(wasm.ResizableLimits{Initial: 1})
+	b.AddFunction("invoke", wasm.FunctionSig{Form: 0, ReturnTypes: []wasm.ValueType{i32}}, nil, []disasm.Instr{
+		builder.Instr(ops.Call, b.Function("env.selfdestruct")),
+		builder.Instr(ops.F32Const, float32(1.5)),
+		builder.Instr(ops.I32TruncSF32),
+	}).
+		Export("memory", wasm.ExternalFunction, b.Function("invoke"))
+	raw := encode(t, b, func(m *wasm.Module) {
+		// an immediate padded to 5 bytes, as emitted by wasm-ld, moves the
+		// offsets of the following instructions.
+		body := &m.Code.Bodies[0]
+		body.Code = append([]byte{ops.Call, 0x81, 0x80, 0x80, 0x80, 0x00}, body.Code[2:]...)
+		m.Start = &wasm.SectionStartFunction{Index: 2}
+		m.Table = &wasm.SectionTables{Entries: []wasm.Table{{ElementType: wasm.ElemTypeAnyFunc, Limits: wasm.ResizableLimits{Flags: 1, Maximum: 100}}}}
+		m.Code.Bodies = append(m.Code.Bodies, wasm.FunctionBody{Code: append(bytes.Repeat([]byte{ops.Nop}, 1024), ops.I32Add)})
+		m.Function.Types = append(m.Function.Types, m.Function.Types[0])
+	})
+	vs, err = p.CheckModule(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		rule   policy.Rule
+		fn     int
+		offset int
+		msg    string
+	}{
+		{policy.RuleImport, -1, -1, "function env.get_balance imported with signature"},
+		{policy.RuleImport, -1, -1, "import of function env.selfdestruct not allowed"},
+		{policy.RuleExport, -1, -1, `missing function export "invoke"`},
+		{policy.RuleExport, -1, -1, `export "memory" is a function, want a memory`},
+		{policy.RuleStart, -1, -1, "start function 2 not allowed"},
+		{policy.RuleMemory, -1, -1, "memory 0 has no maximum size"},
+		{policy.RuleTable, -1, -1, "table 0 has a maximum of 100 elements, above 64"},
+		{policy.RuleCodeSize, -1, -1, "exceeds 1024 bytes"},
+		{policy.RuleValidation, 3, 1024, ""},
+		{policy.RuleFloat, 2, 6, "f32.const"},
+		{policy.RuleFloat, 2, 11, "i32.trunc_s/f32"},
+	}
+	if len(vs) != len(want) {
+		for _, v := range vs {
+			t.Log(v)
+		}
+		t.Fatalf("got %d violations, want %d", len(vs), len(want))
+	}
+	for i, w := range want {
+		v := vs[i]
+		if v.Rule != w.rule || v.Func != w.fn || v.Offset != w.offset || !strings.Contains(v.Message, w.msg) {
+			t.Errorf("violation %d: got %v, want %s at %d:%d containing %q", i, v, w.rule, w.fn, w.offset, w.msg)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	for _, src := range []string{
+		`{"imports": [{"module": "env", "name": "f", "params": ["u32"]}]}`,
+		`{"exports": [{"name": "f", "kind": "func"}]}`,
+		`{"max_pages": 1}`,
+		`[]`,
+	} {
+		if _, err := policy.Read(strings.NewReader(src)); err == nil {
+			t.Errorf("%s: no error", src)
+		}
+	}
+}
+
+func TestCheckModuleFloatDeclarations(t *testing.T) {
+	f32, f64 := wasm.ValueTypeF32, wasm.ValueTypeF64
+	// floating-point values only moved by get_local and get_global.
+	b := builder.New().AddGlobal("g", false, float64(1))
+	b.AddFunction("f", wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{f32}}, []wasm.ValueType{i32, f64}, []disasm.Instr{
+		builder.Instr(ops.GetLocal, uint32(2)),
+		builder.Instr(ops.Drop),
+		builder.Instr(ops.GetGlobal, b.Global("g")),
+		builder.Instr(ops.Drop),
+	})
+	raw := encode(t, b, func(m *wasm.Module) {
+		m.Import = &wasm.SectionImports{Entries: []wasm.ImportEntry{{
+			ModuleName: "env",
+			FieldName:  "rate",
+			Type:       wasm.GlobalVarImport{Type: wasm.GlobalVar{Type: f32}},
+		}}}
+	})
+	vs, err := new(policy.Policy).CheckModule(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range vs {
+		if v.Rule == policy.RuleFloat {
+			got = append(got, v.Error())
+		}
+	}
+	want := []string{
+		"policy: float: type 0 <func [f32] -> []> has floating-point values",
+		"policy: float: imported global env.rate has floating-point type f32",
+		"policy: float: global 1 has floating-point type f64",
+		"policy: float: function 0: local 2 has floating-point type f64",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got violations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckModuleDecodeOptions(t *testing.T) {
+	b := builder.New().AddMemory(wasm.ResizableLimits{Initial: 300})
+	raw := encode(t, b, nil)
+	// the default limits allow 256 pages.
+	if _, err := new(policy.Policy).CheckModule(bytes.NewReader(raw)); err == nil {
+		t.Error("memory of 300 pages: no error")
+	} else if _, ok := err.(wasm.LimitError); !ok {
+		t.Errorf("got error %v, want a LimitError", err)
+	}
+	p := &policy.Policy{DecodeOptions: &wasm.DecodeOptions{MaxModuleSize: 8}}
+	if _, err := p.CheckModule(bytes.NewReader(raw)); err == nil {
+		t.Errorf("module of %d bytes: no error", len(raw))
+	}
+	p.DecodeOptions.MaxModuleSize = 0
+	if _, err := p.CheckModule(bytes.NewReader(raw)); err != nil {
+		t.Error(err)
+	}
+}
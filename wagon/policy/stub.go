@@ -0,0 +1,67 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package policy
+
+import (
+	"fmt"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+// stubResolver returns a resolver providing, for the imports of m, modules
+// exporting entries with the declared signatures, types and limits.
+// Imported globals are immutable, so that ReadModule accepts them.
+func stubResolver(m *wasm.Module) wasm.ResolveFunc {
+	stubs := make(map[string]*wasm.Module)
+	if m.Import == nil {
+		return nil
+	}
+	for _, e := range m.Import.Entries {
+		stub, ok := stubs[e.ModuleName]
+		if !ok {
+			stub = wasm.NewModule()
+			stub.Export.Entries = make(map[string]wasm.ExportEntry)
+			stubs[e.ModuleName] = stub
+		}
+		var index int
+		switch typ := e.Type.(type) {
+		case wasm.FuncImport:
+			if m.Types == nil || int(typ.Type) >= len(m.Types.Entries) {
+				continue
+			}
+			index = len(stub.FunctionIndexSpace)
+			sig := m.Types.Entries[typ.Type]
+			stub.FunctionIndexSpace = append(stub.FunctionIndexSpace, wasm.Function{
+				Sig:  &sig,
+				Body: &wasm.FunctionBody{},
+			})
+		case wasm.GlobalVarImport:
+			index = len(stub.GlobalIndexSpace)
+			stub.GlobalIndexSpace = append(stub.GlobalIndexSpace, wasm.GlobalEntry{
+				Type: wasm.GlobalVar{Type: typ.Type.Type},
+			})
+		case wasm.TableImport:
+			index = len(stub.Table.Entries)
+			stub.Table.Entries = append(stub.Table.Entries, typ.Type)
+			stub.TableIndexSpace = append(stub.TableIndexSpace, nil)
+		case wasm.MemoryImport:
+			index = len(stub.Memory.Entries)
+			stub.Memory.Entries = append(stub.Memory.Entries, typ.Type)
+			stub.LinearMemoryIndexSpace = append(stub.LinearMemoryIndexSpace, nil)
+		}
+		stub.Export.Entries[e.FieldName] = wasm.ExportEntry{
+			FieldStr: e.FieldName,
+			Kind:     e.Type.Kind(),
+			Index:    uint32(index),
+		}
+	}
+	return func(name string) (*wasm.Module, error) {
+		stub, ok := stubs[name]
+		if !ok {
+			return nil, fmt.Errorf("policy: no stub for module %q", name)
+		}
+		return stub, nil
+	}
+}
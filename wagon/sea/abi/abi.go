@@ -0,0 +1,366 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package abi describes the exported functions of a contract in a JSON
+// ABI, and calls them with Go values.
+//
+// An ABI is a JSON array of functions with their inputs and outputs:
+//
+//	[{"name": "transfer", "type": "function",
+//	  "inputs": [{"name": "to", "type": "address"}, {"name": "amount", "type": "uint256"}],
+//	  "outputs": [{"name": "", "type": "bool"}]}]
+//
+// Integers and booleans are passed as WebAssembly values: int32, uint32 and
+// bool as i32, int64 and uint64 as i64. Values of the types bytes, string,
+// address and uint256 are written to the contract memory with
+// sea.WavmMemory.Alloc and passed as an i32 pointer; an address is 20
+// bytes and a uint256 32 big-endian bytes. A function returning one of
+// these types returns a pointer to bytes recorded in the memory.
+package abi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+
+	"github.com/sea-project/sea-pkg/wagon/exec"
+	"github.com/sea-project/sea-pkg/wagon/sea"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+// Types of arguments and return values.
+const (
+	Int32   = "int32"
+	Uint32  = "uint32"
+	Int64   = "int64"
+	Uint64  = "uint64"
+	Bool    = "bool"
+	Bytes   = "bytes"
+	String  = "string"
+	Address = "address"
+	Uint256 = "uint256"
+)
+
+// AddressLength is the length in bytes of an address.
+const AddressLength = 20
+
+// AddressValue is the Go type of address values.
+type AddressValue [AddressLength]byte
+
+var (
+	// ErrOutOfMemory is returned when the arguments of a call do not fit in
+	// the memory of the contract.
+	ErrOutOfMemory = errors.New("abi: arguments do not fit in the contract memory")
+	// ErrNullPointer is returned when a function returning bytes returns a
+	// pointer to no recorded bytes.
+	ErrNullPointer = errors.New("abi: return value points to no bytes")
+)
+
+// Argument is an input or output of a function.
+type Argument struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// valueType returns the WebAssembly type passing values of the type of a.
+func (a Argument) valueType() (wasm.ValueType, error) {
+	switch a.Type {
+	case Int64, Uint64:
+		return wasm.ValueTypeI64, nil
+	case Int32, Uint32, Bool, Bytes, String, Address, Uint256:
+		return wasm.ValueTypeI32, nil
+	}
+	return 0, fmt.Errorf("abi: unknown type %q of argument %q", a.Type, a.Name)
+}
+
+// Method is an exported function of a contract.
+type Method struct {
+	Name    string     `json:"name"`
+	Type    string     `json:"type"`
+	Inputs  []Argument `json:"inputs"`
+	Outputs []Argument `json:"outputs"`
+}
+
+// Sig returns the signature of the WebAssembly function implementing m.
+func (m Method) Sig() (wasm.FunctionSig, error) {
+	sig := wasm.FunctionSig{Form: 0}
+	for _, arg := range m.Inputs {
+		t, err := arg.valueType()
+		if err != nil {
+			return sig, err
+		}
+		sig.ParamTypes = append(sig.ParamTypes, t)
+	}
+	if len(m.Outputs) > 1 {
+		return sig, fmt.Errorf("abi: function %q has %d outputs, want at most 1", m.Name, len(m.Outputs))
+	}
+	for _, arg := range m.Outputs {
+		t, err := arg.valueType()
+		if err != nil {
+			return sig, err
+		}
+		sig.ReturnTypes = append(sig.ReturnTypes, t)
+	}
+	return sig, nil
+}
+
+// ABI holds the functions of a contract by name.
+type ABI struct {
+	Methods map[string]Method
+}
+
+// JSON reads an ABI from r. Entries of a type other than "function" are
+// ignored.
+func JSON(r io.Reader) (ABI, error) {
+	var abi ABI
+	if err := json.NewDecoder(r).Decode(&abi); err != nil {
+		return ABI{}, err
+	}
+	return abi, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (abi *ABI) UnmarshalJSON(data []byte) error {
+	var methods []Method
+	if err := json.Unmarshal(data, &methods); err != nil {
+		return err
+	}
+	abi.Methods = make(map[string]Method)
+	for _, m := range methods {
+		if m.Type != "" && m.Type != "function" {
+			continue
+		}
+		if _, ok := abi.Methods[m.Name]; ok {
+			return fmt.Errorf("abi: duplicate function %q", m.Name)
+		}
+		if _, err := m.Sig(); err != nil {
+			return err
+		}
+		abi.Methods[m.Name] = m
+	}
+	return nil
+}
+
+func (abi ABI) method(name string) (Method, error) {
+	m, ok := abi.Methods[name]
+	if !ok {
+		return Method{}, fmt.Errorf("abi: unknown function %q", name)
+	}
+	return m, nil
+}
+
+// Pack converts the arguments of the function name into the values passed
+// to ExecContractCode, writing those passed by pointer to blocks allocated
+// in mem. It returns the offsets of these blocks, which the caller frees
+// once the call returns. On error, the blocks already allocated are freed.
+func (abi ABI) Pack(mem *sea.WavmMemory, name string, args ...interface{}) (vals, ptrs []uint64, err error) {
+	m, err := abi.method(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(args) != len(m.Inputs) {
+		return nil, nil, fmt.Errorf("abi: function %q takes %d arguments, got %d", name, len(m.Inputs), len(args))
+	}
+	vals = make([]uint64, len(args))
+	for i, arg := range m.Inputs {
+		var allocated bool
+		if vals[i], allocated, err = pack(mem, arg, args[i]); err != nil {
+			for _, ptr := range ptrs {
+				mem.Free(ptr)
+			}
+			return nil, nil, err
+		}
+		if allocated {
+			ptrs = append(ptrs, vals[i])
+		}
+	}
+	return vals, ptrs, nil
+}
+
+// pack converts v into the value of arg, and reports whether it allocated a
+// block of mem for it.
+func pack(mem *sea.WavmMemory, arg Argument, v interface{}) (uint64, bool, error) {
+	typeErr := func() error {
+		return fmt.Errorf("abi: cannot use %v (%T) as %s argument %q", v, v, arg.Type, arg.Name)
+	}
+	var data []byte
+	switch arg.Type {
+	case Int32, Int64:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n := rv.Int()
+			if arg.Type == Int32 {
+				if n < math.MinInt32 || n > math.MaxInt32 {
+					return 0, false, typeErr()
+				}
+				return uint64(uint32(int32(n))), false, nil
+			}
+			return uint64(n), false, nil
+		}
+		return 0, false, typeErr()
+	case Uint32, Uint64:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n := rv.Uint()
+			if arg.Type == Uint32 && n > math.MaxUint32 {
+				return 0, false, typeErr()
+			}
+			return n, false, nil
+		}
+		return 0, false, typeErr()
+	case Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return 0, false, typeErr()
+		}
+		if b {
+			return 1, false, nil
+		}
+		return 0, false, nil
+	case Bytes:
+		b, ok := v.([]byte)
+		if !ok {
+			return 0, false, typeErr()
+		}
+		data = b
+	case String:
+		s, ok := v.(string)
+		if !ok {
+			return 0, false, typeErr()
+		}
+		data = []byte(s)
+	case Address:
+		switch a := v.(type) {
+		case AddressValue:
+			data = a[:]
+		case []byte:
+			if len(a) != AddressLength {
+				return 0, false, typeErr()
+			}
+			data = a
+		default:
+			return 0, false, typeErr()
+		}
+	case Uint256:
+		n, ok := v.(*big.Int)
+		if !ok || n == nil || n.Sign() < 0 || n.BitLen() > 256 {
+			return 0, false, typeErr()
+		}
+		data = make([]byte, 32)
+		b := n.Bytes()
+		copy(data[32-len(b):], b)
+	}
+	ptr, err := mem.Alloc(data)
+	if err == sea.ErrOutOfMemory {
+		return 0, false, ErrOutOfMemory
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint64(ptr), true, nil
+}
+
+// Unpack converts the value ret returned by the function name into a Go
+// value, reading the values returned by pointer from mem. It returns nil
+// for a function without outputs.
+func (abi ABI) Unpack(mem *sea.WavmMemory, name string, ret uint64) (interface{}, error) {
+	m, err := abi.method(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Outputs) == 0 {
+		return nil, nil
+	}
+	switch arg := m.Outputs[0]; arg.Type {
+	case Int32:
+		return int32(uint32(ret)), nil
+	case Uint32:
+		return uint32(ret), nil
+	case Int64:
+		return int64(ret), nil
+	case Uint64:
+		return ret, nil
+	case Bool:
+		return uint32(ret) != 0, nil
+	}
+
+	ptr := uint64(uint32(ret))
+	if _, ok := mem.Size[ptr]; !ok {
+		return nil, ErrNullPointer
+	}
+	data := mem.Get(ptr)
+	switch arg := m.Outputs[0]; arg.Type {
+	case Bytes:
+		if data == nil {
+			data = []byte{}
+		}
+		return data, nil
+	case String:
+		return string(data), nil
+	case Address:
+		var a AddressValue
+		if len(data) != AddressLength {
+			return nil, fmt.Errorf("abi: function %q returned %d bytes for an address", name, len(data))
+		}
+		copy(a[:], data)
+		return a, nil
+	default: // Uint256
+		if len(data) > 32 {
+			return nil, fmt.Errorf("abi: function %q returned %d bytes for a uint256", name, len(data))
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+}
+
+// Call calls the exported function name of the contract run by inter with
+// args, and returns its output converted by Unpack. The signature of the
+// export must match the ABI. The blocks holding the arguments are freed
+// when the call returns.
+func (abi ABI) Call(inter *exec.Interpreter, name string, args ...interface{}) (interface{}, error) {
+	m, err := abi.method(name)
+	if err != nil {
+		return nil, err
+	}
+	module := inter.Module()
+	var export wasm.ExportEntry
+	ok := false
+	if module.Export != nil {
+		export, ok = module.Export.Entries[name]
+	}
+	if !ok || export.Kind != wasm.ExternalFunction {
+		return nil, fmt.Errorf("abi: function %q is not exported", name)
+	}
+	fn := module.GetFunction(int(export.Index))
+	if fn == nil {
+		return nil, fmt.Errorf("abi: function %q is not exported", name)
+	}
+	sig, err := m.Sig()
+	if err != nil {
+		return nil, err
+	}
+	if !sig.Equal(*fn.Sig) {
+		return nil, fmt.Errorf("abi: function %q has signature %v, the ABI describes %v", name, *fn.Sig, sig)
+	}
+
+	vals, ptrs, err := abi.Pack(inter.Memory, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, ptr := range ptrs {
+			inter.Memory.Free(ptr)
+		}
+	}()
+	ret, err := inter.ExecContractCode(int64(export.Index), vals...)
+	if err != nil {
+		return nil, err
+	}
+	return abi.Unpack(inter.Memory, name, ret)
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package abi_test
+
+import (
+	"bytes"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/exec"
+	"github.com/sea-project/sea-pkg/wagon/sea"
+	"github.com/sea-project/sea-pkg/wagon/sea/abi"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+const contractABI = `[
+	{"name": "add", "type": "function",
+	 "inputs": [{"name": "a", "type": "int64"}, {"name": "b", "type": "int64"}],
+	 "outputs": [{"name": "", "type": "int64"}]},
+	{"name": "neg", "inputs": [{"name": "a", "type": "int32"}], "outputs": [{"name": "", "type": "int32"}]},
+	{"name": "not", "inputs": [{"name": "b", "type": "bool"}], "outputs": [{"name": "", "type": "bool"}]},
+	{"name": "echo", "inputs": [{"name": "s", "type": "string"}], "outputs": [{"name": "", "type": "string"}]},
+	{"name": "echoBytes", "inputs": [{"name": "b", "type": "bytes"}], "outputs": [{"name": "", "type": "bytes"}]},
+	{"name": "amount", "inputs": [{"name": "to", "type": "address"}, {"name": "amount", "type": "uint256"}],
+	 "outputs": [{"name": "", "type": "uint256"}]},
+	{"name": "owner", "inputs": [{"name": "to", "type": "address"}], "outputs": [{"name": "", "type": "address"}]},
+	{"name": "Transfer", "type": "event", "inputs": [{"name": "to", "type": "address"}]}
+]`
+
+// newContract returns an interpreter running testdata/contract.wasm, with
+// the heap starting at 1024.
+func newContract(t *testing.T) *exec.Interpreter {
+	f, err := os.Open("testdata/contract.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := wasm.ReadModule(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initMem := func(mem *sea.WavmMemory, module *wasm.Module) error {
+		mem.Pos = 1024
+		return nil
+	}
+	inter, err := exec.NewInterpreter(m, nil, initMem, nil, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inter.RecoverPanic = true
+	return inter
+}
+
+func TestCall(t *testing.T) {
+	contract, err := abi.JSON(strings.NewReader(contractABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := contract.Methods["Transfer"]; ok {
+		t.Error("events are read as functions")
+	}
+	inter := newContract(t)
+
+	var owner abi.AddressValue
+	copy(owner[:], "0123456789abcdefghij")
+	amount, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	for _, tc := range []struct {
+		name string
+		args []interface{}
+		want interface{}
+	}{
+		{"add", []interface{}{int64(-3), 45}, int64(42)},
+		{"neg", []interface{}{int32(7)}, int32(-7)},
+		{"not", []interface{}{false}, true},
+		{"echo", []interface{}{"hello"}, "hello"},
+		{"echoBytes", []interface{}{[]byte{1, 2, 3}}, []byte{1, 2, 3}},
+		{"echoBytes", []interface{}{[]byte{}}, []byte{}},
+		{"owner", []interface{}{owner[:]}, owner},
+	} {
+		got, err := contract.Call(inter, tc.name, tc.args...)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if b, ok := tc.want.([]byte); ok {
+			if !bytes.Equal(got.([]byte), b) {
+				t.Errorf("%s: got %v, want %v", tc.name, got, b)
+			}
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %v (%T), want %v (%T)", tc.name, got, got, tc.want, tc.want)
+		}
+	}
+
+	got, err := contract.Call(inter, "amount", owner, amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.(*big.Int).Cmp(amount) != 0 {
+		t.Errorf("amount: got %v, want %v", got, amount)
+	}
+
+	// the blocks holding the arguments are freed after each call.
+	if n := inter.Memory.Allocated(); n != 0 {
+		t.Errorf("%d bytes of arguments are still allocated", n)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	contract, err := abi.JSON(strings.NewReader(contractABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inter := newContract(t)
+	for _, tc := range []struct {
+		name string
+		args []interface{}
+	}{
+		{"missing", nil},
+		{"add", []interface{}{int64(1)}},
+		{"add", []interface{}{"1", int64(2)}},
+		{"neg", []interface{}{int64(1) << 40}},
+		{"owner", []interface{}{[]byte{1, 2}}},
+		{"amount", []interface{}{abi.AddressValue{}, big.NewInt(-1)}},
+		{"echoBytes", []interface{}{make([]byte, 1<<16)}},
+	} {
+		if _, err := contract.Call(inter, tc.name, tc.args...); err == nil {
+			t.Errorf("%s%v: no error", tc.name, tc.args)
+		}
+	}
+	// the arguments packed before a failing one are freed.
+	if n := inter.Memory.Allocated(); n != 0 {
+		t.Errorf("%d bytes of arguments are still allocated", n)
+	}
+	if _, err := contract.Call(inter, "echoBytes", make([]byte, 1<<16)); err != abi.ErrOutOfMemory {
+		t.Errorf("echoBytes: got error %v, want %v", err, abi.ErrOutOfMemory)
+	}
+
+	// an ABI not matching the signature of the export.
+	wrong, err := abi.JSON(strings.NewReader(`[{"name": "add", "inputs": [{"name": "a", "type": "int32"}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrong.Call(inter, "add", int32(1)); err == nil {
+		t.Error("called add with a mismatched signature")
+	}
+
+	for _, src := range []string{
+		`[{"name": "f", "inputs": [{"name": "a", "type": "float"}]}]`,
+		`[{"name": "f"}, {"name": "f"}]`,
+		`[{"name": "f", "outputs": [{"name": "", "type": "bool"}, {"name": "", "type": "bool"}]}]`,
+	} {
+		if _, err := abi.JSON(strings.NewReader(src)); err == nil {
+			t.Errorf("%s: no error", src)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+;; the contract called by the ABI tests, with a single page of memory.
+;; Strings, bytes, addresses and uint256 values are passed as pointers to
+;; their encoding in the memory of the contract.
+(module
+  (memory 1 1)
+
+  (func $add (export "add") (param i64 i64) (result i64)
+    (i64.add (get_local 0) (get_local 1))
+  )
+  (func $neg (export "neg") (param i32) (result i32)
+    (i32.sub (i32.const 0) (get_local 0))
+  )
+  (func $not (export "not") (param i32) (result i32)
+    (i32.eqz (get_local 0))
+  )
+  (func $echo (export "echo") (export "echoBytes") (param i32) (result i32)
+    (get_local 0)
+  )
+  (func $amount (export "amount") (param i32 i32) (result i32)
+    (get_local 1)
+  )
+  (func $owner (export "owner") (param i32) (result i32)
+    (get_local 0)
+  )
+)
@@ -0,0 +1,166 @@
+package sea
+
+import "errors"
+
+// PageSize is the size in bytes of a page of linear memory.
+const PageSize = 65536
+
+// maxPages is the number of pages addressable by a 32-bit linear memory.
+const maxPages = 65536
+
+var (
+	// ErrOutOfMemory is returned when an allocation does not fit in the
+	// memory and the memory cannot grow.
+	ErrOutOfMemory = errors.New("sea: out of memory")
+	// ErrInvalidFree is returned by Free for a pointer that is not an
+	// allocated block.
+	ErrInvalidFree = errors.New("sea: free of a pointer not allocated")
+)
+
+// Grower is a linear memory growing by pages.
+type Grower interface {
+	// Grow grows the memory by n pages and returns its previous size in
+	// pages, or -1 if the memory cannot grow.
+	Grow(n uint32) int32
+	// Bytes returns the content of the memory.
+	Bytes() []byte
+}
+
+// sizeClasses are the capacities of the blocks of small allocations.
+// Larger allocations are rounded up to a multiple of largeBlock.
+var sizeClasses = [...]int{8, 16, 32, 64, 128, 256, 512, 1024, 2048, 4096}
+
+const largeBlock = 4096
+
+// blockSize returns the capacity of the block holding n bytes.
+func blockSize(n int) int {
+	for _, c := range sizeClasses {
+		if n <= c {
+			return c
+		}
+	}
+	return (n + largeBlock - 1) / largeBlock * largeBlock
+}
+
+// refresh updates Memory after the linear memory was grown by the contract.
+func (m *WavmMemory) refresh() {
+	if m.Grower != nil {
+		m.Memory = m.Grower.Bytes()
+	}
+}
+
+// ensure grows the memory to at least end bytes.
+func (m *WavmMemory) ensure(end uint64) error {
+	m.refresh()
+	if end <= uint64(len(m.Memory)) {
+		return nil
+	}
+	n := (end - uint64(len(m.Memory)) + PageSize - 1) / PageSize
+	if m.Grower != nil {
+		if n > maxPages || m.Grower.Grow(uint32(n)) == -1 {
+			return ErrOutOfMemory
+		}
+		m.Memory = m.Grower.Bytes()
+		return nil
+	}
+	max := uint64(m.MaxPages)
+	if max == 0 {
+		max = maxPages
+	}
+	if uint64(len(m.Memory))/PageSize+n > max {
+		return ErrOutOfMemory
+	}
+	m.Memory = append(m.Memory, make([]byte, n*PageSize)...)
+	return nil
+}
+
+// setPos moves the end of the heap, and the heap_pointer global with it.
+func (m *WavmMemory) setPos(pos int) {
+	m.Pos = pos
+	if m.HeapPointer != nil && uint64(uint32(*m.HeapPointer)) < uint64(pos) {
+		*m.HeapPointer = uint64(pos)
+	}
+}
+
+// Malloc allocates a block of at least n bytes and returns its offset.
+// Blocks are 8-byte aligned, and freed blocks of the same size class are
+// reused before the heap grows.
+func (m *WavmMemory) Malloc(n int) (uint64, error) {
+	if n < 0 {
+		return 0, ErrOutOfMemory
+	}
+	if m.blocks == nil {
+		m.blocks = make(map[uint64]int)
+		m.free = make(map[int][]uint64)
+	}
+	if m.Size == nil {
+		m.Size = make(map[uint64]int)
+	}
+	// the contract may have grown the memory since the last refresh, and
+	// Alloc writes to the block returned.
+	m.refresh()
+	size := blockSize(n)
+	if free := m.free[size]; len(free) > 0 {
+		ptr := free[len(free)-1]
+		m.free[size] = free[:len(free)-1]
+		m.blocks[ptr] = size
+		return ptr, nil
+	}
+
+	start := uint64(m.Pos)
+	if m.HeapPointer != nil {
+		// the contract may have allocated past Pos itself.
+		if hp := uint64(uint32(*m.HeapPointer)); hp > start {
+			start = hp
+		}
+	}
+	start = (start + 7) &^ 7
+	end := start + uint64(size)
+	if end > maxPages*PageSize {
+		return 0, ErrOutOfMemory
+	}
+	if err := m.ensure(end); err != nil {
+		return 0, err
+	}
+	m.setPos(int(end))
+	m.blocks[start] = size
+	return start, nil
+}
+
+// Alloc allocates a block holding value and returns its offset.
+func (m *WavmMemory) Alloc(value []byte) (int, error) {
+	ptr, err := m.Malloc(len(value))
+	if err != nil {
+		return 0, err
+	}
+	copy(m.Memory[ptr:], value)
+	m.Size[ptr] = len(value)
+	return int(ptr), nil
+}
+
+// Free releases the block at ptr allocated by Malloc or Alloc, and clears
+// its content.
+func (m *WavmMemory) Free(ptr uint64) error {
+	size, ok := m.blocks[ptr]
+	if !ok {
+		return ErrInvalidFree
+	}
+	m.refresh()
+	delete(m.blocks, ptr)
+	delete(m.Size, ptr)
+	block := m.Memory[ptr : ptr+uint64(size)]
+	for i := range block {
+		block[i] = 0
+	}
+	m.free[size] = append(m.free[size], ptr)
+	return nil
+}
+
+// Allocated returns the number of bytes held by allocated blocks.
+func (m *WavmMemory) Allocated() int {
+	n := 0
+	for _, size := range m.blocks {
+		n += size
+	}
+	return n
+}
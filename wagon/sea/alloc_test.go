@@ -0,0 +1,159 @@
+package sea
+
+import (
+	"bytes"
+	"testing"
+)
+
+// growerMemory is a linear memory of at most max pages.
+type growerMemory struct {
+	data []byte
+	max  int
+}
+
+func (g *growerMemory) Grow(n uint32) int32 {
+	cur := len(g.data) / PageSize
+	if cur+int(n) > g.max {
+		return -1
+	}
+	g.data = append(g.data, make([]byte, int(n)*PageSize)...)
+	return int32(cur)
+}
+
+func (g *growerMemory) Bytes() []byte { return g.data }
+
+func TestMalloc(t *testing.T) {
+	m := NewWavmMemory()
+	m.Memory = make([]byte, PageSize)
+	m.MaxPages = 2
+	m.Pos = 3
+
+	for _, tc := range []struct {
+		n, ptr, pos int
+	}{
+		{0, 8, 16},
+		{9, 16, 32},
+		{100, 32, 160},
+		{5000, 160, 160 + 8192},
+	} {
+		ptr, err := m.Malloc(tc.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(ptr) != tc.ptr || m.Pos != tc.pos {
+			t.Errorf("Malloc(%d): got %d with heap end %d, want %d and %d", tc.n, ptr, m.Pos, tc.ptr, tc.pos)
+		}
+	}
+	if got, want := m.Allocated(), 8+16+128+8192; got != want {
+		t.Errorf("got %d bytes allocated, want %d", got, want)
+	}
+
+	// freed blocks are cleared and reused by allocations of the same class.
+	p, err := m.Alloc([]byte("hello, world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Free(uint64(p)); err != nil {
+		t.Fatal(err)
+	}
+	if m.Get(uint64(p)) != nil || !bytes.Equal(m.Memory[p:p+12], make([]byte, 12)) {
+		t.Error("freed block not cleared")
+	}
+	if err = m.Free(uint64(p)); err != ErrInvalidFree {
+		t.Errorf("double free: got %v, want %v", err, ErrInvalidFree)
+	}
+	if err = m.Free(12); err != ErrInvalidFree {
+		t.Errorf("free of an inner pointer: got %v, want %v", err, ErrInvalidFree)
+	}
+	pos := m.Pos
+	q, err := m.Alloc([]byte("reused block"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != p || m.Pos != pos || string(m.GetPtr(uint64(q))) != "reused block" {
+		t.Errorf("got block %d and heap end %d, want %d and %d", q, m.Pos, p, pos)
+	}
+
+	// the memory grows by pages up to MaxPages.
+	big, err := m.Malloc(PageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Memory) != 2*PageSize || int(big)+PageSize > len(m.Memory) {
+		t.Errorf("got memory of %d bytes for a block at %d", len(m.Memory), big)
+	}
+	if _, err = m.Malloc(PageSize); err != ErrOutOfMemory {
+		t.Errorf("got %v, want %v", err, ErrOutOfMemory)
+	}
+	if _, err = m.Alloc(make([]byte, 2*PageSize)); err != ErrOutOfMemory {
+		t.Errorf("got %v, want %v", err, ErrOutOfMemory)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != ErrOutOfMemory {
+				t.Errorf("SetBytes: got panic %v, want %v", r, ErrOutOfMemory)
+			}
+		}()
+		m.SetBytes(make([]byte, PageSize))
+	}()
+}
+
+func TestMallocGrowerHeapPointer(t *testing.T) {
+	g := &growerMemory{data: make([]byte, PageSize), max: 3}
+	heapPointer := uint64(100)
+	m := NewWavmMemory()
+	m.Memory = g.Bytes()
+	m.Grower = g
+	m.HeapPointer = &heapPointer
+	m.Pos = 100
+
+	ptr, err := m.Malloc(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ptr != 104 || heapPointer != 120 {
+		t.Errorf("got block %d and heap pointer %d, want 104 and 120", ptr, heapPointer)
+	}
+
+	// the contract allocated past the heap end and grew the memory.
+	heapPointer = 2000
+	g.Grow(1)
+	ptr, err = m.Malloc(PageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ptr != 2000 || heapPointer != 2000+PageSize || m.Pos != 2000+PageSize {
+		t.Errorf("got block %d, heap pointer %d and end %d", ptr, heapPointer, m.Pos)
+	}
+	if len(g.data) != 2*PageSize || len(m.Memory) != len(g.data) {
+		t.Errorf("got memories of %d and %d bytes, want %d", len(g.data), len(m.Memory), 2*PageSize)
+	}
+	if _, err = m.Malloc(2 * PageSize); err != ErrOutOfMemory {
+		t.Errorf("got %v, want %v", err, ErrOutOfMemory)
+	}
+
+	// Set grows the memory instead of panicking.
+	m.Set(uint64(2*PageSize+10), 3, []byte("abc"))
+	if len(g.data) != 3*PageSize || string(m.GetPtr(2*PageSize+10)) != "abc" {
+		t.Errorf("Set: got memory of %d bytes", len(g.data))
+	}
+}
+
+func TestCopyState(t *testing.T) {
+	m := NewWavmMemory()
+	m.Memory = make([]byte, PageSize)
+	p, _ := m.Alloc([]byte("a"))
+	snap := new(WavmMemory)
+	snap.CopyState(m)
+
+	m.Free(uint64(p))
+	m.Alloc([]byte("bb"))
+	m.Alloc(make([]byte, 100))
+	m.CopyState(snap)
+	if m.Pos != snap.Pos || len(m.Size) != 1 || m.Allocated() != 8 {
+		t.Errorf("got heap end %d with %d values in %d bytes", m.Pos, len(m.Size), m.Allocated())
+	}
+	if err := m.Free(uint64(p)); err != nil {
+		t.Error(err)
+	}
+}
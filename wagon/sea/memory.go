@@ -2,13 +2,32 @@ package sea
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
 // Memory implements a simple memory model for the ethereum virtual machine.
+//
+// Host values are allocated with Malloc and Alloc, which reuse freed blocks
+// and grow the memory when the heap reaches its end. Pos is the end of the
+// heap, and Size the length of the value stored in each allocated block.
 type WavmMemory struct {
 	Memory []byte
 	Pos    int
 	Size   map[uint64]int
+
+	// Grower, if set, holds the linear memory backing Memory, which is
+	// grown through it.
+	Grower Grower
+	// MaxPages bounds the growth of a memory without Grower, in pages of
+	// 64 KiB. Zero means the 4 GiB addressable by wasm32.
+	MaxPages uint32
+	// HeapPointer, if set, points to the heap_pointer global of the
+	// contract, which allocations keep at or above Pos.
+	HeapPointer *uint64
+
+	blocks map[uint64]int   // capacity of each allocated block
+	free   map[int][]uint64 // freed blocks by capacity
 }
 
 func NewWavmMemory() *WavmMemory {
@@ -56,12 +75,11 @@ func NewWavmMemory() *WavmMemory {
 // 	return nil
 // }
 
-// Set sets offset + size to value
+// Set sets offset + size to value, growing the memory if needed. It panics
+// with ErrOutOfMemory if the memory cannot grow.
 func (m *WavmMemory) Set(offset, size uint64, value []byte) {
-	// length of Memory may never be less than offset + size.
-	// The Memory should be resized PRIOR to setting the memory
-	if size > uint64(len(m.Memory)) {
-		panic("INVALID memory: Memory empty")
+	if err := m.ensure(offset + size); err != nil {
+		panic(err)
 	}
 
 	// It's possible the offset is greater than 0 and size equals 0. This is because
@@ -69,16 +87,23 @@ func (m *WavmMemory) Set(offset, size uint64, value []byte) {
 	if size > 0 {
 		copy(m.Memory[offset:offset+size], value)
 		m.Size[offset] = len(value)
-		m.Pos = m.Pos + int(size)
 	} else {
 		m.Size[offset] = 0
-		m.Pos = m.Pos + 1
+		size = 1
+	}
+	if end := int(offset + size); end > m.Pos {
+		m.setPos(end)
 	}
 }
+
+// SetBytes allocates a block holding value and returns its offset. It
+// panics with ErrOutOfMemory if the memory cannot grow.
 func (m *WavmMemory) SetBytes(value []byte) (offset int) {
-	offset = m.Len()
-	m.Set(uint64(offset), uint64(len(value)), value)
-	return
+	offset, err := m.Alloc(value)
+	if err != nil {
+		panic(err)
+	}
+	return offset
 }
 
 // Resize resizes the memory to size
@@ -90,6 +115,7 @@ func (m *WavmMemory) Resize(size uint64) {
 
 // Get returns offset + size as a new slice
 func (m *WavmMemory) Get(offset uint64) (cpy []byte) {
+	m.refresh()
 	ptr := uint32(offset)
 	if int32(ptr) < 0 {
 		ptr = uint32(int32(len(m.Memory)) + int32(ptr))
@@ -105,7 +131,7 @@ func (m *WavmMemory) Get(offset uint64) (cpy []byte) {
 		return nil
 	}
 
-	if len(m.Memory) > int(offset) {
+	if uint64(len(m.Memory)) >= offset+uint64(size) {
 		cpy = make([]byte, size)
 		copy(cpy, m.Memory[offset:offset+uint64(size)])
 		return
@@ -116,6 +142,7 @@ func (m *WavmMemory) Get(offset uint64) (cpy []byte) {
 
 // GetPtr returns the offset + size
 func (m *WavmMemory) GetPtr(offset uint64) []byte {
+	m.refresh()
 	ptr := uint32(offset)
 	if int32(ptr) < 0 {
 		ptr = uint32(int32(len(m.Memory)) + int32(ptr))
@@ -130,7 +157,7 @@ func (m *WavmMemory) GetPtr(offset uint64) []byte {
 	} else {
 		return nil
 	}
-	if len(m.Memory) > int(offset) {
+	if uint64(len(m.Memory)) >= offset+uint64(size) {
 		return m.Memory[offset : offset+uint64(size)]
 	}
 	return nil
@@ -142,24 +169,49 @@ func (m *WavmMemory) Len() int {
 }
 
 func (m *WavmMemory) MemSize() int {
+	m.refresh()
 	return len(m.Memory)
 }
 
 // Data returns the backing slice
 func (m *WavmMemory) Data() []byte {
+	m.refresh()
 	return m.Memory
 }
 
+// CopyState sets the heap of m to that of src: Pos, Size and the allocated
+// and freed blocks. The content of the memory is not copied.
+func (m *WavmMemory) CopyState(src *WavmMemory) {
+	m.Pos = src.Pos
+	m.Size = make(map[uint64]int, len(src.Size))
+	for k, v := range src.Size {
+		m.Size[k] = v
+	}
+	m.blocks = make(map[uint64]int, len(src.blocks))
+	for k, v := range src.blocks {
+		m.blocks[k] = v
+	}
+	m.free = make(map[int][]uint64, len(src.free))
+	for k, v := range src.free {
+		m.free[k] = append([]uint64(nil), v...)
+	}
+}
+
 func (m *WavmMemory) Print() {
-	fmt.Printf("### mem %d bytes ###\n", len(m.Memory))
+	m.Fprint(os.Stdout)
+}
+
+// Fprint writes a hex dump of the memory to w, 32 bytes per line.
+func (m *WavmMemory) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "### mem %d bytes ###\n", len(m.Memory))
 	if len(m.Memory) > 0 {
 		addr := 0
 		for i := 0; i+32 <= len(m.Memory); i += 32 {
-			fmt.Printf("%03d: % x\n", addr, m.Memory[i:i+32])
+			fmt.Fprintf(w, "%03d: % x\n", addr, m.Memory[i:i+32])
 			addr++
 		}
 	} else {
-		fmt.Println("-- empty --")
+		fmt.Fprintln(w, "-- empty --")
 	}
-	fmt.Println("####################")
+	fmt.Fprintln(w, "####################")
 }
@@ -12,14 +12,34 @@ import (
 	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
 )
 
+// Error is a validation failure in a function of a module.
 type Error struct {
-	Offset   int // Byte offset in the bytecode vector where the error occurs.
+	Offset   int // Byte offset in the bytecode vector of the offending instruction.
 	Function int // Index into the function index space for the offending function.
 	Err      error
+
+	Name string // Name of the function, if known.
+	Op   string // Mnemonic of the offending instruction, if it was decoded.
+	// Expected and Actual hold the types of the operands expected by the
+	// instruction and those on the stack, bottom first, for type errors.
+	Expected []wasm.ValueType
+	Actual   []wasm.ValueType
 }
 
 func (e Error) Error() string {
-	return fmt.Sprintf("error while validating function %d at offset %d: %v", e.Function, e.Offset, e.Err)
+	fn := fmt.Sprint(e.Function)
+	if e.Name != "" {
+		fn += fmt.Sprintf(" (%s)", e.Name)
+	}
+	at := fmt.Sprint(e.Offset)
+	if e.Op != "" {
+		at += fmt.Sprintf(" (%s)", e.Op)
+	}
+	msg := fmt.Sprintf("error while validating function %s at offset %s: %v", fn, at, e.Err)
+	if e.Expected != nil {
+		msg += fmt.Sprintf(": expected operands %v, got %v", e.Expected, e.Actual)
+	}
+	return msg
 }
 
 var ErrStackUnderflow = errors.New("validate: stack underflow")
@@ -7,6 +7,7 @@ package validate
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 
 	"github.com/sea-project/sea-pkg/wagon/wasm"
@@ -14,7 +15,7 @@ import (
 )
 
 // vibhavp: TODO: We do not verify whether blocks don't access for the parent block, do that.
-func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Module) (*mockVM, error) {
+func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Module, all bool) (*mockVM, error) {
 	vm := &mockVM{
 		stack:    []operand{},
 		stackTop: 0,
@@ -25,6 +26,7 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 		polymorphic: false,
 		blocks:      []block{},
 		curFunc:     fn,
+		all:         all,
 	}
 
 	localVariables := []operand{}
@@ -45,6 +47,7 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 	}
 
 	for {
+		vm.startOp()
 		op, err := vm.code.ReadByte()
 		if err == io.EOF {
 			break
@@ -56,11 +59,12 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 		if err != nil {
 			return vm, err
 		}
+		vm.opName = opStruct.Name
 
 		logger.Printf("PC: %d OP: %s polymorphic: %v", vm.pc(), opStruct.Name, vm.isPolymorphic())
 
 		if !opStruct.Polymorphic {
-			if err := vm.adjustStack(opStruct); err != nil {
+			if err := vm.fail(vm.adjustStack(opStruct)); err != nil {
 				return vm, err
 			}
 		}
@@ -90,7 +94,9 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			if block.blockType != wasm.BlockTypeEmpty {
 				top, under := vm.topOperand()
 				if !vm.isPolymorphic() && (under || top.Type != wasm.ValueType(block.blockType)) {
-					return vm, InvalidTypeError{wasm.ValueType(block.blockType), top.Type}
+					if err := vm.fail(InvalidTypeError{wasm.ValueType(block.blockType), top.Type}); err != nil {
+						return vm, err
+					}
 				}
 				vm.pushOperand(wasm.ValueType(block.blockType))
 			}
@@ -106,7 +112,9 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			if block.blockType != wasm.BlockTypeEmpty {
 				top, under := vm.topOperand()
 				if !isPolymorphic && (under || top.Type != wasm.ValueType(block.blockType)) {
-					return vm, InvalidTypeError{wasm.ValueType(block.blockType), top.Type}
+					if err := vm.fail(InvalidTypeError{wasm.ValueType(block.blockType), top.Type}); err != nil {
+						return vm, err
+					}
 				}
 				vm.stackTop = block.stackTop
 				vm.pushOperand(wasm.ValueType(block.blockType))
@@ -120,8 +128,10 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			if err != nil {
 				return vm, err
 			}
-			if err = vm.canBranch(int(depth)); !vm.isPolymorphic() && err != nil {
-				return vm, err
+			if err = vm.canBranch(int(depth)); !vm.isPolymorphic() {
+				if err = vm.fail(err); err != nil {
+					return vm, err
+				}
 			}
 			if op == ops.Br {
 				vm.setPolymorphic()
@@ -129,7 +139,9 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 		case ops.BrTable:
 			operand, under := vm.popOperand()
 			if !vm.isPolymorphic() && (under || operand.Type != wasm.ValueTypeI32) {
-				return vm, InvalidTypeError{wasm.ValueTypeI32, operand.Type}
+				if err := vm.fail(InvalidTypeError{wasm.ValueTypeI32, operand.Type}); err != nil {
+					return vm, err
+				}
 			}
 			// read table entries
 			targetCount, err := vm.fetchVarUint()
@@ -143,8 +155,10 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 				if err != nil {
 					return vm, err
 				}
-				if err = vm.canBranch(int(entry)); !vm.isPolymorphic() && err != nil {
-					return vm, err
+				if err = vm.canBranch(int(entry)); !vm.isPolymorphic() {
+					if err = vm.fail(err); err != nil {
+						return vm, err
+					}
 				}
 				targetTable = append(targetTable, entry)
 			}
@@ -153,8 +167,10 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			if err != nil {
 				return vm, err
 			}
-			if err = vm.canBranch(int(defaultTarget)); !vm.isPolymorphic() && err != nil {
-				return vm, err
+			if err = vm.canBranch(int(defaultTarget)); !vm.isPolymorphic() {
+				if err = vm.fail(err); err != nil {
+					return vm, err
+				}
 			}
 			vm.setPolymorphic()
 
@@ -166,7 +182,9 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 				// only single returns supported for now
 				top, under := vm.popOperand()
 				if !vm.isPolymorphic() && (under || top.Type != fn.ReturnTypes[0]) {
-					return vm, InvalidTypeError{fn.ReturnTypes[0], top.Type}
+					if err := vm.fail(InvalidTypeError{fn.ReturnTypes[0], top.Type}); err != nil {
+						return vm, err
+					}
 				}
 			}
 			vm.setPolymorphic()
@@ -210,7 +228,9 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			} else { // == set_local or tee_local
 				top, under := vm.popOperand()
 				if !vm.isPolymorphic() && (under || top.Type != v.Type) {
-					return vm, InvalidTypeError{v.Type, top.Type}
+					if err := vm.fail(InvalidTypeError{v.Type, top.Type}); err != nil {
+						return vm, err
+					}
 				}
 				if op == ops.TeeLocal {
 					vm.pushOperand(v.Type)
@@ -232,7 +252,9 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			} else {
 				val, under := vm.popOperand()
 				if !vm.isPolymorphic() && (under || val.Type != gv.Type.Type) {
-					return vm, InvalidTypeError{gv.Type.Type, val.Type}
+					if err := vm.fail(InvalidTypeError{gv.Type.Type, val.Type}); err != nil {
+						return vm, err
+					}
 				}
 			}
 
@@ -266,12 +288,8 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			}
 
 			logger.Printf("Function being called: %v", fn)
-			for index := range fn.Sig.ParamTypes {
-				argType := fn.Sig.ParamTypes[len(fn.Sig.ParamTypes)-index-1]
-				operand, under := vm.popOperand()
-				if !vm.isPolymorphic() && (under || operand.Type != argType) {
-					return vm, InvalidTypeError{argType, operand.Type}
-				}
+			if err := vm.fail(vm.popParams(fn.Sig.ParamTypes)); err != nil {
+				return vm, err
 			}
 
 			if len(fn.Sig.ReturnTypes) > 0 {
@@ -279,7 +297,8 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			}
 
 		case ops.CallIndirect:
-			if module.Table == nil || len(module.Table.Entries) == 0 {
+			// the table may be imported.
+			if _, ok := module.TableLimits(0); !ok {
 				return vm, NoSectionError(wasm.SectionIDTable)
 			}
 			// The call_indirect process consists of getting two i32 values
@@ -302,15 +321,13 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			fnExpectSig := module.Types.Entries[index]
 
 			if operand, under := vm.popOperand(); !vm.isPolymorphic() && (under || operand.Type != wasm.ValueTypeI32) {
-				return vm, InvalidTypeError{wasm.ValueTypeI32, operand.Type}
+				if err := vm.fail(InvalidTypeError{wasm.ValueTypeI32, operand.Type}); err != nil {
+					return vm, err
+				}
 			}
 
-			for index := range fnExpectSig.ParamTypes {
-				argType := fnExpectSig.ParamTypes[len(fnExpectSig.ParamTypes)-index-1]
-				operand, under := vm.popOperand()
-				if !vm.isPolymorphic() && (under || (operand.Type != argType)) {
-					return vm, InvalidTypeError{argType, operand.Type}
-				}
+			if err := vm.fail(vm.popParams(fnExpectSig.ParamTypes)); err != nil {
+				return vm, err
 			}
 
 			if len(fnExpectSig.ReturnTypes) > 0 {
@@ -319,7 +336,9 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 
 		case ops.Drop:
 			if _, under := vm.popOperand(); !vm.isPolymorphic() && under {
-				return vm, ErrStackUnderflow
+				if err := vm.fail(ErrStackUnderflow); err != nil {
+					return vm, err
+				}
 			}
 
 		case ops.Select:
@@ -329,20 +348,28 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			operands := make([]operand, 2)
 			c, under := vm.popOperand()
 			if under || c.Type != wasm.ValueTypeI32 {
-				return vm, InvalidTypeError{wasm.ValueTypeI32, c.Type}
+				if err := vm.fail(InvalidTypeError{wasm.ValueTypeI32, c.Type}); err != nil {
+					return vm, err
+				}
 			}
 
+			underflow := false
 			for i := 0; i < 2; i++ {
 				operand, under := vm.popOperand()
-				if !vm.isPolymorphic() && under {
-					return vm, ErrStackUnderflow
-				}
+				underflow = underflow || under
 				operands[i] = operand
 			}
 
-			// last 2 popped values should be of the same type
-			if operands[0].Type != operands[1].Type {
-				return vm, InvalidTypeError{operands[1].Type, operands[2].Type}
+			if underflow {
+				if err := vm.fail(ErrStackUnderflow); err != nil {
+					return vm, err
+				}
+			} else if operands[0].Type != operands[1].Type {
+				// last 2 popped values should be of the same type
+				vm.expected = []wasm.ValueType{wasm.ValueTypeI32, operands[1].Type, operands[1].Type}
+				if err := vm.fail(InvalidTypeError{operands[1].Type, operands[0].Type}); err != nil {
+					return vm, err
+				}
 			}
 
 			vm.pushOperand(operands[1].Type)
@@ -364,11 +391,64 @@ func VerifyModule(module *wasm.Module) error {
 
 	logger.Printf("There are %d functions", len(module.Function.Types))
 	for i, fn := range module.FunctionIndexSpace {
-		if vm, err := verifyBody(fn.Sig, fn.Body, module); err != nil {
-			return Error{vm.pc(), i, err}
+		if vm, err := verifyBody(fn.Sig, fn.Body, definingModule(module, i), false); err != nil {
+			e := vm.newError(err)
+			e.Function = i
+			e.Name = functionNames(module)[i]
+			return e
 		}
 		logger.Printf("No errors in function %d", i)
 	}
 
 	return nil
 }
+
+// VerifyModuleAll verifies the module like VerifyModule, and returns every
+// failure instead of the first one. Validation of a function goes on after
+// an operand type error; other errors end the validation of the function.
+// Errors not related to a function have a Function index of -1.
+func VerifyModuleAll(module *wasm.Module) []Error {
+	if module.Function == nil || module.Types == nil || len(module.Types.Entries) == 0 {
+		return nil
+	}
+	if module.Code == nil {
+		return []Error{{Function: -1, Err: NoSectionError(wasm.SectionIDCode)}}
+	}
+
+	var errs []Error
+	names := functionNames(module)
+	for i, fn := range module.FunctionIndexSpace {
+		vm, err := verifyBody(fn.Sig, fn.Body, definingModule(module, i), true)
+		if err != nil {
+			vm.errs = append(vm.errs, vm.newError(err))
+		}
+		for _, e := range vm.errs {
+			e.Function = i
+			e.Name = names[i]
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+// definingModule returns the module whose index spaces the body of the
+// function at index i of module refers to: the module exporting the table
+// the function was imported with, or module itself.
+func definingModule(module *wasm.Module, i int) *wasm.Module {
+	if def, _, ok := module.ImportedTableFunction(i); ok {
+		return def
+	}
+	return module
+}
+
+// functionNames returns the names of the functions of module, or an empty
+// string for functions without a name.
+func functionNames(module *wasm.Module) []string {
+	names := module.FunctionNames()
+	for i, name := range names {
+		if name == fmt.Sprintf("func[%d]", i) {
+			names[i] = ""
+		}
+	}
+	return names
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package validate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+var (
+	i32 = wasm.ValueTypeI32
+	i64 = wasm.ValueTypeI64
+	f32 = wasm.ValueTypeF32
+)
+
+func bodiesModule(sig wasm.FunctionSig, codes ...[]byte) *wasm.Module {
+	m := &wasm.Module{
+		Types:    &wasm.SectionTypes{Entries: []wasm.FunctionSig{sig}},
+		Function: &wasm.SectionFunctions{},
+		Code:     &wasm.SectionCode{},
+		Export:   &wasm.SectionExports{Entries: map[string]wasm.ExportEntry{}},
+	}
+	for i, code := range codes {
+		body := &wasm.FunctionBody{Code: code}
+		m.Function.Types = append(m.Function.Types, 0)
+		m.Code.Bodies = append(m.Code.Bodies, *body)
+		m.FunctionIndexSpace = append(m.FunctionIndexSpace, wasm.Function{Sig: &sig, Body: body})
+		if i == 1 {
+			m.Export.Entries["second"] = wasm.ExportEntry{FieldStr: "second", Kind: wasm.ExternalFunction, Index: 1}
+		}
+	}
+	return m
+}
+
+func TestVerifyModuleAll(t *testing.T) {
+	sig := wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{i32, f32}}
+	m := bodiesModule(sig,
+		// valid: get_local 0; drop
+		[]byte{0x20, 0x00, 0x1a},
+		// i64.const 1; get_local 0; i32.add; drop; get_local 1; i32.eqz; drop
+		[]byte{0x42, 0x01, 0x20, 0x00, 0x6a, 0x1a, 0x20, 0x01, 0x45, 0x1a},
+		// get_local 5
+		[]byte{0x20, 0x05},
+	)
+
+	errs := VerifyModuleAll(m)
+	want := []Error{
+		{Offset: 4, Function: 1, Name: "second", Op: "i32.add", Err: InvalidTypeError{i32, i64},
+			Expected: []wasm.ValueType{i32, i32}, Actual: []wasm.ValueType{i64, i32}},
+		{Offset: 8, Function: 1, Name: "second", Op: "i32.eqz", Err: InvalidTypeError{i32, f32},
+			Expected: []wasm.ValueType{i32}, Actual: []wasm.ValueType{f32}},
+		{Offset: 0, Function: 2, Op: "get_local", Err: InvalidLocalIndexError(5)},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Fatalf("got errors:\n%v\nwant:\n%v", errs, want)
+	}
+	if got, want := errs[0].Error(), "error while validating function 1 (second) at offset 4 (i32.add): invalid type, got: i64, wanted: i32: expected operands [i32 i32], got [i64 i32]"; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+
+	// VerifyModule reports the first failure.
+	err := VerifyModule(m)
+	if e, ok := err.(Error); !ok || e.Function != 1 || e.Offset != 4 || e.Op != "i32.add" {
+		t.Errorf("got error %v, want the first failure", err)
+	}
+
+	valid := bodiesModule(sig, []byte{0x20, 0x00, 0x1a})
+	if errs := VerifyModuleAll(valid); errs != nil {
+		t.Errorf("got errors %v for a valid module", errs)
+	}
+}
+
+func TestVerifyModuleAllUnderflow(t *testing.T) {
+	sig := wasm.FunctionSig{Form: 0, ReturnTypes: []wasm.ValueType{i32}}
+	// drop; i32.const 1; f32.const 0; select
+	m := bodiesModule(sig, []byte{0x1a, 0x41, 0x01, 0x43, 0, 0, 0, 0, 0x1b})
+	errs := VerifyModuleAll(m)
+	if len(errs) != 3 {
+		t.Fatalf("got errors %v, want 3", errs)
+	}
+	if errs[0].Err != ErrStackUnderflow || errs[0].Op != "drop" {
+		t.Errorf("got error %v, want a stack underflow in drop", errs[0])
+	}
+	for _, e := range errs[1:] {
+		if e.Op != "select" {
+			t.Errorf("got error %v, want an error in select", e)
+		}
+	}
+}
@@ -27,6 +27,13 @@ type mockVM struct {
 	blocks      []block // a stack of encountered blocks
 
 	curFunc *wasm.FunctionSig
+
+	all      bool             // whether type errors are recorded in errs instead of stopping validation
+	errs     []Error          // errors recorded when all is set
+	opPc     int              // offset of the current instruction
+	opName   string           // mnemonic of the current instruction
+	popped   []operand        // operands popped by the current instruction, topmost first
+	expected []wasm.ValueType // operand types expected by the failing instruction, topmost first
 }
 
 // a block reprsents an instruction sequence preceeded by a control flow operator
@@ -163,6 +170,7 @@ func (vm *mockVM) popOperand() (operand, bool) {
 	}
 	o = vm.stack[stackTop]
 	vm.stackTop--
+	vm.popped = append(vm.popped, o)
 
 	logger.Printf("Stack after pop is %v. Popped %v", vm.stack[:vm.stackTop], o)
 	return o, false
@@ -182,20 +190,101 @@ func (vm *mockVM) pushOperand(t wasm.ValueType) {
 }
 
 func (vm *mockVM) adjustStack(op ops.Op) error {
-	for _, t := range op.Args {
+	err := vm.popTypes(op.Args)
+
+	if op.Returns != wasm.ValueType(wasm.BlockTypeEmpty) {
+		vm.pushOperand(op.Returns)
+	}
+
+	return err
+}
+
+// popTypes pops operands of the types in types, topmost first, and returns
+// an InvalidTypeError for the first mismatch. All operands are popped even
+// after a mismatch, so that validation can go on.
+func (vm *mockVM) popTypes(types []wasm.ValueType) error {
+	var err error
+	for _, t := range types {
 		op, under := vm.popOperand()
-		if !vm.isPolymorphic() && (under || op.Type != t) {
-			return InvalidTypeError{t, op.Type}
+		if err == nil && !vm.isPolymorphic() && (under || op.Type != t) {
+			err = InvalidTypeError{t, op.Type}
+			vm.expected = types
 		}
 	}
+	return err
+}
 
-	if op.Returns != wasm.ValueType(wasm.BlockTypeEmpty) {
-		vm.pushOperand(op.Returns)
+// popParams pops the arguments of a function with the parameters params.
+func (vm *mockVM) popParams(params []wasm.ValueType) error {
+	types := make([]wasm.ValueType, len(params))
+	for i, t := range params {
+		types[len(params)-1-i] = t
 	}
+	return vm.popTypes(types)
+}
+
+// startOp resets the state kept for reporting errors in an instruction.
+func (vm *mockVM) startOp() {
+	vm.opPc = vm.pc()
+	vm.opName = ""
+	vm.popped = vm.popped[:0]
+	vm.expected = nil
+}
 
+// fail handles an error of the current instruction. Operand type errors
+// are recorded and nil is returned when validating with all set, so that
+// validation goes on; other errors are returned.
+func (vm *mockVM) fail(err error) error {
+	if err == nil {
+		return nil
+	}
+	if !vm.all {
+		return err
+	}
+	switch err.(type) {
+	case InvalidTypeError:
+	default:
+		if err != ErrStackUnderflow {
+			return err
+		}
+	}
+	vm.errs = append(vm.errs, vm.newError(err))
+	vm.expected = nil
 	return nil
 }
 
+// newError returns an Error for err in the current instruction, without
+// the index and name of the function.
+func (vm *mockVM) newError(err error) Error {
+	e := Error{Offset: vm.opPc, Err: err, Op: vm.opName}
+	expected := vm.expected
+	actual := make([]wasm.ValueType, len(vm.popped))
+	for i, o := range vm.popped {
+		actual[i] = o.Type
+	}
+	if te, ok := err.(InvalidTypeError); ok && expected == nil {
+		expected = []wasm.ValueType{te.Wanted}
+		if len(actual) == 0 && te.Got != 0 {
+			actual = []wasm.ValueType{te.Got}
+		}
+	}
+	if expected != nil {
+		e.Expected = reverseTypes(expected)
+		e.Actual = reverseTypes(actual)
+	}
+	return e
+}
+
+// reverseTypes returns the types of a topmost-first list of operands in
+// stack order.
+func reverseTypes(types []wasm.ValueType) []wasm.ValueType {
+	r := make([]wasm.ValueType, len(types))
+	for i, t := range types {
+		r[len(types)-1-i] = t
+	}
+	return r
+}
+
 // setPolymorphic sets the current block as having a polymorphic stack
 // blocks created under it will be polymorphic too. All type-checking
 // is ignored in a polymorhpic stack.
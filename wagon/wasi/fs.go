@@ -0,0 +1,348 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wasi
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrEscape is returned by the file systems of this package for a name
+	// leaving their root.
+	ErrEscape = errors.New("wasi: path escapes the file system root")
+	// ErrFileTooLarge is returned by the files of a MemFS for a write or a
+	// seek past the maximum file size.
+	ErrFileTooLarge = errors.New("wasi: file too large")
+)
+
+// DefaultMaxFileSize is the maximum size of the files of a MemFS created
+// by NewMemFS, in bytes.
+const DefaultMaxFileSize = 64 << 20
+
+// File is a file opened from an FS.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+// FS is a sandboxed file system. Names are slash-separated paths relative to
+// the root of the file system, cleaned with path.Clean; "." names the root.
+type FS interface {
+	// OpenFile opens the file name with the os.O_* flags flag, creating it
+	// with the permissions perm if needed.
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	// Stat returns information about the file or directory name.
+	Stat(name string) (os.FileInfo, error)
+}
+
+// cleanName returns the cleaned name of p relative to the root of a file
+// system, or ErrEscape if p is absolute or leaves the root.
+func cleanName(p string) (string, error) {
+	if strings.HasPrefix(p, "/") {
+		return "", ErrEscape
+	}
+	p = path.Clean(p)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", ErrEscape
+	}
+	return p, nil
+}
+
+// dirFS is an FS rooted at a directory of the host.
+type dirFS struct {
+	root string
+}
+
+// DirFS returns a file system holding the files under the host directory
+// root. Names, including symbolic links, cannot leave root.
+func DirFS(root string) (FS, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return nil, err
+	}
+	return dirFS{root: abs}, nil
+}
+
+// resolve returns the host path of name, checking that it stays under the
+// root once symbolic links are evaluated. The last element of name may not
+// exist.
+func (fs dirFS) resolve(name string) (string, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+	full := filepath.Join(fs.root, filepath.FromSlash(name))
+	real, err := filepath.EvalSymlinks(full)
+	if os.IsNotExist(err) {
+		dir, err := filepath.EvalSymlinks(filepath.Dir(full))
+		if err != nil {
+			return "", err
+		}
+		real = filepath.Join(dir, filepath.Base(full))
+	} else if err != nil {
+		return "", err
+	}
+	if real != fs.root && !strings.HasPrefix(real, fs.root+string(filepath.Separator)) {
+		return "", ErrEscape
+	}
+	return real, nil
+}
+
+func (fs dirFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	real, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(real, flag, perm)
+}
+
+func (fs dirFS) Stat(name string) (os.FileInfo, error) {
+	real, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(real)
+}
+
+// MemFS is an in-memory FS. Directories exist implicitly as the parents of
+// its files. A MemFS is safe for concurrent use.
+type MemFS struct {
+	// MaxFileSize bounds the size of the files written by the guest, so
+	// that a write after a seek far past the end of a file cannot make the
+	// host allocate the gap. It must be set before the MemFS is used.
+	MaxFileSize int64
+
+	mu    sync.Mutex
+	files map[string]*memData
+}
+
+type memData struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemFS creates a file system holding files, by name.
+func NewMemFS(files map[string][]byte) *MemFS {
+	fs := &MemFS{MaxFileSize: DefaultMaxFileSize, files: make(map[string]*memData)}
+	for name, data := range files {
+		name, err := cleanName(name)
+		if err != nil || name == "." {
+			continue
+		}
+		fs.files[name] = &memData{data: append([]byte(nil), data...)}
+	}
+	return fs
+}
+
+// ReadFile returns a copy of the content of the file name.
+func (fs *MemFS) ReadFile(name string) ([]byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := fs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return append([]byte(nil), f.data...), nil
+}
+
+// Names returns the names of the files of fs, sorted.
+func (fs *MemFS) Names() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	names := make([]string, 0, len(fs.files))
+	for name := range fs.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isDir reports whether name is the root or the parent of a file.
+func (fs *MemFS) isDir(name string) bool {
+	if name == "." {
+		return true
+	}
+	for f := range fs.files {
+		if strings.HasPrefix(f, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (fs *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	if fs.isDir(name) {
+		if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+		}
+		return &memFile{fs: fs, name: name, dir: true}, nil
+	}
+	f, ok := fs.files[name]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !ok:
+		if dir := path.Dir(name); !fs.isDir(dir) {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		f = &memData{modTime: time.Now()}
+		fs.files[name] = f
+	}
+	if flag&os.O_TRUNC != 0 {
+		f.data = nil
+	}
+	mf := &memFile{
+		fs:     fs,
+		name:   name,
+		f:      f,
+		read:   flag&(os.O_WRONLY|os.O_RDWR) != os.O_WRONLY,
+		write:  flag&(os.O_WRONLY|os.O_RDWR) != 0,
+		append: flag&os.O_APPEND != 0,
+	}
+	return mf, nil
+}
+
+func (fs *MemFS) Stat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := fs.files[name]; ok {
+		return memInfo{name: path.Base(name), size: int64(len(f.data)), modTime: f.modTime}, nil
+	}
+	if fs.isDir(name) {
+		return memInfo{name: path.Base(name), dir: true}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+// memFile is a file opened from a MemFS.
+type memFile struct {
+	fs     *MemFS
+	name   string
+	f      *memData
+	dir    bool
+	off    int64
+	read   bool
+	write  bool
+	append bool
+}
+
+var errBadMode = errors.New("wasi: bad file mode")
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if f.dir || !f.read {
+		return 0, errBadMode
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.off >= int64(len(f.f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.f.data[f.off:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.dir || !f.write {
+		return 0, errBadMode
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.append {
+		f.off = int64(len(f.f.data))
+	}
+	end := f.off + int64(len(p))
+	if end > f.fs.MaxFileSize {
+		return 0, ErrFileTooLarge
+	}
+	if end > int64(len(f.f.data)) {
+		f.f.data = append(f.f.data, make([]byte, end-int64(len(f.f.data)))...)
+	}
+	copy(f.f.data[f.off:], p)
+	f.off += int64(len(p))
+	f.f.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	if f.dir {
+		return 0, errBadMode
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.f.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("wasi: negative offset")
+	}
+	if offset > f.fs.MaxFileSize {
+		return 0, ErrFileTooLarge
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.fs.Stat(f.name)
+}
+
+// memInfo describes a file or directory of a MemFS.
+type memInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi memInfo) Name() string       { return fi.name }
+func (fi memInfo) Size() int64        { return fi.size }
+func (fi memInfo) ModTime() time.Time { return fi.modTime }
+func (fi memInfo) IsDir() bool        { return fi.dir }
+func (fi memInfo) Sys() interface{}   { return nil }
+
+func (fi memInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
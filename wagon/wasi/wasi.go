@@ -0,0 +1,728 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package wasi implements the wasi_snapshot_preview1 host module, for
+// running modules compiled for WASI, such as TinyGo and Rust wasm32-wasi
+// programs, in a sandbox.
+//
+// The module only reaches the host through its Config: the arguments and
+// environment, the standard streams and a file system preopened as "/".
+// In deterministic mode, the clocks and the random source do not depend
+// on the host either, so that runs are reproducible:
+//
+//	stdout := new(bytes.Buffer)
+//	w := wasi.New(wasi.Config{Args: []string{"prog"}, Stdout: stdout, Deterministic: true})
+//	reg := exec.NewHostRegistry()
+//	reg.Register(w.HostModule())
+//	m, err := wasm.ReadModule(r, reg.Resolver(nil))
+//	...
+//	code, err := w.Run(vm)
+package wasi
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/sea-project/sea-pkg/wagon/exec"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+// ModuleName is the name modules import the WASI functions from.
+const ModuleName = "wasi_snapshot_preview1"
+
+// Errno is a WASI error number, returned by the WASI functions.
+type Errno uint32
+
+// Error numbers returned by this implementation.
+const (
+	ErrnoSuccess    Errno = 0
+	ErrnoAcces      Errno = 2
+	ErrnoBadf       Errno = 8
+	ErrnoExist      Errno = 20
+	ErrnoFault      Errno = 21
+	ErrnoFbig       Errno = 22
+	ErrnoInval      Errno = 28
+	ErrnoIO         Errno = 29
+	ErrnoIsdir      Errno = 31
+	ErrnoNoent      Errno = 44
+	ErrnoNosys      Errno = 52
+	ErrnoNotdir     Errno = 54
+	ErrnoSpipe      Errno = 70
+	ErrnoNotcapable Errno = 76
+)
+
+// File types of fdstat and filestat.
+const (
+	fileTypeCharacterDevice = 2
+	fileTypeDirectory       = 3
+	fileTypeRegularFile     = 4
+)
+
+// Flags of path_open.
+const (
+	oflagCreat     = 1 << 0
+	oflagDirectory = 1 << 1
+	oflagExcl      = 1 << 2
+	oflagTrunc     = 1 << 3
+	fdflagAppend   = 1 << 0
+	rightFdRead    = 1 << 1
+	rightFdWrite   = 1 << 6
+)
+
+// deterministicEpoch is the realtime clock of deterministic mode at the
+// first reading, 2020-01-01 UTC.
+const deterministicEpoch = 1577836800 * int64(time.Second)
+
+// ExitError is the error trapping the VM when the module calls proc_exit.
+type ExitError struct {
+	Code uint32
+}
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("wasi: exit status %d", e.Code)
+}
+
+// Config is the environment of a WASI module.
+type Config struct {
+	Args []string // arguments, including the program name
+	Env  []string // environment variables, as "key=value"
+
+	Stdin  io.Reader // nil reads nothing
+	Stdout io.Writer // nil discards the output
+	Stderr io.Writer // nil discards the output
+
+	// FS is preopened as the directory "/". A nil FS gives the module no
+	// file access.
+	FS FS
+
+	// Deterministic replaces the clocks with counters advancing by a
+	// millisecond at each reading, and the random source with a generator
+	// seeded by Seed.
+	Deterministic bool
+	Seed          int64
+}
+
+// fileDesc is an open file descriptor.
+type fileDesc struct {
+	r       io.Reader
+	w       io.Writer
+	file    File   // for files opened by path_open
+	preopen string // name of a preopened directory
+	dir     string // name in the FS of a directory
+	isDir   bool
+}
+
+// WASI holds the state of the WASI functions of a module instance. It is
+// not safe for concurrent use.
+type WASI struct {
+	cfg    Config
+	fds    map[uint32]*fileDesc
+	nextFd uint32
+	start  time.Time
+	ticks  int64
+	rand   *rand.Rand
+}
+
+// New creates the WASI state of a module instance running in cfg.
+func New(cfg Config) *WASI {
+	w := &WASI{
+		cfg:    cfg,
+		fds:    make(map[uint32]*fileDesc),
+		nextFd: 3,
+		start:  time.Now(),
+	}
+	stdin, stdout, stderr := cfg.Stdin, cfg.Stdout, cfg.Stderr
+	if stdin == nil {
+		stdin = eofReader{}
+	}
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	w.fds[0] = &fileDesc{r: stdin}
+	w.fds[1] = &fileDesc{w: stdout}
+	w.fds[2] = &fileDesc{w: stderr}
+	if cfg.FS != nil {
+		w.fds[3] = &fileDesc{preopen: "/", dir: ".", isDir: true}
+		w.nextFd = 4
+	}
+	if cfg.Deterministic {
+		w.rand = rand.New(rand.NewSource(cfg.Seed))
+	}
+	return w
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
+
+// HostModule returns the wasi_snapshot_preview1 host module bound to w.
+// Functions this implementation does not support return ErrnoNosys.
+func (w *WASI) HostModule() *exec.HostModule {
+	m := exec.NewHostModule(ModuleName)
+	m.MustFunc("args_get", w.argsGet).
+		MustFunc("args_sizes_get", w.argsSizesGet).
+		MustFunc("environ_get", w.environGet).
+		MustFunc("environ_sizes_get", w.environSizesGet).
+		MustFunc("clock_res_get", w.clockResGet).
+		MustFunc("clock_time_get", w.clockTimeGet).
+		MustFunc("random_get", w.randomGet).
+		MustFunc("proc_exit", w.procExit).
+		MustFunc("sched_yield", func() Errno { return ErrnoSuccess }).
+		MustFunc("fd_write", w.fdWrite).
+		MustFunc("fd_read", w.fdRead).
+		MustFunc("fd_close", w.fdClose).
+		MustFunc("fd_seek", w.fdSeek).
+		MustFunc("fd_tell", w.fdTell).
+		MustFunc("fd_sync", w.fdSync).
+		MustFunc("fd_datasync", w.fdSync).
+		MustFunc("fd_fdstat_get", w.fdFdstatGet).
+		MustFunc("fd_fdstat_set_flags", w.fdFdstatSetFlags).
+		MustFunc("fd_filestat_get", w.fdFilestatGet).
+		MustFunc("fd_prestat_get", w.fdPrestatGet).
+		MustFunc("fd_prestat_dir_name", w.fdPrestatDirName).
+		MustFunc("path_open", w.pathOpen).
+		MustFunc("path_filestat_get", w.pathFilestatGet)
+
+	nosys := map[string]interface{}{
+		"fd_advise":               func(fd uint32, offset, n uint64, advice uint32) Errno { return ErrnoNosys },
+		"fd_allocate":             func(fd uint32, offset, n uint64) Errno { return ErrnoNosys },
+		"fd_fdstat_set_rights":    func(fd uint32, base, inheriting uint64) Errno { return ErrnoNosys },
+		"fd_filestat_set_size":    func(fd uint32, size uint64) Errno { return ErrnoNosys },
+		"fd_filestat_set_times":   func(fd uint32, atim, mtim uint64, flags uint32) Errno { return ErrnoNosys },
+		"fd_pread":                func(fd, iovs, iovsLen uint32, offset uint64, nreadPtr uint32) Errno { return ErrnoNosys },
+		"fd_pwrite":               func(fd, iovs, iovsLen uint32, offset uint64, nwrittenPtr uint32) Errno { return ErrnoNosys },
+		"fd_readdir":              func(fd, buf, bufLen uint32, cookie uint64, sizePtr uint32) Errno { return ErrnoNosys },
+		"fd_renumber":             func(fd, to uint32) Errno { return ErrnoNosys },
+		"path_create_directory":   func(fd, path, pathLen uint32) Errno { return ErrnoNosys },
+		"path_filestat_set_times": func(fd, flags, path, pathLen uint32, atim, mtim uint64, fstFlags uint32) Errno { return ErrnoNosys },
+		"path_link":               func(oldFd, oldFlags, oldPath, oldLen, newFd, newPath, newLen uint32) Errno { return ErrnoNosys },
+		"path_readlink":           func(fd, path, pathLen, buf, bufLen, usedPtr uint32) Errno { return ErrnoNosys },
+		"path_remove_directory":   func(fd, path, pathLen uint32) Errno { return ErrnoNosys },
+		"path_rename":             func(fd, oldPath, oldLen, newFd, newPath, newLen uint32) Errno { return ErrnoNosys },
+		"path_symlink":            func(oldPath, oldLen, fd, newPath, newLen uint32) Errno { return ErrnoNosys },
+		"path_unlink_file":        func(fd, path, pathLen uint32) Errno { return ErrnoNosys },
+		"poll_oneoff":             func(in, out, n, neventsPtr uint32) Errno { return ErrnoNosys },
+		"proc_raise":              func(sig uint32) Errno { return ErrnoNosys },
+		"sock_recv":               func(fd, iovs, iovsLen, flags, nreadPtr, flagsPtr uint32) Errno { return ErrnoNosys },
+		"sock_send":               func(fd, iovs, iovsLen, flags, nwrittenPtr uint32) Errno { return ErrnoNosys },
+		"sock_shutdown":           func(fd, how uint32) Errno { return ErrnoNosys },
+	}
+	for name, fn := range nosys {
+		m.MustFunc(name, fn)
+	}
+	return m
+}
+
+// Run calls the _start function exported by the module of vm, and returns
+// the status passed to proc_exit, or 0 if _start returns.
+func (w *WASI) Run(vm *exec.VM) (uint32, error) {
+	m := vm.Module()
+	if m.Export == nil {
+		return 0, errors.New("wasi: module has no _start export")
+	}
+	e, ok := m.Export.Entries["_start"]
+	if !ok || e.Kind != wasm.ExternalFunction {
+		return 0, errors.New("wasi: module has no _start export")
+	}
+	vm.RecoverPanic = true
+	_, err := vm.ExecCode(int64(e.Index))
+	if code, ok := ExitCode(err); ok {
+		return code, nil
+	}
+	return 0, err
+}
+
+// ExitCode returns the status passed to proc_exit if err was returned by a
+// VM stopped by proc_exit.
+func ExitCode(err error) (uint32, bool) {
+	var exit ExitError
+	if errors.As(err, &exit) {
+		return exit.Code, true
+	}
+	return 0, false
+}
+
+// slice returns the n bytes of mem at off, or false if they are out of
+// bounds.
+func slice(mem []byte, off, n uint32) ([]byte, bool) {
+	end := uint64(off) + uint64(n)
+	if end > uint64(len(mem)) {
+		return nil, false
+	}
+	return mem[off:end], true
+}
+
+func putUint32(mem []byte, off, v uint32) bool {
+	b, ok := slice(mem, off, 4)
+	if ok {
+		binary.LittleEndian.PutUint32(b, v)
+	}
+	return ok
+}
+
+func putUint64(mem []byte, off uint32, v uint64) bool {
+	b, ok := slice(mem, off, 8)
+	if ok {
+		binary.LittleEndian.PutUint64(b, v)
+	}
+	return ok
+}
+
+// putStrings writes the NUL-terminated strings strs to buf, and pointers to
+// them to ptrs.
+func putStrings(p *exec.Process, strs []string, ptrs, buf uint32) Errno {
+	mem := p.Memory()
+	for _, s := range strs {
+		if !putUint32(mem, ptrs, buf) {
+			return ErrnoFault
+		}
+		b, ok := slice(mem, buf, uint32(len(s))+1)
+		if !ok {
+			return ErrnoFault
+		}
+		copy(b, s)
+		b[len(s)] = 0
+		ptrs += 4
+		buf += uint32(len(s)) + 1
+	}
+	return ErrnoSuccess
+}
+
+// putSizes writes the number of strs and the size of their NUL-terminated
+// content.
+func putSizes(p *exec.Process, strs []string, countPtr, sizePtr uint32) Errno {
+	size := 0
+	for _, s := range strs {
+		size += len(s) + 1
+	}
+	mem := p.Memory()
+	if !putUint32(mem, countPtr, uint32(len(strs))) || !putUint32(mem, sizePtr, uint32(size)) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) argsGet(p *exec.Process, argv, buf uint32) Errno {
+	return putStrings(p, w.cfg.Args, argv, buf)
+}
+
+func (w *WASI) argsSizesGet(p *exec.Process, countPtr, sizePtr uint32) Errno {
+	return putSizes(p, w.cfg.Args, countPtr, sizePtr)
+}
+
+func (w *WASI) environGet(p *exec.Process, environ, buf uint32) Errno {
+	return putStrings(p, w.cfg.Env, environ, buf)
+}
+
+func (w *WASI) environSizesGet(p *exec.Process, countPtr, sizePtr uint32) Errno {
+	return putSizes(p, w.cfg.Env, countPtr, sizePtr)
+}
+
+func (w *WASI) clockResGet(p *exec.Process, id, resPtr uint32) Errno {
+	if id > 3 {
+		return ErrnoInval
+	}
+	res := uint64(1)
+	if w.cfg.Deterministic {
+		res = uint64(time.Millisecond)
+	}
+	if !putUint64(p.Memory(), resPtr, res) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) clockTimeGet(p *exec.Process, id uint32, precision uint64, timePtr uint32) Errno {
+	var t int64
+	switch {
+	case id > 3:
+		return ErrnoInval
+	case w.cfg.Deterministic:
+		t = w.ticks * int64(time.Millisecond)
+		w.ticks++
+		if id == 0 {
+			t += deterministicEpoch
+		}
+	case id == 0:
+		t = time.Now().UnixNano()
+	default:
+		t = int64(time.Since(w.start))
+	}
+	if !putUint64(p.Memory(), timePtr, uint64(t)) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) randomGet(p *exec.Process, buf, n uint32) Errno {
+	b, ok := slice(p.Memory(), buf, n)
+	if !ok {
+		return ErrnoFault
+	}
+	if w.rand != nil {
+		w.rand.Read(b)
+		return ErrnoSuccess
+	}
+	if _, err := crand.Read(b); err != nil {
+		return ErrnoIO
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) procExit(code uint32) error {
+	return ExitError{code}
+}
+
+// iovecs returns the buffers of the iovs array of n entries. The array
+// is bounds-checked before anything is allocated for it, so that n, which
+// the guest controls, cannot make the host allocate more than the memory
+// holds.
+func iovecs(mem []byte, iovs, n uint32) ([][]byte, bool) {
+	if uint64(iovs)+8*uint64(n) > uint64(len(mem)) {
+		return nil, false
+	}
+	table := mem[iovs : uint64(iovs)+8*uint64(n)]
+	var bufs [][]byte
+	for ; len(table) > 0; table = table[8:] {
+		buf, ok := slice(mem, binary.LittleEndian.Uint32(table), binary.LittleEndian.Uint32(table[4:]))
+		if !ok {
+			return nil, false
+		}
+		bufs = append(bufs, buf)
+	}
+	return bufs, true
+}
+
+func (w *WASI) fdWrite(p *exec.Process, fd, iovs, iovsLen, nwrittenPtr uint32) Errno {
+	f, ok := w.fds[fd]
+	if !ok {
+		return ErrnoBadf
+	}
+	if f.w == nil {
+		return ErrnoBadf
+	}
+	mem := p.Memory()
+	bufs, ok := iovecs(mem, iovs, iovsLen)
+	if !ok {
+		return ErrnoFault
+	}
+	written := 0
+	for _, buf := range bufs {
+		n, err := f.w.Write(buf)
+		written += n
+		if err != nil {
+			return errno(err)
+		}
+	}
+	if !putUint32(mem, nwrittenPtr, uint32(written)) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdRead(p *exec.Process, fd, iovs, iovsLen, nreadPtr uint32) Errno {
+	f, ok := w.fds[fd]
+	if !ok {
+		return ErrnoBadf
+	}
+	if f.r == nil {
+		return ErrnoBadf
+	}
+	mem := p.Memory()
+	bufs, ok := iovecs(mem, iovs, iovsLen)
+	if !ok {
+		return ErrnoFault
+	}
+	// like readv, return the bytes available: a pipe or a terminal must not
+	// block until every buffer is full.
+	read := 0
+	for _, buf := range bufs {
+		if len(buf) == 0 {
+			continue
+		}
+		n, err := f.r.Read(buf)
+		read += n
+		if err != nil && err != io.EOF && read == 0 {
+			return ErrnoIO
+		}
+		if err != nil || n < len(buf) {
+			break
+		}
+	}
+	if !putUint32(mem, nreadPtr, uint32(read)) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdClose(fd uint32) Errno {
+	f, ok := w.fds[fd]
+	if !ok {
+		return ErrnoBadf
+	}
+	if f.preopen != "" {
+		return ErrnoNotcapable
+	}
+	delete(w.fds, fd)
+	if f.file != nil && f.file.Close() != nil {
+		return ErrnoIO
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdSeek(p *exec.Process, fd uint32, offset int64, whence, newOffsetPtr uint32) Errno {
+	f, ok := w.fds[fd]
+	if !ok {
+		return ErrnoBadf
+	}
+	if f.file == nil || f.isDir {
+		return ErrnoSpipe
+	}
+	if whence > 2 {
+		return ErrnoInval
+	}
+	off, err := f.file.Seek(offset, int(whence))
+	if err != nil {
+		return ErrnoInval
+	}
+	if !putUint64(p.Memory(), newOffsetPtr, uint64(off)) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdTell(p *exec.Process, fd, offsetPtr uint32) Errno {
+	return w.fdSeek(p, fd, 0, io.SeekCurrent, offsetPtr)
+}
+
+func (w *WASI) fdSync(fd uint32) Errno {
+	if _, ok := w.fds[fd]; !ok {
+		return ErrnoBadf
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdFdstatGet(p *exec.Process, fd, statPtr uint32) Errno {
+	f, ok := w.fds[fd]
+	if !ok {
+		return ErrnoBadf
+	}
+	b, ok := slice(p.Memory(), statPtr, 24)
+	if !ok {
+		return ErrnoFault
+	}
+	for i := range b {
+		b[i] = 0
+	}
+	switch {
+	case f.isDir:
+		b[0] = fileTypeDirectory
+	case f.file != nil:
+		b[0] = fileTypeRegularFile
+	default:
+		b[0] = fileTypeCharacterDevice
+	}
+	binary.LittleEndian.PutUint64(b[8:], ^uint64(0))
+	binary.LittleEndian.PutUint64(b[16:], ^uint64(0))
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdFdstatSetFlags(fd, flags uint32) Errno {
+	if _, ok := w.fds[fd]; !ok {
+		return ErrnoBadf
+	}
+	return ErrnoNosys
+}
+
+// putFilestat writes the filestat of fi to buf.
+func (w *WASI) putFilestat(mem []byte, buf uint32, fi os.FileInfo, fileType byte) Errno {
+	b, ok := slice(mem, buf, 64)
+	if !ok {
+		return ErrnoFault
+	}
+	for i := range b {
+		b[i] = 0
+	}
+	b[16] = fileType
+	binary.LittleEndian.PutUint64(b[24:], 1)
+	if fi != nil {
+		if fi.IsDir() {
+			b[16] = fileTypeDirectory
+		} else {
+			b[16] = fileTypeRegularFile
+			binary.LittleEndian.PutUint64(b[32:], uint64(fi.Size()))
+		}
+		if !w.cfg.Deterministic && !fi.ModTime().IsZero() {
+			t := uint64(fi.ModTime().UnixNano())
+			binary.LittleEndian.PutUint64(b[40:], t)
+			binary.LittleEndian.PutUint64(b[48:], t)
+			binary.LittleEndian.PutUint64(b[56:], t)
+		}
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdFilestatGet(p *exec.Process, fd, buf uint32) Errno {
+	f, ok := w.fds[fd]
+	if !ok {
+		return ErrnoBadf
+	}
+	var fi os.FileInfo
+	var err error
+	switch {
+	case f.file != nil:
+		fi, err = f.file.Stat()
+	case f.isDir:
+		fi, err = w.cfg.FS.Stat(f.dir)
+	default:
+		return w.putFilestat(p.Memory(), buf, nil, fileTypeCharacterDevice)
+	}
+	if err != nil {
+		return ErrnoIO
+	}
+	return w.putFilestat(p.Memory(), buf, fi, 0)
+}
+
+func (w *WASI) fdPrestatGet(p *exec.Process, fd, buf uint32) Errno {
+	f, ok := w.fds[fd]
+	if !ok || f.preopen == "" {
+		return ErrnoBadf
+	}
+	mem := p.Memory()
+	if !putUint32(mem, buf, 0) || !putUint32(mem, buf+4, uint32(len(f.preopen))) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdPrestatDirName(p *exec.Process, fd, path, pathLen uint32) Errno {
+	f, ok := w.fds[fd]
+	if !ok || f.preopen == "" {
+		return ErrnoBadf
+	}
+	b, ok := slice(p.Memory(), path, pathLen)
+	if !ok {
+		return ErrnoFault
+	}
+	if int(pathLen) < len(f.preopen) {
+		return ErrnoInval
+	}
+	copy(b, f.preopen)
+	return ErrnoSuccess
+}
+
+// lookup returns the name in the FS of path relative to the directory fd.
+func (w *WASI) lookup(fd uint32, path string) (string, Errno) {
+	f, ok := w.fds[fd]
+	if !ok {
+		return "", ErrnoBadf
+	}
+	if !f.isDir {
+		return "", ErrnoNotdir
+	}
+	name, err := cleanName(f.dir + "/" + path)
+	if err != nil {
+		return "", ErrnoNotcapable
+	}
+	return name, ErrnoSuccess
+}
+
+// errno maps an error of an FS to an error number.
+func errno(err error) Errno {
+	switch {
+	case err == ErrEscape:
+		return ErrnoNotcapable
+	case err == ErrFileTooLarge:
+		return ErrnoFbig
+	case os.IsNotExist(err):
+		return ErrnoNoent
+	case os.IsExist(err):
+		return ErrnoExist
+	case os.IsPermission(err):
+		return ErrnoAcces
+	}
+	return ErrnoIO
+}
+
+func (w *WASI) pathOpen(p *exec.Process, dirFd, dirFlags uint32, path string, oflags uint32, rightsBase, rightsInheriting uint64, fdflags, fdPtr uint32) Errno {
+	name, errNo := w.lookup(dirFd, path)
+	if errNo != ErrnoSuccess {
+		return errNo
+	}
+	fi, err := w.cfg.FS.Stat(name)
+	switch {
+	case err == nil && fi.IsDir():
+		if oflags&(oflagCreat|oflagTrunc) != 0 {
+			return ErrnoIsdir
+		}
+		return w.newFd(p, &fileDesc{dir: name, isDir: true}, fdPtr)
+	case oflags&oflagDirectory != 0:
+		if err != nil {
+			return errno(err)
+		}
+		return ErrnoNotdir
+	}
+
+	var flag int
+	switch read, write := rightsBase&rightFdRead != 0, rightsBase&rightFdWrite != 0; {
+	case read && write:
+		flag = os.O_RDWR
+	case write:
+		flag = os.O_WRONLY
+	default:
+		flag = os.O_RDONLY
+	}
+	if oflags&oflagCreat != 0 {
+		flag |= os.O_CREATE
+	}
+	if oflags&oflagExcl != 0 {
+		flag |= os.O_EXCL
+	}
+	if oflags&oflagTrunc != 0 {
+		flag |= os.O_TRUNC
+	}
+	if fdflags&fdflagAppend != 0 {
+		flag |= os.O_APPEND
+	}
+	file, err := w.cfg.FS.OpenFile(name, flag, 0644)
+	if err != nil {
+		return errno(err)
+	}
+	return w.newFd(p, &fileDesc{r: file, w: file, file: file}, fdPtr)
+}
+
+// newFd adds f to the open file descriptors and writes its number to fdPtr.
+func (w *WASI) newFd(p *exec.Process, f *fileDesc, fdPtr uint32) Errno {
+	if !putUint32(p.Memory(), fdPtr, w.nextFd) {
+		if f.file != nil {
+			f.file.Close()
+		}
+		return ErrnoFault
+	}
+	w.fds[w.nextFd] = f
+	w.nextFd++
+	return ErrnoSuccess
+}
+
+func (w *WASI) pathFilestatGet(p *exec.Process, fd, flags uint32, path string, buf uint32) Errno {
+	name, errNo := w.lookup(fd, path)
+	if errNo != ErrnoSuccess {
+		return errNo
+	}
+	fi, err := w.cfg.FS.Stat(name)
+	if err != nil {
+		return errno(err)
+	}
+	return w.putFilestat(p.Memory(), buf, fi, 0)
+}
@@ -0,0 +1,284 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wasi_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/exec"
+	"github.com/sea-project/sea-pkg/wagon/wasi"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/builder"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+var (
+	i32 = wasm.ValueTypeI32
+	i64 = wasm.ValueTypeI64
+
+	sigs = map[string]wasm.FunctionSig{
+		"fd_write":       {Form: 0, ParamTypes: []wasm.ValueType{i32, i32, i32, i32}, ReturnTypes: []wasm.ValueType{i32}},
+		"fd_read":        {Form: 0, ParamTypes: []wasm.ValueType{i32, i32, i32, i32}, ReturnTypes: []wasm.ValueType{i32}},
+		"fd_seek":        {Form: 0, ParamTypes: []wasm.ValueType{i32, i64, i32, i32}, ReturnTypes: []wasm.ValueType{i32}},
+		"args_sizes_get": {Form: 0, ParamTypes: []wasm.ValueType{i32, i32}, ReturnTypes: []wasm.ValueType{i32}},
+		"random_get":     {Form: 0, ParamTypes: []wasm.ValueType{i32, i32}, ReturnTypes: []wasm.ValueType{i32}},
+		"clock_time_get": {Form: 0, ParamTypes: []wasm.ValueType{i32, i64, i32}, ReturnTypes: []wasm.ValueType{i32}},
+		"path_open": {Form: 0, ParamTypes: []wasm.ValueType{i32, i32, i32, i32, i32, i64, i64, i32, i32},
+			ReturnTypes: []wasm.ValueType{i32}},
+		"proc_exit": {Form: 0, ParamTypes: []wasm.ValueType{i32}},
+	}
+	importOrder = []string{"fd_write", "fd_read", "fd_seek", "args_sizes_get", "random_get", "clock_time_get", "path_open", "proc_exit"}
+)
+
+func i32c(v int32) disasm.Instr { return builder.Instr(ops.I32Const, v) }
+
+// call calls the WASI function name with the arguments args, storing the
+// errno it returns at errnoPtr.
+func call(b *builder.Builder, errnoPtr int32, name string, args ...disasm.Instr) []disasm.Instr {
+	body := append([]disasm.Instr{i32c(errnoPtr)}, args...)
+	return append(body,
+		builder.Instr(ops.Call, b.Function(wasi.ModuleName+"."+name)),
+		builder.Instr(ops.I32Store, uint32(2), uint32(0)),
+	)
+}
+
+// open opens the file of pathLen bytes at path for writing, creating it,
+// and stores its descriptor at 40.
+func open(b *builder.Builder, errnoPtr, path, pathLen int32) []disasm.Instr {
+	return call(b, errnoPtr, "path_open", i32c(3), i32c(0), i32c(path), i32c(pathLen), i32c(1|8),
+		builder.Instr(ops.I64Const, int64(1<<6)), builder.Instr(ops.I64Const, int64(0)), i32c(0), i32c(40))
+}
+
+// fd returns the descriptor stored at 40 by open.
+func fd() disasm.Instr { return builder.Instr(ops.I32Load, uint32(2), uint32(40)) }
+
+// newVM returns a VM running a module whose _start function runs body,
+// with an iovec at 0 pointing to "hello\n" at 100, "out.txt" at 300 and
+// "../out.txt" at 400.
+func newVM(t *testing.T, w *wasi.WASI, body func(b *builder.Builder) []disasm.Instr) *exec.VM {
+	reg := exec.NewHostRegistry()
+	if err := reg.Register(w.HostModule()); err != nil {
+		t.Fatal(err)
+	}
+	b := builder.New()
+	for _, name := range importOrder {
+		b.AddImport(wasi.ModuleName, name, sigs[name])
+	}
+	b.AddMemory(wasm.ResizableLimits{Initial: 1}).
+		AddData(0, []byte{100, 0, 0, 0, 6, 0, 0, 0}).
+		AddData(100, []byte("hello\n")).
+		AddData(300, []byte("out.txt")).
+		AddData(400, []byte("../out.txt"))
+	b.AddFunction("_start", wasm.FunctionSig{Form: 0}, nil, body(b))
+	b.Export("_start", wasm.ExternalFunction, b.Function("_start")).
+		Export("memory", wasm.ExternalMemory, 0).
+		Resolver(reg.Resolver(nil))
+	m, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, err := exec.NewVM(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vm
+}
+
+func TestRun(t *testing.T) {
+	run := func(seed int64) ([]byte, string) {
+		stdout := new(bytes.Buffer)
+		w := wasi.New(wasi.Config{
+			Args:          []string{"prog", "a", "bc"},
+			Stdout:        stdout,
+			Deterministic: true,
+			Seed:          seed,
+		})
+		vm := newVM(t, w, func(b *builder.Builder) []disasm.Instr {
+			var body []disasm.Instr
+			body = append(body, call(b, 500, "fd_write", i32c(1), i32c(0), i32c(1), i32c(16))...)
+			body = append(body, call(b, 504, "args_sizes_get", i32c(20), i32c(24))...)
+			body = append(body, call(b, 508, "random_get", i32c(200), i32c(8))...)
+			body = append(body, call(b, 512, "clock_time_get", i32c(0), builder.Instr(ops.I64Const, int64(0)), i32c(32))...)
+			body = append(body, call(b, 516, "fd_write", i32c(1), i32c(70000), i32c(1), i32c(16))...)
+			body = append(body, call(b, 520, "fd_write", i32c(9), i32c(0), i32c(1), i32c(16))...)
+			return append(body, i32c(3), builder.Instr(ops.Call, b.Function(wasi.ModuleName+".proc_exit")))
+		})
+		code, err := w.Run(vm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != 3 {
+			t.Errorf("got exit status %d, want 3", code)
+		}
+		return vm.Memory(), stdout.String()
+	}
+
+	mem, stdout := run(1)
+	if stdout != "hello\n" {
+		t.Errorf("got output %q", stdout)
+	}
+	u32 := func(off int) uint32 { return binary.LittleEndian.Uint32(mem[off:]) }
+	for i, want := range []wasi.Errno{wasi.ErrnoSuccess, 0, 0, 0, wasi.ErrnoFault, wasi.ErrnoBadf} {
+		if got := wasi.Errno(u32(500 + 4*i)); got != want {
+			t.Errorf("call %d: got errno %d, want %d", i, got, want)
+		}
+	}
+	if u32(16) != 6 {
+		t.Errorf("got %d bytes written, want 6", u32(16))
+	}
+	if u32(20) != 3 || u32(24) != 10 {
+		t.Errorf("got %d arguments of %d bytes, want 3 and 10", u32(20), u32(24))
+	}
+	if got, want := binary.LittleEndian.Uint64(mem[32:]), uint64(1577836800e9); got != want {
+		t.Errorf("got time %d, want %d", got, want)
+	}
+
+	same, _ := run(1)
+	other, _ := run(2)
+	if !bytes.Equal(mem[200:208], same[200:208]) || bytes.Equal(mem[200:208], other[200:208]) {
+		t.Errorf("random bytes do not depend on the seed only: %x %x %x", mem[200:208], same[200:208], other[200:208])
+	}
+}
+
+func TestPathOpen(t *testing.T) {
+	fs := wasi.NewMemFS(map[string][]byte{"out.txt": []byte("previous content")})
+	w := wasi.New(wasi.Config{FS: fs})
+	vm := newVM(t, w, func(b *builder.Builder) []disasm.Instr {
+		var body []disasm.Instr
+		body = append(body, open(b, 500, 300, 7)...)
+		body = append(body, call(b, 504, "fd_write",
+			i32c(0), fd(), i32c(0), i32c(1), i32c(16))...)
+		body = append(body, open(b, 508, 400, 10)...)
+		return body
+	})
+	if _, err := w.Run(vm); err != nil {
+		t.Fatal(err)
+	}
+	mem := vm.Memory()
+	for i, want := range []wasi.Errno{wasi.ErrnoSuccess, wasi.ErrnoSuccess, wasi.ErrnoNotcapable} {
+		if got := wasi.Errno(binary.LittleEndian.Uint32(mem[500+4*i:])); got != want {
+			t.Errorf("call %d: got errno %d, want %d", i, got, want)
+		}
+	}
+	data, err := fs.ReadFile("out.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello\n" {
+		t.Errorf("got file content %q", data)
+	}
+}
+
+func TestMemFSMaxFileSize(t *testing.T) {
+	fs := wasi.NewMemFS(nil)
+	fs.MaxFileSize = 8
+	w := wasi.New(wasi.Config{FS: fs})
+	seek := func(b *builder.Builder, errnoPtr int32, off int64) []disasm.Instr {
+		return call(b, errnoPtr, "fd_seek", i32c(0), fd(), builder.Instr(ops.I64Const, off), i32c(0), i32c(48))
+	}
+	vm := newVM(t, w, func(b *builder.Builder) []disasm.Instr {
+		var body []disasm.Instr
+		body = append(body, open(b, 500, 300, 7)...)
+		// a seek past the maximum size fails, and so does a write ending past it.
+		body = append(body, seek(b, 504, 1<<40)...)
+		body = append(body, seek(b, 508, 4)...)
+		body = append(body, call(b, 512, "fd_write", i32c(0), fd(), i32c(0), i32c(1), i32c(16))...)
+		body = append(body, seek(b, 516, 2)...)
+		body = append(body, call(b, 520, "fd_write", i32c(0), fd(), i32c(0), i32c(1), i32c(16))...)
+		return body
+	})
+	if _, err := w.Run(vm); err != nil {
+		t.Fatal(err)
+	}
+	mem := vm.Memory()
+	for i, want := range []wasi.Errno{wasi.ErrnoSuccess, wasi.ErrnoInval, wasi.ErrnoSuccess, wasi.ErrnoFbig, wasi.ErrnoSuccess, wasi.ErrnoSuccess} {
+		if got := wasi.Errno(binary.LittleEndian.Uint32(mem[500+4*i:])); got != want {
+			t.Errorf("call %d: got errno %d, want %d", i, got, want)
+		}
+	}
+	data, err := fs.ReadFile("out.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x00\x00hello\n"; string(data) != want {
+		t.Errorf("got file content %q, want %q", data, want)
+	}
+}
+
+// chunkReader returns at most one chunk per Read, like a pipe or a terminal
+// returning the bytes written so far.
+type chunkReader struct {
+	chunks []string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	if r.chunks[0] = r.chunks[0][n:]; r.chunks[0] == "" {
+		r.chunks = r.chunks[1:]
+	}
+	return n, nil
+}
+
+func TestFdRead(t *testing.T) {
+	w := wasi.New(wasi.Config{Stdin: &chunkReader{chunks: []string{"ab", "cdefgh"}}})
+	vm := newVM(t, w, func(b *builder.Builder) []disasm.Instr {
+		// two iovecs of 4 bytes, at 700 and 800.
+		body := []disasm.Instr{
+			i32c(600), i32c(700), builder.Instr(ops.I32Store, uint32(2), uint32(0)),
+			i32c(604), i32c(4), builder.Instr(ops.I32Store, uint32(2), uint32(0)),
+			i32c(608), i32c(800), builder.Instr(ops.I32Store, uint32(2), uint32(0)),
+			i32c(612), i32c(4), builder.Instr(ops.I32Store, uint32(2), uint32(0)),
+		}
+		for i := int32(0); i < 3; i++ {
+			body = append(body, call(b, 500+4*i, "fd_read", i32c(0), i32c(600), i32c(2), i32c(620+4*i))...)
+		}
+		return body
+	})
+	if _, err := w.Run(vm); err != nil {
+		t.Fatal(err)
+	}
+	mem := vm.Memory()
+	u32 := func(off int) uint32 { return binary.LittleEndian.Uint32(mem[off:]) }
+	for i := 0; i < 3; i++ {
+		if got := wasi.Errno(u32(500 + 4*i)); got != wasi.ErrnoSuccess {
+			t.Errorf("call %d: got errno %d", i, got)
+		}
+	}
+	// each call returns what a single read of each buffer provides, and
+	// stops at the first short read.
+	for i, want := range []uint32{2, 6, 0} {
+		if got := u32(620 + 4*i); got != want {
+			t.Errorf("call %d: got %d bytes read, want %d", i, got, want)
+		}
+	}
+	if got := string(mem[700:704]) + string(mem[800:802]); got != "cdefgh" {
+		t.Errorf("got %q in the buffers, want %q", got, "cdefgh")
+	}
+}
+
+func TestIovecsOutOfBounds(t *testing.T) {
+	w := wasi.New(wasi.Config{Stdin: &chunkReader{chunks: []string{"ab"}}, Stdout: new(bytes.Buffer)})
+	vm := newVM(t, w, func(b *builder.Builder) []disasm.Instr {
+		// iovs_len of 2^32-1 entries, far more than the memory holds.
+		body := call(b, 500, "fd_write", i32c(1), i32c(0), i32c(-1), i32c(16))
+		return append(body, call(b, 504, "fd_read", i32c(0), i32c(0), i32c(-1), i32c(16))...)
+	})
+	if _, err := w.Run(vm); err != nil {
+		t.Fatal(err)
+	}
+	mem := vm.Memory()
+	for i := 0; i < 2; i++ {
+		if got := wasi.Errno(binary.LittleEndian.Uint32(mem[500+4*i:])); got != wasi.ErrnoFault {
+			t.Errorf("call %d: got errno %d, want %d", i, got, wasi.ErrnoFault)
+		}
+	}
+}
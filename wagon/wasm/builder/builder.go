@@ -0,0 +1,325 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package builder provides a fluent API for building WebAssembly modules.
+//
+// A Builder assigns the indices of types, functions, globals and memories
+// as they are added, and Build encodes the module, reads it back with its
+// index spaces populated and verifies it:
+//
+//	b := builder.New()
+//	b.AddFunction("answer", sig, nil, []disasm.Instr{builder.Instr(ops.I32Const, int32(42))}).
+//		Export("answer", wasm.ExternalFunction, b.Function("answer"))
+//	m, err := b.Build()
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/validate"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/leb128"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+// ErrNoResolver is returned by Build when the module imports functions and
+// no ResolveFunc was set with Resolver.
+var ErrNoResolver = errors.New("builder: imports require a resolver")
+
+type function struct {
+	name   string
+	typ    uint32
+	locals []wasm.LocalEntry
+	body   []disasm.Instr
+}
+
+// Builder builds a wasm.Module. The methods adding to the module return the
+// Builder for chaining; the first error is reported by Build.
+type Builder struct {
+	types   []wasm.FunctionSig
+	imports []wasm.ImportEntry
+	funcs   []function
+	globals []wasm.GlobalEntry
+	mems    []wasm.Memory
+	data    []wasm.DataSegment
+	exports map[string]wasm.ExportEntry
+
+	funcNames   map[string]uint32
+	globalNames map[string]uint32
+	resolve     wasm.ResolveFunc
+	err         error
+}
+
+// New creates an empty Builder.
+func New() *Builder {
+	return &Builder{
+		exports:     make(map[string]wasm.ExportEntry),
+		funcNames:   make(map[string]uint32),
+		globalNames: make(map[string]uint32),
+	}
+}
+
+func (b *Builder) fail(format string, args ...interface{}) *Builder {
+	if b.err == nil {
+		b.err = fmt.Errorf("builder: "+format, args...)
+	}
+	return b
+}
+
+// AddType adds sig to the type section, if no identical signature was
+// added before.
+func (b *Builder) AddType(sig wasm.FunctionSig) *Builder {
+	b.Type(sig)
+	return b
+}
+
+// Type returns the index of sig in the type section, adding it if needed.
+func (b *Builder) Type(sig wasm.FunctionSig) uint32 {
+	for i, t := range b.types {
+		if t.Form == sig.Form && t.Equal(sig) {
+			return uint32(i)
+		}
+	}
+	b.types = append(b.types, sig)
+	return uint32(len(b.types) - 1)
+}
+
+// AddImport imports the function field of module with the signature sig.
+// Imported functions come first in the function index space, so imports
+// must be added before the functions of the module. The import is named
+// "module.field" for Function.
+func (b *Builder) AddImport(module, field string, sig wasm.FunctionSig) *Builder {
+	if len(b.funcs) > 0 {
+		return b.fail("import %s.%s added after the functions of the module", module, field)
+	}
+	name := module + "." + field
+	if _, ok := b.funcNames[name]; ok {
+		return b.fail("duplicate function %q", name)
+	}
+	b.funcNames[name] = uint32(len(b.imports))
+	b.imports = append(b.imports, wasm.ImportEntry{
+		ModuleName: module,
+		FieldName:  field,
+		Type:       wasm.FuncImport{Type: b.Type(sig)},
+	})
+	return b
+}
+
+// AddFunction adds a function with the signature sig, the local variables
+// locals following its parameters, and the instructions body, without the
+// final end. A non-empty name is written to the name section.
+func (b *Builder) AddFunction(name string, sig wasm.FunctionSig, locals []wasm.ValueType, body []disasm.Instr) *Builder {
+	if name != "" {
+		if _, ok := b.funcNames[name]; ok {
+			return b.fail("duplicate function %q", name)
+		}
+		b.funcNames[name] = uint32(len(b.imports) + len(b.funcs))
+	}
+	var entries []wasm.LocalEntry
+	for _, t := range locals {
+		if n := len(entries); n > 0 && entries[n-1].Type == t {
+			entries[n-1].Count++
+			continue
+		}
+		entries = append(entries, wasm.LocalEntry{Count: 1, Type: t})
+	}
+	b.funcs = append(b.funcs, function{name: name, typ: b.Type(sig), locals: entries, body: body})
+	return b
+}
+
+// Function returns the index in the function index space of the function
+// or import named name.
+func (b *Builder) Function(name string) uint32 {
+	i, ok := b.funcNames[name]
+	if !ok {
+		b.fail("unknown function %q", name)
+	}
+	return i
+}
+
+// AddGlobal adds a global variable initialized to init, which must be an
+// int32, int64, float32 or float64 and sets the type of the variable.
+func (b *Builder) AddGlobal(name string, mutable bool, init interface{}) *Builder {
+	var (
+		typ  wasm.ValueType
+		expr = new(bytes.Buffer)
+	)
+	switch v := init.(type) {
+	case int32:
+		typ = wasm.ValueTypeI32
+		expr.WriteByte(ops.I32Const)
+		leb128.WriteVarint64(expr, int64(v))
+	case int64:
+		typ = wasm.ValueTypeI64
+		expr.WriteByte(ops.I64Const)
+		leb128.WriteVarint64(expr, v)
+	case float32:
+		typ = wasm.ValueTypeF32
+		expr.WriteByte(ops.F32Const)
+		bits := math.Float32bits(v)
+		expr.Write([]byte{byte(bits), byte(bits >> 8), byte(bits >> 16), byte(bits >> 24)})
+	case float64:
+		typ = wasm.ValueTypeF64
+		expr.WriteByte(ops.F64Const)
+		bits := math.Float64bits(v)
+		for i := uint(0); i < 64; i += 8 {
+			expr.WriteByte(byte(bits >> i))
+		}
+	default:
+		return b.fail("invalid initial value %v (%T) for global %q", init, init, name)
+	}
+	expr.WriteByte(ops.End)
+
+	if name != "" {
+		if _, ok := b.globalNames[name]; ok {
+			return b.fail("duplicate global %q", name)
+		}
+		b.globalNames[name] = uint32(len(b.globals))
+	}
+	b.globals = append(b.globals, wasm.GlobalEntry{
+		Type: wasm.GlobalVar{Type: typ, Mutable: mutable},
+		Init: expr.Bytes(),
+	})
+	return b
+}
+
+// Global returns the index in the global index space of the global named
+// name.
+func (b *Builder) Global(name string) uint32 {
+	i, ok := b.globalNames[name]
+	if !ok {
+		b.fail("unknown global %q", name)
+	}
+	return i
+}
+
+// AddMemory adds a linear memory with the given limits.
+func (b *Builder) AddMemory(limits wasm.ResizableLimits) *Builder {
+	b.mems = append(b.mems, wasm.Memory{Limits: limits})
+	return b
+}
+
+// AddData initializes the bytes at offset of the memory at index 0 to data.
+func (b *Builder) AddData(offset uint32, data []byte) *Builder {
+	expr := new(bytes.Buffer)
+	expr.WriteByte(ops.I32Const)
+	leb128.WriteVarint64(expr, int64(int32(offset)))
+	expr.WriteByte(ops.End)
+	b.data = append(b.data, wasm.DataSegment{Offset: expr.Bytes(), Data: data})
+	return b
+}
+
+// Export exports the entry of the given kind at index as field.
+func (b *Builder) Export(field string, kind wasm.External, index uint32) *Builder {
+	if _, ok := b.exports[field]; ok {
+		return b.fail("duplicate export %q", field)
+	}
+	b.exports[field] = wasm.ExportEntry{FieldStr: field, Kind: kind, Index: index}
+	return b
+}
+
+// Resolver sets the function resolving the imports of the module in Build.
+func (b *Builder) Resolver(resolve wasm.ResolveFunc) *Builder {
+	b.resolve = resolve
+	return b
+}
+
+// Instr returns the instruction with the opcode code and the given
+// immediates, of the types documented by disasm.Instr. Block, loop and if
+// take an optional wasm.BlockType, empty by default. Instr panics if code
+// is not a valid opcode.
+func Instr(code byte, immediates ...interface{}) disasm.Instr {
+	op, err := ops.New(code)
+	if err != nil {
+		panic(err)
+	}
+	ins := disasm.Instr{Op: op, Immediates: immediates}
+	switch code {
+	case ops.Block, ops.Loop, ops.If:
+		sig := wasm.BlockTypeEmpty
+		if len(immediates) > 0 {
+			sig = immediates[0].(wasm.BlockType)
+		}
+		ins.Block = &disasm.BlockInfo{Start: true, Signature: sig}
+		ins.Immediates = []interface{}{sig}
+	}
+	return ins
+}
+
+// Bytes encodes the module in the WebAssembly binary format, without
+// verifying it.
+func (b *Builder) Bytes() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	m := &wasm.Module{Types: &wasm.SectionTypes{Entries: b.types}}
+	if len(b.imports) > 0 {
+		m.Import = &wasm.SectionImports{Entries: b.imports}
+	}
+	if len(b.funcs) > 0 {
+		m.Function = &wasm.SectionFunctions{}
+		m.Code = &wasm.SectionCode{}
+		names := wasm.NameSection{Functions: make(wasm.NameMap)}
+		for i, fn := range b.funcs {
+			code, err := disasm.Assemble(fn.body)
+			if err != nil {
+				return nil, err
+			}
+			m.Function.Types = append(m.Function.Types, fn.typ)
+			m.Code.Bodies = append(m.Code.Bodies, wasm.FunctionBody{Locals: fn.locals, Code: code})
+			if fn.name != "" {
+				names.Functions[uint32(len(b.imports)+i)] = fn.name
+			}
+		}
+		if len(names.Functions) > 0 {
+			sec, err := names.Section()
+			if err != nil {
+				return nil, err
+			}
+			m.Other = append(m.Other, sec)
+		}
+	}
+	if len(b.mems) > 0 {
+		m.Memory = &wasm.SectionMemories{Entries: b.mems}
+	}
+	if len(b.globals) > 0 {
+		m.Global = &wasm.SectionGlobals{Globals: b.globals}
+	}
+	if len(b.exports) > 0 {
+		m.Export = &wasm.SectionExports{Entries: b.exports}
+	}
+	if len(b.data) > 0 {
+		m.Data = &wasm.SectionData{Entries: b.data}
+	}
+	buf := new(bytes.Buffer)
+	if err := wasm.EncodeModule(buf, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Build encodes the module, reads it back with wasm.ReadModule, resolving
+// its imports with the function set by Resolver, and verifies it with
+// validate.VerifyModule.
+func (b *Builder) Build() (*wasm.Module, error) {
+	raw, err := b.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(b.imports) > 0 && b.resolve == nil {
+		return nil, ErrNoResolver
+	}
+	m, err := wasm.ReadModule(bytes.NewReader(raw), b.resolve)
+	if err != nil {
+		return nil, err
+	}
+	if err = validate.VerifyModule(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
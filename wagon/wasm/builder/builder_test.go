@@ -0,0 +1,126 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder_test
+
+import (
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/exec"
+	"github.com/sea-project/sea-pkg/wagon/validate"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/builder"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+var (
+	i32    = wasm.ValueTypeI32
+	retI32 = wasm.FunctionSig{Form: 0, ReturnTypes: []wasm.ValueType{i32}}
+	addSig = wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{i32, i32}, ReturnTypes: []wasm.ValueType{i32}}
+)
+
+func TestBuild(t *testing.T) {
+	env := exec.NewHostModule("env")
+	if err := env.Func("double", func(x int32) int32 { return 2 * x }); err != nil {
+		t.Fatal(err)
+	}
+	reg := exec.NewHostRegistry()
+	if err := reg.Register(env); err != nil {
+		t.Fatal(err)
+	}
+	doubleSig := wasm.FunctionSig{Form: 0, ParamTypes: []wasm.ValueType{i32}, ReturnTypes: []wasm.ValueType{i32}}
+
+	b := builder.New().
+		AddImport("env", "double", doubleSig).
+		AddGlobal("base", true, int32(100)).
+		AddMemory(wasm.ResizableLimits{Initial: 1}).
+		AddData(8, []byte{5, 0, 0, 0}).
+		AddFunction("add", addSig, []wasm.ValueType{i32}, []disasm.Instr{
+			builder.Instr(ops.GetLocal, uint32(0)),
+			builder.Instr(ops.GetLocal, uint32(1)),
+			builder.Instr(ops.I32Add),
+			builder.Instr(ops.TeeLocal, uint32(2)),
+		})
+	b.AddFunction("main", retI32, nil, []disasm.Instr{
+		builder.Instr(ops.Block, wasm.BlockType(i32)),
+		builder.Instr(ops.I32Const, int32(0)),
+		builder.Instr(ops.I32Load, uint32(2), uint32(8)),
+		builder.Instr(ops.GetGlobal, b.Global("base")),
+		builder.Instr(ops.Call, b.Function("add")),
+		builder.Instr(ops.End),
+		builder.Instr(ops.Call, b.Function("env.double")),
+	}).
+		Export("main", wasm.ExternalFunction, b.Function("main")).
+		Export("memory", wasm.ExternalMemory, 0).
+		Resolver(reg.Resolver(nil))
+
+	m, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.FunctionNames(); len(got) != 3 || got[0] != "env.double" || got[1] != "add" || got[2] != "main" {
+		t.Errorf("got function names %q", got)
+	}
+	if len(m.Types.Entries) != 3 {
+		t.Errorf("got %d types, want 3", len(m.Types.Entries))
+	}
+
+	vm, err := exec.NewVM(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret, err := vm.ExecCode(int64(m.Export.Entries["main"].Index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != uint32(210) {
+		t.Errorf("main returned %v, want 210", ret)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		b   *builder.Builder
+		err error
+	}{
+		"import after function": {
+			b: builder.New().
+				AddFunction("f", retI32, nil, []disasm.Instr{builder.Instr(ops.I32Const, int32(1))}).
+				AddImport("env", "g", retI32),
+		},
+		"duplicate export": {
+			b: builder.New().
+				AddMemory(wasm.ResizableLimits{Initial: 1}).
+				Export("m", wasm.ExternalMemory, 0).
+				Export("m", wasm.ExternalMemory, 0),
+		},
+		"unknown function": {
+			b: func() *builder.Builder {
+				b := builder.New()
+				return b.Export("f", wasm.ExternalFunction, b.Function("f"))
+			}(),
+		},
+		"invalid global": {
+			b: builder.New().AddGlobal("g", false, "42"),
+		},
+		"no resolver": {
+			b:   builder.New().AddImport("env", "g", retI32),
+			err: builder.ErrNoResolver,
+		},
+	} {
+		_, err := tc.b.Build()
+		if err == nil || (tc.err != nil && err != tc.err) {
+			t.Errorf("%s: got error %v", name, err)
+		}
+	}
+
+	// a body adding with a single operand.
+	_, err := builder.New().
+		AddFunction("f", retI32, nil, []disasm.Instr{builder.Instr(ops.I32Const, int32(1)), builder.Instr(ops.I32Add)}).
+		Build()
+	if _, ok := err.(validate.Error); !ok {
+		t.Errorf("got error %v, want a validation error", err)
+	}
+}
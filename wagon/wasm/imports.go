@@ -129,6 +129,61 @@ func (e InvalidImportError) Error() string {
 	return fmt.Sprintf("wasm: invalid signature for import %#x with name '%s' in module %s", e.TypeIndex, e.FieldName, e.ModuleName)
 }
 
+// ImportLimitsError is returned when the limits of a resolved table or
+// memory don't match the limits of its import declaration.
+type ImportLimitsError struct {
+	ModuleName string
+	FieldName  string
+	Kind       External
+}
+
+func (e ImportLimitsError) Error() string {
+	return fmt.Sprintf("wasm: incompatible limits for imported %v '%s' in module %s", e.Kind, e.FieldName, e.ModuleName)
+}
+
+// ImportEntries returns the import entries of the given kind, in the order
+// of their index space.
+func (module *Module) ImportEntries(kind External) []ImportEntry {
+	if module.Import == nil {
+		return nil
+	}
+	var entries []ImportEntry
+	for _, e := range module.Import.Entries {
+		if e.Type.Kind() == kind {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// MemoryLimits returns the limits of the linear memory at index in the
+// memory index space.
+func (module *Module) MemoryLimits(index uint32) (ResizableLimits, bool) {
+	imported := module.ImportEntries(ExternalMemory)
+	if int(index) < len(imported) {
+		return imported[index].Type.(MemoryImport).Type.Limits, true
+	}
+	index -= uint32(len(imported))
+	if module.Memory == nil || int(index) >= len(module.Memory.Entries) {
+		return ResizableLimits{}, false
+	}
+	return module.Memory.Entries[index].Limits, true
+}
+
+// TableLimits returns the limits of the table at index in the table index
+// space.
+func (module *Module) TableLimits(index uint32) (ResizableLimits, bool) {
+	imported := module.ImportEntries(ExternalTable)
+	if int(index) < len(imported) {
+		return imported[index].Type.(TableImport).Type.Limits, true
+	}
+	index -= uint32(len(imported))
+	if module.Table == nil || int(index) >= len(module.Table.Entries) {
+		return ResizableLimits{}, false
+	}
+	return module.Table.Entries[index].Limits, true
+}
+
 func (module *Module) resolveImports(resolve ResolveFunc) error {
 	if module.Import == nil {
 		return nil
@@ -210,13 +265,45 @@ func (module *Module) resolveImports(resolve ResolveFunc) error {
 			if int(index) >= len(importedModule.TableIndexSpace) {
 				return InvalidTableIndexError(index)
 			}
-			module.TableIndexSpace[0] = importedModule.TableIndexSpace[0]
+			limits, _ := importedModule.TableLimits(index)
+			table := importedModule.TableIndexSpace[index]
+			if n := uint32(len(table)); n > limits.Initial {
+				limits.Initial = n
+			}
+			if !limits.Matches(importEntry.Type.(TableImport).Type.Limits) {
+				return ImportLimitsError{importEntry.ModuleName, importEntry.FieldName, ExternalTable}
+			}
+			// the table elements index the function index space of the
+			// imported module: the functions are appended to the index
+			// space of this module, and the elements remapped, once the
+			// functions of this module are populated.
+			funcs := make([]Function, len(table))
+			for i, elem := range table {
+				fn := importedModule.GetFunction(int(elem))
+				if fn == nil {
+					return InvalidFunctionIndexError(elem)
+				}
+				funcs[i] = *fn
+			}
+			if module.imports.TableFuncs == nil {
+				module.imports.TableFuncs = make(map[int]importedTable)
+			}
+			module.imports.TableFuncs[module.imports.Tables] = importedTable{
+				module: importedModule,
+				elems:  append([]uint32(nil), table...),
+				funcs:  funcs,
+			}
 			module.imports.Tables++
 		case ExternalMemory:
 			if int(index) >= len(importedModule.LinearMemoryIndexSpace) {
 				return InvalidLinearMemoryIndexError(index)
 			}
-			module.LinearMemoryIndexSpace[0] = importedModule.LinearMemoryIndexSpace[0]
+			limits, _ := importedModule.MemoryLimits(index)
+			if !limits.Matches(importEntry.Type.(MemoryImport).Type.Limits) {
+				return ImportLimitsError{importEntry.ModuleName, importEntry.FieldName, ExternalMemory}
+			}
+			data := importedModule.LinearMemoryIndexSpace[index]
+			module.LinearMemoryIndexSpace[module.imports.Memories] = append([]byte(nil), data...)
 			module.imports.Memories++
 		default:
 			return InvalidExternalError(exportEntry.Kind)
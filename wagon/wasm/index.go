@@ -58,6 +58,76 @@ func (m *Module) populateFunctions() error {
 	return nil
 }
 
+// importedTable holds the functions of a table imported from module, and
+// their indices in the function index space of module.
+type importedTable struct {
+	module *Module
+	elems  []uint32
+	funcs  []Function
+}
+
+// tableElem is an element of an imported table, holding the function at
+// index of module.
+type tableElem struct {
+	table, elem uint32
+	module      *Module
+	index       uint32
+}
+
+// populateImportedTables appends the functions referenced by the imported
+// tables to the function index space, and points the table elements at
+// them.
+func (m *Module) populateImportedTables() error {
+	m.imports.TableFuncBase = len(m.FunctionIndexSpace)
+	for index := 0; index < m.imports.Tables; index++ {
+		imported, ok := m.imports.TableFuncs[index]
+		if !ok {
+			continue
+		}
+		table := make([]uint32, len(imported.funcs))
+		for i, fn := range imported.funcs {
+			table[i] = uint32(len(m.FunctionIndexSpace))
+			m.FunctionIndexSpace = append(m.FunctionIndexSpace, fn)
+			m.imports.TableElems = append(m.imports.TableElems, tableElem{
+				table:  uint32(index),
+				elem:   uint32(i),
+				module: imported.module,
+				index:  imported.elems[i],
+			})
+		}
+		m.TableIndexSpace[index] = table
+	}
+	m.imports.TableFuncs = nil
+	return nil
+}
+
+// ImportedTableElement reports whether the function at index i of the
+// function index space was appended for an imported table, and if so
+// returns the index of the table in the table index space and the index
+// of the element in the table of the exporting module.
+func (m *Module) ImportedTableElement(i int) (table, elem uint32, ok bool) {
+	j := i - m.imports.TableFuncBase
+	if j < 0 || j >= len(m.imports.TableElems) {
+		return 0, 0, false
+	}
+	e := m.imports.TableElems[j]
+	return e.table, e.elem, true
+}
+
+// ImportedTableFunction returns the module defining the function at index i
+// of the function index space, if it was appended for an imported table,
+// and the index of the function in the function index space of that
+// module. The body of the function refers to the index spaces of the
+// defining module, not to those of m.
+func (m *Module) ImportedTableFunction(i int) (def *Module, index uint32, ok bool) {
+	j := i - m.imports.TableFuncBase
+	if j < 0 || j >= len(m.imports.TableElems) {
+		return nil, 0, false
+	}
+	e := m.imports.TableElems[j]
+	return e.module, e.index, true
+}
+
 // GetFunction returns a *Function, based on the function's index in
 // the function index space. Returns nil when the index is invalid
 func (m *Module) GetFunction(i int) *Function {
@@ -89,7 +159,7 @@ func (m *Module) GetGlobal(i int) *GlobalEntry {
 }
 
 func (m *Module) populateTables() error {
-	if m.Table == nil || len(m.Table.Entries) == 0 || m.Elements == nil || len(m.Elements.Entries) == 0 {
+	if len(m.TableIndexSpace) == 0 || m.Elements == nil || len(m.Elements.Entries) == 0 {
 		return nil
 	}
 
@@ -139,10 +209,8 @@ func (m *Module) populateLinearMemory() error {
 	if m.Data == nil || len(m.Data.Entries) == 0 {
 		return nil
 	}
-	// each module can only have a single linear memory in the MVP
-
 	for _, entry := range m.Data.Entries {
-		if entry.Index != 0 {
+		if int(entry.Index) >= len(m.LinearMemoryIndexSpace) {
 			return InvalidLinearMemoryIndexError(entry.Index)
 		}
 
@@ -0,0 +1,218 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wasm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm/leb128"
+)
+
+// DecodeOptions limits the resources allocated while decoding a module, for
+// reading untrusted modules with DecodeModuleWithOptions and
+// ReadModuleWithOptions. A zero field means no limit.
+//
+// When decoding with options, counts and sizes read from the module are
+// also checked against the size of their section, so that no allocation
+// exceeds a small multiple of the module size.
+type DecodeOptions struct {
+	MaxModuleSize   uint32 // size of the module in bytes
+	MaxFunctions    uint32 // functions declared by the function and code sections
+	MaxLocals       uint32 // local variables declared by a function body
+	MaxMemoryPages  uint32 // initial size in pages of a memory, and extent of the data segments
+	MaxTableSize    uint32 // initial size of a table, and extent of the element segments
+	MaxDataSegments uint32 // segments of the data section
+	MaxNestingDepth uint32 // nesting of blocks in a function body
+}
+
+// DefaultDecodeOptions holds limits suitable for contracts uploaded by
+// untrusted users.
+var DefaultDecodeOptions = DecodeOptions{
+	MaxModuleSize:   4 << 20,
+	MaxFunctions:    1 << 14,
+	MaxLocals:       1 << 14,
+	MaxMemoryPages:  256,
+	MaxTableSize:    1 << 16,
+	MaxDataSegments: 1 << 14,
+	MaxNestingDepth: 1 << 10,
+}
+
+// LimitError is returned when decoding a module exceeds one of its
+// DecodeOptions, or declares a count larger than its section.
+type LimitError struct {
+	Section SectionID
+	Offset  int64  // offset in the module of the value over the limit
+	What    string // description of the value
+	Value   uint64
+	Limit   uint64
+}
+
+func (e LimitError) Error() string {
+	return fmt.Sprintf("wasm: %s section at offset %#x: %s %d exceeds limit %d", e.Section, e.Offset, e.What, e.Value, e.Limit)
+}
+
+// noLimits are the options of readers created without DecodeOptions.
+var noLimits DecodeOptions
+
+// payloadReader reads the payload of a section while tracking its offset in
+// the module, for checking the DecodeOptions.
+type payloadReader struct {
+	r       io.Reader
+	opts    *DecodeOptions
+	section SectionID
+	offset  int64 // offset in the module of the next byte
+	end     int64 // offset in the module of the end of the payload
+}
+
+func (r *payloadReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// sub returns a reader for the n bytes just read from r into buf.
+func (r *payloadReader) sub(buf io.Reader, n int) *payloadReader {
+	return &payloadReader{
+		r:       buf,
+		opts:    r.opts,
+		section: r.section,
+		offset:  r.offset - int64(n),
+		end:     r.offset,
+	}
+}
+
+// check returns a LimitError if n exceeds a non-zero max.
+func (r *payloadReader) check(off int64, what string, n, max uint64) error {
+	if max != 0 && n > max {
+		return LimitError{Section: r.section, Offset: off, What: what, Value: n, Limit: max}
+	}
+	return nil
+}
+
+// decodeOptions returns the options of r, or options without limits if r
+// is not reading a section decoded with options.
+func decodeOptions(r io.Reader) *DecodeOptions {
+	if pr, ok := r.(*payloadReader); ok {
+		return pr.opts
+	}
+	return &noLimits
+}
+
+// readerOffset returns the offset in the module of the next byte of r, or
+// -1 if r is not reading a section decoded with options.
+func readerOffset(r io.Reader) int64 {
+	if pr, ok := r.(*payloadReader); ok {
+		return pr.offset
+	}
+	return -1
+}
+
+// checkLimit checks n read at off against a non-zero max, when r is reading
+// a section decoded with options.
+func checkLimit(r io.Reader, off int64, what string, n uint64, max uint32) error {
+	if pr, ok := r.(*payloadReader); ok {
+		return pr.check(off, what, n, uint64(max))
+	}
+	return nil
+}
+
+// readCount reads the number of entries or bytes that follow in r, and
+// checks it against a non-zero max and the remaining size of the section.
+func readCount(r io.Reader, what string, max uint32) (uint32, error) {
+	pr, ok := r.(*payloadReader)
+	if !ok {
+		return leb128.ReadVarUint32(r)
+	}
+	off := pr.offset
+	n, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return 0, err
+	}
+	if err = pr.check(off, what, uint64(n), uint64(max)); err != nil {
+		return 0, err
+	}
+	// every entry takes at least a byte.
+	if rem := pr.end - pr.offset; int64(n) > rem {
+		return 0, LimitError{Section: pr.section, Offset: off, What: what, Value: uint64(n), Limit: uint64(rem)}
+	}
+	return n, nil
+}
+
+// checkSegment checks that a segment of n entries at the constant offset
+// computed by expr fits in max entries.
+func checkSegment(r io.Reader, off int64, what string, expr []byte, n int, max uint64) error {
+	if max == 0 || len(expr) == 0 || expr[0] != i32Const {
+		return nil
+	}
+	start, err := leb128.ReadVarint32(bytes.NewReader(expr[1:]))
+	if err != nil {
+		return nil
+	}
+	if pr, ok := r.(*payloadReader); ok {
+		return pr.check(off, what, uint64(uint32(start))+uint64(n), max)
+	}
+	return nil
+}
+
+// nestingDepth returns the offset in code of the first block instruction
+// nested deeper than max, or -1. Decoding stops at a malformed
+// instruction, which is reported by the validation of the module.
+func nestingDepth(code []byte, max uint32) int {
+	depth := uint32(0)
+	for pc := 0; pc < len(code); {
+		op := code[pc]
+		pc++
+		switch {
+		case op == 0x02 || op == 0x03 || op == 0x04: // block, loop, if
+			depth++
+			if depth > max {
+				return pc - 1
+			}
+			pc++ // block type
+		case op == end:
+			if depth > 0 {
+				depth--
+			}
+		case op == 0x0c || op == 0x0d || op == 0x10 || (op >= 0x20 && op <= 0x24): // br, br_if, call, variable access
+			pc = skipLEB128(code, pc)
+		case op == 0x0e: // br_table
+			n, size, err := leb128.ReadVarUint32Size(bytes.NewReader(code[pc:]))
+			if err != nil {
+				return -1
+			}
+			pc += int(size)
+			for i := uint64(0); i <= uint64(n) && pc < len(code); i++ {
+				pc = skipLEB128(code, pc)
+			}
+		case op == 0x11: // call_indirect
+			pc = skipLEB128(code, pc) + 1
+		case op >= 0x28 && op <= 0x3e: // memory access
+			pc = skipLEB128(code, skipLEB128(code, pc))
+		case op == 0x3f || op == 0x40: // current_memory, grow_memory
+			pc++
+		case op == i32Const || op == i64Const:
+			pc = skipLEB128(code, pc)
+		case op == f32Const:
+			pc += 4
+		case op == f64Const:
+			pc += 8
+		}
+	}
+	return -1
+}
+
+// skipLEB128 returns the offset in code following the LEB128 value at pc.
+func skipLEB128(code []byte, pc int) int {
+	for pc < len(code) {
+		b := code[pc]
+		pc++
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return pc
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wasm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+func TestDecodeOptionsTestdata(t *testing.T) {
+	for _, dir := range testPaths {
+		fnames, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fname := range fnames {
+			raw, err := ioutil.ReadFile(fname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the size checks apply even without limits.
+			if _, err := wasm.DecodeModuleWithOptions(bytes.NewReader(raw), wasm.DecodeOptions{}); err != nil {
+				t.Errorf("%s: %v", fname, err)
+			}
+		}
+	}
+}
+
+func encode(t *testing.T, m *wasm.Module) []byte {
+	buf := new(bytes.Buffer)
+	if err := wasm.EncodeModule(buf, m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeOptions(t *testing.T) {
+	sig := wasm.FunctionSig{Form: 0}
+	// block block block end end end
+	nested := []byte{0x02, 0x40, 0x02, 0x40, 0x02, 0x40, 0x0b, 0x0b, 0x0b}
+	module := encode(t, &wasm.Module{
+		Types:    &wasm.SectionTypes{Entries: []wasm.FunctionSig{sig}},
+		Function: &wasm.SectionFunctions{Types: []uint32{0, 0}},
+		Table: &wasm.SectionTables{
+			Entries: []wasm.Table{{ElementType: wasm.ElemTypeAnyFunc, Limits: wasm.ResizableLimits{Initial: 4}}},
+		},
+		Memory: &wasm.SectionMemories{
+			Entries: []wasm.Memory{{Limits: wasm.ResizableLimits{Initial: 2}}},
+		},
+		Code: &wasm.SectionCode{
+			Bodies: []wasm.FunctionBody{
+				{Locals: []wasm.LocalEntry{{Count: 3, Type: wasm.ValueTypeI32}, {Count: 2, Type: wasm.ValueTypeI64}}},
+				{Code: nested},
+			},
+		},
+		Data: &wasm.SectionData{
+			Entries: []wasm.DataSegment{
+				{Offset: []byte{0x41, 0x00, 0x0b}, Data: []byte("a")},
+				{Offset: []byte{0x41, 0x80, 0x80, 0x08, 0x0b}, Data: []byte("b")},
+			},
+		},
+	})
+
+	if _, err := wasm.DecodeModuleWithOptions(bytes.NewReader(module), wasm.DefaultDecodeOptions); err != nil {
+		t.Fatalf("DefaultDecodeOptions: %v", err)
+	}
+
+	for _, tc := range []struct {
+		opts    wasm.DecodeOptions
+		section wasm.SectionID
+		what    string
+		value   uint64
+	}{
+		{wasm.DecodeOptions{MaxModuleSize: 32}, wasm.SectionIDCode, "module size", 52},
+		{wasm.DecodeOptions{MaxFunctions: 1}, wasm.SectionIDFunction, "function count", 2},
+		{wasm.DecodeOptions{MaxLocals: 4}, wasm.SectionIDCode, "local count", 5},
+		{wasm.DecodeOptions{MaxMemoryPages: 1}, wasm.SectionIDMemory, "memory pages", 2},
+		{wasm.DecodeOptions{MaxMemoryPages: 2}, wasm.SectionIDData, "data segment end", 2*65536 + 1},
+		{wasm.DecodeOptions{MaxTableSize: 3}, wasm.SectionIDTable, "table size", 4},
+		{wasm.DecodeOptions{MaxDataSegments: 1}, wasm.SectionIDData, "data segment count", 2},
+		{wasm.DecodeOptions{MaxNestingDepth: 2}, wasm.SectionIDCode, "nesting depth", 3},
+	} {
+		_, err := wasm.DecodeModuleWithOptions(bytes.NewReader(module), tc.opts)
+		lerr, ok := err.(wasm.LimitError)
+		if !ok {
+			t.Errorf("%+v: got error %v, want a LimitError", tc.opts, err)
+			continue
+		}
+		if lerr.Section != tc.section || lerr.What != tc.what || lerr.Value != tc.value {
+			t.Errorf("%+v: got error %v", tc.opts, err)
+		}
+		if lerr.Offset < 8 || lerr.Offset >= int64(len(module)) {
+			t.Errorf("%+v: offset %#x out of the module", tc.opts, lerr.Offset)
+		}
+	}
+}
+
+func TestDecodeOptionsOffset(t *testing.T) {
+	module := encode(t, &wasm.Module{
+		Memory: &wasm.SectionMemories{
+			Entries: []wasm.Memory{{Limits: wasm.ResizableLimits{Initial: 2}}},
+		},
+	})
+	_, err := wasm.DecodeModuleWithOptions(bytes.NewReader(module), wasm.DecodeOptions{MaxMemoryPages: 1})
+	// header, section id, payload size and memory count precede the limits.
+	want := wasm.LimitError{Section: wasm.SectionIDMemory, Offset: 11, What: "memory pages", Value: 2, Limit: 1}
+	if err != want {
+		t.Fatalf("got error %v, want %v", err, want)
+	}
+	if got, want := err.Error(), "wasm: memory section at offset 0xb: memory pages 2 exceeds limit 1"; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+}
+
+func TestDecodeOptionsCounts(t *testing.T) {
+	module := []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		// type section declaring 2^32-1 types in 5 bytes.
+		0x01, 0x05, 0xff, 0xff, 0xff, 0xff, 0x0f,
+	}
+	_, err := wasm.DecodeModuleWithOptions(bytes.NewReader(module), wasm.DecodeOptions{})
+	want := wasm.LimitError{Section: wasm.SectionIDType, Offset: 10, What: "type count", Value: 1<<32 - 1, Limit: 0}
+	if err != want {
+		t.Errorf("got error %v, want %v", err, want)
+	}
+
+	// a body holding only its local declarations.
+	module = []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		0x01, 0x04, 0x01, 0x60, 0x00, 0x00,
+		0x03, 0x02, 0x01, 0x00,
+		0x0a, 0x03, 0x01, 0x01, 0x00,
+	}
+	if _, err := wasm.DecodeModule(bytes.NewReader(module)); err != wasm.ErrFunctionNoEnd {
+		t.Errorf("got error %v, want %v", err, wasm.ErrFunctionNoEnd)
+	}
+}
+
+func TestDecodeSectionLength(t *testing.T) {
+	module := []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		// custom section declaring a payload of 4 GiB - 1, holding 1 byte.
+		0x00, 0xff, 0xff, 0xff, 0xff, 0x0f, 0x00,
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := wasm.DecodeModuleWithOptions(bytes.NewReader(module), wasm.DecodeOptions{}); err == nil {
+		t.Error("truncated section: no error")
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("decoding allocated %d bytes", n)
+	}
+}
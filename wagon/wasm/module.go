@@ -65,6 +65,15 @@ type Module struct {
 		Globals  int
 		Tables   int
 		Memories int
+
+		// functions referenced by the imported tables, by table index
+		TableFuncs map[int]importedTable
+
+		// the functions appended for the imported tables start at
+		// TableFuncBase in the function index space, TableElems holding
+		// the table element each of them comes from
+		TableFuncBase int
+		TableElems    []tableElem
 	}
 }
 
@@ -90,6 +99,16 @@ type ResolveFunc func(name string) (*Module, error)
 // DecodeModule is the same as ReadModule, but it only decodes the module without
 // initializing the index space or resolving imports.
 func DecodeModule(r io.Reader) (*Module, error) {
+	return decodeModule(r, nil)
+}
+
+// DecodeModuleWithOptions is like DecodeModule, and enforces the limits of
+// opts while decoding. Exceeding a limit returns a LimitError.
+func DecodeModuleWithOptions(r io.Reader, opts DecodeOptions) (*Module, error) {
+	return decodeModule(r, &opts)
+}
+
+func decodeModule(r io.Reader, opts *DecodeOptions) (*Module, error) {
 	reader := &readpos.ReadPos{
 		R:      r,
 		CurPos: 0,
@@ -107,7 +126,7 @@ func DecodeModule(r io.Reader) (*Module, error) {
 	}
 
 	for {
-		done, err := m.readSection(reader)
+		done, err := m.readSection(reader, opts)
 		if err != nil {
 			return nil, err
 		} else if done {
@@ -119,14 +138,37 @@ func DecodeModule(r io.Reader) (*Module, error) {
 // ReadModule reads a module from the reader r. resolvePath must take a string
 // and a return a reader to the module pointed to by the string.
 func ReadModule(r io.Reader, resolvePath ResolveFunc) (*Module, error) {
-	m, err := DecodeModule(r)
+	return readModule(r, resolvePath, nil)
+}
+
+// ReadModuleWithOptions is like ReadModule, and enforces the limits of opts
+// while decoding the module. Modules returned by resolvePath are decoded by
+// the resolver.
+func ReadModuleWithOptions(r io.Reader, resolvePath ResolveFunc, opts DecodeOptions) (*Module, error) {
+	return readModule(r, resolvePath, &opts)
+}
+
+func readModule(r io.Reader, resolvePath ResolveFunc, opts *DecodeOptions) (*Module, error) {
+	m, err := decodeModule(r, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	m.LinearMemoryIndexSpace = make([][]byte, 1)
+	// the index spaces start with the imported memories and tables.
+	memories := len(m.ImportEntries(ExternalMemory))
+	if m.Memory != nil {
+		memories += len(m.Memory.Entries)
+	}
+	if memories == 0 {
+		memories = 1
+	}
+	m.LinearMemoryIndexSpace = make([][]byte, memories)
+	tables := len(m.ImportEntries(ExternalTable))
 	if m.Table != nil {
-		m.TableIndexSpace = make([][]uint32, int(len(m.Table.Entries)))
+		tables += len(m.Table.Entries)
+	}
+	if tables > 0 {
+		m.TableIndexSpace = make([][]uint32, tables)
 	}
 
 	if m.Import != nil && resolvePath != nil {
@@ -139,6 +181,7 @@ func ReadModule(r io.Reader, resolvePath ResolveFunc) (*Module, error) {
 	for _, fn := range []func() error{
 		m.populateGlobals,
 		m.populateFunctions,
+		m.populateImportedTables,
 		m.populateTables,
 		m.populateLinearMemory,
 	} {
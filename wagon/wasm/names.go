@@ -0,0 +1,287 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wasm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm/leb128"
+)
+
+// CustomSectionName is the name of the custom section holding debug names,
+// as defined in:
+// https://webassembly.github.io/spec/core/appendix/custom.html#name-section
+const CustomSectionName = "name"
+
+// Subsection IDs of the name section.
+const (
+	NameSubsectionModule   = 0
+	NameSubsectionFunction = 1
+	NameSubsectionLocal    = 2
+)
+
+// NameMap maps indices to names.
+type NameMap map[uint32]string
+
+// NameSection is the decoded content of the name custom section.
+type NameSection struct {
+	Module    string             // name of the module, if any
+	Functions NameMap            // names of functions, by index in the function index space
+	Locals    map[uint32]NameMap // names of locals, by function index and local index
+}
+
+// CustomSectionError is returned when a custom section is malformed.
+type CustomSectionError struct {
+	Name string
+	Err  error
+}
+
+func (e CustomSectionError) Error() string {
+	return fmt.Sprintf("wasm: malformed custom section %q: %v", e.Name, e.Err)
+}
+
+// CustomSection returns the payload of the first custom section named name,
+// with the name itself stripped. It returns nil if the module has no such
+// section.
+func (m *Module) CustomSection(name string) []byte {
+	for i := range m.Other {
+		s := &m.Other[i]
+		if s.ID != SectionIDCustom {
+			continue
+		}
+		r := bytes.NewReader(s.Bytes)
+		n, err := leb128.ReadVarUint32(r)
+		if err != nil || uint64(n) > uint64(r.Len()) {
+			continue
+		}
+		sname, _ := readString(r, int(n))
+		if sname == name {
+			return s.Bytes[len(s.Bytes)-r.Len():]
+		}
+	}
+	return nil
+}
+
+// Names decodes the name section of the module. It returns nil and no error
+// if the module has no name section.
+func (m *Module) Names() (*NameSection, error) {
+	payload := m.CustomSection(CustomSectionName)
+	if payload == nil {
+		return nil, nil
+	}
+	names, err := ReadNameSection(bytes.NewReader(payload))
+	if err != nil {
+		return nil, CustomSectionError{Name: CustomSectionName, Err: err}
+	}
+	return names, nil
+}
+
+// ReadNameSection reads the payload of a name section from r.
+// Unknown subsections are skipped.
+func ReadNameSection(r io.Reader) (*NameSection, error) {
+	names := &NameSection{
+		Functions: make(NameMap),
+		Locals:    make(map[uint32]NameMap),
+	}
+	for {
+		id, err := leb128.ReadVarUint32(r)
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		size, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := readBytes(r, int(size))
+		if err != nil {
+			return nil, err
+		}
+		sr := bytes.NewReader(payload)
+
+		switch id {
+		case NameSubsectionModule:
+			if names.Module, err = readName(sr); err != nil {
+				return nil, err
+			}
+		case NameSubsectionFunction:
+			if names.Functions, err = readNameMap(sr); err != nil {
+				return nil, err
+			}
+		case NameSubsectionLocal:
+			count, err := leb128.ReadVarUint32(sr)
+			if err != nil {
+				return nil, err
+			}
+			for i := uint32(0); i < count; i++ {
+				index, err := leb128.ReadVarUint32(sr)
+				if err != nil {
+					return nil, err
+				}
+				if names.Locals[index], err = readNameMap(sr); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+}
+
+func readName(r io.Reader) (string, error) {
+	n, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return "", err
+	}
+	return readString(r, int(n))
+}
+
+func readNameMap(r io.Reader) (NameMap, error) {
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	m := make(NameMap, count)
+	for i := uint32(0); i < count; i++ {
+		index, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		if m[index], err = readName(r); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// MarshalWASM encodes the name section payload, without the section name.
+func (s *NameSection) MarshalWASM(w io.Writer) error {
+	buf := new(bytes.Buffer)
+	writeSub := func(id uint32) error {
+		if _, err := leb128.WriteVarUint32(w, id); err != nil {
+			return err
+		}
+		err := writeBytesUint(w, buf.Bytes())
+		buf.Reset()
+		return err
+	}
+	if s.Module != "" {
+		if err := writeStringUint(buf, s.Module); err != nil {
+			return err
+		}
+		if err := writeSub(NameSubsectionModule); err != nil {
+			return err
+		}
+	}
+	if len(s.Functions) > 0 {
+		if err := writeNameMap(buf, s.Functions); err != nil {
+			return err
+		}
+		if err := writeSub(NameSubsectionFunction); err != nil {
+			return err
+		}
+	}
+	if len(s.Locals) > 0 {
+		indices := make([]uint32, 0, len(s.Locals))
+		for i := range s.Locals {
+			indices = append(indices, i)
+		}
+		sortIndices(indices)
+		if _, err := leb128.WriteVarUint32(buf, uint32(len(indices))); err != nil {
+			return err
+		}
+		for _, i := range indices {
+			if _, err := leb128.WriteVarUint32(buf, i); err != nil {
+				return err
+			}
+			if err := writeNameMap(buf, s.Locals[i]); err != nil {
+				return err
+			}
+		}
+		if err := writeSub(NameSubsectionLocal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Section returns the name section as a custom section ready to be
+// appended to Module.Other.
+func (s *NameSection) Section() (RawSection, error) {
+	buf := new(bytes.Buffer)
+	if err := writeStringUint(buf, CustomSectionName); err != nil {
+		return RawSection{}, err
+	}
+	if err := s.MarshalWASM(buf); err != nil {
+		return RawSection{}, err
+	}
+	return RawSection{ID: SectionIDCustom, Bytes: buf.Bytes()}, nil
+}
+
+func writeNameMap(w io.Writer, m NameMap) error {
+	indices := make([]uint32, 0, len(m))
+	for i := range m {
+		indices = append(indices, i)
+	}
+	sortIndices(indices)
+	if _, err := leb128.WriteVarUint32(w, uint32(len(indices))); err != nil {
+		return err
+	}
+	for _, i := range indices {
+		if _, err := leb128.WriteVarUint32(w, i); err != nil {
+			return err
+		}
+		if err := writeStringUint(w, m[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortIndices(indices []uint32) {
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+}
+
+// FunctionNames returns a printable name for every function of the function
+// index space. Names are taken from the name section, then from the import
+// and export entries, and default to "func[index]".
+func (m *Module) FunctionNames() []string {
+	names := make([]string, len(m.FunctionIndexSpace))
+	if m.Export != nil {
+		for name, e := range m.Export.Entries {
+			if e.Kind == ExternalFunction && int(e.Index) < len(names) {
+				// prefer the smallest name for a deterministic result
+				if names[e.Index] == "" || name < names[e.Index] {
+					names[e.Index] = name
+				}
+			}
+		}
+	}
+	if m.Import != nil {
+		i := 0
+		for _, e := range m.Import.Entries {
+			if _, ok := e.Type.(FuncImport); ok && i < len(names) {
+				names[i] = e.ModuleName + "." + e.FieldName
+				i++
+			}
+		}
+	}
+	if ns, err := m.Names(); err == nil && ns != nil {
+		for i, name := range ns.Functions {
+			if int(i) < len(names) && name != "" {
+				names[i] = name
+			}
+		}
+	}
+	for i, name := range names {
+		if name == "" {
+			names[i] = fmt.Sprintf("func[%d]", i)
+		}
+	}
+	return names
+}
@@ -0,0 +1,62 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wasm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNameSection(t *testing.T) {
+	want := &NameSection{
+		Module:    "contract",
+		Functions: NameMap{0: "env.log", 2: "main"},
+		Locals:    map[uint32]NameMap{2: {0: "ptr", 1: "len"}},
+	}
+	sec, err := want.Section()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Module{
+		Types: &SectionTypes{Entries: []FunctionSig{{Form: 0}}},
+		Import: &SectionImports{Entries: []ImportEntry{
+			{ModuleName: "env", FieldName: "log", Type: FuncImport{Type: 0}},
+		}},
+		Function: &SectionFunctions{Types: []uint32{0, 0}},
+		Export: &SectionExports{Entries: map[string]ExportEntry{
+			"run": {FieldStr: "run", Kind: ExternalFunction, Index: 1},
+		}},
+		Code:  &SectionCode{Bodies: []FunctionBody{{Code: []byte{0x0b}}, {Code: []byte{0x0b}}}},
+		Other: []RawSection{sec},
+	}
+	buf := new(bytes.Buffer)
+	if err := EncodeModule(buf, m); err != nil {
+		t.Fatal(err)
+	}
+	m, err = DecodeModule(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := m.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got names %+v, want %+v", got, want)
+	}
+
+	m.FunctionIndexSpace = make([]Function, 3)
+	if got, want := m.FunctionNames(), []string{"env.log", "run", "main"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got function names %v, want %v", got, want)
+	}
+
+	m.Other = nil
+	if names, err := m.Names(); names != nil || err != nil {
+		t.Errorf("got %v, %v for a module without a name section", names, err)
+	}
+}
@@ -85,9 +85,17 @@ func (s *RawSection) SectionID() SectionID {
 }
 
 func (s *RawSection) ReadPayload(r io.Reader) error {
-	s.Bytes = make([]byte, s.PayloadLen)
-	_, err := io.ReadFull(r, s.Bytes)
-	return err
+	// the payload is read before it is stored, not sized by its length.
+	buf := new(bytes.Buffer)
+	n, err := buf.ReadFrom(io.LimitReader(r, int64(s.PayloadLen)))
+	if err != nil {
+		return err
+	}
+	if n < int64(s.PayloadLen) {
+		return io.ErrUnexpectedEOF
+	}
+	s.Bytes = buf.Bytes()
+	return nil
 }
 
 func (s *RawSection) WritePayload(w io.Writer) error {
@@ -121,7 +129,7 @@ func (e MissingSectionError) Error() string {
 
 // reads a valid section from r. The first return value is true if and only if
 // the module has been completely read.
-func (m *Module) readSection(r *readpos.ReadPos) (bool, error) {
+func (m *Module) readSection(r *readpos.ReadPos, opts *DecodeOptions) (bool, error) {
 	var err error
 	var id uint32
 
@@ -158,9 +166,32 @@ func (m *Module) readSection(r *readpos.ReadPos) (bool, error) {
 
 	s.Start = r.CurPos
 
+	if opts != nil && opts.MaxModuleSize != 0 && s.Start+int64(payloadDataLen) > int64(opts.MaxModuleSize) {
+		return false, LimitError{
+			Section: s.ID,
+			Offset:  s.Start,
+			What:    "module size",
+			Value:   uint64(s.Start) + uint64(payloadDataLen),
+			Limit:   uint64(opts.MaxModuleSize),
+		}
+	}
+
 	sectionBytes := new(bytes.Buffer)
-	sectionBytes.Grow(int(payloadDataLen))
-	sectionReader := io.LimitReader(io.TeeReader(r, sectionBytes), int64(payloadDataLen))
+	if opts != nil && opts.MaxModuleSize != 0 {
+		// the payload length only sizes the buffer once checked against
+		// the module size.
+		sectionBytes.Grow(int(payloadDataLen))
+	}
+	var sectionReader io.Reader = io.LimitReader(io.TeeReader(r, sectionBytes), int64(payloadDataLen))
+	if opts != nil {
+		sectionReader = &payloadReader{
+			r:       sectionReader,
+			opts:    opts,
+			section: s.ID,
+			offset:  s.Start,
+			end:     s.Start + int64(payloadDataLen),
+		}
+	}
 
 	var sec Section
 	switch s.ID {
@@ -256,7 +287,7 @@ func (*SectionTypes) SectionID() SectionID {
 }
 
 func (s *SectionTypes) ReadPayload(r io.Reader) error {
-	count, err := leb128.ReadVarUint32(r)
+	count, err := readCount(r, "type count", 0)
 	if err != nil {
 		return err
 	}
@@ -295,7 +326,7 @@ func (*SectionImports) SectionID() SectionID {
 }
 
 func (s *SectionImports) ReadPayload(r io.Reader) error {
-	count, err := leb128.ReadVarUint32(r)
+	count, err := readCount(r, "import count", 0)
 	if err != nil {
 		return err
 	}
@@ -324,7 +355,7 @@ func (s *SectionImports) WritePayload(w io.Writer) error {
 }
 
 func (i *ImportEntry) UnmarshalWASM(r io.Reader) error {
-	modLen, err := leb128.ReadVarUint32(r)
+	modLen, err := readCount(r, "module name length", 0)
 	if err != nil {
 		return err
 	}
@@ -333,7 +364,7 @@ func (i *ImportEntry) UnmarshalWASM(r io.Reader) error {
 		return err
 	}
 
-	fieldLen, err := leb128.ReadVarUint32(r)
+	fieldLen, err := readCount(r, "field name length", 0)
 	if err != nil {
 		return err
 	}
@@ -409,7 +440,7 @@ func (*SectionFunctions) SectionID() SectionID {
 }
 
 func (s *SectionFunctions) ReadPayload(r io.Reader) error {
-	count, err := leb128.ReadVarUint32(r)
+	count, err := readCount(r, "function count", decodeOptions(r).MaxFunctions)
 	if err != nil {
 		return err
 	}
@@ -447,7 +478,7 @@ func (*SectionTables) SectionID() SectionID {
 }
 
 func (s *SectionTables) ReadPayload(r io.Reader) error {
-	count, err := leb128.ReadVarUint32(r)
+	count, err := readCount(r, "table count", 0)
 	if err != nil {
 		return err
 	}
@@ -484,7 +515,7 @@ func (*SectionMemories) SectionID() SectionID {
 }
 
 func (s *SectionMemories) ReadPayload(r io.Reader) error {
-	count, err := leb128.ReadVarUint32(r)
+	count, err := readCount(r, "memory count", 0)
 	if err != nil {
 		return err
 	}
@@ -521,7 +552,7 @@ func (*SectionGlobals) SectionID() SectionID {
 }
 
 func (s *SectionGlobals) ReadPayload(r io.Reader) error {
-	count, err := leb128.ReadVarUint32(r)
+	count, err := readCount(r, "global count", 0)
 	if err != nil {
 		return err
 	}
@@ -584,7 +615,7 @@ func (*SectionExports) SectionID() SectionID {
 }
 
 func (s *SectionExports) ReadPayload(r io.Reader) error {
-	count, err := leb128.ReadVarUint32(r)
+	count, err := readCount(r, "export count", 0)
 	if err != nil {
 		return err
 	}
@@ -637,7 +668,7 @@ type ExportEntry struct {
 }
 
 func (e *ExportEntry) UnmarshalWASM(r io.Reader) error {
-	fieldLen, err := leb128.ReadVarUint32(r)
+	fieldLen, err := readCount(r, "field name length", 0)
 	if err != nil {
 		return err
 	}
@@ -700,7 +731,7 @@ func (*SectionElements) SectionID() SectionID {
 }
 
 func (s *SectionElements) ReadPayload(r io.Reader) error {
-	count, err := leb128.ReadVarUint32(r)
+	count, err := readCount(r, "element segment count", 0)
 	if err != nil {
 		return err
 	}
@@ -736,6 +767,7 @@ type ElementSegment struct {
 func (s *ElementSegment) UnmarshalWASM(r io.Reader) error {
 	var err error
 
+	off := readerOffset(r)
 	if s.Index, err = leb128.ReadVarUint32(r); err != nil {
 		return err
 	}
@@ -743,10 +775,13 @@ func (s *ElementSegment) UnmarshalWASM(r io.Reader) error {
 		return err
 	}
 
-	numElems, err := leb128.ReadVarUint32(r)
+	numElems, err := readCount(r, "element count", 0)
 	if err != nil {
 		return err
 	}
+	if err = checkSegment(r, off, "element segment end", s.Offset, int(numElems), uint64(decodeOptions(r).MaxTableSize)); err != nil {
+		return err
+	}
 	s.Elems = make([]uint32, numElems)
 
 	for i := range s.Elems {
@@ -790,7 +825,7 @@ func (*SectionCode) SectionID() SectionID {
 }
 
 func (s *SectionCode) ReadPayload(r io.Reader) error {
-	count, err := leb128.ReadVarUint32(r)
+	count, err := readCount(r, "function body count", decodeOptions(r).MaxFunctions)
 	if err != nil {
 		return err
 	}
@@ -828,7 +863,7 @@ type FunctionBody struct {
 
 func (f *FunctionBody) UnmarshalWASM(r io.Reader) error {
 
-	bodySize, err := leb128.ReadVarUint32(r)
+	bodySize, err := readCount(r, "function body size", 0)
 	if err != nil {
 		return err
 	}
@@ -840,15 +875,26 @@ func (f *FunctionBody) UnmarshalWASM(r io.Reader) error {
 	}
 
 	bytesReader := bytes.NewBuffer(body)
+	var localsReader io.Reader = bytesReader
+	if pr, ok := r.(*payloadReader); ok {
+		localsReader = pr.sub(bytesReader, len(body))
+	}
+	opts := decodeOptions(r)
 
-	localCount, err := leb128.ReadVarUint32(bytesReader)
+	localCount, err := readCount(localsReader, "local entry count", 0)
 	if err != nil {
 		return err
 	}
 	f.Locals = make([]LocalEntry, localCount)
 
+	var locals uint64
 	for i := range f.Locals {
-		if err = f.Locals[i].UnmarshalWASM(bytesReader); err != nil {
+		off := readerOffset(localsReader)
+		if err = f.Locals[i].UnmarshalWASM(localsReader); err != nil {
+			return err
+		}
+		locals += uint64(f.Locals[i].Count)
+		if err = checkLimit(localsReader, off, "local count", locals, opts.MaxLocals); err != nil {
 			return err
 		}
 	}
@@ -858,10 +904,17 @@ func (f *FunctionBody) UnmarshalWASM(r io.Reader) error {
 	code := bytesReader.Bytes()
 	logger.Printf("Read %d bytes for function body", len(code))
 
-	if code[len(code)-1] != end {
+	if len(code) == 0 || code[len(code)-1] != end {
 		return ErrFunctionNoEnd
 	}
 
+	if opts.MaxNestingDepth != 0 {
+		if pc := nestingDepth(code, opts.MaxNestingDepth); pc >= 0 {
+			off := readerOffset(r) - int64(len(code)) + int64(pc)
+			return checkLimit(r, off, "nesting depth", uint64(opts.MaxNestingDepth)+1, opts.MaxNestingDepth)
+		}
+	}
+
 	f.Code = code[:len(code)-1]
 
 	return nil
@@ -926,7 +979,7 @@ func (*SectionData) SectionID() SectionID {
 }
 
 func (s *SectionData) ReadPayload(r io.Reader) error {
-	count, err := leb128.ReadVarUint32(r)
+	count, err := readCount(r, "data segment count", decodeOptions(r).MaxDataSegments)
 	if err != nil {
 		return err
 	}
@@ -961,6 +1014,7 @@ type DataSegment struct {
 func (s *DataSegment) UnmarshalWASM(r io.Reader) error {
 	var err error
 
+	off := readerOffset(r)
 	if s.Index, err = leb128.ReadVarUint32(r); err != nil {
 		return err
 	}
@@ -968,10 +1022,14 @@ func (s *DataSegment) UnmarshalWASM(r io.Reader) error {
 		return err
 	}
 
-	size, err := leb128.ReadVarUint32(r)
+	size, err := readCount(r, "data segment size", 0)
 	if err != nil {
 		return err
 	}
+	maxBytes := uint64(decodeOptions(r).MaxMemoryPages) * 65536
+	if err = checkSegment(r, off, "data segment end", s.Offset, int(size), maxBytes); err != nil {
+		return err
+	}
 	s.Data, err = readBytes(r, int(size))
 
 	return err
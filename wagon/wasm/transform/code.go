@@ -0,0 +1,114 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package transform
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm/leb128"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+)
+
+// CodeError is returned when the code of a function body cannot be decoded.
+type CodeError struct {
+	Func   int // index of the body in the code section
+	Offset int // offset of the instruction in the code of the body
+	Err    error
+}
+
+func (e CodeError) Error() string {
+	return fmt.Sprintf("transform: function body %d at offset %d: %v", e.Func, e.Offset, e.Err)
+}
+
+// call is a call instruction, whose function index is encoded in
+// code[start:end].
+type call struct {
+	start, end int
+	index      uint32
+}
+
+// calls returns the call instructions of code, the i-th function body
+// without its final end.
+func calls(i int, code []byte) ([]call, error) {
+	var cs []call
+	r := bytes.NewReader(code)
+	pos := func() int { return len(code) - r.Len() }
+	uleb := func() (uint32, error) {
+		v, _, err := leb128.ReadVarUint32Size(r)
+		return v, err
+	}
+	skip := func(n int) error {
+		if r.Len() < n {
+			return fmt.Errorf("truncated immediate")
+		}
+		_, err := r.Seek(int64(n), 1)
+		return err
+	}
+	for r.Len() > 0 {
+		pc := pos()
+		op, _ := r.ReadByte()
+		if _, err := ops.New(op); err != nil {
+			return nil, CodeError{Func: i, Offset: pc, Err: err}
+		}
+		var err error
+		switch {
+		case op == ops.Block || op == ops.Loop || op == ops.If:
+			_, err = leb128.ReadVarint32(r)
+		case op == ops.Br || op == ops.BrIf || (op >= ops.GetLocal && op <= ops.SetGlobal):
+			_, err = uleb()
+		case op == ops.BrTable:
+			var n uint32
+			n, err = uleb()
+			for i := uint64(0); i <= uint64(n) && err == nil; i++ {
+				_, err = uleb()
+			}
+		case op == ops.Call:
+			start := pos()
+			var index uint32
+			if index, err = uleb(); err == nil {
+				cs = append(cs, call{start: start, end: pos(), index: index})
+			}
+		case op == ops.CallIndirect:
+			if _, err = uleb(); err == nil {
+				err = skip(1)
+			}
+		case op >= ops.I32Load && op <= ops.I64Store32:
+			if _, err = uleb(); err == nil {
+				_, err = uleb()
+			}
+		case op == ops.CurrentMemory || op == ops.GrowMemory:
+			err = skip(1)
+		case op == ops.I32Const:
+			_, err = leb128.ReadVarint32(r)
+		case op == ops.I64Const:
+			_, err = leb128.ReadVarint64(r)
+		case op == ops.F32Const:
+			err = skip(4)
+		case op == ops.F64Const:
+			err = skip(8)
+		}
+		if err != nil {
+			return nil, CodeError{Func: i, Offset: pc, Err: err}
+		}
+	}
+	return cs, nil
+}
+
+// renumberCalls returns code with the function index of each call cs
+// replaced by remap of it.
+func renumberCalls(code []byte, cs []call, remap []uint32) []byte {
+	if len(cs) == 0 {
+		return code
+	}
+	out := make([]byte, 0, len(code))
+	last := 0
+	for _, c := range cs {
+		out = append(out, code[last:c.start]...)
+		out = leb128.AppendUleb128(out, uint64(remap[c.index]))
+		last = c.end
+	}
+	return append(out, code[last:]...)
+}
@@ -0,0 +1,309 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package transform rewrites WebAssembly modules to reduce their size, such
+// as contract binaries stored on chain: it removes the functions not
+// reachable from the exports, the start function and the element segments,
+// renumbering the remaining ones throughout the module, and removes custom
+// sections such as debug information and producers metadata.
+//
+// Modules must be decoded by wasm.DecodeModule and written back with
+// wasm.EncodeModule: the index spaces built by wasm.ReadModule are not
+// updated.
+package transform
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/leb128"
+)
+
+// ErrFunctionCount is returned when the function and code sections of a
+// module declare a different number of functions.
+var ErrFunctionCount = errors.New("transform: function and code sections have different lengths")
+
+// Options selects what Strip removes from a module.
+type Options struct {
+	KeepFunctions bool     // whether to keep the unreachable functions
+	KeepSections  []string // names of the custom sections to keep
+}
+
+// Stats counts what Strip removed from a module.
+type Stats struct {
+	Functions int // functions removed, imported or defined
+	Sections  int // custom sections removed
+}
+
+// Strip removes the custom sections of m, except the ones named in
+// opts.KeepSections, and the unreachable functions of m unless
+// opts.KeepFunctions is set.
+func Strip(m *wasm.Module, opts Options) (Stats, error) {
+	var stats Stats
+	stats.Sections = StripCustom(m, opts.KeepSections...)
+	if !opts.KeepFunctions {
+		n, err := RemoveUnreachable(m)
+		if err != nil {
+			return stats, err
+		}
+		stats.Functions = n
+	}
+	return stats, nil
+}
+
+// StripCustom removes the custom sections of m, except the ones named in
+// keep. It returns the number of removed sections.
+func StripCustom(m *wasm.Module, keep ...string) int {
+	kept := m.Other[:0]
+	for _, s := range m.Other {
+		if s.ID == wasm.SectionIDCustom && !contains(keep, customName(s)) {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	n := len(m.Other) - len(kept)
+	if len(kept) == 0 {
+		kept = nil
+	}
+	m.Other = kept
+	return n
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// customName returns the name of the custom section s.
+func customName(s wasm.RawSection) string {
+	r := bytes.NewReader(s.Bytes)
+	n, err := leb128.ReadVarUint32(r)
+	if err != nil || uint64(n) > uint64(r.Len()) {
+		return ""
+	}
+	start := len(s.Bytes) - r.Len()
+	return string(s.Bytes[start : start+int(n)])
+}
+
+// functions returns the number of imported and defined functions of m.
+func functions(m *wasm.Module) (imported, defined int, err error) {
+	if m.Import != nil {
+		for _, e := range m.Import.Entries {
+			if _, ok := e.Type.(wasm.FuncImport); ok {
+				imported++
+			}
+		}
+	}
+	var bodies int
+	if m.Function != nil {
+		defined = len(m.Function.Types)
+	}
+	if m.Code != nil {
+		bodies = len(m.Code.Bodies)
+	}
+	if defined != bodies {
+		return 0, 0, ErrFunctionCount
+	}
+	return imported, defined, nil
+}
+
+// Reachable reports whether each function of the function index space of
+// m, imported functions first, is reachable through call instructions from
+// the exported functions, the start function or the element segments of m.
+func Reachable(m *wasm.Module) ([]bool, error) {
+	reachable, _, err := reachability(m)
+	return reachable, err
+}
+
+// reachability returns the reachable functions of m, and the calls of the
+// reachable function bodies.
+func reachability(m *wasm.Module) ([]bool, [][]call, error) {
+	imported, defined, err := functions(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	n := imported + defined
+	reachable := make([]bool, n)
+	bodyCalls := make([][]call, defined)
+
+	var queue []uint32
+	mark := func(index uint32) error {
+		if int(index) >= n {
+			return wasm.InvalidFunctionIndexError(index)
+		}
+		if !reachable[index] {
+			reachable[index] = true
+			queue = append(queue, index)
+		}
+		return nil
+	}
+	var roots []uint32
+	if m.Export != nil {
+		for _, e := range m.Export.Entries {
+			if e.Kind == wasm.ExternalFunction {
+				roots = append(roots, e.Index)
+			}
+		}
+	}
+	if m.Start != nil {
+		roots = append(roots, m.Start.Index)
+	}
+	if m.Elements != nil {
+		for _, e := range m.Elements.Entries {
+			roots = append(roots, e.Elems...)
+		}
+	}
+	for _, index := range roots {
+		if err := mark(index); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for len(queue) > 0 {
+		index := int(queue[0])
+		queue = queue[1:]
+		if index < imported {
+			continue
+		}
+		body := index - imported
+		cs, err := calls(body, m.Code.Bodies[body].Code)
+		if err != nil {
+			return nil, nil, err
+		}
+		bodyCalls[body] = cs
+		for _, c := range cs {
+			if err := mark(c.index); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return reachable, bodyCalls, nil
+}
+
+// RemoveUnreachable removes the imported and defined functions of m which
+// are not reachable, as reported by Reachable, and renumbers the remaining
+// ones in the code, the exports, the start function, the element segments
+// and the name section of m. It returns the number of removed functions.
+func RemoveUnreachable(m *wasm.Module) (int, error) {
+	reachable, bodyCalls, err := reachability(m)
+	if err != nil {
+		return 0, err
+	}
+	remap := make([]uint32, len(reachable))
+	next := uint32(0)
+	for i, ok := range reachable {
+		if ok {
+			remap[i] = next
+			next++
+		}
+	}
+	removed := len(reachable) - int(next)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	// the name section is decoded before the functions are renumbered.
+	names, err := m.Names()
+	if err != nil {
+		return 0, err
+	}
+
+	index := 0
+	if m.Import != nil {
+		entries := m.Import.Entries[:0]
+		for _, e := range m.Import.Entries {
+			if _, ok := e.Type.(wasm.FuncImport); ok {
+				index++
+				if !reachable[index-1] {
+					continue
+				}
+			}
+			entries = append(entries, e)
+		}
+		m.Import.Entries = entries
+		if len(entries) == 0 {
+			m.Import = nil
+		}
+	}
+	if m.Function != nil {
+		types := m.Function.Types[:0]
+		bodies := m.Code.Bodies[:0]
+		for i, typ := range m.Function.Types {
+			if !reachable[index+i] {
+				continue
+			}
+			body := m.Code.Bodies[i]
+			body.Code = renumberCalls(body.Code, bodyCalls[i], remap)
+			types = append(types, typ)
+			bodies = append(bodies, body)
+		}
+		m.Function.Types = types
+		m.Code.Bodies = bodies
+		if len(types) == 0 {
+			m.Function = nil
+			m.Code = nil
+		}
+	}
+
+	if m.Export != nil {
+		for name, e := range m.Export.Entries {
+			if e.Kind == wasm.ExternalFunction {
+				e.Index = remap[e.Index]
+				m.Export.Entries[name] = e
+			}
+		}
+	}
+	if m.Start != nil {
+		m.Start.Index = remap[m.Start.Index]
+	}
+	if m.Elements != nil {
+		for _, e := range m.Elements.Entries {
+			for i, elem := range e.Elems {
+				e.Elems[i] = remap[elem]
+			}
+		}
+	}
+	if names != nil {
+		if err := renumberNames(m, names, reachable, remap); err != nil {
+			return 0, err
+		}
+	}
+	return removed, nil
+}
+
+// renumberNames replaces the name section of m by names, keeping the names of
+// the reachable functions under their new index.
+func renumberNames(m *wasm.Module, names *wasm.NameSection, reachable []bool, remap []uint32) error {
+	out := &wasm.NameSection{
+		Module:    names.Module,
+		Functions: make(wasm.NameMap),
+		Locals:    make(map[uint32]wasm.NameMap),
+	}
+	for index, name := range names.Functions {
+		if int(index) < len(reachable) && reachable[index] {
+			out.Functions[remap[index]] = name
+		}
+	}
+	for index, locals := range names.Locals {
+		if int(index) < len(reachable) && reachable[index] {
+			out.Locals[remap[index]] = locals
+		}
+	}
+	sec, err := out.Section()
+	if err != nil {
+		return err
+	}
+	for i, s := range m.Other {
+		if s.ID == wasm.SectionIDCustom && customName(s) == wasm.CustomSectionName {
+			m.Other[i] = sec
+			break
+		}
+	}
+	return nil
+}
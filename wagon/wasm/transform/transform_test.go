@@ -0,0 +1,133 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package transform_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/disasm"
+	"github.com/sea-project/sea-pkg/wagon/exec"
+	"github.com/sea-project/sea-pkg/wagon/validate"
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+	"github.com/sea-project/sea-pkg/wagon/wasm/builder"
+	ops "github.com/sea-project/sea-pkg/wagon/wasm/operators"
+	"github.com/sea-project/sea-pkg/wagon/wasm/transform"
+)
+
+var retI32 = wasm.FunctionSig{Form: 0, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}
+
+// envModule resolves the imports of the tested module.
+func envModule(name string) (*wasm.Module, error) {
+	b := builder.New().
+		AddFunction("one", retI32, nil, []disasm.Instr{builder.Instr(ops.I32Const, int32(1))}).
+		AddFunction("unused", retI32, nil, []disasm.Instr{builder.Instr(ops.I32Const, int32(0))})
+	b.Export("one", wasm.ExternalFunction, b.Function("one")).
+		Export("unused", wasm.ExternalFunction, b.Function("unused"))
+	return b.Build()
+}
+
+// testModule returns a module whose functions "dead" and "env.unused" are
+// unreachable, with a name section and a producers section.
+func testModule(t *testing.T) *wasm.Module {
+	b := builder.New().
+		AddImport("env", "unused", retI32).
+		AddImport("env", "one", retI32)
+	b.AddFunction("dead", retI32, nil, []disasm.Instr{
+		builder.Instr(ops.Call, b.Function("env.unused")),
+	}).
+		AddFunction("helper", retI32, nil, []disasm.Instr{
+			builder.Instr(ops.Call, b.Function("env.one")),
+			builder.Instr(ops.I32Const, int32(40)),
+			builder.Instr(ops.I32Add),
+		}).
+		AddFunction("tabled", retI32, nil, []disasm.Instr{builder.Instr(ops.I32Const, int32(2))})
+	b.AddFunction("main", retI32, nil, []disasm.Instr{
+		builder.Instr(ops.Call, b.Function("helper")),
+		builder.Instr(ops.I32Const, int32(0)),
+		builder.Instr(ops.CallIndirect, b.Type(retI32), uint32(0)),
+		builder.Instr(ops.I32Add),
+	}).
+		Export("main", wasm.ExternalFunction, b.Function("main"))
+	tabled := b.Function("tabled")
+	raw, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.DecodeModule(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Table = &wasm.SectionTables{Entries: []wasm.Table{{ElementType: wasm.ElemTypeAnyFunc, Limits: wasm.ResizableLimits{Initial: 1}}}}
+	m.Elements = &wasm.SectionElements{Entries: []wasm.ElementSegment{{
+		Offset: []byte{ops.I32Const, 0, ops.End},
+		Elems:  []uint32{tabled},
+	}}}
+	m.Other = append(m.Other, wasm.RawSection{ID: wasm.SectionIDCustom, Bytes: append([]byte{9}, "producers\x00"...)})
+	return m
+}
+
+func TestStrip(t *testing.T) {
+	m := testModule(t)
+	reachable, err := transform.Reachable(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []bool{false, true, false, true, true, true}; !reflect.DeepEqual(reachable, want) {
+		t.Errorf("Reachable = %v, want %v", reachable, want)
+	}
+
+	stats, err := transform.Strip(m, transform.Options{KeepSections: []string{wasm.CustomSectionName}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (transform.Stats{Functions: 2, Sections: 1}) {
+		t.Errorf("got stats %+v", stats)
+	}
+
+	buf := new(bytes.Buffer)
+	if err = wasm.EncodeModule(buf, m); err != nil {
+		t.Fatal(err)
+	}
+	stripped, err := wasm.ReadModule(buf, envModule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = validate.VerifyModule(stripped); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stripped.FunctionNames(), []string{"env.one", "helper", "tabled", "main"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("function names %q, want %q", got, want)
+	}
+	if got := stripped.Elements.Entries[0].Elems; !reflect.DeepEqual(got, []uint32{2}) {
+		t.Errorf("element segment holds %v, want [2]", got)
+	}
+	if stripped.CustomSection("producers") != nil {
+		t.Error("producers section not removed")
+	}
+
+	vm, err := exec.NewVM(stripped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := vm.ExecCode(int64(stripped.Export.Entries["main"].Index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != uint32(43) {
+		t.Errorf("main returned %v, want 43", res)
+	}
+}
+
+func TestStripCodeError(t *testing.T) {
+	m := testModule(t)
+	main := m.Export.Entries["main"].Index - 2
+	m.Code.Bodies[main].Code = []byte{ops.I32Const}
+	_, err := transform.RemoveUnreachable(m)
+	if cerr, ok := err.(transform.CodeError); !ok || cerr.Func != int(main) || cerr.Offset != 0 {
+		t.Errorf("got error %v, want a CodeError for function body %d at offset 0", err, main)
+	}
+}
@@ -114,6 +114,25 @@ func (f FunctionSig) String() string {
 	return fmt.Sprintf("<func %v -> %v>", f.ParamTypes, f.ReturnTypes)
 }
 
+// Equal reports whether f and other have the same parameter and return
+// types. The type constructor Form is not compared.
+func (f FunctionSig) Equal(other FunctionSig) bool {
+	if len(f.ParamTypes) != len(other.ParamTypes) || len(f.ReturnTypes) != len(other.ReturnTypes) {
+		return false
+	}
+	for i, t := range f.ParamTypes {
+		if other.ParamTypes[i] != t {
+			return false
+		}
+	}
+	for i, t := range f.ReturnTypes {
+		if other.ReturnTypes[i] != t {
+			return false
+		}
+	}
+	return true
+}
+
 type InvalidTypeConstructorError struct {
 	Wanted int
 	Got    int
@@ -130,7 +149,7 @@ func (f *FunctionSig) UnmarshalWASM(r io.Reader) error {
 	}
 	f.Form = int8(form)
 
-	paramCount, err := leb128.ReadVarUint32(r)
+	paramCount, err := readCount(r, "parameter count", 0)
 	if err != nil {
 		return err
 	}
@@ -143,7 +162,7 @@ func (f *FunctionSig) UnmarshalWASM(r io.Reader) error {
 		}
 	}
 
-	returnCount, err := leb128.ReadVarUint32(r)
+	returnCount, err := readCount(r, "result count", 0)
 	if err != nil {
 		return err
 	}
@@ -240,11 +259,12 @@ func (t *Table) UnmarshalWASM(r io.Reader) error {
 		return err
 	}
 
+	off := readerOffset(r)
 	err = t.Limits.UnmarshalWASM(r)
 	if err != nil {
 		return err
 	}
-	return err
+	return checkLimit(r, off, "table size", uint64(t.Limits.Initial), decodeOptions(r).MaxTableSize)
 }
 
 func (t *Table) MarshalWASM(w io.Writer) error {
@@ -262,7 +282,11 @@ type Memory struct {
 }
 
 func (m *Memory) UnmarshalWASM(r io.Reader) error {
-	return m.Limits.UnmarshalWASM(r)
+	off := readerOffset(r)
+	if err := m.Limits.UnmarshalWASM(r); err != nil {
+		return err
+	}
+	return checkLimit(r, off, "memory pages", uint64(m.Limits.Initial), decodeOptions(r).MaxMemoryPages)
 }
 
 func (m *Memory) MarshalWASM(w io.Writer) error {
@@ -313,6 +337,24 @@ type ResizableLimits struct {
 	Maximum uint32 // If flags is 1, it describes the maximum size of the table or memory
 }
 
+// HasMaximum reports whether the Maximum field is valid.
+func (lim ResizableLimits) HasMaximum() bool {
+	return lim.Flags&0x1 != 0
+}
+
+// Matches reports whether a table or memory with limits lim can be
+// imported by a declaration with the limits imported, as defined in:
+// https://webassembly.github.io/spec/core/valid/types.html#limits
+func (lim ResizableLimits) Matches(imported ResizableLimits) bool {
+	if lim.Initial < imported.Initial {
+		return false
+	}
+	if imported.HasMaximum() {
+		return lim.HasMaximum() && lim.Maximum <= imported.Maximum
+	}
+	return true
+}
+
 func (lim *ResizableLimits) UnmarshalWASM(r io.Reader) error {
 	*lim = ResizableLimits{}
 	f, err := leb128.ReadVarUint32(r)
@@ -0,0 +1,30 @@
+// Copyright 2018 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wasm_test
+
+import (
+	"testing"
+
+	"github.com/sea-project/sea-pkg/wagon/wasm"
+)
+
+func TestFunctionSigEqual(t *testing.T) {
+	i32, i64 := wasm.ValueTypeI32, wasm.ValueTypeI64
+	sig := wasm.FunctionSig{Form: -0x20, ParamTypes: []wasm.ValueType{i32, i64}, ReturnTypes: []wasm.ValueType{i32}}
+	for _, tc := range []struct {
+		other wasm.FunctionSig
+		want  bool
+	}{
+		{wasm.FunctionSig{Form: -0x20, ParamTypes: []wasm.ValueType{i32, i64}, ReturnTypes: []wasm.ValueType{i32}}, true},
+		{wasm.FunctionSig{ParamTypes: []wasm.ValueType{i32, i64}, ReturnTypes: []wasm.ValueType{i32}}, true},
+		{wasm.FunctionSig{ParamTypes: []wasm.ValueType{i64, i32}, ReturnTypes: []wasm.ValueType{i32}}, false},
+		{wasm.FunctionSig{ParamTypes: []wasm.ValueType{i32, i64}}, false},
+		{wasm.FunctionSig{ParamTypes: []wasm.ValueType{i32}, ReturnTypes: []wasm.ValueType{i32}}, false},
+	} {
+		if got := sig.Equal(tc.other); got != tc.want {
+			t.Errorf("%v.Equal(%v) = %v, want %v", sig, tc.other, got, tc.want)
+		}
+	}
+}